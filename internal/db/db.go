@@ -4,6 +4,7 @@ import (
 	"gorm.io/gorm"
 	"k8s.io/klog"
 	
+	"github.com/Theodoree/music_player/internal/decode/eq"
 	"github.com/Theodoree/music_player/internal/model"
 )
 
@@ -11,6 +12,8 @@ type tableOperator interface {
 	GetMusicTable(page uint, limit uint) ([]model.MusicTable, error)
 	GetMusicTableByID(id uint) (model.MusicTable, error)
 	SaveMusicTable(tag model.MusicTable) error
+	// UpdateMusicTable 更新表格的名称和文字编码
+	UpdateMusicTable(item model.MusicTable) error
 	DeleteMusicTable(item model.MusicTable) error
 }
 type musicOperator interface {
@@ -19,11 +22,28 @@ type musicOperator interface {
 	SaveMusics(item []model.Music) error
 	SaveMusic(item model.Music) error
 	UpdateMusic(item model.Music) error
+	// UpdateReplayGain 只更新音乐的响度增益
+	UpdateReplayGain(item model.Music) error
+	// UpdateTrim 只更新音乐的裁剪范围
+	UpdateTrim(item model.Music) error
+	// UpdateTags 只更新音乐标签中的文字
+	UpdateTags(item model.Music) error
+	// UpdateFailure 只更新音乐播放失败的次数和错误
+	UpdateFailure(item model.Music) error
+}
+
+type eqPresetOperator interface {
+	GetEQPresets() ([]model.EQPreset, error)
+	// SaveEQPreset 按名称保存, 同名时覆盖
+	SaveEQPreset(item model.EQPreset) error
+	// DeleteEQPreset 内置预设不会被删除
+	DeleteEQPreset(item model.EQPreset) error
 }
 
 type MusicStore interface {
 	tableOperator
 	musicOperator
+	eqPresetOperator
 }
 
 const DefaultTableID = 1
@@ -50,6 +70,14 @@ func (db *db) Init() {
 		})
 	}
 	
+	// 内置均衡器预设
+	for _, p := range eq.Presets {
+		item := model.EQPreset{Name: p.Name, Preamp: p.Preamp, BuiltIn: true}
+		item.SetGains(p.Gains[:])
+		if err := db.SaveEQPreset(item); err != nil {
+			klog.Error(err)
+		}
+	}
 }
 
 // implementation tableOperator
@@ -63,6 +91,9 @@ func (db *db) GetMusicTableByID(id uint) (model.MusicTable, error) {
 func (db *db) SaveMusicTable(item model.MusicTable) error {
 	return model.MusicTableQuery{}.Add(db.DB, item)
 }
+func (db *db) UpdateMusicTable(item model.MusicTable) error {
+	return model.MusicTableQuery{}.Update(db.DB, db.cache, item)
+}
 func (db *db) DeleteMusicTable(item model.MusicTable) error {
 	if item.ID == DefaultTableID {
 		return nil
@@ -87,3 +118,27 @@ func (db *db) SaveMusic(item model.Music) error {
 func (db *db) UpdateMusic(item model.Music) error {
 	return model.MusicQuery{}.Update(db.DB, item)
 }
+func (db *db) UpdateReplayGain(item model.Music) error {
+	return model.MusicQuery{}.UpdateReplayGain(db.DB, item)
+}
+func (db *db) UpdateTrim(item model.Music) error {
+	return model.MusicQuery{}.UpdateTrim(db.DB, item)
+}
+func (db *db) UpdateTags(item model.Music) error {
+	return model.MusicQuery{}.UpdateTags(db.DB, item)
+}
+func (db *db) UpdateFailure(item model.Music) error {
+	return model.MusicQuery{}.UpdateFailure(db.DB, item)
+}
+
+// implementation eqPresetOperator
+
+func (db *db) GetEQPresets() ([]model.EQPreset, error) {
+	return model.EQPresetQuery{}.GetAll(db.DB)
+}
+func (db *db) SaveEQPreset(item model.EQPreset) error {
+	return model.EQPresetQuery{}.Save(db.DB, item)
+}
+func (db *db) DeleteEQPreset(item model.EQPreset) error {
+	return model.EQPresetQuery{}.Delete(db.DB, item)
+}
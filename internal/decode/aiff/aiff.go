@@ -0,0 +1,278 @@
+// Package aiff implements decoding of AIFF and AIFF-C files into beep.StreamSeekCloser
+// and reading of their text and ID3 chunks.
+package aiff
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	
+	"github.com/Theodoree/music_player/internal/decode/iff"
+	"github.com/faiface/beep"
+)
+
+var (
+	ErrNotAIFF          = errors.New("aiff: missing FORM/AIFF header")
+	ErrNoCommonChunk    = errors.New("aiff: missing COMM chunk")
+	ErrNoSoundChunk     = errors.New("aiff: missing SSND chunk")
+	ErrUnsupportedCodec = errors.New("aiff: unsupported compression type")
+)
+
+// 支持的 AIFF-C 压缩类型, 都是未压缩的 PCM
+const (
+	compressionNone    = "NONE"
+	compressionSowt    = "sowt" // little-endian PCM
+	compressionFloat32 = "fl32"
+	compressionFloat64 = "fl64"
+)
+
+// header 是解析后的 COMM 与 SSND 信息
+type header struct {
+	channels    int
+	frames      int
+	sampleSize  int // bits
+	sampleRate  float64
+	compression string
+	// dataStart SSND 中第一个采样帧在文件中的偏移
+	dataStart int64
+}
+
+func (h header) bytesPerFrame() int {
+	return h.channels * ((h.sampleSize + 7) / 8)
+}
+
+// chunk 是 FORM 中的一个子块
+type chunk struct {
+	id     string
+	offset int64 // 数据起始偏移
+	size   int64
+}
+
+// readChunks 遍历 FORM 中所有子块
+func readChunks(r io.ReadSeeker) (formType string, chunks []chunk, err error) {
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	var form [12]byte
+	if _, err = io.ReadFull(r, form[:]); err != nil {
+		return "", nil, ErrNotAIFF
+	}
+	formType = string(form[8:12])
+	if string(form[0:4]) != "FORM" || (formType != "AIFF" && formType != "AIFC") {
+		return "", nil, ErrNotAIFF
+	}
+	end := int64(binary.BigEndian.Uint32(form[4:8])) + 8
+	offset := int64(12)
+	for offset+8 <= end {
+		var head [8]byte
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		if _, err = io.ReadFull(r, head[:]); err != nil {
+			// 文件被截断时保留已经读到的块
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(head[4:8]))
+		chunks = append(chunks, chunk{id: string(head[0:4]), offset: offset + 8, size: size})
+		// 块大小为奇数时补齐一个字节
+		offset += 8 + size + size&1
+	}
+	return formType, chunks, nil
+}
+
+func readHeader(r io.ReadSeeker) (header, error) {
+	formType, chunks, err := readChunks(r)
+	if err != nil {
+		return header{}, err
+	}
+	var (
+		h                header
+		hasCOMM, hasSSND bool
+	)
+	h.compression = compressionNone
+	for _, c := range chunks {
+		switch c.id {
+		case "COMM":
+			buf, err := iff.ReadChunk(r, c.offset, c.size)
+			if err != nil || len(buf) < 18 {
+				return header{}, ErrNoCommonChunk
+			}
+			h.channels = int(binary.BigEndian.Uint16(buf[0:2]))
+			h.frames = int(binary.BigEndian.Uint32(buf[2:6]))
+			h.sampleSize = int(binary.BigEndian.Uint16(buf[6:8]))
+			h.sampleRate = extendedToFloat(buf[8:18])
+			if formType == "AIFC" && len(buf) >= 22 {
+				h.compression = string(buf[18:22])
+			}
+			hasCOMM = true
+		case "SSND":
+			var buf [8]byte
+			if _, err := r.Seek(c.offset, io.SeekStart); err != nil {
+				return header{}, err
+			}
+			if _, err := io.ReadFull(r, buf[:]); err != nil {
+				return header{}, ErrNoSoundChunk
+			}
+			h.dataStart = c.offset + 8 + int64(binary.BigEndian.Uint32(buf[0:4]))
+			hasSSND = true
+		}
+	}
+	if !hasCOMM {
+		return header{}, ErrNoCommonChunk
+	}
+	if !hasSSND {
+		return header{}, ErrNoSoundChunk
+	}
+	switch h.compression {
+	case compressionNone, compressionSowt:
+		if h.sampleSize < 1 || h.sampleSize > 32 {
+			return header{}, fmt.Errorf("aiff: unsupported sample size %d", h.sampleSize)
+		}
+	case compressionFloat32, "FL32":
+		h.compression, h.sampleSize = compressionFloat32, 32
+	case compressionFloat64, "FL64":
+		h.compression, h.sampleSize = compressionFloat64, 64
+	default:
+		return header{}, ErrUnsupportedCodec
+	}
+	if h.channels < 1 || h.sampleRate <= 0 {
+		return header{}, ErrNoCommonChunk
+	}
+	return h, nil
+}
+
+// extendedToFloat 把 IEEE 754 80位扩展精度浮点数(COMM中的采样率)转成float64
+func extendedToFloat(b []byte) float64 {
+	sign := 1.0
+	if b[0]&0x80 != 0 {
+		sign = -1
+	}
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+// Decode 解码 AIFF/AIFF-C, 返回的 StreamSeekCloser 关闭时会同时关闭 r
+func Decode(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	if _, err := r.Seek(h.dataStart, io.SeekStart); err != nil {
+		return nil, beep.Format{}, err
+	}
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(math.Round(h.sampleRate)),
+		NumChannels: h.channels,
+		Precision:   (h.sampleSize + 7) / 8,
+	}
+	return &decoder{r: r, h: h}, format, nil
+}
+
+// Duration 返回音频的采样率和总帧数, 不解码音频数据
+func Duration(r io.ReadSeeker) (beep.SampleRate, int, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return beep.SampleRate(math.Round(h.sampleRate)), h.frames, nil
+}
+
+type decoder struct {
+	r   io.ReadSeekCloser
+	h   header
+	pos int
+	buf []byte
+	err error
+}
+
+func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.err != nil || d.pos >= d.h.frames {
+		return 0, false
+	}
+	frames := len(samples)
+	if frames > d.h.frames-d.pos {
+		frames = d.h.frames - d.pos
+	}
+	bpf := d.h.bytesPerFrame()
+	if cap(d.buf) < frames*bpf {
+		d.buf = make([]byte, frames*bpf)
+	}
+	buf := d.buf[:frames*bpf]
+	read, err := io.ReadFull(d.r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		d.err = err
+	}
+	bps := bpf / d.h.channels
+	for n = 0; (n+1)*bpf <= read; n++ {
+		frame := buf[n*bpf : (n+1)*bpf]
+		left := d.sample(frame[0:bps])
+		right := left
+		if d.h.channels >= 2 {
+			right = d.sample(frame[bps : 2*bps])
+		}
+		samples[n] = [2]float64{left, right}
+	}
+	d.pos += n
+	if n == 0 {
+		// 数据比 COMM 声明的短
+		d.h.frames = d.pos
+		return 0, false
+	}
+	return n, true
+}
+
+// sample 把一个声道的采样转换为[-1,1]
+func (d *decoder) sample(b []byte) float64 {
+	switch d.h.compression {
+	case compressionFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case compressionFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	var v uint32
+	if d.h.compression == compressionSowt {
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint32(b[i])
+		}
+	} else {
+		for i := 0; i < len(b); i++ {
+			v = v<<8 | uint32(b[i])
+		}
+	}
+	// 左对齐到32位后按有符号数解释
+	shift := 32 - 8*len(b)
+	return float64(int32(v<<shift)) / (1 << 31)
+}
+
+func (d *decoder) Err() error {
+	return d.err
+}
+
+func (d *decoder) Len() int {
+	return d.h.frames
+}
+
+func (d *decoder) Position() int {
+	return d.pos
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || p > d.h.frames {
+		return fmt.Errorf("aiff: seek position %v out of range [%v, %v]", p, 0, d.h.frames)
+	}
+	if _, err := d.r.Seek(d.h.dataStart+int64(p*d.h.bytesPerFrame()), io.SeekStart); err != nil {
+		return fmt.Errorf("aiff: seek error: %w", err)
+	}
+	d.pos = p
+	return nil
+}
+
+func (d *decoder) Close() error {
+	return d.r.Close()
+}
@@ -0,0 +1,114 @@
+package aiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// buildAIFF 生成一个 16bit 双声道 44.1kHz 的 AIFF 文件
+func buildAIFF(frames [][2]int16, name string) []byte {
+	var body bytes.Buffer
+	writeChunk := func(id string, data []byte) {
+		body.WriteString(id)
+		_ = binary.Write(&body, binary.BigEndian, uint32(len(data)))
+		body.Write(data)
+		if len(data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	
+	var comm bytes.Buffer
+	_ = binary.Write(&comm, binary.BigEndian, uint16(2))
+	_ = binary.Write(&comm, binary.BigEndian, uint32(len(frames)))
+	_ = binary.Write(&comm, binary.BigEndian, uint16(16))
+	// 44100 的80位扩展精度表示
+	comm.Write([]byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0})
+	writeChunk("COMM", comm.Bytes())
+	writeChunk("NAME", []byte(name))
+	
+	var ssnd bytes.Buffer
+	_ = binary.Write(&ssnd, binary.BigEndian, uint32(0))
+	_ = binary.Write(&ssnd, binary.BigEndian, uint32(0))
+	for _, f := range frames {
+		_ = binary.Write(&ssnd, binary.BigEndian, f)
+	}
+	writeChunk("SSND", ssnd.Bytes())
+	
+	var file bytes.Buffer
+	file.WriteString("FORM")
+	_ = binary.Write(&file, binary.BigEndian, uint32(body.Len()+4))
+	file.WriteString("AIFF")
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	frames := [][2]int16{{0, 0}, {16384, -16384}, {32767, -32768}, {-1, 1}}
+	buf := buildAIFF(frames, "song")
+	
+	s, format, err := Decode(nopCloser{bytes.NewReader(buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != 44100 || format.NumChannels != 2 || format.Precision != 2 {
+		t.Fatalf("unexpected format %+v", format)
+	}
+	if s.Len() != len(frames) {
+		t.Fatalf("Len() = %d, want %d", s.Len(), len(frames))
+	}
+	
+	samples := make([][2]float64, 8)
+	n, ok := s.Stream(samples)
+	if !ok || n != len(frames) {
+		t.Fatalf("Stream() = %d, %v", n, ok)
+	}
+	for i, f := range frames {
+		for c := 0; c < 2; c++ {
+			want := float64(f[c]) / (1 << 15)
+			if math.Abs(samples[i][c]-want) > 1e-9 {
+				t.Fatalf("sample %d/%d = %v, want %v", i, c, samples[i][c], want)
+			}
+		}
+	}
+	if _, ok := s.Stream(samples); ok {
+		t.Fatal("Stream() after end should return false")
+	}
+	
+	if err := s.Seek(2); err != nil {
+		t.Fatal(err)
+	}
+	n, _ = s.Stream(samples[:1])
+	if n != 1 || s.Position() != 3 || samples[0][0] != float64(32767)/(1<<15) {
+		t.Fatalf("unexpected sample after seek: %v", samples[0])
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	buf := buildAIFF([][2]int16{{0, 0}}, "title")
+	m, err := ReadMetadata(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "title" {
+		t.Fatalf("Title = %q", m.Title)
+	}
+	sampleRate, frames, err := Duration(bytes.NewReader(buf))
+	if err != nil || sampleRate != 44100 || frames != 1 {
+		t.Fatalf("Duration() = %v, %v, %v", sampleRate, frames, err)
+	}
+}
+
+func TestNotAIFF(t *testing.T) {
+	if _, _, err := Decode(nopCloser{bytes.NewReader([]byte("RIFF\x00\x00\x00\x00WAVE"))}); err != ErrNotAIFF {
+		t.Fatalf("err = %v, want ErrNotAIFF", err)
+	}
+}
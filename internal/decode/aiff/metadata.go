@@ -0,0 +1,59 @@
+package aiff
+
+import (
+	"io"
+	"math"
+	"strings"
+	
+	"github.com/Theodoree/music_player/internal/decode/iff"
+)
+
+// Metadata AIFF 中的文本块(NAME/AUTH)与 ID3 块
+type Metadata struct {
+	// ID3 ID3 块中的标签, 标题、艺术家和专辑的值优先于文本块
+	iff.ID3
+	
+	// 音频参数, BitDepth 为每个采样的位数, Frames 为总帧数; COMM 块无法识别时均为 0
+	Channels   int
+	BitDepth   int
+	SampleRate int
+	Frames     int
+}
+
+// ReadMetadata 读取 AIFF 的元数据和音频参数, ID3 块中的值优先于文本块
+func ReadMetadata(r io.ReadSeeker) (Metadata, error) {
+	_, chunks, err := readChunks(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	var m Metadata
+	for _, c := range chunks {
+		if c.id != "NAME" && c.id != "AUTH" {
+			continue
+		}
+		buf, err := iff.ReadChunk(r, c.offset, c.size)
+		if err != nil {
+			continue
+		}
+		text := strings.TrimRight(string(buf), "\x00 ")
+		if text == "" {
+			continue
+		}
+		if c.id == "NAME" {
+			m.Title = text
+		} else {
+			m.Artist = text
+		}
+	}
+	for _, c := range chunks {
+		if c.id != "ID3 " && c.id != "id3 " {
+			continue
+		}
+		m.Merge(r, c.offset, c.size)
+	}
+	if h, err := readHeader(r); err == nil {
+		m.Channels, m.BitDepth, m.Frames = h.channels, h.sampleSize, h.frames
+		m.SampleRate = int(math.Round(h.sampleRate))
+	}
+	return m, nil
+}
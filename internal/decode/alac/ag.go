@@ -0,0 +1,147 @@
+package alac
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// 自适应 Golomb 解码, 参照 Apple ALAC 参考实现 ag_dec.c
+const (
+	qbShift        = 9
+	qb             = 1 << qbShift
+	mmulShift      = 2
+	mdenShift      = qbShift - mmulShift - 1
+	mOff           = 1 << (mdenShift - 2)
+	bitOff         = 24
+	maxMeanClamp   = 0xffff
+	meanClampValue = 0xffff
+	maxPrefix16    = 9
+	maxPrefix32    = 9
+	maxDataBits16  = 16
+)
+
+var errParam = errors.New("alac: invalid bitstream")
+
+// agParams 自适应 Golomb 参数
+type agParams struct {
+	mb, pb, kb, wb uint32
+	maxRun         uint32
+}
+
+func newAGParams(mb, pb, kb, maxRun uint32) agParams {
+	return agParams{mb: mb, pb: pb, kb: kb, wb: 1<<kb - 1, maxRun: maxRun}
+}
+
+func lead(m uint32) uint32 {
+	return uint32(bits.LeadingZeros32(m))
+}
+
+func lg3a(x uint32) uint32 {
+	return 31 - lead(x+3)
+}
+
+// dynGet 解码零值游程长度
+func dynGet(b *bitReader, pos *uint32, m, k uint32) uint32 {
+	tempBits := *pos
+	stream := b.peek32(tempBits)
+	pre := lead(^stream)
+	var result uint32
+	if pre >= maxPrefix16 {
+		pre = maxPrefix16
+		tempBits += pre
+		result = b.bits(tempBits, maxDataBits16)
+		tempBits += maxDataBits16
+	} else {
+		tempBits += pre + 1
+		v := b.bits(tempBits, k)
+		tempBits += k
+		result = pre*m + v - 1
+		if v < 2 {
+			result -= v - 1
+			tempBits--
+		}
+	}
+	*pos = tempBits
+	return result
+}
+
+// dynGet32 解码一个残差
+func dynGet32(b *bitReader, pos *uint32, m, k, maxBits uint32) uint32 {
+	tempBits := *pos
+	stream := b.peek32(tempBits)
+	result := lead(^stream)
+	if result >= maxPrefix32 {
+		result = b.bits(tempBits+maxPrefix32, maxBits)
+		tempBits += maxPrefix32 + maxBits
+	} else {
+		tempBits += result + 1
+		if k != 1 {
+			v := b.bits(tempBits, k)
+			tempBits += k - 1
+			result *= m
+			if v >= 2 {
+				result += v - 1
+				tempBits++
+			}
+		}
+	}
+	*pos = tempBits
+	return result
+}
+
+// dynDecomp 解码 numSamples 个残差到 pc
+func dynDecomp(p agParams, b *bitReader, pc []int32, numSamples int, maxSize uint32) error {
+	pos := b.pos
+	maxPos := uint32(len(b.buf) * 8)
+	mb := p.mb
+	var zmode uint32
+	c := 0
+	for c < numSamples {
+		if pos >= maxPos {
+			return errParam
+		}
+		m := mb >> qbShift
+		k := lg3a(m)
+		if k > p.kb {
+			k = p.kb
+		}
+		m = 1<<k - 1
+		
+		n := dynGet32(b, &pos, m, k, maxSize)
+		
+		// 最低位是符号位
+		nd := n + zmode
+		del := int32((nd + 1) >> 1)
+		if nd&1 != 0 {
+			del = -del
+		}
+		pc[c] = del
+		c++
+		
+		mb = p.pb*(n+zmode) + mb - ((p.pb * mb) >> qbShift)
+		if n > maxMeanClamp {
+			mb = meanClampValue
+		}
+		zmode = 0
+		
+		if (mb<<mmulShift) < qb && c < numSamples {
+			zmode = 1
+			k := lead(mb) - bitOff + ((mb + mOff) >> mdenShift)
+			mz := (uint32(1)<<k - 1) & p.wb
+			n := dynGet(b, &pos, mz, k)
+			if c+int(n) > numSamples {
+				return errParam
+			}
+			for j := uint32(0); j < n; j++ {
+				pc[c] = 0
+				c++
+			}
+			if n >= 65535 {
+				zmode = 0
+			}
+			mb = 0
+		}
+	}
+	b.pos = pos
+	return nil
+}
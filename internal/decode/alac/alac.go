@@ -0,0 +1,342 @@
+// Package alac implements an Apple Lossless decoder for MP4/M4A files.
+//
+// The codec follows Apple's open source reference decoder (ALACDecoder.cpp, ag_dec.c,
+// dp_dec.c, matrix_dec.c); the container is demuxed by mp4.go.
+package alac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedCodec = errors.New("alac: unsupported codec")
+
+// 码流中的元素类型
+const (
+	idSCE = 0 // single channel element
+	idCPE = 1 // channel pair element
+	idCCE = 2 // coupling channel element
+	idLFE = 3 // LFE channel element
+	idDSE = 4 // data stream element
+	idPCE = 5 // program config element
+	idFIL = 6 // fill element
+	idEND = 7 // frame end
+)
+
+// Config 即 ALACSpecificConfig, 位于 stsd 的 alac 子块
+type Config struct {
+	FrameLength       uint32
+	CompatibleVersion uint8
+	BitDepth          uint8
+	PB                uint8
+	MB                uint8
+	KB                uint8
+	NumChannels       uint8
+	MaxRun            uint16
+	MaxFrameBytes     uint32
+	AvgBitRate        uint32
+	SampleRate        uint32
+}
+
+// parseConfig 解析24字节的 ALACSpecificConfig
+func parseConfig(b []byte) (Config, error) {
+	if len(b) < 24 {
+		return Config{}, fmt.Errorf("alac: config too short (%d bytes)", len(b))
+	}
+	c := Config{
+		FrameLength:       binary.BigEndian.Uint32(b[0:4]),
+		CompatibleVersion: b[4],
+		BitDepth:          b[5],
+		PB:                b[6],
+		MB:                b[7],
+		KB:                b[8],
+		NumChannels:       b[9],
+		MaxRun:            binary.BigEndian.Uint16(b[10:12]),
+		MaxFrameBytes:     binary.BigEndian.Uint32(b[12:16]),
+		AvgBitRate:        binary.BigEndian.Uint32(b[16:20]),
+		SampleRate:        binary.BigEndian.Uint32(b[20:24]),
+	}
+	if c.CompatibleVersion != 0 || c.FrameLength == 0 || c.NumChannels == 0 {
+		return Config{}, ErrUnsupportedCodec
+	}
+	switch c.BitDepth {
+	case 16, 20, 24, 32:
+	default:
+		return Config{}, fmt.Errorf("alac: unsupported bit depth %d", c.BitDepth)
+	}
+	return c, nil
+}
+
+// codec 解码单个 ALAC 数据包
+type codec struct {
+	cfg       Config
+	predictor []int32
+	mixU      []int32
+	mixV      []int32
+	shift     []uint32
+	// channels 每个声道解码后的整数采样
+	channels [][]int32
+}
+
+func newCodec(cfg Config) *codec {
+	n := int(cfg.FrameLength)
+	c := &codec{
+		cfg:       cfg,
+		predictor: make([]int32, n),
+		mixU:      make([]int32, n),
+		mixV:      make([]int32, n),
+		shift:     make([]uint32, n*2),
+		channels:  make([][]int32, cfg.NumChannels),
+	}
+	for i := range c.channels {
+		c.channels[i] = make([]int32, n)
+	}
+	return c
+}
+
+// decode 解码一个数据包, 返回采样帧数, 采样保存在 c.channels 中
+func (c *codec) decode(packet []byte) (int, error) {
+	b := &bitReader{buf: packet}
+	channelIndex := 0
+	numSamples := int(c.cfg.FrameLength)
+	for {
+		if b.overrun() {
+			return 0, errParam
+		}
+		tag := b.read(3)
+		switch tag {
+		case idSCE, idLFE:
+			n, err := c.decodeSCE(b, channelIndex)
+			if err != nil {
+				return 0, err
+			}
+			numSamples = n
+			channelIndex++
+		case idCPE:
+			n, err := c.decodeCPE(b, channelIndex)
+			if err != nil {
+				return 0, err
+			}
+			numSamples = n
+			channelIndex += 2
+		case idCCE, idPCE:
+			return 0, ErrUnsupportedCodec
+		case idDSE:
+			// 数据流元素, 跳过
+			b.advance(4)
+			align := b.readOne()
+			count := b.read(8)
+			if count == 255 {
+				count += b.read(8)
+			}
+			if align != 0 {
+				b.byteAlign()
+			}
+			b.advance(count * 8)
+		case idFIL:
+			// 填充元素, 跳过
+			count := b.read(4)
+			if count == 15 {
+				count += b.read(8) - 1
+			}
+			b.advance(count * 8)
+		case idEND:
+			return numSamples, nil
+		}
+		if channelIndex >= int(c.cfg.NumChannels) {
+			return numSamples, nil
+		}
+	}
+}
+
+// elementHeader 是 SCE/CPE 的公共头
+type elementHeader struct {
+	numSamples   int
+	bytesShifted uint32
+	escape       bool
+}
+
+func (c *codec) readElementHeader(b *bitReader) (elementHeader, error) {
+	b.advance(4) // element instance tag
+	if b.read(12) != 0 {
+		return elementHeader{}, errParam
+	}
+	h := elementHeader{numSamples: int(c.cfg.FrameLength)}
+	headerByte := b.read(4)
+	partialFrame := headerByte >> 3
+	h.bytesShifted = (headerByte >> 1) & 3
+	h.escape = headerByte&1 != 0
+	if h.bytesShifted == 3 {
+		return elementHeader{}, errParam
+	}
+	if partialFrame != 0 {
+		h.numSamples = int(b.read(16)<<16 | b.read(16))
+	}
+	if h.numSamples > int(c.cfg.FrameLength) {
+		return elementHeader{}, errParam
+	}
+	return h, nil
+}
+
+// predictorParams 每个声道的预测参数
+type predictorParams struct {
+	mode     uint32
+	denShift uint32
+	pbFactor uint32
+	coefs    []int16
+}
+
+func readPredictorParams(b *bitReader) predictorParams {
+	var p predictorParams
+	headerByte := b.read(8)
+	p.mode = headerByte >> 4
+	p.denShift = headerByte & 0xf
+	headerByte = b.read(8)
+	p.pbFactor = headerByte >> 5
+	num := headerByte & 0x1f
+	p.coefs = make([]int16, num)
+	for i := range p.coefs {
+		p.coefs[i] = int16(b.read(16))
+	}
+	return p
+}
+
+// decodeChannel 解码一个声道的残差并做预测还原
+func (c *codec) decodeChannel(b *bitReader, p predictorParams, out []int32, numSamples int, chanBits uint32) error {
+	ag := newAGParams(uint32(c.cfg.MB), uint32(c.cfg.PB)*p.pbFactor/4, uint32(c.cfg.KB), uint32(c.cfg.MaxRun))
+	if err := dynDecomp(ag, b, c.predictor, numSamples, chanBits); err != nil {
+		return err
+	}
+	if p.mode != 0 {
+		unpcBlock(c.predictor, c.predictor, numSamples, nil, 31, chanBits, 0)
+	}
+	unpcBlock(c.predictor, out, numSamples, p.coefs, len(p.coefs), chanBits, p.denShift)
+	return nil
+}
+
+// readUncompressed 读取未压缩(escape)的采样
+func readUncompressed(b *bitReader, chanBits uint32) int32 {
+	shift := 32 - chanBits
+	if chanBits <= 16 {
+		return int32(b.read(chanBits)<<shift) >> shift
+	}
+	extraBits := chanBits - 16
+	val := int32(b.read(16)<<16) >> shift
+	return val | int32(b.read(extraBits))
+}
+
+func (c *codec) decodeSCE(b *bitReader, channelIndex int) (int, error) {
+	if channelIndex >= len(c.channels) {
+		return 0, errParam
+	}
+	h, err := c.readElementHeader(b)
+	if err != nil {
+		return 0, err
+	}
+	bitDepth := uint32(c.cfg.BitDepth)
+	chanBits := bitDepth - h.bytesShifted*8
+	numSamples := h.numSamples
+	
+	if !h.escape {
+		b.advance(16) // mixBits, mixRes
+		p := readPredictorParams(b)
+		var shiftReader bitReader
+		if h.bytesShifted != 0 {
+			shiftReader = *b
+			b.advance(h.bytesShifted * 8 * uint32(numSamples))
+		}
+		if err := c.decodeChannel(b, p, c.mixU, numSamples, chanBits); err != nil {
+			return 0, err
+		}
+		if h.bytesShifted != 0 {
+			shift := h.bytesShifted * 8
+			for i := 0; i < numSamples; i++ {
+				c.shift[i] = shiftReader.read(shift)
+			}
+		}
+	} else {
+		for i := 0; i < numSamples; i++ {
+			c.mixU[i] = readUncompressed(b, bitDepth)
+		}
+		h.bytesShifted = 0
+	}
+	
+	out := c.channels[channelIndex]
+	shift := h.bytesShifted * 8
+	for i := 0; i < numSamples; i++ {
+		v := c.mixU[i]
+		if shift != 0 {
+			v = v<<shift | int32(c.shift[i])
+		}
+		out[i] = v
+	}
+	return numSamples, nil
+}
+
+func (c *codec) decodeCPE(b *bitReader, channelIndex int) (int, error) {
+	if channelIndex+1 >= len(c.channels) {
+		return 0, errParam
+	}
+	h, err := c.readElementHeader(b)
+	if err != nil {
+		return 0, err
+	}
+	bitDepth := uint32(c.cfg.BitDepth)
+	// 立体声的差值声道多一位
+	chanBits := bitDepth - h.bytesShifted*8 + 1
+	numSamples := h.numSamples
+	var (
+		mixBits uint32
+		mixRes  int32
+	)
+	
+	if !h.escape {
+		mixBits = b.read(8)
+		mixRes = int32(int8(b.read(8)))
+		pu := readPredictorParams(b)
+		pv := readPredictorParams(b)
+		var shiftReader bitReader
+		if h.bytesShifted != 0 {
+			shiftReader = *b
+			b.advance(h.bytesShifted * 8 * 2 * uint32(numSamples))
+		}
+		if err := c.decodeChannel(b, pu, c.mixU, numSamples, chanBits); err != nil {
+			return 0, err
+		}
+		if err := c.decodeChannel(b, pv, c.mixV, numSamples, chanBits); err != nil {
+			return 0, err
+		}
+		if h.bytesShifted != 0 {
+			shift := h.bytesShifted * 8
+			for i := 0; i < numSamples; i++ {
+				c.shift[i*2] = shiftReader.read(shift)
+				c.shift[i*2+1] = shiftReader.read(shift)
+			}
+		}
+	} else {
+		for i := 0; i < numSamples; i++ {
+			c.mixU[i] = readUncompressed(b, bitDepth)
+			c.mixV[i] = readUncompressed(b, bitDepth)
+		}
+		h.bytesShifted = 0
+	}
+	
+	// 反矩阵化, 参照 matrix_dec.c
+	left, right := c.channels[channelIndex], c.channels[channelIndex+1]
+	shift := h.bytesShifted * 8
+	for i := 0; i < numSamples; i++ {
+		u, v := c.mixU[i], c.mixV[i]
+		l, r := u, v
+		if mixRes != 0 {
+			l = u + v - ((mixRes * v) >> mixBits)
+			r = l - v
+		}
+		if shift != 0 {
+			l = l<<shift | int32(c.shift[i*2])
+			r = r<<shift | int32(c.shift[i*2+1])
+		}
+		left[i], right[i] = l, r
+	}
+	return numSamples, nil
+}
@@ -0,0 +1,213 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+type bitWriter struct {
+	buf  []byte
+	nbit uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.nbit%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.nbit % 8)
+		}
+		w.nbit++
+	}
+}
+
+// escapePacket 生成一个未压缩的16位立体声数据包
+func escapePacket(left, right []int16, frameLength int) []byte {
+	var w bitWriter
+	w.write(idCPE, 3)
+	w.write(0, 4)
+	w.write(0, 12)
+	partial := len(left) != frameLength
+	header := uint32(1)
+	if partial {
+		header |= 1 << 3
+	}
+	w.write(header, 4)
+	if partial {
+		w.write(uint32(len(left)), 32)
+	}
+	for i := range left {
+		w.write(uint32(uint16(left[i])), 16)
+		w.write(uint32(uint16(right[i])), 16)
+	}
+	w.write(idEND, 3)
+	return w.buf
+}
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func u32(vs ...uint32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+// buildM4A 把数据包封装成只有一个音轨的 MP4, 每个数据包一个 chunk
+func buildM4A(codec string, cfg Config, packets [][]byte, lastFrames uint32) []byte {
+	ftyp := mp4Box("ftyp", []byte("M4A "), u32(0))
+	mdat := mp4Box("mdat", packets...)
+	
+	var offsets, sizes []uint32
+	offset := uint32(len(ftyp) + 8)
+	for _, p := range packets {
+		offsets = append(offsets, offset)
+		sizes = append(sizes, uint32(len(p)))
+		offset += uint32(len(p))
+	}
+	
+	conf := make([]byte, 24)
+	binary.BigEndian.PutUint32(conf[0:], cfg.FrameLength)
+	conf[5], conf[6], conf[7], conf[8], conf[9] = cfg.BitDepth, cfg.PB, cfg.MB, cfg.KB, cfg.NumChannels
+	binary.BigEndian.PutUint16(conf[10:], cfg.MaxRun)
+	binary.BigEndian.PutUint32(conf[20:], cfg.SampleRate)
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[16:], uint16(cfg.NumChannels))
+	binary.BigEndian.PutUint16(entry[18:], uint16(cfg.BitDepth))
+	binary.BigEndian.PutUint32(entry[24:], cfg.SampleRate<<16)
+	stsd := mp4Box("stsd", u32(0, 1), mp4Box(codec, entry, mp4Box("alac", u32(0), conf)))
+	
+	stts := u32(0, 1, uint32(len(packets)), cfg.FrameLength)
+	if lastFrames != cfg.FrameLength {
+		stts = u32(0, 2, uint32(len(packets)-1), cfg.FrameLength, 1, lastFrames)
+	}
+	stbl := mp4Box("stbl",
+		stsd,
+		mp4Box("stts", stts),
+		mp4Box("stsc", u32(0, 1, 1, 1, 1)),
+		mp4Box("stsz", u32(0, 0, uint32(len(sizes))), u32(sizes...)),
+		mp4Box("stco", u32(0, uint32(len(offsets))), u32(offsets...)),
+	)
+	mdhd := mp4Box("mdhd", u32(0, 0, 0, cfg.SampleRate, 0, 0))
+	hdlr := mp4Box("hdlr", u32(0, 0), []byte("soun"), u32(0, 0, 0), []byte{0})
+	moov := mp4Box("moov", mp4Box("trak", mp4Box("mdia", mdhd, hdlr, mp4Box("minf", stbl))))
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func TestDecodeEscape(t *testing.T) {
+	cfg := Config{FrameLength: 16, BitDepth: 16, PB: 40, MB: 10, KB: 14, NumChannels: 2, MaxRun: 255, SampleRate: 44100}
+	var left, right []int16
+	for i := 0; i < 40; i++ {
+		left = append(left, int16(i*1000-20000))
+		right = append(right, int16(-i*500))
+	}
+	var packets [][]byte
+	for i := 0; i < len(left); i += 16 {
+		end := i + 16
+		if end > len(left) {
+			end = len(left)
+		}
+		packets = append(packets, escapePacket(left[i:end], right[i:end], 16))
+	}
+	file := buildM4A("alac", cfg, packets, 8)
+	
+	rate, frames, err := Duration(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 44100 || frames != 40 {
+		t.Fatalf("Duration = %v, %v", rate, frames)
+	}
+	
+	s, format, err := Decode(nopCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.NumChannels != 2 || format.SampleRate != 44100 || s.Len() != 40 {
+		t.Fatalf("format = %+v, len = %d", format, s.Len())
+	}
+	samples := make([][2]float64, 64)
+	n, ok := s.Stream(samples)
+	if !ok || n != 40 || s.Err() != nil {
+		t.Fatalf("Stream = %d, %v, %v", n, ok, s.Err())
+	}
+	for i := 0; i < n; i++ {
+		want := [2]float64{float64(left[i]) / 32768, float64(right[i]) / 32768}
+		if samples[i] != want {
+			t.Fatalf("sample %d = %v, want %v", i, samples[i], want)
+		}
+	}
+	if _, ok := s.Stream(samples); ok {
+		t.Fatal("Stream after end should return false")
+	}
+	
+	if err := s.Seek(21); err != nil {
+		t.Fatal(err)
+	}
+	n, _ = s.Stream(samples[:2])
+	if n != 2 || samples[0][0] != float64(left[21])/32768 || s.Position() != 23 {
+		t.Fatalf("after seek got %v at position %d", samples[0], s.Position())
+	}
+}
+
+func TestDecodeCompressed(t *testing.T) {
+	// 全零残差的压缩数据包: mode 0, 无预测系数, 第一个残差为0, 之后是长度为7的零值游程
+	cfg := Config{FrameLength: 8, BitDepth: 16, PB: 40, MB: 10, KB: 14, NumChannels: 1, MaxRun: 255, SampleRate: 48000}
+	var w bitWriter
+	w.write(idSCE, 3)
+	w.write(0, 4)
+	w.write(0, 12)
+	w.write(0, 4)
+	w.write(0, 16)
+	w.write(0, 8) // mode, denShift
+	w.write(4<<5, 8)
+	w.write(0, 1)
+	// 游程: 前缀0, k=4 位的 v=8, 即 7
+	w.write(0, 1)
+	w.write(8, 4)
+	w.write(idEND, 3)
+	
+	c := newCodec(cfg)
+	n, err := c.decode(w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Fatalf("decode = %d frames", n)
+	}
+	for i, v := range c.channels[0][:n] {
+		if v != 0 {
+			t.Fatalf("sample %d = %d", i, v)
+		}
+	}
+}
+
+func TestDecodeAAC(t *testing.T) {
+	cfg := Config{FrameLength: 16, BitDepth: 16, NumChannels: 2, SampleRate: 44100}
+	file := buildM4A("mp4a", cfg, [][]byte{{0}}, 16)
+	if _, _, err := Duration(bytes.NewReader(file)); err != ErrUnsupportedCodec {
+		t.Fatalf("err = %v, want %v", err, ErrUnsupportedCodec)
+	}
+	if err := Check(bytes.NewReader(file)); err != ErrUnsupportedCodec {
+		t.Fatalf("Check = %v, want %v", err, ErrUnsupportedCodec)
+	}
+	if err := Check(bytes.NewReader(buildM4A("alac", cfg, [][]byte{{0}}, 16))); err != nil {
+		t.Fatalf("Check alac = %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package alac
+
+// bitReader 按大端位序读取 ALAC 码流, 越界部分按0填充
+type bitReader struct {
+	buf []byte
+	pos uint32 // bit
+}
+
+// peek32 返回从 pos 开始的32位
+func (b *bitReader) peek32(pos uint32) uint32 {
+	idx := int(pos >> 3)
+	var v uint64
+	for i := 0; i < 5; i++ {
+		v <<= 8
+		if idx+i < len(b.buf) {
+			v |= uint64(b.buf[idx+i])
+		}
+	}
+	return uint32(v >> (8 - pos&7))
+}
+
+// bits 返回从 pos 开始的n(0~32)位
+func (b *bitReader) bits(pos uint32, n uint32) uint32 {
+	if n == 0 {
+		return 0
+	}
+	return b.peek32(pos) >> (32 - n)
+}
+
+func (b *bitReader) read(n uint32) uint32 {
+	v := b.bits(b.pos, n)
+	b.pos += n
+	return v
+}
+
+func (b *bitReader) readOne() uint32 {
+	return b.read(1)
+}
+
+func (b *bitReader) advance(n uint32) {
+	b.pos += n
+}
+
+func (b *bitReader) byteAlign() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+// overrun 是否已经读到数据末尾之后
+func (b *bitReader) overrun() bool {
+	return int(b.pos) > len(b.buf)*8
+}
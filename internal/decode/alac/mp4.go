@@ -0,0 +1,347 @@
+package alac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var ErrNoAudioTrack = errors.New("alac: no audio track in mp4 container")
+
+// track 是从 moov 中解析出的音轨采样表
+type track struct {
+	cfg       Config
+	timescale uint32
+	// offsets/sizes 每个数据包在文件中的位置和大小
+	offsets []int64
+	sizes   []uint32
+	// starts 每个数据包第一个采样帧的序号, 最后一个元素为总帧数
+	starts []int64
+}
+
+// box 是 MP4 中的一个盒子
+type box struct {
+	typ    string
+	offset int64 // 数据起始偏移
+	size   int64 // 数据大小
+}
+
+// readBoxes 读取[start,end)范围内的所有子盒子
+func readBoxes(r io.ReadSeeker, start, end int64) ([]box, error) {
+	var boxes []box
+	offset := start
+	for offset+8 <= end {
+		var head [8]byte
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(head[0:4]))
+		typ := string(head[4:8])
+		headSize := int64(8)
+		switch size {
+		case 0:
+			// 延伸到文件末尾
+			size = end - offset
+		case 1:
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headSize = 16
+		}
+		if size < headSize || offset+size > end {
+			return nil, fmt.Errorf("alac: invalid mp4 box %q", typ)
+		}
+		boxes = append(boxes, box{typ: typ, offset: offset + headSize, size: size - headSize})
+		offset += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+func readBox(r io.ReadSeeker, b box) ([]byte, error) {
+	buf := make([]byte, b.size)
+	if _, err := r.Seek(b.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// children 读取盒子内的子盒子
+func children(r io.ReadSeeker, b box) ([]box, error) {
+	return readBoxes(r, b.offset, b.offset+b.size)
+}
+
+// path 沿着路径查找盒子
+func path(r io.ReadSeeker, b box, types ...string) (box, error) {
+	for _, typ := range types {
+		boxes, err := children(r, b)
+		if err != nil {
+			return box{}, err
+		}
+		var ok bool
+		if b, ok = findBox(boxes, typ); !ok {
+			return box{}, fmt.Errorf("alac: missing mp4 box %q", typ)
+		}
+	}
+	return b, nil
+}
+
+// readTrack 找到第一个 ALAC 音轨并解析采样表
+func readTrack(r io.ReadSeeker) (*track, error) {
+	trak, err := findTrack(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseTrack(r, trak)
+}
+
+// findTrack 找到第一个编码为 ALAC 的音轨, 有音轨但都不是 ALAC 时返回 ErrUnsupportedCodec
+func findTrack(r io.ReadSeeker) (box, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return box{}, err
+	}
+	top, err := readBoxes(r, 0, end)
+	if err != nil {
+		return box{}, err
+	}
+	moov, ok := findBox(top, "moov")
+	if !ok {
+		return box{}, errors.New("alac: missing moov box")
+	}
+	traks, err := children(r, moov)
+	if err != nil {
+		return box{}, err
+	}
+	foundAudio := false
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		hdlr, err := path(r, trak, "mdia", "hdlr")
+		if err != nil {
+			continue
+		}
+		buf, err := readBox(r, hdlr)
+		if err != nil || len(buf) < 12 || string(buf[8:12]) != "soun" {
+			continue
+		}
+		foundAudio = true
+		// stsd: version/flags(4) entry count(4) entry size(4) entry type(4)
+		stsd, err := path(r, trak, "mdia", "minf", "stbl", "stsd")
+		if err != nil {
+			return box{}, err
+		}
+		if buf, err = readBox(r, stsd); err != nil {
+			return box{}, err
+		}
+		if len(buf) >= 16 && string(buf[12:16]) == "alac" {
+			return trak, nil
+		}
+	}
+	if foundAudio {
+		return box{}, ErrUnsupportedCodec
+	}
+	return box{}, ErrNoAudioTrack
+}
+
+func parseTrack(r io.ReadSeeker, trak box) (*track, error) {
+	var t track
+	mdhd, err := path(r, trak, "mdia", "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	buf, err := readBox(r, mdhd)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(buf) >= 24 && buf[0] == 0:
+		t.timescale = binary.BigEndian.Uint32(buf[12:16])
+	case len(buf) >= 32 && buf[0] == 1:
+		t.timescale = binary.BigEndian.Uint32(buf[20:24])
+	default:
+		return nil, errors.New("alac: invalid mdhd box")
+	}
+	
+	stbl, err := path(r, trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	boxes, err := children(r, stbl)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string][]byte{}
+	for _, typ := range []string{"stsd", "stts", "stsc", "stsz", "stco", "co64"} {
+		b, ok := findBox(boxes, typ)
+		if !ok {
+			continue
+		}
+		if tables[typ], err = readBox(r, b); err != nil {
+			return nil, err
+		}
+	}
+	if t.cfg, err = parseStsd(tables["stsd"]); err != nil {
+		return nil, err
+	}
+	if err := t.parseSampleTable(tables); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseStsd 从 stsd 中读取 ALACSpecificConfig
+func parseStsd(buf []byte) (Config, error) {
+	// version/flags(4) entry count(4) entry size(4) entry type(4)
+	if len(buf) < 16 {
+		return Config{}, errors.New("alac: invalid stsd box")
+	}
+	if string(buf[12:16]) != "alac" {
+		return Config{}, ErrUnsupportedCodec
+	}
+	entry := buf[8:]
+	entrySize := int(binary.BigEndian.Uint32(entry[0:4]))
+	if entrySize > len(entry) {
+		entrySize = len(entry)
+	}
+	// AudioSampleEntry 头部共28字节, 之后是子盒子
+	for offset := 8 + 28; offset+12 <= entrySize; {
+		size := int(binary.BigEndian.Uint32(entry[offset : offset+4]))
+		if size < 8 || offset+size > entrySize {
+			break
+		}
+		if string(entry[offset+4:offset+8]) == "alac" {
+			// 子盒子: size(4) type(4) version/flags(4) config(24)
+			return parseConfig(entry[offset+12 : offset+size])
+		}
+		offset += size
+	}
+	return Config{}, errors.New("alac: missing ALACSpecificConfig")
+}
+
+// parseSampleTable 由 stts/stsc/stsz/stco 计算每个数据包的位置、大小和起始帧
+func (t *track) parseSampleTable(tables map[string][]byte) error {
+	stsz := tables["stsz"]
+	if len(stsz) < 12 {
+		return errors.New("alac: invalid stsz box")
+	}
+	fixedSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if fixedSize == 0 && len(stsz) < 12+count*4 {
+		return errors.New("alac: invalid stsz box")
+	}
+	t.sizes = make([]uint32, count)
+	for i := range t.sizes {
+		if fixedSize != 0 {
+			t.sizes[i] = fixedSize
+		} else {
+			t.sizes[i] = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+	
+	var chunkOffsets []int64
+	if co := tables["stco"]; len(co) >= 8 {
+		n := int(binary.BigEndian.Uint32(co[4:8]))
+		for i := 0; i < n && 8+i*4+4 <= len(co); i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(co[8+i*4:])))
+		}
+	} else if co := tables["co64"]; len(co) >= 8 {
+		n := int(binary.BigEndian.Uint32(co[4:8]))
+		for i := 0; i < n && 8+i*8+8 <= len(co); i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(co[8+i*8:])))
+		}
+	} else {
+		return errors.New("alac: missing chunk offsets")
+	}
+	
+	stsc := tables["stsc"]
+	if len(stsc) < 8 {
+		return errors.New("alac: invalid stsc box")
+	}
+	type stscEntry struct{ firstChunk, samplesPerChunk uint32 }
+	var entries []stscEntry
+	for i := 0; i < int(binary.BigEndian.Uint32(stsc[4:8])) && 8+i*12+12 <= len(stsc); i++ {
+		e := stsc[8+i*12:]
+		entries = append(entries, stscEntry{binary.BigEndian.Uint32(e[0:4]), binary.BigEndian.Uint32(e[4:8])})
+	}
+	t.offsets = make([]int64, 0, count)
+	sample := 0
+	for i, e := range entries {
+		last := uint32(len(chunkOffsets))
+		if i+1 < len(entries) {
+			last = entries[i+1].firstChunk - 1
+		}
+		for chunk := e.firstChunk; chunk >= 1 && chunk <= last && int(chunk) <= len(chunkOffsets); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for j := uint32(0); j < e.samplesPerChunk && sample < count; j++ {
+				t.offsets = append(t.offsets, offset)
+				offset += int64(t.sizes[sample])
+				sample++
+			}
+		}
+	}
+	if len(t.offsets) != count {
+		return errors.New("alac: sample table does not match chunk table")
+	}
+	
+	// stts 给出每个数据包的时长, 换算到采样率
+	stts := tables["stts"]
+	if len(stts) < 8 {
+		return errors.New("alac: invalid stts box")
+	}
+	t.starts = make([]int64, 0, count+1)
+	var pos int64
+	for i := 0; i < int(binary.BigEndian.Uint32(stts[4:8])) && 8+i*8+8 <= len(stts); i++ {
+		e := stts[8+i*8:]
+		n, delta := binary.BigEndian.Uint32(e[0:4]), binary.BigEndian.Uint32(e[4:8])
+		for j := uint32(0); j < n && len(t.starts) < count; j++ {
+			t.starts = append(t.starts, pos)
+			pos += t.scale(delta)
+		}
+	}
+	for len(t.starts) < count {
+		t.starts = append(t.starts, pos)
+		pos += int64(t.cfg.FrameLength)
+	}
+	t.starts = append(t.starts, pos)
+	return nil
+}
+
+// scale 把 mdhd 时间刻度下的时长换算成采样帧
+func (t *track) scale(d uint32) int64 {
+	if t.timescale == 0 || t.timescale == t.cfg.SampleRate {
+		return int64(d)
+	}
+	return int64(d) * int64(t.cfg.SampleRate) / int64(t.timescale)
+}
+
+// frames 总帧数
+func (t *track) frames() int64 {
+	return t.starts[len(t.starts)-1]
+}
+
+// packetAt 返回包含第 pos 帧的数据包序号
+func (t *track) packetAt(pos int64) int {
+	return sort.Search(len(t.sizes), func(i int) bool {
+		return t.starts[i+1] > pos
+	})
+}
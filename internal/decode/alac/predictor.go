@@ -0,0 +1,80 @@
+package alac
+
+// 自适应线性预测, 参照 Apple ALAC 参考实现 dp_dec.c
+
+func signOf(i int32) int32 {
+	switch {
+	case i > 0:
+		return 1
+	case i < 0:
+		return -1
+	}
+	return 0
+}
+
+// unpcBlock 由残差 pc 还原采样到 out, pc 与 out 可以是同一个切片
+func unpcBlock(pc, out []int32, num int, coefs []int16, numActive int, chanBits uint32, denShift uint32) {
+	chanShift := 32 - chanBits
+	var denHalf int32
+	if denShift > 0 {
+		denHalf = 1 << (denShift - 1)
+	}
+	out[0] = pc[0]
+	if numActive == 0 {
+		if num > 1 {
+			copy(out[1:num], pc[1:num])
+		}
+		return
+	}
+	if numActive == 31 {
+		prev := out[0]
+		for j := 1; j < num; j++ {
+			del := pc[j] + prev
+			prev = (del << chanShift) >> chanShift
+			out[j] = prev
+		}
+		return
+	}
+	
+	for j := 1; j <= numActive && j < num; j++ {
+		del := pc[j] + out[j-1]
+		out[j] = (del << chanShift) >> chanShift
+	}
+	
+	lim := numActive + 1
+	for j := lim; j < num; j++ {
+		var sum1 int32
+		top := out[j-lim]
+		for k := 0; k < numActive; k++ {
+			sum1 += int32(coefs[k]) * (out[j-1-k] - top)
+		}
+		
+		del := pc[j]
+		del0 := del
+		sg := signOf(del)
+		del += top + ((sum1 + denHalf) >> denShift)
+		out[j] = (del << chanShift) >> chanShift
+		
+		if sg > 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - out[j-1-k]
+				sgn := signOf(dd)
+				coefs[k] -= int16(sgn)
+				del0 -= int32(numActive-k) * ((sgn * dd) >> denShift)
+				if del0 <= 0 {
+					break
+				}
+			}
+		} else if sg < 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - out[j-1-k]
+				sgn := signOf(dd)
+				coefs[k] += int16(sgn)
+				del0 -= int32(numActive-k) * ((-sgn * dd) >> denShift)
+				if del0 >= 0 {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package alac
+
+import (
+	"fmt"
+	"io"
+	
+	"github.com/faiface/beep"
+)
+
+// Decode 解码 MP4/M4A 容器中的 ALAC 音轨, 返回的 StreamSeekCloser 关闭时会同时关闭 r
+// 非 ALAC 编码(如 AAC)返回 ErrUnsupportedCodec
+func Decode(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	t, err := readTrack(r)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(t.cfg.SampleRate),
+		NumChannels: int(t.cfg.NumChannels),
+		Precision:   (int(t.cfg.BitDepth) + 7) / 8,
+	}
+	if format.NumChannels > 2 {
+		format.NumChannels = 2
+	}
+	return &decoder{r: r, t: t, c: newCodec(t.cfg)}, format, nil
+}
+
+// Duration 返回音频的采样率和总帧数, 不解码音频数据
+func Duration(r io.ReadSeeker) (beep.SampleRate, int, error) {
+	t, err := readTrack(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return beep.SampleRate(t.cfg.SampleRate), int(t.frames()), nil
+}
+
+// ReadConfig 返回 ALAC 的编码参数和总帧数, 不解码音频数据
+func ReadConfig(r io.ReadSeeker) (Config, int, error) {
+	t, err := readTrack(r)
+	if err != nil {
+		return Config{}, 0, err
+	}
+	return t.cfg, int(t.frames()), nil
+}
+
+// Check 检查 MP4 中是否有 ALAC 音轨, 只读取 stsd 中的编码, 不解析采样表;
+// 同为 .m4a 的 AAC 文件返回 ErrUnsupportedCodec
+func Check(r io.ReadSeeker) error {
+	_, err := findTrack(r)
+	return err
+}
+
+type decoder struct {
+	r io.ReadSeekCloser
+	t *track
+	c *codec
+	// packet 下一个要解码的数据包
+	packet int
+	// frames/offset 当前已解码数据包的帧数和已输出的帧数
+	frames int
+	offset int
+	pos    int
+	buf    []byte
+	err    error
+}
+
+func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.err != nil {
+		return 0, false
+	}
+	for n < len(samples) {
+		if d.offset >= d.frames {
+			if !d.decodePacket() {
+				break
+			}
+			continue
+		}
+		left, right := d.channels()
+		scale := 1 / float64(int64(1)<<(d.t.cfg.BitDepth-1))
+		for d.offset < d.frames && n < len(samples) {
+			samples[n] = [2]float64{float64(left[d.offset]) * scale, float64(right[d.offset]) * scale}
+			d.offset++
+			n++
+		}
+	}
+	d.pos += n
+	return n, n > 0
+}
+
+// channels 返回用作左右声道的采样, 多声道时按 ALAC 声道布局取 L/R
+func (d *decoder) channels() (left, right []int32) {
+	switch ch := d.c.channels; len(ch) {
+	case 1:
+		return ch[0], ch[0]
+	case 2:
+		return ch[0], ch[1]
+	default:
+		// 3声道以上第一个是中置声道
+		return ch[1], ch[2]
+	}
+}
+
+// decodePacket 读取并解码下一个数据包
+func (d *decoder) decodePacket() bool {
+	if d.packet >= len(d.t.sizes) {
+		return false
+	}
+	size := int(d.t.sizes[d.packet])
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+	buf := d.buf[:size]
+	if _, err := d.r.Seek(d.t.offsets[d.packet], io.SeekStart); err != nil {
+		d.err = err
+		return false
+	}
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = err
+		return false
+	}
+	frames, err := d.c.decode(buf)
+	if err != nil {
+		d.err = fmt.Errorf("alac: packet %d: %w", d.packet, err)
+		return false
+	}
+	d.packet++
+	d.frames, d.offset = frames, 0
+	return true
+}
+
+func (d *decoder) Err() error {
+	return d.err
+}
+
+func (d *decoder) Len() int {
+	return int(d.t.frames())
+}
+
+func (d *decoder) Position() int {
+	return d.pos
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || p > d.Len() {
+		return fmt.Errorf("alac: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	d.packet = d.t.packetAt(int64(p))
+	d.frames, d.offset = 0, 0
+	d.pos = p
+	if d.packet >= len(d.t.sizes) {
+		return nil
+	}
+	// 解码目标帧所在的数据包, 跳过包内之前的帧
+	skip := p - int(d.t.starts[d.packet])
+	if !d.decodePacket() {
+		return fmt.Errorf("alac: seek error: %w", d.err)
+	}
+	d.offset = skip
+	return nil
+}
+
+func (d *decoder) Close() error {
+	return d.r.Close()
+}
@@ -0,0 +1,63 @@
+package decode
+
+import (
+	"context"
+	"io"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/decode/silence"
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/model"
+)
+
+// Analysis 一遍解码得到的响度、静音和波形。
+// 响度和波形各自可能无法计算(太短、长度未知), 错误记在 LoudnessErr/WaveformErr 中
+type Analysis struct {
+	Loudness    replaygain.Info
+	LoudnessErr error
+	// Silence 开头和结尾的静音, 相对于 start
+	Silence     silence.Result
+	Waveform    waveform.Peaks
+	WaveformErr error
+}
+
+// Analyze 完整解码一遍 [start,end) 之间的部分, 同时测量响度、检测静音并提取峰值波形, end<=0 表示到结尾;
+// 用于后台分析没有增益和裁剪范围的音乐, 不会关闭 reader
+func Analyze(ctx context.Context, Type model.MusicType, reader io.ReadSeeker, start, end time.Duration) (Analysis, error) {
+	streamer, format, err := openRegion(reader, Type, start, end)
+	if err != nil {
+		return Analysis{}, err
+	}
+	defer func() {
+		_ = streamer.Close()
+	}()
+	
+	meter, detector := replaygain.NewMeter(format), silence.NewDetector(format)
+	extractor, waveformErr := waveform.NewExtractor(format, streamer.Len())
+	buf := make([][2]float64, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Analysis{}, err
+		}
+		n, ok := streamer.Stream(buf)
+		meter.Add(buf[:n])
+		detector.Add(buf[:n])
+		if extractor != nil {
+			extractor.Add(buf[:n])
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return Analysis{}, err
+	}
+	
+	a := Analysis{Silence: detector.Result(), WaveformErr: waveformErr}
+	a.Loudness, a.LoudnessErr = meter.Info()
+	if extractor != nil {
+		a.Waveform = extractor.Peaks()
+	}
+	return a, nil
+}
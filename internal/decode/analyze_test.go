@@ -0,0 +1,58 @@
+package decode
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+)
+
+// TestAnalyze 一遍解码同时得到响度、静音和波形
+func TestAnalyze(t *testing.T) {
+	const rate = 44100
+	var pos int
+	// 前后各2秒静音, 中间4秒正弦波
+	sine := beep.Take(rate*4, beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := 0.5 * math.Sin(2*math.Pi*440*float64(pos)/rate)
+			samples[i] = [2]float64{v, v}
+			pos++
+		}
+		return len(samples), true
+	}))
+	path := filepath.Join(t.TempDir(), "music.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encode.Encode(context.Background(), f, beep.Seq(beep.Silence(rate*2), sine, beep.Silence(rate*2)), rate, 16, encode.FormatWAV, encode.Tags{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	a, err := Analyze(context.Background(), model.MusicTypeWAV, bytes.NewReader(buf), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.LoudnessErr != nil || !a.Loudness.HasTrack || a.Loudness.TrackPeak == 0 {
+		t.Fatalf("loudness = %+v, %v", a.Loudness, a.LoudnessErr)
+	}
+	if a.Silence.Start != time.Second*2-time.Millisecond*100 || a.Silence.End != time.Second*6+time.Millisecond*500 {
+		t.Fatalf("silence = %+v", a.Silence)
+	}
+	if a.WaveformErr != nil || a.Waveform.Duration != time.Second*8 || len(a.Waveform.Values) != waveform.Points {
+		t.Fatalf("waveform = %v, %d points, %v", a.Waveform.Duration, len(a.Waveform.Values), a.WaveformErr)
+	}
+}
@@ -0,0 +1,169 @@
+// Package charset 把老旧标签、CUE 和 LRC 文件中的 GBK、Big5 文字转换为 UTF-8
+package charset
+
+import (
+	"bytes"
+	"unicode/utf8"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// common 歌名、歌手和歌词中常见的简体和繁体字, 用错误的编码解码时很少出现
+const common = "的一是不了人我在有他这中大来上个国到说们为子和你地出道也时年得就那要下以生会自着去之过家学对可她里后小么心多天而能好都然没日于起" +
+	"还发成事只作当想看文无开手十用主行方又如前所本见经头面公同三已老从动两长知民样现分将外但身些与高意进把法此实回二理美点月明其种声全工己话儿者向情" +
+	"部正名定女问力机给等几很业最间新什打便位因重被走电四第门相次东海口使西再平真听世气信北少关并内加化由却代入先山五太水万眼体别处总才场书比住九笑" +
+	"通目报立马命张活难神数件安表原白路期叫死常感金何更反合放做或王果亲界今京任至物记边风干许八直毛林题南度色字请交爱让百吃义怎元六思非流每青夫连远" +
+	"带花快条变传近留红决周保达运半候七必城父步完深即求轻告江英满李息写呢极令黄收脸钱倒未取始双越千片容像找友孩站广形早房音火首单影失拿香似若弟谁读" +
+	"飞喜离虽坐落梦泪雨雪夜星光云寂寞忘记念恋伤痛回忆等待永远温柔晴阳春秋冬夏歌曲唱舞乐怀抱吻唯愿梨香蝶曾经孤独微笑眼泪思念幸福快乐朋友" +
+	"這個們來為國說會時過學對裡後麼發現經頭兩長樣將從動點實問種聲當話兒與進見開無業間氣電門東車聽關內產萬處總師書員別應務記邊風戰幹許覺請愛讓認論義" +
+	"結連遠帶條變聯傳領運強區極黃錢設歷視離雖編寶談隨盡劍講殺級團終樂議廣夢憶淚戀飛歲臉嗎還讀寫誰謝愛難帶輕溫晚陽陰雲雪舊綠藍紅"
+
+var commonRunes = func() map[rune]bool {
+	m := map[rune]bool{}
+	for _, r := range common {
+		m[r] = true
+	}
+	return m
+}()
+
+// candidate 可能的双字节编码, weight 按首字节和尾字节给出这个字在该编码中的常见程度
+type candidate struct {
+	charset model.Charset
+	enc     encoding.Encoding
+	weight  func(lead, trail byte) int
+}
+
+var candidates = []candidate{
+	{model.CharsetGBK, simplifiedchinese.GBK, gbkWeight},
+	{model.CharsetBig5, traditionalchinese.Big5, big5Weight},
+}
+
+// gbkWeight GB2312 的汉字和全角标点, GBK 扩展的字很少出现在正常的文字中
+func gbkWeight(lead, trail byte) int {
+	switch {
+	case trail < 0xa1:
+		return -1
+	case lead >= 0xb0 && lead <= 0xf7:
+		return 1
+	case lead >= 0xa1 && lead <= 0xa3:
+		return 0
+	}
+	return -1
+}
+
+// big5Weight Big5 的常用字(A440-C67E)和全角标点, 次常用字和扩展区的字较少出现
+func big5Weight(lead, trail byte) int {
+	switch {
+	case lead >= 0xa4 && (lead < 0xc6 || lead == 0xc6 && trail <= 0x7e):
+		return 1
+	case lead >= 0xa1 && lead <= 0xa3:
+		return 0
+	}
+	return -1
+}
+
+// score 按 c 解码 b 的得分, 有无效字节时 ok 为 false
+func score(b []byte, c candidate) (s int, ok bool) {
+	dec := c.enc.NewDecoder()
+	for i := 0; i < len(b); {
+		if b[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if i+1 >= len(b) {
+			return 0, false
+		}
+		out, err := dec.Bytes(b[i : i+2])
+		r, _ := utf8.DecodeRune(out)
+		if err != nil || r == utf8.RuneError || utf8.RuneCount(out) != 1 {
+			return 0, false
+		}
+		s += c.weight(b[i], b[i+1])
+		if commonRunes[r] {
+			s += 2
+		}
+		i += 2
+	}
+	return s, true
+}
+
+// Detect 识别不是 Unicode 的文字的编码: 合法的 UTF-8 返回 CharsetUTF8, 像是中文时返回 GBK 或 Big5,
+// 无法识别(例如西文的 Latin-1 文字)时返回 CharsetAuto
+func Detect(b []byte) model.Charset {
+	if utf8.Valid(b) {
+		return model.CharsetUTF8
+	}
+	best, bestScore := model.CharsetAuto, 0
+	for _, c := range candidates {
+		if s, ok := score(b, c); ok && s > bestScore {
+			best, bestScore = c.charset, s
+		}
+	}
+	return best
+}
+
+// Decode 把文件内容转换为 UTF-8. 有 BOM 时按 BOM 解码, 否则按 c 解码;
+// CharsetAuto 无法识别时按 Windows-1252 解码
+func Decode(b []byte, c model.Charset) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xef\xbb\xbf")):
+		return string(b[3:])
+	case bytes.HasPrefix(b, []byte("\xff\xfe")):
+		return decode(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), b)
+	case bytes.HasPrefix(b, []byte("\xfe\xff")):
+		return decode(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), b)
+	}
+	if c == model.CharsetAuto {
+		c = Detect(b)
+	}
+	switch c {
+	case model.CharsetUTF8:
+		return string(b)
+	case model.CharsetGBK:
+		return decode(simplifiedchinese.GBK, b)
+	case model.CharsetBig5:
+		return decode(traditionalchinese.Big5, b)
+	}
+	return decode(charmap.Windows1252, b)
+}
+
+// Fix 修复标签读取库解码错误的文字: ID3 中标为 ISO-8859-1 的文字已经被逐字节转换为 U+0000-U+00FF,
+// ID3v1 和 Vorbis 注释中的原始字节不是合法的 UTF-8; 其余的文字不变. c 为 CharsetUTF8 时不转换
+func Fix(s string, c model.Charset) string {
+	if c == model.CharsetUTF8 {
+		return s
+	}
+	raw, latin1 := []byte(s), true
+	if utf8.ValidString(s) {
+		raw = raw[:0]
+		for _, r := range s {
+			if r > 0xff {
+				return s
+			}
+			raw = append(raw, byte(r))
+		}
+	} else {
+		latin1 = false
+	}
+	if c == model.CharsetAuto {
+		c = Detect(raw)
+		// 原样的 ASCII 和无法识别的 ISO-8859-1 文字
+		if latin1 && (c == model.CharsetAuto || len(raw) == len(s)) {
+			return s
+		}
+	}
+	return Decode(raw, c)
+}
+
+func decode(enc encoding.Encoding, b []byte) string {
+	out, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(out)
+}
@@ -0,0 +1,95 @@
+package charset
+
+import (
+	"testing"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func encodeWith(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// latin1 按 ISO-8859-1 逐字节转换, 与标签读取库处理 ID3 文本帧的方式相同
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, v := range b {
+		r[i] = rune(v)
+	}
+	return string(r)
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		text string
+		enc  encoding.Encoding
+		want model.Charset
+	}{
+		{"月亮代表我的心", simplifiedchinese.GBK, model.CharsetGBK},
+		{"周杰伦 - 七里香", simplifiedchinese.GBK, model.CharsetGBK},
+		{"[00:12.30]窗外的麻雀 在电线杆上多嘴", simplifiedchinese.GBK, model.CharsetGBK},
+		{"月亮代表我的心", traditionalchinese.Big5, model.CharsetBig5},
+		{"周杰倫 - 七里香", traditionalchinese.Big5, model.CharsetBig5},
+		{"[00:12.30]窗外的麻雀 在電線桿上多嘴", traditionalchinese.Big5, model.CharsetBig5},
+	}
+	for _, c := range cases {
+		if got := Detect(encodeWith(t, c.enc, c.text)); got != c.want {
+			t.Errorf("Detect(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+	for _, s := range []string{"Caf\xe9 del Mar", "Mot\xf6rhead", "Sigur R\xf3s", "Beyonc\xe9"} {
+		if got := Detect([]byte(s)); got != model.CharsetAuto {
+			t.Errorf("Detect(%q) = %d, want auto", s, got)
+		}
+	}
+}
+
+func TestFix(t *testing.T) {
+	gbk := encodeWith(t, simplifiedchinese.GBK, "后来")
+	big5 := encodeWith(t, traditionalchinese.Big5, "後來")
+	big5AsGBK, _ := simplifiedchinese.GBK.NewDecoder().Bytes(big5)
+	cases := []struct {
+		in      string
+		charset model.Charset
+		want    string
+	}{
+		{latin1(gbk), model.CharsetAuto, "后来"},
+		{string(gbk), model.CharsetAuto, "后来"},
+		{latin1(big5), model.CharsetAuto, "後來"},
+		{latin1([]byte("后来")), model.CharsetAuto, "后来"},
+		{"Café", model.CharsetAuto, "Café"},
+		{"后来", model.CharsetBig5, "后来"},
+		{"ASCII", model.CharsetGBK, "ASCII"},
+		{latin1(gbk), model.CharsetUTF8, latin1(gbk)},
+		// 自动识别错误时手动指定
+		{latin1(big5), model.CharsetGBK, string(big5AsGBK)},
+	}
+	for _, c := range cases {
+		if got := Fix(c.in, c.charset); got != c.want {
+			t.Errorf("Fix(%q, %d) = %q, want %q", c.in, c.charset, got, c.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if got := Decode([]byte("\xff\xfe\x0e\x54\x65\x67"), model.CharsetGBK); got != "后来" {
+		t.Errorf("UTF-16LE = %q", got)
+	}
+	if got := Decode([]byte("\xef\xbb\xbf后来"), model.CharsetAuto); got != "后来" {
+		t.Errorf("UTF-8 BOM = %q", got)
+	}
+	if got := Decode(encodeWith(t, simplifiedchinese.GBK, "[00:01.00]后来"), model.CharsetAuto); got != "[00:01.00]后来" {
+		t.Errorf("GBK = %q", got)
+	}
+	if got := Decode([]byte("Caf\xe9"), model.CharsetAuto); got != "Café" {
+		t.Errorf("Windows-1252 = %q", got)
+	}
+}
@@ -0,0 +1,299 @@
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	
+	"github.com/Theodoree/music_player/internal/decode/aiff"
+	"github.com/Theodoree/music_player/internal/decode/alac"
+	"github.com/Theodoree/music_player/internal/decode/dsd"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+var ErrUnknownType = errors.New("decode: unknown music type")
+
+// probeSize 识别格式时读取的文件开头的字节数, 不含 ID3v2 标签
+const probeSize = 64
+
+// Codec 一种音频格式: 按文件开头的内容或扩展名识别, 创建解码流和读取元数据
+type Codec struct {
+	Type model.MusicType
+	// Name 格式名称, 例如 MP3、FLAC
+	Name string
+	// Extensions 带点的小写扩展名, 内容无法识别时使用
+	Extensions []string
+	// Probe 判断开头的内容是否为这种格式, head 为跳过 ID3v2 标签之后的最多 probeSize 字节
+	Probe func(head []byte) bool
+	// Check 可选, 读取更多内容确认能够解码, 例如 M4A 容器中的编码; 导入时不能解码的文件被跳过
+	Check func(r io.ReadSeeker) error
+	// ExtFallback Probe 无法可靠识别这种格式, 例如 MP3 第一帧之前有其它数据;
+	// 内容无法识别时可以按扩展名识别, 但解码器必须能够打开
+	ExtFallback bool
+	// Decode 创建解码流, 关闭解码流时关闭 r
+	Decode func(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error)
+	// Metadata 读取标签和音频参数, 见 ReadMetadata
+	Metadata func(r io.ReadSeeker) (Metadata, error)
+}
+
+// codecs 按注册的顺序识别, 特征明确的格式在前, 只能按帧头识别的 MP3 在最后
+var codecs []Codec
+
+// Register 注册格式, 同一类型重复注册时替换原来的格式
+func Register(c Codec) {
+	for i := range codecs {
+		if codecs[i].Type == c.Type {
+			codecs[i] = c
+			return
+		}
+	}
+	codecs = append(codecs, c)
+}
+
+func init() {
+	Register(Codec{
+		Type:       model.MusicTypeFLAC,
+		Name:       "FLAC",
+		Extensions: []string{".flac"},
+		Probe:      magic(0, "fLaC"),
+		Decode:     decodeFLAC,
+		Metadata:   getFLACMetadata,
+	})
+	Register(Codec{
+		Type:       model.MusicTypeWAV,
+		Name:       "WAV",
+		Extensions: []string{".wav", ".wave"},
+		Probe:      allOf(magic(0, "RIFF"), magic(8, "WAVE")),
+		Decode: func(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+			return wav.Decode(r)
+		},
+		Metadata: getWAVMetadata,
+	})
+	Register(Codec{
+		Type:       model.MusicTypeOGG,
+		Name:       "Ogg Vorbis",
+		Extensions: []string{".ogg", ".oga"},
+		// 第一页只有一个分段, 包从第 28 字节开始; Opus 等其它编码不支持
+		Probe: allOf(magic(0, "OggS"), magic(28, "\x01vorbis")),
+		Decode: func(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+			return vorbis.Decode(r)
+		},
+		Metadata: getOGGMetadata,
+	})
+	Register(Codec{
+		Type:       model.MusicTypeAIFF,
+		Name:       "AIFF",
+		Extensions: []string{".aiff", ".aif", ".aifc"},
+		Probe:      allOf(magic(0, "FORM"), anyOf(magic(8, "AIFF"), magic(8, "AIFC"))),
+		Decode:     aiff.Decode,
+		Metadata:   getAIFFMetadata,
+	})
+	Register(Codec{
+		Type:       model.MusicTypeM4A,
+		Name:       "ALAC",
+		Extensions: []string{".m4a"},
+		Probe:      m4aBrand,
+		Check:      alac.Check,
+		Decode:     alac.Decode,
+		Metadata:   getM4AMetadata,
+	})
+	Register(Codec{
+		Type:       model.MusicTypeDSD,
+		Name:       "DSD",
+		Extensions: []string{".dsf", ".dff"},
+		Probe:      anyOf(magic(0, "DSD "), allOf(magic(0, "FRM8"), magic(12, "DSD "))),
+		Decode:     dsd.Decode,
+		Metadata:   getDSDMetadata,
+	})
+	Register(Codec{
+		Type:        model.MusicTypeMP3,
+		Name:        "MP3",
+		Extensions:  []string{".mp3"},
+		Probe:       mp3Header,
+		ExtFallback: true,
+		Decode:      decodeMP3,
+		Metadata:    getMP3Metadata,
+	})
+}
+
+// flacMu mewkiz/flac 解析元数据块时共用包级的缓冲区, 不能并发解析;
+// 播放、后台分析和读取元数据可能同时打开 FLAC 文件
+var flacMu sync.Mutex
+
+func decodeFLAC(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	flacMu.Lock()
+	defer flacMu.Unlock()
+	return flac.Decode(r)
+}
+
+// decodeMP3 边下载边播放的文件不能扫描全部帧, 使用估算长度的解码流
+func decodeMP3(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	if p, ok := r.(Progressive); ok && !p.Complete() {
+		return decodeProgressiveMP3(p)
+	}
+	return mp3.Decode(r)
+}
+
+// magic 在 offset 处是否为 s
+func magic(offset int, s string) func(head []byte) bool {
+	return func(head []byte) bool {
+		return len(head) >= offset+len(s) && string(head[offset:offset+len(s)]) == s
+	}
+}
+
+func allOf(probes ...func([]byte) bool) func([]byte) bool {
+	return func(head []byte) bool {
+		for _, p := range probes {
+			if !p(head) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyOf(probes ...func([]byte) bool) func([]byte) bool {
+	return func(head []byte) bool {
+		for _, p := range probes {
+			if p(head) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// m4aBrands 音频专用的 ftyp 品牌; 通用的 mp42 品牌还需要同时带有音频编码的品牌
+var m4aBrands = []string{"M4A ", "M4B ", "M4P "}
+
+// m4aBrand ftyp 盒子中的主品牌和兼容品牌是否表明这是音频文件, 视频和 HEIC 图片等同样以 ftyp 开头
+func m4aBrand(head []byte) bool {
+	if !magic(4, "ftyp")(head) || len(head) < 12 {
+		return false
+	}
+	end := min(int(binary.BigEndian.Uint32(head)), len(head))
+	// 主品牌之后是4字节的版本号, 然后是兼容品牌
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= end; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+	for _, b := range m4aBrands {
+		if slices.Contains(brands, b) {
+			return true
+		}
+	}
+	return slices.Contains(brands, "mp42") && (slices.Contains(brands, "alac") || slices.Contains(brands, "mp4a"))
+}
+
+// id3v2Size 开头的 ID3v2 标签的总长度, 包括标签头和 v2.4 的标签尾; head 不是 ID3v2 标签时 ok 为 false
+func id3v2Size(head []byte) (size int64, ok bool) {
+	if len(head) < 10 || string(head[:3]) != "ID3" {
+		return 0, false
+	}
+	// 标签大小为 synchsafe 整数, 不含10字节的标签头
+	size = int64(head[6]&0x7f)<<21 | int64(head[7]&0x7f)<<14 | int64(head[8]&0x7f)<<7 | int64(head[9]&0x7f) + 10
+	if head[3] == 4 && head[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, true
+}
+
+// Lookup 按类型查找格式
+func Lookup(t model.MusicType) (Codec, bool) {
+	for _, c := range codecs {
+		if c.Type == t {
+			return c, true
+		}
+	}
+	return Codec{}, false
+}
+
+// LookupExt 按文件名的扩展名查找格式, 不区分大小写
+func LookupExt(name string) (Codec, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return Codec{}, false
+	}
+	for _, c := range codecs {
+		for _, e := range c.Extensions {
+			if e == ext {
+				return c, true
+			}
+		}
+	}
+	return Codec{}, false
+}
+
+// Probe 按开头的内容识别格式. 开头的 ID3v2 标签被跳过, 有标签但之后的内容无法识别时视为 MP3
+func Probe(r io.ReadSeeker) (Codec, bool) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Codec{}, false
+	}
+	head := make([]byte, probeSize)
+	n, _ := io.ReadFull(r, head)
+	start, id3 := id3v2Size(head[:n])
+	if id3 {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return Codec{}, false
+		}
+		n, _ = io.ReadFull(r, head)
+	}
+	for _, c := range codecs {
+		if c.Probe(head[:n]) {
+			return c, true
+		}
+	}
+	if id3 {
+		return Lookup(model.MusicTypeMP3)
+	}
+	return Codec{}, false
+}
+
+// DetectType 按内容识别文件的格式, 扩展名和内容不符时以内容为准。
+// 内容无法识别时只有 ExtFallback 的格式按扩展名识别, 并且要能打开解码器;
+// 格式的 Check 不通过时视为无法识别, 例如 AAC 编码的 .m4a 文件
+func DetectType(path string) (model.MusicType, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return model.MusicTypeUnknown, false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		return model.MusicTypeUnknown, false
+	}
+	c, ok := Probe(f)
+	if !ok {
+		if c, ok = LookupExt(path); !ok || !c.ExtFallback || !canDecode(c, f) {
+			return model.MusicTypeUnknown, false
+		}
+	}
+	if c.Check != nil && c.Check(f) != nil {
+		return model.MusicTypeUnknown, false
+	}
+	return c.Type, true
+}
+
+// canDecode 能否打开 r 的解码器, 不会关闭 r
+func canDecode(c Codec, r io.ReadSeeker) bool {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	s, _, err := c.Decode(nopCloser{r})
+	if err != nil {
+		return false
+	}
+	_ = s.Close()
+	return true
+}
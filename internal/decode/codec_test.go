@@ -0,0 +1,102 @@
+package decode
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+)
+
+func TestProbe(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x01\x00"), make([]byte, 128)...)
+	mp3Frame := []byte{0xff, 0xfb, 0x90, 0x64}
+	cases := []struct {
+		name string
+		head []byte
+		want model.MusicType
+		ok   bool
+	}{
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), model.MusicTypeFLAC, true},
+		{"id3 flac", append(append([]byte{}, id3...), "fLaC"...), model.MusicTypeFLAC, true},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), model.MusicTypeWAV, true},
+		{"aiff", []byte("FORM\x00\x00\x00\x00AIFC"), model.MusicTypeAIFF, true},
+		{"ogg", append(append([]byte("OggS"), make([]byte, 24)...), "\x01vorbis"...), model.MusicTypeOGG, true},
+		{"opus", append(append([]byte("OggS"), make([]byte, 24)...), "OpusHead"...), 0, false},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A "), model.MusicTypeM4A, true},
+		{"mp42 alac", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42alac"), model.MusicTypeM4A, true},
+		// 视频和图片同样是 ISO-BMFF
+		{"mp4 video", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2"), 0, false},
+		{"mp42 video", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), 0, false},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), 0, false},
+		{"dsf", []byte("DSD \x1c\x00\x00\x00"), model.MusicTypeDSD, true},
+		{"dff", []byte("FRM8\x00\x00\x00\x00\x00\x00\x00\x00DSD "), model.MusicTypeDSD, true},
+		{"mp3", mp3Frame, model.MusicTypeMP3, true},
+		{"id3 mp3", append(append([]byte{}, id3...), mp3Frame...), model.MusicTypeMP3, true},
+		// 标签之后是填充或无法识别的数据时仍视为 MP3
+		{"id3 padding", append(append([]byte{}, id3...), make([]byte, 64)...), model.MusicTypeMP3, true},
+		{"jpeg", []byte{0xff, 0xd8, 0xff, 0xe0}, 0, false},
+		{"text", []byte("[00:01.00]lyrics"), 0, false},
+	}
+	for _, c := range cases {
+		codec, ok := Probe(bytes.NewReader(c.head))
+		if ok != c.ok || ok && codec.Type != c.want {
+			t.Errorf("%s: Probe = %s %v, want %d %v", c.name, codec.Name, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	dir := t.TempDir()
+	// 扩展名错误和大写的扩展名都按内容识别
+	path := filepath.Join(dir, "song.MP3")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encode.Encode(context.Background(), f, beep.Silence(44100), 44100, 16, encode.FormatFLAC, encode.Tags{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if typ, ok := DetectType(path); !ok || typ != model.MusicTypeFLAC {
+		t.Fatalf("DetectType = %d %v, want FLAC", typ, ok)
+	}
+	if _, err := GetMetadata(path, model.MusicTypeFLAC); err != nil {
+		t.Fatal(err)
+	}
+	
+	// 不是音乐的文件即使扩展名是音乐也不会被当作音乐
+	for _, name := range []string{"broken.FLAC", "page.mp3", "notes.txt", "mp3", "cover.jpg.mp3.bak"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("<html><body>not audio</body></html>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := DetectType(path); ok {
+			t.Errorf("DetectType(%s) = true", name)
+		}
+	}
+	// 第一帧之前有其它数据的 MP3 按扩展名识别, 解码器能够找到帧
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+	path = filepath.Join(dir, "junk.mp3")
+	if err := os.WriteFile(path, append([]byte("junk before the first frame"), bytes.Repeat(frame, 20)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if typ, ok := DetectType(path); !ok || typ != model.MusicTypeMP3 {
+		t.Errorf("DetectType(junk.mp3) = %d %v, want MP3", typ, ok)
+	}
+	// M4A 品牌但没有 ALAC 音轨的文件无法解码, 不按扩展名退回
+	path = filepath.Join(dir, "aac.m4a")
+	if err := os.WriteFile(path, []byte("\x00\x00\x00\x10ftypM4A \x00\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := DetectType(path); ok {
+		t.Errorf("DetectType(aac.m4a) = true")
+	}
+	if _, ok := DetectType(dir); ok {
+		t.Errorf("DetectType(dir) = true")
+	}
+}
@@ -0,0 +1,474 @@
+// Package dsd implements decoding of DSF and DSDIFF (DFF) files into beep.StreamSeekCloser.
+//
+// The 1-bit DSD stream is converted to PCM on the fly by a decimating FIR low-pass
+// filter: DSD64 becomes 88.2kHz PCM, DSD128 176.4kHz and so on.
+package dsd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	
+	"github.com/faiface/beep"
+)
+
+var (
+	ErrNotDSD           = errors.New("dsd: not a DSF or DFF file")
+	ErrUnsupportedCodec = errors.New("dsd: unsupported compression type")
+	ErrUnsupportedRate  = errors.New("dsd: unsupported sample rate")
+)
+
+// 文件格式
+const (
+	formatDSF = iota
+	formatDFF
+)
+
+// header 是解析后的格式信息
+type header struct {
+	format     int
+	channels   int
+	sampleRate int // 1位采样的采样率, 如 DSD64 为 2822400
+	// bytesPerChannel 每个声道的数据字节数
+	bytesPerChannel int64
+	// dataStart 音频数据在文件中的偏移
+	dataStart int64
+	// blockSize DSF 每个声道一个块的字节数, DFF 为按字节交错
+	blockSize int64
+	// lsbFirst DSF 中每个字节的低位在前
+	lsbFirst bool
+	// metadata DSF 的 ID3v2 标签偏移, 0表示没有
+	metadata int64
+}
+
+// ratio 降采样倍数, 输出采样率为 88.2kHz 或 96kHz 的整数倍
+func (h header) ratio() (int, error) {
+	for _, rate := range []int{88200, 96000} {
+		if h.sampleRate%rate == 0 {
+			if r := h.sampleRate / rate; r >= 8 && r%8 == 0 {
+				return r, nil
+			}
+		}
+	}
+	return 0, ErrUnsupportedRate
+}
+
+// readHeader 根据文件头识别 DSF 或 DFF
+func readHeader(r io.ReadSeeker) (header, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return header{}, err
+	}
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return header{}, ErrNotDSD
+	}
+	var (
+		h   header
+		err error
+	)
+	switch string(magic[:]) {
+	case "DSD ":
+		h, err = readDSFHeader(r)
+	case "FRM8":
+		h, err = readDFFHeader(r)
+	default:
+		return header{}, ErrNotDSD
+	}
+	if err != nil {
+		return header{}, err
+	}
+	if h.channels < 1 || h.sampleRate <= 0 {
+		return header{}, ErrNotDSD
+	}
+	if _, err := h.ratio(); err != nil {
+		return header{}, err
+	}
+	return h, nil
+}
+
+// readDSFHeader 解析 DSF, 所有字段都是小端序
+func readDSFHeader(r io.ReadSeeker) (header, error) {
+	// DSD 块(28字节) + fmt 块(52字节) + data 块头(12字节)
+	var buf [92]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return header{}, err
+	}
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return header{}, ErrNotDSD
+	}
+	le := binary.LittleEndian
+	dsdSize := int64(le.Uint64(buf[4:12]))
+	if dsdSize != 28 || string(buf[28:32]) != "fmt " {
+		return header{}, ErrNotDSD
+	}
+	f := buf[28:80]
+	if le.Uint32(f[16:20]) != 0 {
+		// 只支持未压缩的 DSD raw
+		return header{}, ErrUnsupportedCodec
+	}
+	h := header{
+		format:     formatDSF,
+		channels:   int(le.Uint32(f[24:28])),
+		sampleRate: int(le.Uint32(f[28:32])),
+		blockSize:  int64(le.Uint32(f[44:48])),
+		lsbFirst:   le.Uint32(f[32:36]) == 1,
+		metadata:   int64(le.Uint64(buf[20:28])),
+	}
+	sampleCount := int64(le.Uint64(f[36:44]))
+	h.bytesPerChannel = sampleCount / 8
+	
+	// fmt 块通常是52字节, 按块大小找到 data 块
+	fmtSize := int64(le.Uint64(f[4:12]))
+	dataOffset := 28 + fmtSize
+	if fmtSize != 52 {
+		if _, err := r.Seek(dataOffset, io.SeekStart); err != nil {
+			return header{}, err
+		}
+		if _, err := io.ReadFull(r, buf[80:92]); err != nil {
+			return header{}, ErrNotDSD
+		}
+	}
+	if string(buf[80:84]) != "data" || h.blockSize <= 0 {
+		return header{}, ErrNotDSD
+	}
+	h.dataStart = dataOffset + 12
+	return h, nil
+}
+
+// chunk 是 DFF 中的一个块
+type chunk struct {
+	id     string
+	offset int64 // 数据起始偏移
+	size   int64
+}
+
+// readChunks 遍历[start,end)范围内的 DFF 块, 块大小为64位大端序
+func readChunks(r io.ReadSeeker, start, end int64) ([]chunk, error) {
+	var chunks []chunk
+	offset := start
+	for offset+12 <= end {
+		var head [12]byte
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			// 文件被截断时保留已经读到的块
+			break
+		}
+		size := int64(binary.BigEndian.Uint64(head[4:12]))
+		if size < 0 {
+			break
+		}
+		chunks = append(chunks, chunk{id: string(head[0:4]), offset: offset + 12, size: size})
+		// 块大小为奇数时补齐一个字节
+		offset += 12 + size + size&1
+	}
+	return chunks, nil
+}
+
+// readDFFChunks 读取 FRM8 中的所有块
+func readDFFChunks(r io.ReadSeeker) ([]chunk, error) {
+	var head [16]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, ErrNotDSD
+	}
+	if string(head[0:4]) != "FRM8" || string(head[12:16]) != "DSD " {
+		return nil, ErrNotDSD
+	}
+	end := int64(binary.BigEndian.Uint64(head[4:12])) + 12
+	return readChunks(r, 16, end)
+}
+
+// readDFFHeader 解析 DSDIFF, 所有字段都是大端序
+func readDFFHeader(r io.ReadSeeker) (header, error) {
+	chunks, err := readDFFChunks(r)
+	if err != nil {
+		return header{}, err
+	}
+	h := header{format: formatDFF}
+	hasData := false
+	for _, c := range chunks {
+		switch c.id {
+		case "PROP":
+			if err := readDFFProp(r, c, &h); err != nil {
+				return header{}, err
+			}
+		case "DSD ":
+			h.dataStart = c.offset
+			h.bytesPerChannel = c.size
+			hasData = true
+		case "DST ":
+			return header{}, ErrUnsupportedCodec
+		}
+	}
+	if !hasData || h.channels < 1 {
+		return header{}, ErrNotDSD
+	}
+	h.bytesPerChannel /= int64(h.channels)
+	return h, nil
+}
+
+// readDFFProp 读取 PROP 块中的采样率、声道数和压缩类型
+func readDFFProp(r io.ReadSeeker, prop chunk, h *header) error {
+	var kind [4]byte
+	if _, err := r.Seek(prop.offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, kind[:]); err != nil || string(kind[:]) != "SND " {
+		return ErrNotDSD
+	}
+	chunks, err := readChunks(r, prop.offset+4, prop.offset+prop.size)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		var buf [4]byte
+		if _, err := r.Seek(c.offset, io.SeekStart); err != nil {
+			return err
+		}
+		switch c.id {
+		case "FS  ":
+			if _, err := io.ReadFull(r, buf[:4]); err != nil {
+				return ErrNotDSD
+			}
+			h.sampleRate = int(binary.BigEndian.Uint32(buf[:4]))
+		case "CHNL":
+			if _, err := io.ReadFull(r, buf[:2]); err != nil {
+				return ErrNotDSD
+			}
+			h.channels = int(binary.BigEndian.Uint16(buf[:2]))
+		case "CMPR":
+			if _, err := io.ReadFull(r, buf[:4]); err != nil {
+				return ErrNotDSD
+			}
+			if string(buf[:4]) != "DSD " {
+				return ErrUnsupportedCodec
+			}
+		}
+	}
+	return nil
+}
+
+// Decode 解码 DSF/DFF 为 PCM, 返回的 StreamSeekCloser 关闭时会同时关闭 r
+func Decode(r io.ReadSeekCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	ratio, _ := h.ratio()
+	d := &decoder{r: r, h: h, f: newFilter(ratio), step: ratio / 8}
+	d.channels = h.channels
+	if d.channels > 2 {
+		// 多声道只取前两个(左/右)声道
+		d.channels = 2
+	}
+	d.work = make([][]byte, d.channels)
+	if err := d.prime(0); err != nil {
+		return nil, beep.Format{}, err
+	}
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(h.sampleRate / ratio),
+		NumChannels: d.channels,
+		Precision:   3,
+	}
+	return d, format, nil
+}
+
+// Duration 返回 PCM 的采样率和总帧数, 不解码音频数据
+func Duration(r io.ReadSeeker) (beep.SampleRate, int, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	ratio, _ := h.ratio()
+	return beep.SampleRate(h.sampleRate / ratio), int(h.bytesPerChannel * 8 / int64(ratio)), nil
+}
+
+type decoder struct {
+	r io.ReadSeekCloser
+	h header
+	f *filter
+	// step 每个输出帧消耗的字节数(每个声道)
+	step     int
+	channels int
+	pos      int
+	// work 每个声道的字节缓冲, 前 f.size() 字节是滤波器的历史数据
+	work [][]byte
+	buf  []byte
+	err  error
+}
+
+func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.err != nil || d.pos >= d.Len() {
+		return 0, false
+	}
+	frames := len(samples)
+	if frames > d.Len()-d.pos {
+		frames = d.Len() - d.pos
+	}
+	size := d.f.size()
+	got, err := d.read(int64(d.pos*d.step), frames*d.step, size)
+	if err != nil {
+		d.err = err
+	}
+	frames = got / d.step
+	for n = 0; n < frames; n++ {
+		start := (n + 1) * d.step
+		left := d.f.apply(d.work[0][start : start+size])
+		right := left
+		if d.channels >= 2 {
+			right = d.f.apply(d.work[1][start : start+size])
+		}
+		samples[n] = [2]float64{left, right}
+	}
+	// 保留最后 size 字节作为下一次的历史数据
+	for c := range d.work {
+		copy(d.work[c][:size], d.work[c][frames*d.step:frames*d.step+size])
+	}
+	d.pos += n
+	if n == 0 {
+		// 数据比头部声明的短
+		d.h.bytesPerChannel = int64(d.pos * d.step)
+		return 0, false
+	}
+	return n, true
+}
+
+// prime 为从第 p 帧开始解码准备滤波器历史数据
+func (d *decoder) prime(p int) error {
+	size := d.f.size()
+	start := int64(p * d.step)
+	begin := start - int64(size)
+	if begin < 0 {
+		begin = 0
+	}
+	n := int(start - begin)
+	d.grow(size)
+	for c := range d.work {
+		for i := 0; i < size; i++ {
+			d.work[c][i] = silence
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	_, err := d.read(begin, n, size-n)
+	return err
+}
+
+// grow 保证每个声道的缓冲区至少有 n 字节
+func (d *decoder) grow(n int) {
+	for c := range d.work {
+		if len(d.work[c]) < n {
+			w := make([]byte, n)
+			copy(w, d.work[c])
+			d.work[c] = w
+		}
+	}
+}
+
+// read 读取每个声道从第 start 字节开始的 n 字节到 d.work[c][off:], 返回实际读到的字节数
+func (d *decoder) read(start int64, n int, off int) (int, error) {
+	d.grow(off + n)
+	var (
+		got int
+		err error
+	)
+	switch d.h.format {
+	case formatDSF:
+		got, err = d.readDSF(start, n, off)
+	case formatDFF:
+		got, err = d.readDFF(start, n, off)
+	}
+	if d.h.lsbFirst {
+		for c := range d.work {
+			for i, b := range d.work[c][off : off+got] {
+				d.work[c][off+i] = bits.Reverse8(b)
+			}
+		}
+	}
+	return got, err
+}
+
+// readDSF DSF 中每个声道按 blockSize 分块交错存放
+func (d *decoder) readDSF(start int64, n int, off int) (int, error) {
+	bs := d.h.blockSize
+	got := 0
+	for got < n {
+		pos := start + int64(got)
+		block, within := pos/bs, pos%bs
+		m := int(bs - within)
+		if m > n-got {
+			m = n - got
+		}
+		for c := range d.work {
+			offset := d.h.dataStart + (block*int64(d.h.channels)+int64(c))*bs + within
+			if _, err := d.r.Seek(offset, io.SeekStart); err != nil {
+				return got, err
+			}
+			if _, err := io.ReadFull(d.r, d.work[c][off+got:off+got+m]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return got, nil
+				}
+				return got, err
+			}
+		}
+		got += m
+	}
+	return got, nil
+}
+
+// readDFF DFF 中各声道按字节交错存放
+func (d *decoder) readDFF(start int64, n int, off int) (int, error) {
+	ch := d.h.channels
+	if _, err := d.r.Seek(d.h.dataStart+start*int64(ch), io.SeekStart); err != nil {
+		return 0, err
+	}
+	if cap(d.buf) < n*ch {
+		d.buf = make([]byte, n*ch)
+	}
+	buf := d.buf[:n*ch]
+	read, err := io.ReadFull(d.r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	got := read / ch
+	for i := 0; i < got; i++ {
+		for c := range d.work {
+			d.work[c][off+i] = buf[i*ch+c]
+		}
+	}
+	return got, nil
+}
+
+func (d *decoder) Err() error {
+	return d.err
+}
+
+func (d *decoder) Len() int {
+	return int(d.h.bytesPerChannel / int64(d.step))
+}
+
+func (d *decoder) Position() int {
+	return d.pos
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || p > d.Len() {
+		return fmt.Errorf("dsd: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	if err := d.prime(p); err != nil {
+		return fmt.Errorf("dsd: seek error: %w", err)
+	}
+	d.pos = p
+	return nil
+}
+
+func (d *decoder) Close() error {
+	return d.r.Close()
+}
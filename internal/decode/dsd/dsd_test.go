@@ -0,0 +1,195 @@
+package dsd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+const (
+	testRate   = 2822400
+	testFreq   = 1000
+	testAmp    = 0.5
+	testFrames = 2048 // 输出帧数
+)
+
+// modulate 用一阶 sigma-delta 调制生成正弦波的 DSD 码流, 高位在前
+func modulate(bytesPerChannel int) []byte {
+	out := make([]byte, bytesPerChannel)
+	var integrator float64
+	for i := 0; i < bytesPerChannel*8; i++ {
+		x := testAmp * math.Sin(2*math.Pi*testFreq*float64(i)/testRate)
+		y := -1.0
+		if integrator >= 0 {
+			y = 1
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+		integrator += x - y
+	}
+	return out
+}
+
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		var r byte
+		for j := 0; j < 8; j++ {
+			r = r<<1 | (v>>j)&1
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// buildDSF 生成双声道 DSF, 左声道为正弦波, 右声道为静音
+func buildDSF(left []byte, blockSize int) []byte {
+	le := binary.LittleEndian
+	blocks := (len(left) + blockSize - 1) / blockSize
+	data := make([]byte, blocks*blockSize*2)
+	lsb := reverse(left)
+	for b := 0; b < blocks; b++ {
+		for i := 0; i < blockSize; i++ {
+			data[(b*2+1)*blockSize+i] = silence
+			if idx := b*blockSize + i; idx < len(lsb) {
+				data[b*2*blockSize+i] = lsb[idx]
+			}
+		}
+	}
+	buf := make([]byte, 92, 92+len(data))
+	copy(buf[0:], "DSD ")
+	le.PutUint64(buf[4:], 28)
+	le.PutUint64(buf[12:], uint64(92+len(data)))
+	copy(buf[28:], "fmt ")
+	le.PutUint64(buf[32:], 52)
+	le.PutUint32(buf[40:], 1)
+	le.PutUint32(buf[48:], 2)
+	le.PutUint32(buf[52:], 2)
+	le.PutUint32(buf[56:], testRate)
+	le.PutUint32(buf[60:], 1)
+	le.PutUint64(buf[64:], uint64(len(left)*8))
+	le.PutUint32(buf[72:], uint32(blockSize))
+	copy(buf[80:], "data")
+	le.PutUint64(buf[84:], uint64(12+len(data)))
+	return append(buf, data...)
+}
+
+func dffChunk(id string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 12, 12+len(body)+1)
+	copy(b, id)
+	binary.BigEndian.PutUint64(b[4:], uint64(len(body)))
+	b = append(b, body...)
+	if len(body)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// buildDFF 生成双声道 DFF, 左声道为正弦波, 右声道为静音
+func buildDFF(left []byte, title string) []byte {
+	data := make([]byte, len(left)*2)
+	for i, v := range left {
+		data[i*2], data[i*2+1] = v, silence
+	}
+	fs := make([]byte, 4)
+	binary.BigEndian.PutUint32(fs, testRate)
+	diti := make([]byte, 4)
+	binary.BigEndian.PutUint32(diti, uint32(len(title)))
+	prop := dffChunk("PROP", []byte("SND "),
+		dffChunk("FS  ", fs),
+		dffChunk("CHNL", []byte{0, 2}, []byte("SLFTSRGT")),
+		dffChunk("CMPR", []byte("DSD "), []byte{14}, []byte("not compressed")),
+	)
+	body := bytes.Join([][]byte{
+		[]byte("DSD "),
+		dffChunk("FVER", []byte{1, 5, 0, 0}),
+		prop,
+		dffChunk("DSD ", data),
+		dffChunk("DIIN", dffChunk("DITI", diti, []byte(title))),
+	}, nil)
+	head := make([]byte, 12)
+	copy(head, "FRM8")
+	binary.BigEndian.PutUint64(head[4:], uint64(len(body)))
+	return append(head, body...)
+}
+
+func checkSine(t *testing.T, file []byte) {
+	rate, frames, err := Duration(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 88200 || frames != testFrames {
+		t.Fatalf("Duration = %v, %v", rate, frames)
+	}
+	
+	s, format, err := Decode(nopCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != 88200 || format.NumChannels != 2 || s.Len() != testFrames {
+		t.Fatalf("format = %+v, len = %d", format, s.Len())
+	}
+	samples := make([][2]float64, testFrames)
+	for n := 0; n < testFrames; {
+		got, ok := s.Stream(samples[n:])
+		if !ok {
+			t.Fatalf("Stream stopped at %d: %v", n, s.Err())
+		}
+		n += got
+	}
+	
+	// 滤波器的群延迟为半个窗口
+	delay := float64(len(newFilter(32).tables)*8-1) / 2 / 32
+	var errSum, sigSum float64
+	for i := 128; i < testFrames; i++ {
+		want := testAmp * math.Sin(2*math.Pi*testFreq*(float64(i+1)-delay)/88200)
+		errSum += (samples[i][0] - want) * (samples[i][0] - want)
+		sigSum += want * want
+		if math.Abs(samples[i][1]) > 0.01 {
+			t.Fatalf("silent channel sample %d = %v", i, samples[i][1])
+		}
+	}
+	if snr := 10 * math.Log10(sigSum/errSum); snr < 30 {
+		t.Fatalf("SNR = %.1f dB", snr)
+	}
+	
+	// 跳转后的输出与连续解码一致
+	if err := s.Seek(1000); err != nil {
+		t.Fatal(err)
+	}
+	seeked := make([][2]float64, 16)
+	if n, _ := s.Stream(seeked); n != 16 || s.Position() != 1016 {
+		t.Fatalf("Stream after seek = %d at %d", n, s.Position())
+	}
+	for i := range seeked {
+		if math.Abs(seeked[i][0]-samples[1000+i][0]) > 1e-9 {
+			t.Fatalf("sample %d after seek = %v, want %v", i, seeked[i][0], samples[1000+i][0])
+		}
+	}
+}
+
+func TestDecodeDSF(t *testing.T) {
+	// 块大小不整除数据长度, 覆盖跨块读取
+	checkSine(t, buildDSF(modulate(testFrames*4), 1000))
+}
+
+func TestDecodeDFF(t *testing.T) {
+	file := buildDFF(modulate(testFrames*4), "test title")
+	checkSine(t, file)
+	
+	m, err := ReadMetadata(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "test title" {
+		t.Fatalf("Title = %q", m.Title)
+	}
+}
@@ -0,0 +1,71 @@
+package dsd
+
+import "math"
+
+// 滤波器参数
+const (
+	// tapsPerRatio 每个降采样倍数对应的 FIR 阶数, DSD64 降到 88.2kHz 时为1024阶
+	tapsPerRatio = 32
+	// cutoff 截止频率相对输出采样率的比例, 88.2kHz 时约为24kHz
+	cutoff = 0.272
+	// silence DSD 的静音码型, 0和1各占一半
+	silence = 0x69
+)
+
+// filter 把1位 DSD 降采样为 PCM 的 FIR 低通滤波器
+// 每个字节8个1位采样对输出的贡献预先算好, 计算时逐字节查表
+type filter struct {
+	// tables[j][v] 窗口中第j个字节取值为v时对输出的贡献
+	tables [][256]float64
+}
+
+// newFilter 用 Blackman 窗的 sinc 函数设计降采样 ratio 倍的低通滤波器
+func newFilter(ratio int) *filter {
+	taps := ratio * tapsPerRatio
+	fc := cutoff / float64(ratio)
+	coefs := make([]float64, taps)
+	var sum float64
+	mid := float64(taps-1) / 2
+	for i := range coefs {
+		x := float64(i) - mid
+		h := 2 * fc
+		if x != 0 {
+			h = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(taps-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(taps-1))
+		coefs[i] = h * w
+		sum += coefs[i]
+	}
+	
+	f := &filter{tables: make([][256]float64, taps/8)}
+	for j := range f.tables {
+		for v := 0; v < 256; v++ {
+			var acc float64
+			for b := 0; b < 8; b++ {
+				// 字节内高位在前, 1 表示 +1, 0 表示 -1
+				c := coefs[j*8+b] / sum
+				if v&(0x80>>b) != 0 {
+					acc += c
+				} else {
+					acc -= c
+				}
+			}
+			f.tables[j][v] = acc
+		}
+	}
+	return f
+}
+
+// size 滤波器窗口的字节数
+func (f *filter) size() int {
+	return len(f.tables)
+}
+
+// apply 计算一个窗口的输出, window 的长度为 f.size()
+func (f *filter) apply(window []byte) float64 {
+	var v float64
+	for j, b := range window[:len(f.tables)] {
+		v += f.tables[j][b]
+	}
+	return v
+}
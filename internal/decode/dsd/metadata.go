@@ -0,0 +1,80 @@
+package dsd
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	
+	"github.com/Theodoree/music_player/internal/decode/iff"
+)
+
+// Metadata DSF 的 ID3v2 标签, DFF 的 DIIN 块(DITI/DIAR)与 ID3 块
+type Metadata struct {
+	// ID3 ID3 标签, 其中的值优先于 DIIN 块
+	iff.ID3
+	
+	// 音频参数, SampleRate 为 1 位采样的采样率(如 DSD64 为 2822400), Samples 为每个声道的采样数
+	Channels   int
+	SampleRate int
+	Samples    int64
+}
+
+// ReadMetadata 读取 DSF/DFF 的元数据和音频参数, ID3 中的值优先于 DIIN 块
+func ReadMetadata(r io.ReadSeeker) (Metadata, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	m := Metadata{Channels: h.channels, SampleRate: h.sampleRate, Samples: h.bytesPerChannel * 8}
+	if h.format == formatDSF {
+		if h.metadata > 0 {
+			m.Merge(r, h.metadata, 1<<31-1)
+		}
+		return m, nil
+	}
+	
+	chunks, err := readDFFChunks(r)
+	if err != nil {
+		return m, err
+	}
+	for _, c := range chunks {
+		switch c.id {
+		case "DIIN":
+			if err := m.readDIIN(r, c); err != nil {
+				return m, err
+			}
+		case "ID3 ", "id3 ":
+			m.Merge(r, c.offset, c.size)
+		}
+	}
+	return m, nil
+}
+
+// readDIIN 读取 DFF 的 DITI(标题) 与 DIAR(艺术家)
+func (m *Metadata) readDIIN(r io.ReadSeeker, diin chunk) error {
+	chunks, err := readChunks(r, diin.offset, diin.offset+diin.size)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if c.id != "DITI" && c.id != "DIAR" {
+			continue
+		}
+		buf, err := iff.ReadChunk(r, c.offset, c.size)
+		if err != nil || len(buf) < 4 {
+			continue
+		}
+		// 4字节长度 + 文本
+		n := int(binary.BigEndian.Uint32(buf[0:4]))
+		if n > len(buf)-4 {
+			n = len(buf) - 4
+		}
+		text := strings.TrimRight(string(buf[4:4+n]), "\x00 ")
+		if c.id == "DITI" {
+			m.Title = text
+		} else {
+			m.Artist = text
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package eq
+
+import "math"
+
+// biquad RBJ Audio EQ Cookbook 中的峰值滤波器, 系数已按 a0 归一化
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+}
+
+// peaking 以 freq 为中心频率、gain(dB) 为增益的峰值滤波器
+func peaking(freq, gain, q, rate float64) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * freq / rate
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	
+	a0 := 1 + alpha/a
+	return biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+// biquadState 转置直接II型的状态, 每个声道一份
+type biquadState struct {
+	z1, z2 float64
+}
+
+func (f *biquad) process(s *biquadState, x float64) float64 {
+	y := f.b0*x + s.z1
+	s.z1 = f.b1*x - f.a1*y + s.z2
+	s.z2 = f.b2*x - f.a2*y
+	return y
+}
@@ -0,0 +1,125 @@
+// Package eq 10 段图形均衡器: ISO 倍频程中心频率上的峰值滤波器、前级增益以及防止提升后削波的限幅器
+package eq
+
+import (
+	"math"
+	
+	"github.com/faiface/beep"
+)
+
+// Bands 频段数量
+const Bands = 10
+
+// Frequencies ISO 倍频程中心频率(Hz)
+var Frequencies = [Bands]float64{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+// MaxGain 各频段与前级增益的调节范围 ±MaxGain(dB)
+const MaxGain = 12.0
+
+// q 一个倍频程带宽对应的品质因数
+const q = math.Sqrt2
+
+// nyquistRatio 中心频率超过 采样率*nyquistRatio 的频段被忽略
+const nyquistRatio = 0.45
+
+// Settings 均衡器设置, 增益单位 dB
+type Settings struct {
+	Enabled bool
+	Preamp  float64
+	Gains   [Bands]float64
+}
+
+// Preset 均衡器预设
+type Preset struct {
+	Name   string
+	Preamp float64
+	Gains  [Bands]float64
+}
+
+// Presets 内置预设, 有提升的预设用负的前级增益预留余量
+var Presets = []Preset{
+	{Name: "平直"},
+	{Name: "摇滚", Preamp: -5, Gains: [Bands]float64{5, 4, 3, 1, -1, -1, 1, 3, 4, 5}},
+	{Name: "流行", Preamp: -4, Gains: [Bands]float64{-1, 1, 3, 4, 3, 1, -1, -1, 1, 2}},
+	{Name: "人声", Preamp: -4, Gains: [Bands]float64{-3, -2, -1, 1, 3, 4, 4, 3, 1, -1}},
+	{Name: "低音增强", Preamp: -7, Gains: [Bands]float64{7, 6, 5, 3, 1, 0, 0, 0, 0, 0}},
+}
+
+// Equalizer 作用于 Streamer 的均衡器, 未启用时直接透传。
+// Set 与 Stream 不能并发调用, 播放中修改设置需与输出线程互斥
+type Equalizer struct {
+	Streamer beep.Streamer
+	rate     float64
+	settings Settings
+	preamp   float64
+	active   [Bands]bool
+	filters  [Bands]biquad
+	states   [Bands][2]biquadState
+	limiter  limiter
+}
+
+// New 创建均衡器, rate 为 Streamer 的采样率
+func New(s beep.Streamer, rate beep.SampleRate) *Equalizer {
+	e := &Equalizer{Streamer: s, rate: float64(rate), preamp: 1}
+	e.limiter = newLimiter(e.rate)
+	return e
+}
+
+// Set 更新设置, 增益超出 ±MaxGain 时被截断。
+// 保留滤波器状态, 播放中调节不会产生爆音
+func (e *Equalizer) Set(s Settings) {
+	s.Preamp = clamp(s.Preamp)
+	for i := range s.Gains {
+		s.Gains[i] = clamp(s.Gains[i])
+	}
+	e.settings = s
+	e.preamp = math.Pow(10, s.Preamp/20)
+	for i, freq := range Frequencies {
+		active := s.Gains[i] != 0 && freq < e.rate*nyquistRatio
+		if !active {
+			e.states[i] = [2]biquadState{}
+		} else {
+			e.filters[i] = peaking(freq, s.Gains[i], q, e.rate)
+		}
+		e.active[i] = active
+	}
+	if !s.Enabled {
+		e.limiter.reset()
+	}
+}
+
+// Settings 返回当前设置
+func (e *Equalizer) Settings() Settings {
+	return e.settings
+}
+
+func (e *Equalizer) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = e.Streamer.Stream(samples)
+	if !e.settings.Enabled {
+		return n, ok
+	}
+	for i := range samples[:n] {
+		for c := range samples[i] {
+			x := samples[i][c] * e.preamp
+			for b := range e.filters {
+				if e.active[b] {
+					x = e.filters[b].process(&e.states[b][c], x)
+				}
+			}
+			samples[i][c] = x
+		}
+		samples[i] = e.limiter.process(samples[i])
+	}
+	return n, ok
+}
+
+func (e *Equalizer) Err() error {
+	return e.Streamer.Err()
+}
+
+func clamp(gain float64) float64 {
+	if math.IsNaN(gain) {
+		return 0
+	}
+	return math.Max(-MaxGain, math.Min(MaxGain, gain))
+}
@@ -0,0 +1,89 @@
+package eq
+
+import (
+	"math"
+	"testing"
+	
+	"github.com/faiface/beep"
+)
+
+// sine 振幅为 amp 的立体声正弦波
+func sine(freq, amp float64, rate beep.SampleRate) beep.Streamer {
+	i := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for n := range samples {
+			v := amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+			samples[n] = [2]float64{v, v}
+			i++
+		}
+		return len(samples), true
+	})
+}
+
+// peak 跳过前 skip 个采样后, 测量 n 个采样的峰值
+func peak(s beep.Streamer, skip, n int) float64 {
+	buf := make([][2]float64, skip+n)
+	s.Stream(buf)
+	var p float64
+	for _, v := range buf[skip:] {
+		p = math.Max(p, math.Max(math.Abs(v[0]), math.Abs(v[1])))
+	}
+	return p
+}
+
+func TestEqualizerBand(t *testing.T) {
+	const rate = 44100
+	// 1kHz 频段 +6dB, 1kHz 正弦波提升约一倍, 远离的 31Hz 频段几乎不受影响
+	var s Settings
+	s.Enabled = true
+	s.Gains[5] = 6
+	e := New(sine(1000, 0.1, rate), rate)
+	e.Set(s)
+	if p := peak(e, rate/10, rate/10); math.Abs(p-0.1995) > 0.005 {
+		t.Fatalf("1kHz peak = %v", p)
+	}
+	e = New(sine(31, 0.1, rate), rate)
+	e.Set(s)
+	if p := peak(e, rate/2, rate/2); math.Abs(p-0.1) > 0.002 {
+		t.Fatalf("31Hz peak = %v", p)
+	}
+	
+	// 未启用时透传
+	s.Enabled = false
+	e = New(sine(1000, 0.1, rate), rate)
+	e.Set(s)
+	if p := peak(e, 0, rate/10); math.Abs(p-0.1) > 1e-5 {
+		t.Fatalf("disabled peak = %v", p)
+	}
+}
+
+func TestEqualizerLimiter(t *testing.T) {
+	const rate = 48000
+	var s Settings
+	s.Enabled = true
+	s.Preamp = MaxGain
+	for i := range s.Gains {
+		s.Gains[i] = MaxGain
+	}
+	e := New(sine(440, 0.9, rate), rate)
+	e.Set(s)
+	if p := peak(e, 0, rate); p > threshold+1e-12 {
+		t.Fatalf("limited peak = %v", p)
+	}
+}
+
+func TestEqualizerNyquist(t *testing.T) {
+	// 22.05kHz 采样率下 16kHz 频段超出范围, 被忽略
+	const rate = 22050
+	var s Settings
+	s.Enabled = true
+	s.Gains[9] = MaxGain
+	e := New(sine(1000, 0.1, rate), rate)
+	e.Set(s)
+	if e.active[9] {
+		t.Fatal("16kHz band should be inactive")
+	}
+	if p := peak(e, 0, rate/10); math.Abs(p-0.1) > 1e-5 {
+		t.Fatalf("peak = %v", p)
+	}
+}
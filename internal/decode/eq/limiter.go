@@ -0,0 +1,36 @@
+package eq
+
+import "math"
+
+// threshold 限幅器输出的最大幅度, 略低于满刻度
+const threshold = 0.98
+
+// releaseTime 限幅后增益恢复的时间常数(秒)
+const releaseTime = 0.2
+
+// limiter 瞬时启动、指数释放的峰值限幅器, 两个声道共用增益, 输出不会超过 threshold
+type limiter struct {
+	gain    float64
+	release float64
+}
+
+func newLimiter(rate float64) limiter {
+	return limiter{gain: 1, release: 1 - math.Exp(-1/(releaseTime*rate))}
+}
+
+func (l *limiter) process(s [2]float64) [2]float64 {
+	target := 1.0
+	if peak := math.Max(math.Abs(s[0]), math.Abs(s[1])); peak > threshold {
+		target = threshold / peak
+	}
+	if target < l.gain {
+		l.gain = target
+	} else {
+		l.gain += (target - l.gain) * l.release
+	}
+	return [2]float64{s[0] * l.gain, s[1] * l.gain}
+}
+
+func (l *limiter) reset() {
+	l.gain = 1
+}
@@ -0,0 +1,17 @@
+package decode
+
+import (
+	"github.com/Theodoree/music_player/internal/decode/eq"
+)
+
+// SetEqualizer 设置均衡器, 对正在播放和预加载的音乐立即生效
+func SetEqualizer(s eq.Settings) {
+	_output.lock()
+	defer _output.unlock()
+	_output.eq = s
+	for _, d := range append([]*beepDecoder{_output.cur, _output.next}, _output.fading...) {
+		if d != nil {
+			d.eq.Set(s)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package decode
+
+import (
+	"context"
+	"io"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+)
+
+// Export 把音乐中 [start,end) 之间的部分转码写入 w, end<=0 表示到结尾; 不经过均衡器、变速等播放效果,
+// 采样率不同时重采样。不会关闭 reader
+func Export(ctx context.Context, Type model.MusicType, reader io.ReadSeeker, start, end time.Duration, w io.WriteSeeker, opts encode.Options, tags encode.Tags) error {
+	streamer, format, err := openRegion(reader, Type, start, end)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = streamer.Close()
+	}()
+	
+	rate := opts.SampleRate
+	if rate == 0 {
+		rate = format.SampleRate
+	}
+	var s beep.Streamer = streamer
+	if rate != format.SampleRate {
+		s = beep.Resample(resampleQuality, format.SampleRate, rate, s)
+	}
+	return encode.Encode(ctx, w, s, rate, opts.BitDepthFor(format.Precision), opts.Format, tags)
+}
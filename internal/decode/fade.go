@@ -0,0 +1,75 @@
+package decode
+
+import (
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+// fadeDuration 暂停、播放、停止和手动切歌时的淡入淡出时长
+const fadeDuration = time.Millisecond * 150
+
+// fader 按采样线性调整增益, 用于淡入淡出和交叉淡化
+type fader struct {
+	Streamer beep.Streamer
+	gain     float64
+	target   float64
+	step     float64
+	// onDone 增益到达目标时调用一次, 调用时已持有 输出锁
+	onDone func()
+}
+
+// to 在n个采样内把增益调整到target, 调用方需持有 输出锁
+func (f *fader) to(target float64, n int, onDone func()) {
+	f.target = target
+	f.onDone = onDone
+	if n <= 0 {
+		f.gain = target
+		f.step = 0
+		f.reached()
+		return
+	}
+	f.step = (target - f.gain) / float64(n)
+	if f.step == 0 {
+		f.reached()
+	}
+}
+
+func (f *fader) reached() {
+	if f.onDone == nil {
+		return
+	}
+	fn := f.onDone
+	f.onDone = nil
+	fn()
+}
+
+func (f *fader) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = f.Streamer.Stream(samples)
+	for i := range samples[:n] {
+		if f.gain != f.target {
+			f.gain += f.step
+			if (f.step > 0 && f.gain >= f.target) || (f.step < 0 && f.gain <= f.target) || f.step == 0 {
+				f.gain = f.target
+				f.reached()
+			}
+		}
+		samples[i][0] *= f.gain
+		samples[i][1] *= f.gain
+	}
+	return n, ok
+}
+
+func (f *fader) Err() error {
+	return f.Streamer.Err()
+}
+
+// SetCrossfade 设置自动切歌时的交叉淡化时长, 0 表示无缝衔接
+func SetCrossfade(d time.Duration) {
+	_output.lock()
+	defer _output.unlock()
+	if d < 0 {
+		d = 0
+	}
+	_output.crossfade = d
+}
@@ -0,0 +1,78 @@
+// Package iff AIFF、DFF 等由块组成的文件共用的读取函数: 有长度上限的块读取和 ID3 块的标签
+package iff
+
+import (
+	"errors"
+	"io"
+	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/dhowden/tag"
+)
+
+var ErrChunkSize = errors.New("iff: chunk size exceeds file")
+
+// ReadChunk 读取从 offset 开始的 size 字节。
+// size 直接来自文件, 超过文件剩余长度时返回 ErrChunkSize, 不按损坏的长度分配内存
+func ReadChunk(r io.ReadSeeker, offset, size int64) ([]byte, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || size < 0 || offset > end || size > end-offset {
+		return nil, ErrChunkSize
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ID3 ID3 块中的标签
+type ID3 struct {
+	Title  string
+	Artist string
+	Album  string
+	// ReplayGain ID3 中的 ReplayGain 标签
+	ReplayGain replaygain.Info
+	// Tags ID3 中的全部标签, 没有 ID3 块时为 nil
+	Tags tag.Metadata
+}
+
+// Merge 读取从 offset 开始最多 size 字节的 ID3v2 标签, 用其中的值覆盖已有的值; 无法解析时不做修改
+func (m *ID3) Merge(r io.ReadSeeker, offset, size int64) {
+	id3, err := tag.ReadID3v2Tags(io.NewSectionReader(readerAt{r}, offset, size))
+	if err != nil {
+		return
+	}
+	if id3.Title() != "" {
+		m.Title = id3.Title()
+	}
+	if id3.Artist() != "" {
+		m.Artist = id3.Artist()
+	}
+	if id3.Album() != "" {
+		m.Album = id3.Album()
+	}
+	m.ReplayGain = replaygain.FromTags(id3.Raw())
+	m.Tags = id3
+}
+
+// readerAt 用 io.ReadSeeker 实现 io.ReaderAt, 不可并发使用
+type readerAt struct {
+	r io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
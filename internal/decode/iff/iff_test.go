@@ -0,0 +1,20 @@
+package iff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestReadChunk(t *testing.T) {
+	r := bytes.NewReader([]byte("0123456789"))
+	if buf, err := ReadChunk(r, 2, 8); err != nil || string(buf) != "23456789" {
+		t.Fatalf("ReadChunk = %q, %v", buf, err)
+	}
+	// 损坏的长度超过文件剩余长度
+	for _, c := range [][2]int64{{2, 9}, {11, 0}, {0, 1<<32 - 1}, {0, -1}} {
+		if _, err := ReadChunk(r, c[0], c[1]); !errors.Is(err, ErrChunkSize) {
+			t.Errorf("ReadChunk(%d, %d) err = %v", c[0], c[1], err)
+		}
+	}
+}
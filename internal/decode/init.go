@@ -2,27 +2,51 @@ package decode
 
 import (
 	"context"
-	"errors"
 	"github.com/Theodoree/music_player/internal/music"
 	"io"
+	"os"
 	"time"
 	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
 	"github.com/Theodoree/music_player/internal/model"
+	"github.com/dhowden/tag"
 )
 
+// Metadata 音乐文件的标签、内嵌图片和音频参数
 type Metadata struct {
 	// 音乐名
 	Title string
 	// 歌手名
 	Artist string
+	// 专辑歌手, 合辑中通常与 Artist 不同
+	AlbumArtist string
 	// 专辑名称
-	Album string
-	// 专辑页面(BASE64)
-	AlbumPicture string
-	// 专辑页面类型
-	MimeType string
-	// 结束时间
-	EndTime time.Duration
+	Album    string
+	Composer string
+	Genre    string
+	Year     int
+	// 音轨号和碟号, Total 为 0 表示未知
+	Track      int
+	TrackTotal int
+	Disc       int
+	DiscTotal  int
+	// Lyrics 内嵌的歌词
+	Lyrics string
+	// Pictures 内嵌的全部图片, 按文件中的顺序
+	Pictures []tag.Picture
+	// ReplayGain 标签中的响度增益
+	ReplayGain replaygain.Info
+	
+	// Codec 编码, 例如 MP3、FLAC、PCM
+	Codec string
+	// Bitrate 平均码率(bps)
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	// BitDepth 每个采样的位数, 有损编码为 0
+	BitDepth int
+	// Duration 时长
+	Duration time.Duration
 }
 
 type Decoder interface {
@@ -36,28 +60,46 @@ type Decoder interface {
 	SetVolume(f float64)
 	// Metadata 获取音乐元数据
 	Metadata() (Metadata, error)
-	// CurTime 获取当前播放时间
+	// CurTime 获取当前播放时间, 为媒体时间, 不受播放速度影响
 	CurTime() time.Duration
-	// EndTime 获取音乐结束时间
+	// EndTime 获取音乐结束时间(媒体时间)
 	EndTime() time.Duration
 	// Seek 跳转到指定百分比[0,100]
 	Seek(f float64)
+	// SeekTime 跳转到指定时间
+	SeekTime(t time.Duration)
+	// SetLoop 在 [a,b) 之间循环播放, b<=a 时取消循环
+	SetLoop(a, b time.Duration)
+	// SetTrim 只播放 [start,end) 之间的部分, 以文件开头为准, end<=0 表示到结尾。
+	// 设置后 CurTime、EndTime、Seek 都相对于裁剪后的范围
+	SetTrim(start, end time.Duration)
+	// Prepare 预加载, 挂到当前播放的音乐之后无缝播放, 无法拼接时返回false
+	Prepare() bool
+	// SetReplayGain 设置音乐的响度增益, 按 SetReplayGainMode 设置的模式生效
+	SetReplayGain(info replaygain.Info)
+	// SetSpeed 设置播放速度[0.5,2], 音调不变
+	SetSpeed(speed float64)
+	// SetPitch 设置变调的半音数[-12,12], 速度不变
+	SetPitch(semitones float64)
 }
 
-// FLAC、MP3、WAV decoder power by @github.com/faiface/beep
+// FLAC、MP3、WAV、OGG decoder power by @github.com/faiface/beep, AIFF decoder by internal/decode/aiff,
+// M4A(ALAC) decoder by internal/decode/alac, DSF/DFF decoder by internal/decode/dsd
 func NewDecoder(ctx context.Context, MusicType model.MusicType, reader io.ReadSeekCloser, volume float64, cb *music.Callback) (Decoder, error) {
-	switch MusicType {
-	case model.MusicTypeFLAC:
-		return newFLACDecoder(ctx, reader, volume, cb)
-	case model.MusicTypeMP3:
-		return newMP3Decoder(ctx, reader, volume, cb)
-	case model.MusicTypeWAV:
-		return newWAVDecoder(ctx, reader, volume, cb)
-	default:
-		return nil, errors.New("unhandled default case")
+	if _, ok := Lookup(MusicType); !ok {
+		return nil, ErrUnknownType
 	}
+	return newBeepDecoder(ctx, reader, volume, cb, MusicType)
 }
 
-func GetMetadata(filepath string, MusicType model.MusicType) Metadata {
-	return Metadata{}
+// GetMetadata 读取音乐文件的元数据, 见 ReadMetadata
+func GetMetadata(path string, MusicType model.MusicType) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return ReadMetadata(f, MusicType)
 }
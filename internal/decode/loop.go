@@ -0,0 +1,54 @@
+package decode
+
+import (
+	"time"
+	
+	"github.com/faiface/beep"
+	"k8s.io/klog"
+)
+
+// minLoopDuration A-B 循环的最短时长
+const minLoopDuration = time.Millisecond * 100
+
+// looper 播放到 b 时跳回 a, b<=a 时不循环; 字段由 输出锁保护。
+// 位于变速之前, 跳转点两侧的音频对变速来说是连续的
+type looper struct {
+	beep.StreamSeeker
+	a, b int
+}
+
+func (l *looper) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		chunk := samples[n:]
+		if l.b > l.a {
+			pos := l.Position()
+			if pos >= l.b {
+				if err := l.Seek(l.a); err != nil {
+					klog.Error(err)
+					l.a, l.b = 0, 0
+					continue
+				}
+				pos = l.a
+			}
+			chunk = chunk[:min(len(chunk), l.b-pos)]
+		}
+		sn, sok := l.StreamSeeker.Stream(chunk)
+		n += sn
+		if !sok || sn == 0 {
+			return n, n > 0
+		}
+	}
+	return n, true
+}
+
+// SetLoop 在 [a,b) 之间循环播放, b<=a 时取消循环
+func (d *beepDecoder) SetLoop(a, b time.Duration) {
+	_output.lock()
+	defer _output.unlock()
+	if b-a < minLoopDuration {
+		d.loop.a, d.loop.b = 0, 0
+		return
+	}
+	d.loop.a = max(d.format.SampleRate.N(a), 0)
+	d.loop.b = min(d.format.SampleRate.N(b), d.streamer.Len())
+}
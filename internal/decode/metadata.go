@@ -1,50 +1,366 @@
 package decode
 
 import (
-	"encoding/base64"
-	"errors"
-	"github.com/dhowden/tag"
-	"github.com/go-audio/wav"
+	"bytes"
+	"encoding/binary"
 	"io"
+	"sort"
+	"strconv"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/aiff"
+	"github.com/Theodoree/music_player/internal/decode/alac"
+	"github.com/Theodoree/music_player/internal/decode/charset"
+	"github.com/Theodoree/music_player/internal/decode/dsd"
+	"github.com/Theodoree/music_player/internal/decode/iff"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+	gowav "github.com/go-audio/wav"
+	mflac "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
 )
 
-// support MP3 M4A M4B M4P ALAC FLAC OGG DSF
-func getTagMetadata(r io.ReadSeeker) (Metadata, error) {
-	decoder, err := tag.ReadFrom(r)
+// ReadMetadata 读取标签、内嵌图片和音频参数, 不解码音频数据(MP3 需要扫描所有帧计算时长)。
+// 没有标签或标签损坏时只返回音频参数, 音频参数读取失败时返回错误
+func ReadMetadata(r io.ReadSeeker, MusicType model.MusicType) (Metadata, error) {
+	c, ok := Lookup(MusicType)
+	if !ok {
+		return Metadata{}, ErrUnknownType
+	}
+	m, err := c.Metadata(r)
 	if err != nil {
 		return Metadata{}, err
 	}
 	
+	// 没有码率信息的按文件大小估算, 包含了标签和封面的大小
+	if m.Bitrate == 0 && m.Duration > 0 {
+		if size, err := r.Seek(0, io.SeekEnd); err == nil {
+			m.Bitrate = int(float64(size*8) / m.Duration.Seconds())
+		}
+	}
+	return m, nil
+}
+
+// ReadLyrics 读取内嵌的歌词(ID3 USLT 帧、Vorbis LYRICS 注释等); MP3 只读取标签, 不扫描音频帧
+func ReadLyrics(r io.ReadSeeker, MusicType model.MusicType) (string, error) {
+	if MusicType == model.MusicTypeMP3 {
+		return getTagMetadata(r).Lyrics, nil
+	}
+	m, err := ReadMetadata(r, MusicType)
+	return m.Lyrics, err
+}
+
+// getTagMetadata 用 tag 读取 MP3 M4A FLAC OGG DSF 的标签, 没有标签时返回空的 Metadata
+func getTagMetadata(r io.ReadSeeker) Metadata {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}
+	}
+	t, err := tag.ReadFrom(r)
+	if err != nil {
+		return Metadata{}
+	}
+	return fromTags(t)
+}
+
+// fromTags 把 tag 的标签转换为 Metadata, t 为 nil 时返回空的 Metadata
+func fromTags(t tag.Metadata) Metadata {
 	var m Metadata
-	m.Title = decoder.Title()
-	m.Artist = decoder.Artist()
-	m.Album = decoder.Album()
-	pic := decoder.Picture()
-	if pic != nil {
-		m.AlbumPicture = base64.StdEncoding.EncodeToString(pic.Data)
-		m.MimeType = pic.MIMEType
+	if t == nil {
+		return m
+	}
+	m.Title = t.Title()
+	m.Artist = t.Artist()
+	m.AlbumArtist = t.AlbumArtist()
+	m.Album = t.Album()
+	m.Composer = t.Composer()
+	m.Genre = t.Genre()
+	m.Year = t.Year()
+	m.Track, m.TrackTotal = t.Track()
+	m.Disc, m.DiscTotal = t.Disc()
+	m.Lyrics = t.Lyrics()
+	m.ReplayGain = replaygain.FromTags(t.Raw())
+	
+	// Picture 只返回一张, ID3 的多个 APIC 帧在 Raw 中, 重复的帧名带有 _0、_1 后缀
+	raw := t.Raw()
+	keys := make([]string, 0, len(raw))
+	for k, v := range raw {
+		if _, ok := v.(*tag.Picture); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.Pictures = append(m.Pictures, *raw[k].(*tag.Picture))
+	}
+	if len(m.Pictures) == 0 {
+		if pic := t.Picture(); pic != nil {
+			m.Pictures = append(m.Pictures, *pic)
+		}
+	}
+	return m
+}
+
+// FixCharset 按编码 c 转换标签中读取错误的文字, 见 charset.Fix. 读取时不转换,
+// 自动识别错误后可以用表格指定的编码重新转换
+func (m *Metadata) FixCharset(c model.Charset) {
+	for _, s := range []*string{&m.Title, &m.Artist, &m.AlbumArtist, &m.Album, &m.Composer, &m.Genre, &m.Lyrics} {
+		*s = charset.Fix(*s, c)
+	}
+}
+
+// Cover 正面封面, 没有时返回第一张图片; 没有图片时返回 nil
+func (m *Metadata) Cover() *tag.Picture {
+	for i := range m.Pictures {
+		if m.Pictures[i].Type == pictureTypes[3] {
+			return &m.Pictures[i]
+		}
+	}
+	if len(m.Pictures) > 0 {
+		return &m.Pictures[0]
+	}
+	return nil
+}
+
+func getMP3Metadata(r io.ReadSeeker) (Metadata, error) {
+	m := getTagMetadata(r)
+	frame, err := mp3FirstFrame(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
+	}
+	streamer, format, err := mp3.Decode(nopCloser{r})
+	if err != nil {
+		return Metadata{}, err
 	}
+	m.Codec = "MP3"
+	m.SampleRate = int(format.SampleRate)
+	m.Channels = frame.channels
+	m.Duration = format.SampleRate.D(streamer.Len())
 	return m, nil
 }
 
+// getFLACMetadata tag 只保留最后一个 PICTURE 块, 图片和音频参数从元数据块中读取
 func getFLACMetadata(r io.ReadSeeker) (Metadata, error) {
-	return getTagMetadata(r)
+	m := getTagMetadata(r)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
+	}
+	flacMu.Lock()
+	stream, err := mflac.Parse(r)
+	flacMu.Unlock()
+	if err != nil {
+		return Metadata{}, err
+	}
+	info := stream.Info
+	m.Codec = "FLAC"
+	m.SampleRate = int(info.SampleRate)
+	m.Channels = int(info.NChannels)
+	m.BitDepth = int(info.BitsPerSample)
+	if info.SampleRate > 0 {
+		m.Duration = time.Duration(float64(info.NSamples) / float64(info.SampleRate) * float64(time.Second))
+	}
+	
+	var pictures []tag.Picture
+	for _, block := range stream.Blocks {
+		pic, ok := block.Body.(*meta.Picture)
+		if !ok {
+			continue
+		}
+		p := tag.Picture{MIMEType: pic.MIME, Type: pictureTypes[0], Description: pic.Desc, Data: pic.Data}
+		if int(pic.Type) < len(pictureTypes) {
+			p.Type = pictureTypes[pic.Type]
+		}
+		pictures = append(pictures, p)
+	}
+	if len(pictures) > 0 {
+		m.Pictures = pictures
+	}
+	return m, nil
 }
 
-func getMP3Metadata(r io.ReadSeeker) (Metadata, error) {
-	return getTagMetadata(r)
+// pictureTypes FLAC PICTURE 块和 ID3 APIC 帧的图片类型, 与 tag 中的名称相同
+var pictureTypes = []string{
+	"Other",
+	"32x32 pixels 'file icon' (PNG only)",
+	"Other file icon",
+	"Cover (front)",
+	"Cover (back)",
+	"Leaflet page",
+	"Media (e.g. lable side of CD)",
+	"Lead artist/lead performer/soloist",
+	"Artist/performer",
+	"Conductor",
+	"Band/Orchestra",
+	"Composer",
+	"Lyricist/text writer",
+	"Recording Location",
+	"During recording",
+	"During performance",
+	"Movie/video screen capture",
+	"A bright coloured fish",
+	"Illustration",
+	"Band/artist logotype",
+	"Publisher/Studio logotype",
+}
+
+func getOGGMetadata(r io.ReadSeeker) (Metadata, error) {
+	m := getTagMetadata(r)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
+	}
+	streamer, format, err := vorbis.Decode(nopCloser{r})
+	if err != nil {
+		return Metadata{}, err
+	}
+	m.Codec = "Vorbis"
+	m.SampleRate = int(format.SampleRate)
+	m.Channels = format.NumChannels
+	m.Duration = format.SampleRate.D(streamer.Len())
+	return m, nil
+}
+
+// getM4AMetadata 只支持 ALAC 编码, AAC 返回 alac.ErrUnsupportedCodec
+func getM4AMetadata(r io.ReadSeeker) (Metadata, error) {
+	m := getTagMetadata(r)
+	cfg, frames, err := alac.ReadConfig(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	m.Codec = "ALAC"
+	m.Bitrate = int(cfg.AvgBitRate)
+	m.SampleRate = int(cfg.SampleRate)
+	m.Channels = int(cfg.NumChannels)
+	m.BitDepth = int(cfg.BitDepth)
+	if cfg.SampleRate > 0 {
+		m.Duration = time.Duration(float64(frames) / float64(cfg.SampleRate) * float64(time.Second))
+	}
+	return m, nil
+}
+
+// getAIFFMetadata AIFF 不在 tag 的支持范围内, 由 aiff 包读取文本块、ID3 块和 COMM 块
+func getAIFFMetadata(r io.ReadSeeker) (Metadata, error) {
+	meta, err := aiff.ReadMetadata(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if meta.SampleRate == 0 {
+		return Metadata{}, aiff.ErrNoCommonChunk
+	}
+	// ID3 块中已有的值优先, 文本块只补充空的字段
+	m := fromTags(meta.Tags)
+	m.Title = firstOf(m.Title, meta.Title)
+	m.Artist = firstOf(m.Artist, meta.Artist)
+	m.Album = firstOf(m.Album, meta.Album)
+	m.ReplayGain = meta.ReplayGain
+	m.Codec = "PCM"
+	m.SampleRate = meta.SampleRate
+	m.Channels = meta.Channels
+	m.BitDepth = meta.BitDepth
+	m.Bitrate = meta.SampleRate * meta.Channels * meta.BitDepth
+	m.Duration = time.Duration(float64(meta.Frames) / float64(meta.SampleRate) * float64(time.Second))
+	return m, nil
 }
 
+// getDSDMetadata tag 只认识 DSF, DSF 与 DFF 都由 dsd 包读取
+func getDSDMetadata(r io.ReadSeeker) (Metadata, error) {
+	meta, err := dsd.ReadMetadata(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	m := fromTags(meta.Tags)
+	m.Title = meta.Title
+	m.Artist = meta.Artist
+	m.Album = meta.Album
+	m.ReplayGain = meta.ReplayGain
+	m.Codec = "DSD"
+	m.SampleRate = meta.SampleRate
+	m.Channels = meta.Channels
+	m.BitDepth = 1
+	m.Bitrate = meta.SampleRate * meta.Channels
+	if meta.SampleRate > 0 {
+		m.Duration = time.Duration(float64(meta.Samples) / float64(meta.SampleRate) * float64(time.Second))
+	}
+	return m, nil
+}
+
+// getWAVMetadata 标签来自 id3 块和 LIST/INFO 块, id3 块中的值优先
 func getWAVMetadata(r io.ReadSeeker) (Metadata, error) {
-	decoder := wav.NewDecoder(r)
-	if decoder == nil {
-		return Metadata{}, errors.New("wav decoder is nil")
+	m := fromTags(wavID3(r))
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
 	}
-	
+	decoder := gowav.NewDecoder(r)
 	decoder.ReadMetadata()
-	var m Metadata
-	m.Title = decoder.Metadata.Title
-	m.Artist = decoder.Metadata.Artist
-	m.Album = decoder.Metadata.Product
+	if info := decoder.Metadata; info != nil {
+		track, _ := strconv.Atoi(info.TrackNbr)
+		m.Title = firstOf(m.Title, info.Title)
+		m.Artist = firstOf(m.Artist, info.Artist)
+		m.Album = firstOf(m.Album, info.Product)
+		m.Genre = firstOf(m.Genre, info.Genre)
+		if m.Track == 0 {
+			m.Track = track
+		}
+	}
+	
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Metadata{}, err
+	}
+	streamer, format, err := wav.Decode(r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	m.Codec = "PCM"
+	m.SampleRate = int(format.SampleRate)
+	m.Channels = format.NumChannels
+	m.BitDepth = format.Precision * 8
+	m.Bitrate = m.SampleRate * m.Channels * m.BitDepth
+	m.Duration = format.SampleRate.D(streamer.Len())
 	return m, nil
 }
+
+// wavID3 RIFF 中 id3 块的标签, 没有时返回 nil
+func wavID3(r io.ReadSeeker) tag.Metadata {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return nil
+	}
+	for {
+		var head [8]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil
+		}
+		size := int64(binary.LittleEndian.Uint32(head[4:8]))
+		if id := string(head[:4]); id == "id3 " || id == "ID3 " {
+			offset, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil
+			}
+			buf, err := iff.ReadChunk(r, offset, size)
+			if err != nil {
+				return nil
+			}
+			t, err := tag.ReadID3v2Tags(bytes.NewReader(buf))
+			if err != nil {
+				return nil
+			}
+			return t
+		}
+		if _, err := r.Seek(size+size&1, io.SeekCurrent); err != nil {
+			return nil
+		}
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
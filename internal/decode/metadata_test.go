@@ -0,0 +1,60 @@
+package decode
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+)
+
+func TestGetMetadata(t *testing.T) {
+	tags := encode.Tags{Title: "Title", Artist: "Artist", Album: "Album", Track: 3}
+	for _, tc := range []struct {
+		format   encode.Format
+		typ      model.MusicType
+		codec    string
+		bitDepth int
+	}{
+		{encode.FormatWAV, model.MusicTypeWAV, "PCM", 24},
+		{encode.FormatFLAC, model.MusicTypeFLAC, "FLAC", 16},
+	} {
+		path := filepath.Join(t.TempDir(), "a"+tc.format.Ext())
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := encode.Encode(context.Background(), f, beep.Silence(48000*2), 48000, tc.bitDepth, tc.format, tags); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		
+		m, err := GetMetadata(path, tc.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Title != "Title" || m.Artist != "Artist" || m.Album != "Album" || m.Track != 3 {
+			t.Errorf("%s: tags = %+v", tc.codec, m)
+		}
+		if m.Codec != tc.codec || m.SampleRate != 48000 || m.Channels != 2 || m.BitDepth != tc.bitDepth || m.Bitrate == 0 {
+			t.Errorf("%s: codec = %s, rate = %d, channels = %d, bit depth = %d, bitrate = %d",
+				tc.codec, m.Codec, m.SampleRate, m.Channels, m.BitDepth, m.Bitrate)
+		}
+		if m.Duration != 2*time.Second {
+			t.Errorf("%s: duration = %v", tc.codec, m.Duration)
+		}
+	}
+}
+
+// TestWAVID3Corrupt id3 块的长度损坏时不按这个长度分配内存
+func TestWAVID3Corrupt(t *testing.T) {
+	file := []byte("RIFF\x00\x00\x00\x00WAVEid3 \xf0\xff\xff\xffID3")
+	if tags := wavID3(bytes.NewReader(file)); tags != nil {
+		t.Fatalf("tags = %v", tags)
+	}
+}
@@ -0,0 +1,268 @@
+package decode
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/decode/spectrum"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"k8s.io/klog"
+)
+
+// outputSampleRate 输出设备的固定采样率, 所有解码器都会被重采样到该采样率
+const outputSampleRate = beep.SampleRate(44100)
+
+// resampleQuality beep.Resample 的插值质量
+const resampleQuality = 4
+
+// output 是全局唯一的混音器, 输出后端只在第一次播放时以 outputSampleRate 打开一次。
+// 每个解码器经过重采样后接入混音器, 音量等效果作用于混音后的输出。
+// 当前解码器播放结束时, 若已经挂上了下一个解码器, 会在同一次 Stream 调用内无缝衔接;
+// 设置了交叉淡化时, 下一首会在当前音乐结束前 crossfade 时长开始淡入, 当前音乐同时淡出。
+//
+// 各场景的淡入淡出:
+//   - 自动切歌: crossfade > 0 时交叉淡化, 否则无缝衔接
+//   - 单曲循环: 同一首无法与自己重叠, 播完后直接从头播放, 不淡入
+//   - 手动上一首/下一首/停止: 当前音乐在 fadeDuration 内淡出, 新的音乐同时淡入
+//   - 暂停/播放: 在 fadeDuration 内淡出后暂停 / 恢复后淡入
+//
+// 除 out、started 和 spectrum 外的所有字段都由输出后端的锁保护。
+type output struct {
+	// out 输出后端, 只能在第一次播放前通过 SetOutput 替换
+	out       Output
+	initOnce  sync.Once
+	started   atomic.Bool
+	crossfade time.Duration
+	// gainMode 响度归一化模式
+	gainMode replaygain.Mode
+	// eq 均衡器设置, 新的解码器创建时使用
+	eq eq.Settings
+	// speed 播放速度, pitch 变调的半音数, 新的解码器创建时使用
+	speed float64
+	pitch float64
+	// volume 主音量, 作用于混音后的输出
+	volume *effects.Volume
+	cur    *beepDecoder
+	next   *beepDecoder
+	// fading 正在淡出的解码器, 淡出结束或播放结束后关闭
+	fading []*beepDecoder
+	buf    [][2]float64
+	// spectrum 分析混音后、主音量之前的输出, 有自己的锁
+	spectrum *spectrum.Analyzer
+}
+
+var _output = output{out: defaultOutput(), volume: &effects.Volume{Base: 2}, speed: 1, spectrum: spectrum.New(outputSampleRate)}
+
+func init() {
+	_output.volume.Streamer = &_output
+}
+
+// init 打开输出后端, 只会执行一次
+func (o *output) init() {
+	o.initOnce.Do(func() {
+		o.started.Store(true)
+		if err := o.out.Init(outputSampleRate, o.volume); err != nil {
+			klog.Error(err)
+		}
+	})
+}
+
+// lock 与输出线程互斥, 持有期间后端不会拉取采样
+func (o *output) lock() {
+	o.out.Lock()
+}
+
+func (o *output) unlock() {
+	o.out.Unlock()
+}
+
+// resample 把解码器的输出重采样到设备采样率
+func (o *output) resample(s beep.Streamer, from beep.SampleRate) beep.Streamer {
+	if from == outputSampleRate {
+		return s
+	}
+	return beep.Resample(resampleQuality, from, outputSampleRate, s)
+}
+
+// SetVolume 设置混音器的主音量[0,1]
+func SetVolume(f float64) {
+	_output.lock()
+	defer _output.unlock()
+	if f > 1 {
+		f = 1
+	}
+	if f < 0 {
+		f = 0
+	}
+	
+	_output.volume.Volume = _volume[int(f*100)]
+}
+
+// play 将解码器设为当前播放项, 如果它已经是当前项则什么都不做
+func (o *output) play(d *beepDecoder) {
+	o.init()
+	_output.lock()
+	defer _output.unlock()
+	if o.cur == d {
+		return
+	}
+	// 正在替换其他音乐(手动切歌), 淡入
+	if o.cur != nil || len(o.fading) > 0 {
+		d.fader.gain = 0
+		d.fader.to(1, d.format.SampleRate.N(fadeDuration), nil)
+	}
+	if o.cur != nil {
+		o.fadeOut(o.cur, fadeDuration)
+	}
+	o.cur, o.next = d, nil
+}
+
+// enqueue 把解码器挂到当前播放项之后, 当前没有音乐在播放时返回false
+func (o *output) enqueue(d *beepDecoder) bool {
+	_output.lock()
+	defer _output.unlock()
+	if o.cur == nil || o.cur == d {
+		return false
+	}
+	o.next = d
+	return true
+}
+
+// stop 淡出并停止解码器, 解码器不在播放时返回false, 由调用方直接关闭
+func (o *output) stop(d *beepDecoder) bool {
+	_output.lock()
+	defer _output.unlock()
+	if slices.Contains(o.fading, d) {
+		return true
+	}
+	if o.cur != d || d.ctrl.Paused {
+		return false
+	}
+	o.cur = nil
+	o.fadeOut(d, fadeDuration)
+	return true
+}
+
+// hurry 让正在淡出的解码器在 fadeDuration 内结束, 用于暂停
+func (o *output) hurry() {
+	_output.lock()
+	defer _output.unlock()
+	for _, f := range o.fading {
+		if f.fader.step < 0 && f.fader.gain/-f.fader.step <= float64(f.format.SampleRate.N(fadeDuration)) {
+			continue
+		}
+		o.fadeOut(f, fadeDuration)
+	}
+}
+
+// fadeOut 调用方需持有 输出锁
+func (o *output) fadeOut(d *beepDecoder, duration time.Duration) {
+	if !slices.Contains(o.fading, d) {
+		o.fading = append(o.fading, d)
+	}
+	d.fader.to(0, d.format.SampleRate.N(duration), func() {
+		o.remove(d)
+	})
+}
+
+// remove 从淡出列表中移除并关闭, 调用方需持有 输出锁
+func (o *output) remove(d *beepDecoder) {
+	if !slices.Contains(o.fading, d) {
+		return
+	}
+	o.fading = slices.DeleteFunc(o.fading, func(f *beepDecoder) bool {
+		return f == d
+	})
+	go d.Close()
+}
+
+// detach 将解码器从播放流中移除
+func (o *output) detach(d *beepDecoder) {
+	_output.lock()
+	defer _output.unlock()
+	if o.cur == d {
+		o.cur = nil
+	}
+	if o.next == d {
+		o.next = nil
+	}
+	o.fading = slices.DeleteFunc(o.fading, func(f *beepDecoder) bool {
+		return f == d
+	})
+}
+
+// Stream Implementation beep.Streamer, 调用方(输出后端)已持有锁
+func (o *output) Stream(samples [][2]float64) (n int, ok bool) {
+	o.crossfadeNext()
+	n = o.streamCur(samples)
+	for i := range samples[n:] {
+		samples[n+i] = [2]float64{}
+	}
+	
+	// 叠加正在淡出的音乐
+	if len(o.fading) > 0 {
+		if cap(o.buf) < len(samples) {
+			o.buf = make([][2]float64, len(samples))
+		}
+		buf := o.buf[:len(samples)]
+		for _, f := range slices.Clone(o.fading) {
+			fn, fok := f.out.Stream(buf)
+			for i := range buf[:fn] {
+				samples[i][0] += buf[i][0]
+				samples[i][1] += buf[i][1]
+			}
+			if !fok || fn < len(buf) {
+				o.remove(f)
+			}
+		}
+	}
+	o.spectrum.Write(samples)
+	return len(samples), true
+}
+
+// streamCur 播放当前音乐, 结束时切换到预加载的下一首
+func (o *output) streamCur(samples [][2]float64) (n int) {
+	for n < len(samples) && o.cur != nil {
+		sn, sok := o.cur.out.Stream(samples[n:])
+		n += sn
+		if sok && n == len(samples) {
+			break
+		}
+		done := o.cur
+		o.cur, o.next = o.next, nil
+		if o.cur != nil {
+			o.cur.start()
+		}
+		go done.Close()
+	}
+	return n
+}
+
+// crossfadeNext 当前音乐剩余时长不足 crossfade 时开始交叉淡化
+func (o *output) crossfadeNext() {
+	if o.crossfade <= 0 || o.cur == nil || o.next == nil || o.cur.ctrl.Paused {
+		return
+	}
+	remain := o.cur.remaining()
+	if remain > o.cur.format.SampleRate.N(o.crossfade) {
+		return
+	}
+	prev := o.cur
+	o.cur, o.next = o.next, nil
+	o.cur.fader.gain = 0
+	o.cur.fader.to(1, remain, nil)
+	o.cur.start()
+	o.fading = append(o.fading, prev)
+	prev.fader.to(0, remain, nil)
+	// 交叉淡化开始即切换到下一首, 旧的音乐淡出结束后关闭
+	prev.done()
+}
+
+func (o *output) Err() error {
+	return nil
+}
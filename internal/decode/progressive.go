@@ -0,0 +1,202 @@
+package decode
+
+import (
+	"errors"
+	"io"
+	
+	"github.com/faiface/beep"
+	gomp3 "github.com/hajimehoshi/go-mp3"
+)
+
+// Progressive 边下载边播放的 reader, 例如按 HTTP Range 请求分块下载的网络音乐
+type Progressive interface {
+	io.ReadSeekCloser
+	// Size 文件的总字节数
+	Size() int64
+	// Complete 是否已经全部下载
+	Complete() bool
+	// Ready 从当前位置起的 n 个字节(到文件结尾为止)是否已经下载, 不会阻塞;
+	// 没有下载时优先下载这一段, 并进入缓冲状态。下载放弃后总是返回 true, 由 Read 返回错误
+	Ready(n int64) bool
+	// Err 下载放弃时的错误, 还在下载或已经完成时为 nil
+	Err() error
+}
+
+// progressiveAhead 解码前至少要下载好的字节数
+const progressiveAhead = 64 << 10
+
+const mp3BytesPerFrame = 4
+
+// progressiveMP3 边下载边播放的 MP3 解码流。
+// go-mp3 遇到可以 Seek 的 reader 会在创建时扫描整个文件计算长度, 这里隐藏 Seek,
+// 长度按第一帧的码率估算, 跳转时按比例换算为字节偏移后重新同步帧头, 因此只适用于 CBR。
+// Stream 在输出线程中调用, 数据还没有下载时输出静音而不是阻塞, 下载放弃后播完已经下载的部分再结束并返回错误
+type progressiveMP3 struct {
+	r Progressive
+	// d 为 nil 时表示跳转后还没有重新创建解码器
+	d         *gomp3.Decoder
+	format    beep.Format
+	dataStart int64
+	total     int
+	pos       int
+	buf       []byte
+	err       error
+}
+
+func decodeProgressiveMP3(r Progressive) (beep.StreamSeekCloser, beep.Format, error) {
+	frame, err := mp3FirstFrame(r)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	start := frame.start
+	p := &progressiveMP3{r: r, dataStart: start}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, beep.Format{}, err
+	}
+	if p.d, err = gomp3.NewDecoder(readerOnly{r}); err != nil {
+		return nil, beep.Format{}, err
+	}
+	p.format = beep.Format{SampleRate: beep.SampleRate(p.d.SampleRate()), NumChannels: 2, Precision: 2}
+	p.total = int(float64(r.Size()-start) * 8 / float64(frame.bitrate) * float64(p.format.SampleRate))
+	return p, p.format, nil
+}
+
+func (p *progressiveMP3) Stream(samples [][2]float64) (n int, ok bool) {
+	if p.err != nil {
+		return 0, false
+	}
+	if !p.r.Complete() && !p.r.Ready(progressiveAhead) {
+		clear(samples)
+		return len(samples), true
+	}
+	if p.d == nil {
+		if p.d, p.err = gomp3.NewDecoder(readerOnly{p.r}); p.err != nil {
+			if err := p.r.Err(); err != nil {
+				p.err = err
+			}
+			return 0, false
+		}
+	}
+	size := len(samples) * mp3BytesPerFrame
+	if cap(p.buf) < size {
+		p.buf = make([]byte, size)
+	}
+	buf := p.buf[:size]
+	bn, err := io.ReadFull(p.d, buf)
+	for n = 0; n < bn/mp3BytesPerFrame; n++ {
+		samples[n], _ = p.format.DecodeSigned(buf[n*mp3BytesPerFrame:])
+	}
+	p.pos += n
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		p.err = err
+	}
+	// go-mp3 把 reader 的错误当作文件结尾, 下载放弃时不能当作正常播放完成
+	if n == 0 && p.err == nil {
+		p.err = p.r.Err()
+	}
+	return n, n > 0
+}
+
+func (p *progressiveMP3) Err() error {
+	return p.err
+}
+
+// Len 估算的总长度, 实际播放的长度可能略有出入
+func (p *progressiveMP3) Len() int {
+	return max(p.total, p.pos)
+}
+
+func (p *progressiveMP3) Position() int {
+	return p.pos
+}
+
+// Seek 只移动 reader 并让下载优先跳到目标位置, 解码器在数据到达后由 Stream 重新创建
+func (p *progressiveMP3) Seek(pos int) error {
+	if pos < 0 || pos > p.Len() {
+		return errors.New("mp3: seek position out of range")
+	}
+	off := p.dataStart
+	if p.total > 0 {
+		off += int64(float64(pos) / float64(p.total) * float64(p.r.Size()-p.dataStart))
+	}
+	if _, err := p.r.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	p.d = nil
+	p.pos = pos
+	p.err = nil
+	return nil
+}
+
+func (p *progressiveMP3) Close() error {
+	return p.r.Close()
+}
+
+// readerOnly 隐藏 Seek, 避免 go-mp3 扫描整个文件
+type readerOnly struct {
+	io.Reader
+}
+
+// mp3Bitrates Layer III 的码率表(kbps), 分别为 MPEG1 和 MPEG2/2.5
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mp3Frame 第一帧的帧头
+type mp3Frame struct {
+	// start 帧在文件中的位置
+	start int64
+	// bitrate 码率(bps), VBR 文件为第一帧的码率
+	bitrate  int
+	channels int
+}
+
+// mp3Header b 的开头是否为有效的 Layer III 帧头
+func mp3Header(b []byte) bool {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 || (b[1]>>1)&3 != 1 {
+		return false
+	}
+	version, index := (b[1]>>3)&3, b[2]>>4
+	return version != 1 && index != 0 && index != 15 && (b[2]>>2)&3 != 3
+}
+
+// mp3FirstFrame 跳过 ID3v2 标签, 返回第一个有效的帧头
+func mp3FirstFrame(r io.ReadSeeker) (frame mp3Frame, err error) {
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return frame, err
+	}
+	head := make([]byte, 10)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return frame, err
+	}
+	start, _ := id3v2Size(head)
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return frame, err
+	}
+	
+	// 在开头的一段数据内寻找第一个有效的帧头
+	buf := make([]byte, 16<<10)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return frame, err
+	}
+	for i := 0; i+4 <= n; i++ {
+		b := buf[i : i+4]
+		if !mp3Header(b) {
+			continue
+		}
+		version, index := (b[1]>>3)&3, b[2]>>4
+		table := 1
+		if version == 3 {
+			table = 0
+		}
+		frame = mp3Frame{start: start + int64(i), bitrate: mp3Bitrates[table][index] * 1000, channels: 2}
+		// 声道模式 3 为单声道
+		if b[3]>>6 == 3 {
+			frame.channels = 1
+		}
+		return frame, nil
+	}
+	return frame, errors.New("mp3: no frame header found")
+}
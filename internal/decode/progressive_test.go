@@ -0,0 +1,44 @@
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	
+	"github.com/faiface/beep"
+)
+
+// failedProgressive 下载已经放弃的 Progressive, 只有开头的一部分数据
+type failedProgressive struct {
+	*bytes.Reader
+	err error
+}
+
+func (f *failedProgressive) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if errors.Is(err, io.EOF) {
+		err = f.err
+	}
+	return n, err
+}
+
+func (f *failedProgressive) Close() error     { return nil }
+func (f *failedProgressive) Complete() bool   { return false }
+func (f *failedProgressive) Ready(int64) bool { return true }
+func (f *failedProgressive) Err() error       { return f.err }
+
+func TestProgressiveMP3Failed(t *testing.T) {
+	errDropped := errors.New("connection dropped")
+	p := &progressiveMP3{
+		r:      &failedProgressive{Reader: bytes.NewReader(make([]byte, 1024)), err: errDropped},
+		format: beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2},
+	}
+	samples := make([][2]float64, 512)
+	if n, ok := p.Stream(samples); n != 0 || ok {
+		t.Fatalf("Stream = %d, %v", n, ok)
+	}
+	if !errors.Is(p.Err(), errDropped) {
+		t.Fatalf("Err = %v", p.Err())
+	}
+}
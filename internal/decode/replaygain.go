@@ -0,0 +1,42 @@
+package decode
+
+import (
+	"io"
+	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+)
+
+// SetReplayGainMode 设置响度归一化模式, 对正在播放和预加载的音乐立即生效
+func SetReplayGainMode(mode replaygain.Mode) {
+	_output.lock()
+	defer _output.unlock()
+	_output.gainMode = mode
+	for _, d := range append([]*beepDecoder{_output.cur, _output.next}, _output.fading...) {
+		if d != nil {
+			d.applyGain()
+		}
+	}
+}
+
+// SetReplayGain 设置音乐的响度增益
+func (d *beepDecoder) SetReplayGain(info replaygain.Info) {
+	_output.lock()
+	defer _output.unlock()
+	d.replayGain = info
+	d.applyGain()
+}
+
+// applyGain 按当前模式计算增益, 调用方需持有 输出锁
+func (d *beepDecoder) applyGain() {
+	// effects.Gain 的输出为 采样*(1+Gain)
+	d.gain.Gain = d.replayGain.Factor(_output.gainMode) - 1
+}
+
+// nopCloser 防止解码器关闭调用方的 reader
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
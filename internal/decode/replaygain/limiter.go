@@ -0,0 +1,44 @@
+package replaygain
+
+import (
+	"math"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+// limiterRelease 增益降低后恢复到 1 的时间常数
+const limiterRelease = time.Millisecond * 200
+
+// Limiter 放在增益之后防止削波: 采样超过满刻度时立即把增益降到刚好不超过, 之后按 limiterRelease 逐渐恢复。
+// 没有超过满刻度的信号原样通过, 用于没有峰值标签(例如 R128)时的正增益
+type Limiter struct {
+	Streamer beep.Streamer
+	gain     float64
+	// release 每个采样恢复剩余差值的比例
+	release float64
+}
+
+func NewLimiter(s beep.Streamer, rate beep.SampleRate) *Limiter {
+	return &Limiter{Streamer: s, gain: 1, release: 1 - math.Exp(-1/float64(max(rate.N(limiterRelease), 1)))}
+}
+
+func (l *Limiter) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = l.Streamer.Stream(samples)
+	for i := range samples[:n] {
+		peak := max(math.Abs(samples[i][0]), math.Abs(samples[i][1]))
+		if peak*l.gain > 1 {
+			l.gain = 1 / peak
+		}
+		samples[i][0] *= l.gain
+		samples[i][1] *= l.gain
+		if l.gain < 1 {
+			l.gain += (1 - l.gain) * l.release
+		}
+	}
+	return n, ok
+}
+
+func (l *Limiter) Err() error {
+	return l.Streamer.Err()
+}
@@ -0,0 +1,172 @@
+package replaygain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+var ErrTooShort = errors.New("replaygain: audio too short to measure")
+
+// BS.1770 门限
+const (
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU
+	// 400ms 的块, 相邻块重叠 75%, 即每 100ms 一个子块
+	subBlocksPerBlock = 4
+)
+
+// biquad 二阶 IIR 滤波器, 直接 II 型
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting 返回 BS.1770 的 K 加权滤波器(高架 + 高通), 系数按采样率由双线性变换求得
+func kWeighting(rate float64) [2]biquad {
+	// 高架滤波器, 模拟头部的声学效应
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	// 高通滤波器
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// Measure 读完 s 并测量门限积分响度与采样峰值, 结果作为音轨增益返回。
+// format.NumChannels 为源文件的声道数, 单声道只计算一次能量
+func Measure(ctx context.Context, s beep.Streamer, format beep.Format) (Info, error) {
+	m := NewMeter(format)
+	buf := make([][2]float64, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Info{}, err
+		}
+		n, ok := s.Stream(buf)
+		m.Add(buf[:n])
+		if !ok {
+			break
+		}
+	}
+	if es, ok := s.(interface{ Err() error }); ok && es.Err() != nil {
+		return Info{}, es.Err()
+	}
+	return m.Info()
+}
+
+// Meter 逐块累计响度和峰值, 用于在同一遍解码中同时做其它分析
+type Meter struct {
+	channels int
+	filters  [2][2]biquad
+	// subLen 每 100ms 的采样数
+	subLen    int
+	peak      float64
+	sum       float64
+	count     int
+	subBlocks []float64
+}
+
+// NewMeter format.NumChannels 为源文件的声道数, 单声道只计算一次能量
+func NewMeter(format beep.Format) *Meter {
+	m := &Meter{channels: min(max(format.NumChannels, 1), 2), subLen: format.SampleRate.N(time.Second / 10)}
+	for c := range m.filters {
+		m.filters[c] = kWeighting(float64(format.SampleRate))
+	}
+	return m
+}
+
+func (m *Meter) Add(frames [][2]float64) {
+	for _, frame := range frames {
+		for c := 0; c < m.channels; c++ {
+			x := frame[c]
+			if a := math.Abs(x); a > m.peak {
+				m.peak = a
+			}
+			y := m.filters[c][1].process(m.filters[c][0].process(x))
+			m.sum += y * y
+		}
+		m.count++
+		if m.count == m.subLen {
+			m.subBlocks = append(m.subBlocks, m.sum/float64(m.subLen))
+			m.sum, m.count = 0, 0
+		}
+	}
+}
+
+// Info 已经加入的采样的响度作为音轨增益, 不足一个门限块时返回 ErrTooShort
+func (m *Meter) Info() (Info, error) {
+	loudness, ok := integrate(m.subBlocks)
+	if !ok {
+		return Info{}, ErrTooShort
+	}
+	return Info{TrackGain: ReferenceLoudness - loudness, TrackPeak: m.peak, HasTrack: true}, nil
+}
+
+// integrate 由每 100ms 的均方能量计算门限积分响度
+func integrate(subBlocks []float64) (float64, bool) {
+	if len(subBlocks) < subBlocksPerBlock {
+		return 0, false
+	}
+	blocks := make([]float64, 0, len(subBlocks)-subBlocksPerBlock+1)
+	for i := 0; i+subBlocksPerBlock <= len(subBlocks); i++ {
+		var power float64
+		for _, p := range subBlocks[i : i+subBlocksPerBlock] {
+			power += p
+		}
+		blocks = append(blocks, power/subBlocksPerBlock)
+	}
+	
+	gated := func(threshold float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, p := range blocks {
+			if loudnessOf(p) > threshold {
+				sum += p
+				n++
+			}
+		}
+		return sum, n
+	}
+	sum, n := gated(absoluteGate)
+	if n == 0 {
+		return 0, false
+	}
+	sum, n = gated(loudnessOf(sum/float64(n)) + relativeGate)
+	if n == 0 {
+		return 0, false
+	}
+	return loudnessOf(sum / float64(n)), true
+}
+
+// loudnessOf 均方能量换算为 LUFS
+func loudnessOf(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
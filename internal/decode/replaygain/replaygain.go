@@ -0,0 +1,129 @@
+// Package replaygain reads ReplayGain and EBU R128 gain tags, measures the loudness of
+// untagged tracks (ITU-R BS.1770 gated integrated loudness) and turns either into a
+// linear gain factor with clipping prevention: the factor is capped by the peak when it
+// is known, and a Limiter after the gain catches the rest.
+package replaygain
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	
+	"github.com/dhowden/tag"
+)
+
+// ReferenceLoudness ReplayGain 2.0 的参考响度(LUFS), 增益 = ReferenceLoudness - 响度
+const ReferenceLoudness = -18.0
+
+// r128Offset R128 增益以 -23 LUFS 为参考, 换算为 ReplayGain 需要加上的差值(dB)
+const r128Offset = ReferenceLoudness - -23.0
+
+// Mode 响度归一化模式
+type Mode int
+
+const (
+	ModeOff Mode = iota
+	ModeTrack
+	ModeAlbum
+)
+
+// Info 一首音乐的增益信息, Gain 单位 dB, Peak 为线性峰值(0 表示未知)
+type Info struct {
+	TrackGain float64
+	TrackPeak float64
+	AlbumGain float64
+	AlbumPeak float64
+	HasTrack  bool
+	HasAlbum  bool
+}
+
+// Found 是否读到或测量到了任何增益
+func (i Info) Found() bool {
+	return i.HasTrack || i.HasAlbum
+}
+
+// Factor 按模式返回线性增益, 峰值已知时保证增益后不超过满刻度, 峰值未知时由增益之后的 Limiter 防止削波。
+// 缺少所选模式的增益时回退到另一个, 都没有时返回1
+func (i Info) Factor(mode Mode) float64 {
+	var gain, peak float64
+	switch {
+	case mode == ModeOff:
+		return 1
+	case mode == ModeAlbum && i.HasAlbum, mode == ModeTrack && !i.HasTrack && i.HasAlbum:
+		gain, peak = i.AlbumGain, i.AlbumPeak
+	case i.HasTrack:
+		gain, peak = i.TrackGain, i.TrackPeak
+	default:
+		return 1
+	}
+	f := math.Pow(10, gain/20)
+	if peak > 0 && f*peak > 1 {
+		f = 1 / peak
+	}
+	return f
+}
+
+// FromTags 从 tag.Metadata.Raw() 中读取增益, 支持:
+//   - Vorbis comment / MP4 freeform 中的 REPLAYGAIN_* 与 R128_*_GAIN
+//   - ID3v2 TXXX 帧中的 REPLAYGAIN_*
+//
+// ReplayGain 标签优先于 R128 标签
+func FromTags(raw map[string]interface{}) Info {
+	values := map[string]string{}
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[strings.ToLower(k)] = v
+		case *tag.Comm:
+			if strings.HasPrefix(k, "TXXX") || strings.HasPrefix(k, "TXX") {
+				values[strings.ToLower(v.Description)] = v.Text
+			}
+		}
+	}
+	
+	var i Info
+	if g, ok := parseGain(values["replaygain_track_gain"]); ok {
+		i.TrackGain, i.HasTrack = g, true
+	} else if g, ok := parseR128(values["r128_track_gain"]); ok {
+		i.TrackGain, i.HasTrack = g, true
+	}
+	if g, ok := parseGain(values["replaygain_album_gain"]); ok {
+		i.AlbumGain, i.HasAlbum = g, true
+	} else if g, ok := parseR128(values["r128_album_gain"]); ok {
+		i.AlbumGain, i.HasAlbum = g, true
+	}
+	i.TrackPeak, _ = parsePeak(values["replaygain_track_peak"])
+	i.AlbumPeak, _ = parsePeak(values["replaygain_album_peak"])
+	return i
+}
+
+// parseGain 解析形如 "-6.54 dB" 的增益
+func parseGain(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "dB"), "db"))
+	if s == "" {
+		return 0, false
+	}
+	g, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(g) || math.IsInf(g, 0) {
+		return 0, false
+	}
+	return g, true
+}
+
+// parseR128 解析 Q7.8 定点数的 R128 增益并换算到 ReplayGain 参考响度
+func parseR128(s string) (float64, bool) {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v < math.MinInt16 || v > math.MaxInt16 {
+		return 0, false
+	}
+	return float64(v)/256 + r128Offset, true
+}
+
+func parsePeak(s string) (float64, bool) {
+	p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || p <= 0 || math.IsNaN(p) || math.IsInf(p, 0) {
+		return 0, false
+	}
+	return p, true
+}
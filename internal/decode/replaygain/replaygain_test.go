@@ -0,0 +1,128 @@
+package replaygain
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+	
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+)
+
+func TestFromTags(t *testing.T) {
+	i := FromTags(map[string]interface{}{
+		"replaygain_track_gain": "-6.50 dB",
+		"replaygain_track_peak": "0.988",
+		"r128_album_gain":       "-1280",
+	})
+	if !i.HasTrack || i.TrackGain != -6.5 || i.TrackPeak != 0.988 {
+		t.Fatalf("track = %+v", i)
+	}
+	if !i.HasAlbum || i.AlbumGain != 0 {
+		t.Fatalf("album = %+v", i)
+	}
+	
+	i = FromTags(map[string]interface{}{
+		"TXXX":   &tag.Comm{Description: "REPLAYGAIN_TRACK_GAIN", Text: "+2.00 dB"},
+		"TXXX_1": &tag.Comm{Description: "replaygain_album_gain", Text: "1.5 dB"},
+	})
+	if !i.HasTrack || i.TrackGain != 2 || !i.HasAlbum || i.AlbumGain != 1.5 {
+		t.Fatalf("id3 = %+v", i)
+	}
+	
+	if FromTags(map[string]interface{}{"title": "x"}).Found() {
+		t.Fatal("no gain tags should not be found")
+	}
+}
+
+func TestFactor(t *testing.T) {
+	i := Info{TrackGain: -6, AlbumGain: 6, AlbumPeak: 0.9, HasTrack: true, HasAlbum: true}
+	if f := i.Factor(ModeOff); f != 1 {
+		t.Fatalf("off = %v", f)
+	}
+	if f := i.Factor(ModeTrack); math.Abs(f-0.501) > 1e-3 {
+		t.Fatalf("track = %v", f)
+	}
+	// +6dB 会使 0.9 的峰值削波, 限制到 1/0.9
+	if f := i.Factor(ModeAlbum); math.Abs(f-1/0.9) > 1e-9 {
+		t.Fatalf("album = %v", f)
+	}
+	if f := (Info{TrackGain: -6, HasTrack: true}).Factor(ModeAlbum); math.Abs(f-0.501) > 1e-3 {
+		t.Fatalf("album fallback = %v", f)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// 没有峰值标签的 +6dB 增益, 0.8 的正弦波增益后会超过满刻度
+	rate := beep.SampleRate(44100)
+	var i int
+	sine := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for j := range samples {
+			v := 0.8 * math.Sin(2*math.Pi*1000*float64(i)/float64(rate))
+			samples[j] = [2]float64{v, -v}
+			i++
+		}
+		return len(samples), true
+	})
+	factor := (Info{TrackGain: 6, HasTrack: true}).Factor(ModeTrack)
+	gained := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		n, ok := sine.Stream(samples)
+		for j := range samples[:n] {
+			samples[j][0] *= factor
+			samples[j][1] *= factor
+		}
+		return n, ok
+	})
+	buf := make([][2]float64, rate.N(time.Second))
+	n, _ := NewLimiter(gained, rate).Stream(buf)
+	var peak float64
+	for _, s := range buf[:n] {
+		peak = max(peak, math.Abs(s[0]), math.Abs(s[1]))
+	}
+	if peak > 1 || peak < 0.99 {
+		t.Fatalf("peak = %v, want just below 1", peak)
+	}
+	
+	// 不超过满刻度的信号原样通过
+	quiet := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for j := range samples {
+			samples[j] = [2]float64{0.5, -0.5}
+		}
+		return len(samples), true
+	})
+	n, _ = NewLimiter(quiet, rate).Stream(buf)
+	for _, s := range buf[:n] {
+		if s != [2]float64{0.5, -0.5} {
+			t.Fatalf("sample = %v, want unchanged", s)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	// 10 秒 1kHz -20dBFS 的立体声正弦波, 响度约为 -20 LUFS
+	const rate = 48000
+	amp := 0.1
+	i := 0
+	s := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		if i >= rate*10 {
+			return 0, false
+		}
+		for n := range samples {
+			v := amp * math.Sin(2*math.Pi*1000*float64(i)/rate)
+			samples[n] = [2]float64{v, v}
+			i++
+		}
+		return len(samples), true
+	})
+	info, err := Measure(context.Background(), s, beep.Format{SampleRate: rate, NumChannels: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(info.TrackGain-2) > 0.2 {
+		t.Fatalf("gain = %v dB, want about 2", info.TrackGain)
+	}
+	if math.Abs(info.TrackPeak-amp) > 1e-3 {
+		t.Fatalf("peak = %v", info.TrackPeak)
+	}
+}
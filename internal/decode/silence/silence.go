@@ -0,0 +1,133 @@
+// Package silence 检测音乐开头和结尾的静音, 以及隐藏音轨之前的长时间静音
+package silence
+
+import (
+	"context"
+	"math"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+const (
+	// Threshold 低于 -60dBFS 的峰值视为静音
+	Threshold = 0.001
+	// MinTrim 静音不足这个时长时不裁剪, 避免切掉自然的起音和余音
+	MinTrim = time.Second
+	// HiddenGap 超过这个时长的静音之后的部分视为隐藏音轨, 裁掉
+	HiddenGap = time.Second * 30
+)
+
+// window 判断静音的窗口长度
+const window = time.Millisecond * 50
+
+// 裁剪后在声音前后保留的余量
+const (
+	leadIn  = time.Millisecond * 100
+	tailOut = time.Millisecond * 500
+)
+
+// Result 检测结果, End 为 0 表示不裁剪结尾
+type Result struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Detect 完整解码一遍 s, 按窗口峰值找出第一段声音的开始和结束。
+// 开头或结尾的静音不足 MinTrim 时不裁剪; 声音之后出现超过 HiddenGap 的静音时, 在静音处结束
+func Detect(ctx context.Context, s beep.Streamer, format beep.Format) (Result, error) {
+	d := NewDetector(format)
+	buf := make([][2]float64, 4096)
+	for !d.Done() {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		n, ok := s.Stream(buf)
+		d.Add(buf[:n])
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Result{}, err
+	}
+	return d.Result(), nil
+}
+
+// Detector 逐块检测静音, 用于在同一遍解码中同时做其它分析; 规则见 Detect
+type Detector struct {
+	format    beep.Format
+	size, gap int
+	
+	pos, windowPos int
+	peak           float64
+	// first 第一个有声音的窗口, last 当前最后一个有声音的窗口结束位置, 都为 -1 表示还没有声音
+	first, last int
+	// cut 隐藏音轨之前静音开始的位置
+	cut int
+}
+
+func NewDetector(format beep.Format) *Detector {
+	return &Detector{
+		format: format,
+		size:   format.SampleRate.N(window),
+		gap:    format.SampleRate.N(HiddenGap),
+		first:  -1,
+		last:   -1,
+		cut:    -1,
+	}
+}
+
+// Done 是否已经找到隐藏音轨之前的静音, 之后加入的采样被忽略
+func (d *Detector) Done() bool {
+	return d.cut >= 0
+}
+
+func (d *Detector) Add(frames [][2]float64) {
+	for _, frame := range frames {
+		if d.cut >= 0 {
+			return
+		}
+		d.peak = math.Max(d.peak, math.Max(math.Abs(frame[0]), math.Abs(frame[1])))
+		d.pos++
+		if d.pos-d.windowPos < d.size {
+			continue
+		}
+		if d.peak >= Threshold {
+			if d.first < 0 {
+				d.first = d.windowPos
+			}
+			d.last = d.pos
+		} else if d.last >= 0 && d.pos-d.last >= d.gap {
+			d.cut = d.last
+			return
+		}
+		d.windowPos, d.peak = d.pos, 0
+	}
+}
+
+// Result 已经加入的采样的检测结果
+func (d *Detector) Result() Result {
+	first, last := d.first, d.last
+	// 最后不足一个窗口的部分
+	if d.cut < 0 && d.pos > d.windowPos && d.peak >= Threshold {
+		if first < 0 {
+			first = d.windowPos
+		}
+		last = d.pos
+	}
+	if first < 0 {
+		// 整首都是静音
+		return Result{}
+	}
+	
+	var r Result
+	if start := d.format.SampleRate.D(first); start >= MinTrim {
+		r.Start = start - leadIn
+	}
+	end := d.format.SampleRate.D(last)
+	if d.cut >= 0 || d.format.SampleRate.D(d.pos)-end >= MinTrim {
+		r.End = end + tailOut
+	}
+	return r
+}
@@ -0,0 +1,59 @@
+package silence
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+var format = beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+
+// track 按片段拼接的测试音频, loud 为 true 的片段是正弦波, 否则是静音
+func track(parts ...any) beep.Streamer {
+	var streamers []beep.Streamer
+	for i := 0; i < len(parts); i += 2 {
+		d, loud := parts[i].(time.Duration), parts[i+1].(bool)
+		var pos int
+		streamers = append(streamers, beep.Take(format.SampleRate.N(d), beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+			for j := range samples {
+				var v float64
+				if loud {
+					v = 0.5 * math.Sin(2*math.Pi*440*float64(pos)/float64(format.SampleRate))
+				}
+				samples[j] = [2]float64{v, v}
+				pos++
+			}
+			return len(samples), true
+		})))
+	}
+	return beep.Seq(streamers...)
+}
+
+func TestDetect(t *testing.T) {
+	const loud, silent = true, false
+	s := time.Second
+	cases := []struct {
+		name  string
+		track beep.Streamer
+		want  Result
+	}{
+		{"no silence", track(10*s, loud), Result{}},
+		{"short silence", track(s/2, silent, 10*s, loud, s/2, silent), Result{}},
+		{"intro and outro", track(5*s, silent, 10*s, loud, 3*s, silent), Result{Start: 5*s - leadIn, End: 15*s + tailOut}},
+		{"hidden track", track(10*s, loud, 40*s, silent, 5*s, loud), Result{End: 10*s + tailOut}},
+		{"all silence", track(10*s, silent), Result{}},
+	}
+	for _, c := range cases {
+		got, err := Detect(context.Background(), c.track, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 以窗口为单位检测, 允许一个窗口的误差
+		if (got.Start-c.want.Start).Abs() > window || (got.End-c.want.End).Abs() > window || (got.End == 0) != (c.want.End == 0) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
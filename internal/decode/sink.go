@@ -0,0 +1,61 @@
+package decode
+
+import (
+	"errors"
+	"sync"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+// Output 音频输出后端, 负责从混音器拉取采样。
+// 除了扬声器, 还有由假时钟驱动的 NullOutput 和写入 WAV 文件的 WAVOutput, 用于没有声卡的环境和测试;
+// 应用中通过设置和 OpenOutput 选择后端
+type Output interface {
+	// Init 以 sampleRate 打开输出并开始从 s 拉取采样, 只会调用一次
+	Init(sampleRate beep.SampleRate, s beep.Streamer) error
+	// Lock 与输出线程互斥, 持有期间不会拉取采样
+	Lock()
+	Unlock()
+	// Every 按后端的时钟每隔 d 调用一次 fn, 调用时不持有锁, 返回的函数用于停止
+	Every(d time.Duration, fn func()) (stop func())
+	// Close 关闭输出
+	Close() error
+}
+
+var ErrOutputStarted = errors.New("decode: output already started")
+
+// SetOutput 替换输出后端, 必须在第一次播放之前调用
+func SetOutput(out Output) error {
+	if out == nil {
+		return errors.New("decode: nil output")
+	}
+	if _output.started.Load() {
+		return ErrOutputStarted
+	}
+	_output.out = out
+	return nil
+}
+
+// every 用真实时钟实现 Output.Every
+func every(d time.Duration, fn func()) (stop func()) {
+	ticker := time.NewTicker(d)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
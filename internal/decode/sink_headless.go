@@ -0,0 +1,14 @@
+//go:build headless
+
+package decode
+
+import "errors"
+
+// defaultOutput 没有声卡时默认不输出, 由调用方推进 NullOutput 的时钟
+func defaultOutput() Output {
+	return NewNullOutput()
+}
+
+func newSpeakerOutput() (Output, error) {
+	return nil, errors.New("decode: speaker output is not available in headless builds")
+}
@@ -0,0 +1,136 @@
+package decode
+
+import (
+	"slices"
+	"sync"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+// advanceStep NullOutput 推进时钟时每次拉取的时长
+const advanceStep = time.Millisecond * 10
+
+// NullOutput 丢弃输出的后端, 由假时钟驱动: 只有调用 Advance 时间才会前进,
+// 按经过的时间拉取相应数量的采样并调用到期的 Every 回调, 用于没有声卡时的确定性测试
+type NullOutput struct {
+	mu       sync.Mutex
+	rate     beep.SampleRate
+	s        beep.Streamer
+	buf      [][2]float64
+	rendered int
+	// sink 接收拉取到的采样, 调用时持有 mu
+	sink func(samples [][2]float64) error
+	err  error
+	
+	clockMu sync.Mutex
+	now     time.Duration
+	timers  []*nullTimer
+}
+
+type nullTimer struct {
+	period time.Duration
+	next   time.Duration
+	fn     func()
+}
+
+func NewNullOutput() *NullOutput {
+	return &NullOutput{}
+}
+
+func (n *NullOutput) Init(sampleRate beep.SampleRate, s beep.Streamer) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rate, n.s = sampleRate, s
+	n.rendered = sampleRate.N(n.Now())
+	return nil
+}
+
+func (n *NullOutput) Lock() {
+	n.mu.Lock()
+}
+
+func (n *NullOutput) Unlock() {
+	n.mu.Unlock()
+}
+
+func (n *NullOutput) Every(d time.Duration, fn func()) (stop func()) {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	t := &nullTimer{period: d, next: n.now + d, fn: fn}
+	n.timers = append(n.timers, t)
+	return func() {
+		n.clockMu.Lock()
+		defer n.clockMu.Unlock()
+		n.timers = slices.DeleteFunc(n.timers, func(v *nullTimer) bool {
+			return v == t
+		})
+	}
+}
+
+func (n *NullOutput) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+// Now 假时钟经过的时间
+func (n *NullOutput) Now() time.Duration {
+	n.clockMu.Lock()
+	defer n.clockMu.Unlock()
+	return n.now
+}
+
+// Advance 让假时钟前进 d, 每 advanceStep 拉取一次采样, 之后调用到期的回调。
+// 回调在调用方的协程中同步执行, 返回 sink 遇到的第一个错误
+func (n *NullOutput) Advance(d time.Duration) error {
+	end := n.Now() + d
+	for {
+		now := n.Now()
+		if now >= end {
+			break
+		}
+		now += min(advanceStep, end-now)
+		n.render(now)
+		
+		n.clockMu.Lock()
+		n.now = now
+		var due []func()
+		for _, t := range n.timers {
+			for t.next <= now {
+				due = append(due, t.fn)
+				t.next += t.period
+			}
+		}
+		n.clockMu.Unlock()
+		for _, fn := range due {
+			fn()
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+// render 拉取到 now 为止的采样
+func (n *NullOutput) render(now time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.s == nil {
+		return
+	}
+	size := n.rate.N(now) - n.rendered
+	if size <= 0 {
+		return
+	}
+	if cap(n.buf) < size {
+		n.buf = make([][2]float64, size)
+	}
+	buf := n.buf[:size]
+	sn, _ := n.s.Stream(buf)
+	clear(buf[sn:])
+	n.rendered += size
+	if n.sink != nil && n.err == nil {
+		n.err = n.sink(buf)
+	}
+}
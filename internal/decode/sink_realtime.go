@@ -0,0 +1,113 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	
+	"github.com/faiface/beep"
+	"k8s.io/klog"
+)
+
+// OutputBackend 可以通过设置选择的输出后端
+type OutputBackend string
+
+const (
+	// OutputDefault 默认输出, 一般为扬声器, 使用 headless 标签编译时为 null
+	OutputDefault OutputBackend = ""
+	OutputSpeaker OutputBackend = "speaker"
+	// OutputNull 丢弃输出
+	OutputNull OutputBackend = "null"
+	// OutputWAV 把输出写入 WAV 文件
+	OutputWAV OutputBackend = "wav"
+)
+
+// OutputSettings 输出后端的设置, 输出只能在第一次播放前替换, 因此只在创建播放器时生效
+type OutputSettings struct {
+	Backend OutputBackend
+	// Path wav 后端写入的文件
+	Path string
+}
+
+// OpenOutput 按设置创建输出后端, null 和 wav 后端按真实时钟推进, 与扬声器一样实时播放
+func OpenOutput(s OutputSettings) (Output, error) {
+	switch s.Backend {
+	case OutputDefault:
+		return defaultOutput(), nil
+	case OutputSpeaker:
+		return newSpeakerOutput()
+	case OutputNull:
+		return newRealtimeOutput(NewNullOutput()), nil
+	case OutputWAV:
+		if s.Path == "" {
+			return nil, errors.New("decode: wav output needs a path")
+		}
+		out, err := NewWAVOutput(s.Path)
+		if err != nil {
+			return nil, err
+		}
+		return newRealtimeOutput(out), nil
+	}
+	return nil, fmt.Errorf("decode: unknown output backend %q", s.Backend)
+}
+
+// clockedOutput 由假时钟驱动的输出, 即 NullOutput 和 WAVOutput
+type clockedOutput interface {
+	Output
+	Advance(d time.Duration) error
+}
+
+// realtimeOutput 在 Init 之后按真实时钟推进假时钟, Close 时先停止推进再关闭
+type realtimeOutput struct {
+	clockedOutput
+	stop    chan struct{}
+	done    chan struct{}
+	started sync.Once
+	closed  sync.Once
+}
+
+func newRealtimeOutput(out clockedOutput) *realtimeOutput {
+	return &realtimeOutput{clockedOutput: out, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (r *realtimeOutput) Init(sampleRate beep.SampleRate, s beep.Streamer) error {
+	if err := r.clockedOutput.Init(sampleRate, s); err != nil {
+		return err
+	}
+	r.started.Do(func() {
+		go r.run()
+	})
+	return nil
+}
+
+func (r *realtimeOutput) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(advanceStep)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			if err := r.Advance(now.Sub(last)); err != nil {
+				klog.Error(err)
+				return
+			}
+			last = now
+		}
+	}
+}
+
+func (r *realtimeOutput) Close() error {
+	r.closed.Do(func() {
+		close(r.stop)
+		// 没有 Init 时推进协程没有启动
+		r.started.Do(func() {
+			close(r.done)
+		})
+		<-r.done
+	})
+	return r.clockedOutput.Close()
+}
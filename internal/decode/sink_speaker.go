@@ -0,0 +1,51 @@
+//go:build !headless
+
+package decode
+
+import (
+	"time"
+	
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+)
+
+// speakerOutput 通过 beep/speaker 输出到声卡
+type speakerOutput struct{}
+
+// NewSpeakerOutput 默认的声卡输出, 使用 headless 标签编译时不可用
+func NewSpeakerOutput() Output {
+	return speakerOutput{}
+}
+
+func defaultOutput() Output {
+	return NewSpeakerOutput()
+}
+
+func newSpeakerOutput() (Output, error) {
+	return NewSpeakerOutput(), nil
+}
+
+func (speakerOutput) Init(sampleRate beep.SampleRate, s beep.Streamer) error {
+	if err := speaker.Init(sampleRate, sampleRate.N(time.Second/10)); err != nil {
+		return err
+	}
+	speaker.Play(s)
+	return nil
+}
+
+func (speakerOutput) Lock() {
+	speaker.Lock()
+}
+
+func (speakerOutput) Unlock() {
+	speaker.Unlock()
+}
+
+func (speakerOutput) Every(d time.Duration, fn func()) (stop func()) {
+	return every(d, fn)
+}
+
+func (speakerOutput) Close() error {
+	speaker.Close()
+	return nil
+}
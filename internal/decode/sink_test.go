@@ -0,0 +1,45 @@
+package decode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+)
+
+func TestOpenOutput(t *testing.T) {
+	for _, s := range []OutputSettings{{Backend: "alsa"}, {Backend: OutputWAV}} {
+		if _, err := OpenOutput(s); err == nil {
+			t.Errorf("OpenOutput(%+v) succeeded", s)
+		}
+	}
+	
+	// 通过设置选择的 wav 后端按真实时钟写入
+	path := filepath.Join(t.TempDir(), "out.wav")
+	out, err := OpenOutput(OutputSettings{Backend: OutputWAV, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Init(outputSampleRate, beep.Silence(-1)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, _, err := wav.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := outputSampleRate.D(s.Len()); d < time.Millisecond*100 || d > time.Second {
+		t.Fatalf("rendered %v in 200ms", d)
+	}
+}
@@ -0,0 +1,104 @@
+package decode
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+	
+	"github.com/faiface/beep"
+)
+
+// wavHeaderSize 标准 PCM WAV 文件头的大小
+const wavHeaderSize = 44
+
+// WAVOutput 把输出写入 16 位立体声 WAV 文件的后端, 与 NullOutput 一样由假时钟驱动
+type WAVOutput struct {
+	*NullOutput
+	f      *os.File
+	w      *bufio.Writer
+	frames int
+	// started 占位的文件头已经写入
+	started bool
+}
+
+// NewWAVOutput 创建 WAV 文件, 文件头在 Close 时补全
+func NewWAVOutput(path string) (*WAVOutput, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	o := &WAVOutput{NullOutput: NewNullOutput(), f: f, w: bufio.NewWriter(f)}
+	o.NullOutput.sink = o.write
+	return o, nil
+}
+
+// Init 通过缓冲写入占位的文件头, 之后的数据紧跟在文件头之后
+func (o *WAVOutput) Init(sampleRate beep.SampleRate, s beep.Streamer) error {
+	o.NullOutput.mu.Lock()
+	if !o.started {
+		if _, err := o.w.Write(o.header(sampleRate)); err != nil {
+			o.NullOutput.mu.Unlock()
+			return err
+		}
+		o.started = true
+	}
+	o.NullOutput.mu.Unlock()
+	return o.NullOutput.Init(sampleRate, s)
+}
+
+// write 调用时已持有 NullOutput 的锁
+func (o *WAVOutput) write(samples [][2]float64) error {
+	var buf [4]byte
+	for _, s := range samples {
+		for c, v := range s {
+			v = math.Max(-1, math.Min(1, v))
+			binary.LittleEndian.PutUint16(buf[c*2:], uint16(int16(math.Round(v*math.MaxInt16))))
+		}
+		if _, err := o.w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	o.frames += len(samples)
+	return nil
+}
+
+// header 按已写入的帧数生成文件头, 调用时已持有 NullOutput 的锁
+func (o *WAVOutput) header(sampleRate beep.SampleRate) []byte {
+	const channels, bits = 2, 16
+	dataSize := uint32(o.frames * channels * bits / 8)
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, wavHeaderSize-8+dataSize)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, 1) // PCM
+	h = binary.LittleEndian.AppendUint16(h, channels)
+	h = binary.LittleEndian.AppendUint32(h, uint32(sampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(sampleRate)*channels*bits/8)
+	h = binary.LittleEndian.AppendUint16(h, channels*bits/8)
+	h = binary.LittleEndian.AppendUint16(h, bits)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	return h
+}
+
+// Close 写入剩余数据并补全文件头
+func (o *WAVOutput) Close() error {
+	err := o.NullOutput.Close()
+	o.NullOutput.mu.Lock()
+	if ferr := o.w.Flush(); err == nil {
+		err = ferr
+	}
+	if o.started {
+		// WriteAt 不移动文件的偏移
+		if _, herr := o.f.WriteAt(o.header(o.NullOutput.rate), 0); err == nil {
+			err = herr
+		}
+	}
+	o.NullOutput.mu.Unlock()
+	if cerr := o.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+package decode
+
+import (
+	"github.com/Theodoree/music_player/internal/decode/spectrum"
+)
+
+// WatchSpectrum 按输出后端的时钟每隔 spectrum.Interval 回调一次混音后输出的频谱,
+// 暂停或没有播放时频谱会回落为静音。需在 SetOutput 之后调用, 返回的函数用于停止
+func WatchSpectrum(fn func(f spectrum.Frame)) (stop func()) {
+	return _output.out.Every(spectrum.Interval, func() {
+		fn(_output.spectrum.Frame())
+	})
+}
@@ -0,0 +1,139 @@
+// Package spectrum 实时频谱分析: 收集输出的采样, 定期做加窗 FFT 得到按对数划分的频段强度
+package spectrum
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+const (
+	// Size FFT 的点数
+	Size = 2048
+	// Bands 频段数, 在 MinFreq 到 MaxFreq 之间按对数均分
+	Bands   = 32
+	MinFreq = 40.0
+	MaxFreq = 16000.0
+	// WaveSize 示波器的点数
+	WaveSize = 512
+	// Interval 刷新间隔, 约 30 fps
+	Interval = time.Second / 30
+)
+
+// minDB 对应强度 0 的分贝数, 0dBFS 对应强度 1
+const minDB = -70.0
+
+// fallDuration 频段从最强落到 0 的时长, 上升是即时的
+const fallDuration = time.Millisecond * 600
+
+// Frame 一帧频谱, 数组保存, 可以直接按值传递
+type Frame struct {
+	// Bands 各频段的强度 [0,1]
+	Bands [Bands]float64
+	// Wave 最近一段波形(左右声道平均) [-1,1]
+	Wave [WaveSize]float64
+}
+
+// Silent 是否没有任何声音
+func (f *Frame) Silent() bool {
+	for _, v := range f.Bands {
+		if v > 0 {
+			return false
+		}
+	}
+	for _, v := range f.Wave {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Analyzer 频谱分析器。Write 在输出线程中调用, 只复制采样;
+// FFT 在 Frame 中完成, 可以与 Write 并发
+type Analyzer struct {
+	mu   sync.Mutex
+	ring [Size]float64
+	pos  int
+	
+	// 以下只在 Frame 中使用
+	window [Size]float64
+	buf    [Size]complex128
+	// edges 各频段的起止 bin, bands 平滑后的强度
+	edges [Bands + 1]float64
+	bands [Bands]float64
+	// scale 把幅度换算为正弦波的振幅
+	scale float64
+}
+
+// New 创建分析器, rate 为 Write 写入的采样率
+func New(rate beep.SampleRate) *Analyzer {
+	a := &Analyzer{}
+	var sum float64
+	for i := range a.window {
+		a.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/Size)
+		sum += a.window[i]
+	}
+	a.scale = 2 / sum
+	binWidth := float64(rate) / Size
+	maxFreq := math.Min(MaxFreq, float64(rate)/2)
+	for i := range a.edges {
+		freq := MinFreq * math.Pow(maxFreq/MinFreq, float64(i)/Bands)
+		a.edges[i] = freq / binWidth
+	}
+	return a
+}
+
+// Write 写入混音后的采样
+func (a *Analyzer) Write(samples [][2]float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(samples) > Size {
+		samples = samples[len(samples)-Size:]
+	}
+	for _, s := range samples {
+		a.ring[a.pos] = (s[0] + s[1]) / 2
+		a.pos = (a.pos + 1) % Size
+	}
+}
+
+// Frame 分析最近 Size 个采样, 每隔 Interval 调用一次, 不能并发调用
+func (a *Analyzer) Frame() Frame {
+	var f Frame
+	var in [Size]float64
+	a.mu.Lock()
+	n := copy(in[:], a.ring[a.pos:])
+	copy(in[n:], a.ring[:a.pos])
+	a.mu.Unlock()
+	
+	// 示波器取最近的 WaveSize*2 个采样, 隔一个取一个
+	wave := in[Size-WaveSize*2:]
+	for i := range f.Wave {
+		f.Wave[i] = math.Max(-1, math.Min(1, wave[i*2]))
+	}
+	
+	for i, v := range in {
+		a.buf[i] = complex(v*a.window[i], 0)
+	}
+	fft(a.buf[:])
+	fall := float64(Interval) / float64(fallDuration)
+	for b := range a.bands {
+		lo, hi := a.edges[b], a.edges[b+1]
+		// 低频段可能不足一个 bin, 至少取一个
+		var mag float64
+		for k := int(lo); k <= max(int(hi), int(lo)) && k < Size/2; k++ {
+			mag = math.Max(mag, cmplx.Abs(a.buf[k]))
+		}
+		level := 0.0
+		if mag *= a.scale; mag > 0 {
+			db := 20 * math.Log10(mag)
+			level = math.Max(0, math.Min(1, (db-minDB)/-minDB))
+		}
+		a.bands[b] = math.Max(level, a.bands[b]-fall)
+		f.Bands[b] = a.bands[b]
+	}
+	return f
+}
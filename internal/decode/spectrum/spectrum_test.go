@@ -0,0 +1,73 @@
+package spectrum
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	
+	"github.com/faiface/beep"
+)
+
+const rate = beep.SampleRate(44100)
+
+func TestFFT(t *testing.T) {
+	const n = 64
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(math.Sin(float64(i)*0.3)+float64(i%5), 0)
+	}
+	want := make([]complex128, n)
+	for k := range want {
+		for i, v := range x {
+			want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*i)/n))
+		}
+	}
+	fft(x)
+	for k := range x {
+		if cmplx.Abs(x[k]-want[k]) > 1e-9 {
+			t.Fatalf("bin %d = %v, want %v", k, x[k], want[k])
+		}
+	}
+}
+
+// band 频率所在的频段
+func band(freq float64) int {
+	return int(math.Log(freq/MinFreq) / math.Log(MaxFreq/MinFreq) * Bands)
+}
+
+func TestSine(t *testing.T) {
+	a := New(rate)
+	const freq = 1000
+	buf := make([][2]float64, Size)
+	for i := range buf {
+		v := math.Sin(2 * math.Pi * freq * float64(i) / float64(rate))
+		buf[i] = [2]float64{v, v}
+	}
+	a.Write(buf)
+	f := a.Frame()
+	peak := band(freq)
+	if f.Bands[peak] < 0.95 {
+		t.Fatalf("band %d = %v, want about 1", peak, f.Bands[peak])
+	}
+	for b, v := range f.Bands {
+		if (b < peak-2 || b > peak+2) && v > 0.3 {
+			t.Errorf("band %d = %v, want quiet", b, v)
+		}
+	}
+	if f.Silent() {
+		t.Fatal("frame is silent")
+	}
+	
+	// 静音后逐渐回落到 0
+	a.Write(make([][2]float64, Size))
+	f = a.Frame()
+	if f.Bands[peak] <= 0 || f.Bands[peak] >= 1 {
+		t.Fatalf("band %d after silence = %v, want falling", peak, f.Bands[peak])
+	}
+	for i := 0; i < int(fallDuration/Interval)+1; i++ {
+		f = a.Frame()
+	}
+	if !f.Silent() {
+		t.Fatalf("frame is not silent: %v", f.Bands)
+	}
+}
@@ -0,0 +1,39 @@
+package decode
+
+// SetSpeed 设置所有音乐的播放速度, 对正在播放和预加载的音乐立即生效
+func SetSpeed(speed float64) {
+	_output.lock()
+	defer _output.unlock()
+	_output.speed = speed
+	for _, d := range append([]*beepDecoder{_output.cur, _output.next}, _output.fading...) {
+		if d != nil {
+			d.stretch.SetSpeed(speed)
+		}
+	}
+}
+
+// SetPitch 设置所有音乐变调的半音数, 对正在播放和预加载的音乐立即生效
+func SetPitch(semitones float64) {
+	_output.lock()
+	defer _output.unlock()
+	_output.pitch = semitones
+	for _, d := range append([]*beepDecoder{_output.cur, _output.next}, _output.fading...) {
+		if d != nil {
+			d.stretch.SetPitch(semitones)
+		}
+	}
+}
+
+// SetSpeed 只设置这首音乐的播放速度
+func (d *beepDecoder) SetSpeed(speed float64) {
+	_output.lock()
+	defer _output.unlock()
+	d.stretch.SetSpeed(speed)
+}
+
+// SetPitch 只设置这首音乐变调的半音数
+func (d *beepDecoder) SetPitch(semitones float64) {
+	_output.lock()
+	defer _output.unlock()
+	d.stretch.SetPitch(semitones)
+}
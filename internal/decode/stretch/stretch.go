@@ -0,0 +1,104 @@
+// Package stretch 变速不变调与变调不变速: 用 WSOLA 做时间伸缩, 再重采样改变音调
+package stretch
+
+import (
+	"math"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 2.0
+	// MaxPitch 变调范围 ±MaxPitch 个半音
+	MaxPitch = 12.0
+)
+
+// frameDuration WSOLA 的帧长, seekDuration 相似位置的搜索范围
+const (
+	frameDuration = time.Millisecond * 40
+	seekDuration  = time.Millisecond * 12
+)
+
+// resampleQuality 变调重采样的插值质量
+const resampleQuality = 4
+
+// Stretcher 以 speed 倍速播放 Streamer, 音调不变, 并独立升降 pitch 个半音。
+// 先以 speed/ratio 做时间伸缩, 再以 ratio 重采样, 总体速度为 speed, 音调乘以 ratio。
+// 设置与 Stream 不能并发调用, 播放中修改需与输出线程互斥
+type Stretcher struct {
+	wsola     *wsola
+	resampler *beep.Resampler
+	speed     float64
+	pitch     float64
+}
+
+// New 创建 Stretcher, rate 为 Streamer 的采样率
+func New(s beep.Streamer, rate beep.SampleRate) *Stretcher {
+	return &Stretcher{wsola: newWSOLA(s, rate), speed: 1}
+}
+
+// SetSpeed 设置播放速度, 范围 [MinSpeed, MaxSpeed]
+func (s *Stretcher) SetSpeed(speed float64) {
+	if math.IsNaN(speed) {
+		speed = 1
+	}
+	s.speed = math.Max(MinSpeed, math.Min(MaxSpeed, speed))
+	s.update()
+}
+
+// SetPitch 设置变调的半音数, 范围 ±MaxPitch
+func (s *Stretcher) SetPitch(semitones float64) {
+	if math.IsNaN(semitones) {
+		semitones = 0
+	}
+	s.pitch = math.Max(-MaxPitch, math.Min(MaxPitch, semitones))
+	s.update()
+}
+
+func (s *Stretcher) Speed() float64 {
+	return s.speed
+}
+
+func (s *Stretcher) Pitch() float64 {
+	return s.pitch
+}
+
+func (s *Stretcher) update() {
+	ratio := math.Pow(2, s.pitch/12)
+	s.wsola.tempo = s.speed / ratio
+	switch {
+	case s.pitch == 0:
+		s.resampler = nil
+	case s.resampler == nil:
+		s.resampler = beep.ResampleRatio(resampleQuality, ratio, s.wsola)
+	default:
+		s.resampler.SetRatio(ratio)
+	}
+}
+
+// Pending 已从源读取但还没有播放出去的采样数, 源的位置减去它即为正在播放的位置
+func (s *Stretcher) Pending() int {
+	return s.wsola.pending()
+}
+
+// Reset 清空缓冲, 源 Seek 之后调用
+func (s *Stretcher) Reset() {
+	s.wsola.reset()
+	if s.resampler != nil {
+		s.resampler = nil
+		s.update()
+	}
+}
+
+func (s *Stretcher) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.resampler != nil {
+		return s.resampler.Stream(samples)
+	}
+	return s.wsola.Stream(samples)
+}
+
+func (s *Stretcher) Err() error {
+	return s.wsola.Err()
+}
@@ -0,0 +1,115 @@
+package stretch
+
+import (
+	"math"
+	"testing"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+const rate = beep.SampleRate(44100)
+
+// sine n 个采样的立体声正弦波
+func sine(freq float64, n int) [][2]float64 {
+	buf := make([][2]float64, n)
+	for i := range buf {
+		v := 0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+		buf[i] = [2]float64{v, v}
+	}
+	return buf
+}
+
+func source(buf [][2]float64) beep.Streamer {
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		n := copy(samples, buf)
+		buf = buf[n:]
+		return n, n > 0
+	})
+}
+
+func readAll(s beep.Streamer) [][2]float64 {
+	var out [][2]float64
+	buf := make([][2]float64, 512)
+	for {
+		n, ok := s.Stream(buf)
+		out = append(out, buf[:n]...)
+		if !ok {
+			return out
+		}
+	}
+}
+
+// frequency 用过零点估计频率, 跳过开头和结尾
+func frequency(buf [][2]float64) float64 {
+	buf = buf[len(buf)/10 : len(buf)*9/10]
+	var crossings int
+	for i := 1; i < len(buf); i++ {
+		if buf[i-1][0] < 0 && buf[i][0] >= 0 {
+			crossings++
+		}
+	}
+	return float64(crossings) / rate.D(len(buf)).Seconds()
+}
+
+func TestIdentity(t *testing.T) {
+	in := sine(440, int(rate))
+	out := readAll(New(source(in), rate))
+	if len(out) != len(in) {
+		t.Fatalf("len = %d, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if math.Abs(out[i][0]-in[i][0]) > 1e-9 {
+			t.Fatalf("sample %d = %v, want %v", i, out[i][0], in[i][0])
+		}
+	}
+}
+
+func TestSpeedAndPitch(t *testing.T) {
+	cases := []struct {
+		speed, pitch float64
+		freq         float64
+	}{
+		{speed: 2, freq: 440},
+		{speed: 0.5, freq: 440},
+		{speed: 1.5, freq: 440},
+		{speed: 1, pitch: 12, freq: 880},
+		{speed: 1, pitch: -12, freq: 220},
+		{speed: 2, pitch: 12, freq: 880},
+	}
+	in := sine(440, int(rate)*2)
+	for _, c := range cases {
+		s := New(source(in), rate)
+		s.SetSpeed(c.speed)
+		s.SetPitch(c.pitch)
+		out := readAll(s)
+		want := float64(len(in)) / c.speed
+		if math.Abs(float64(len(out))-want) > want*0.02 {
+			t.Errorf("speed %v pitch %v: len = %d, want %v", c.speed, c.pitch, len(out), want)
+		}
+		if f := frequency(out); math.Abs(f-c.freq) > c.freq*0.02 {
+			t.Errorf("speed %v pitch %v: freq = %v, want %v", c.speed, c.pitch, f, c.freq)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	in := sine(440, int(rate)*2)
+	s := New(source(in), rate)
+	s.SetSpeed(2)
+	buf := make([][2]float64, rate.N(time.Second/10))
+	var out, pulled int
+	for i := 0; i < 5; i++ {
+		n, _ := s.Stream(buf)
+		out += n
+	}
+	pulled = s.wsola.pulled
+	// 源的位置减去未播放的部分, 应等于输出对应的媒体位置
+	if media := pulled - s.Pending(); math.Abs(float64(media-out*2)) > 2 {
+		t.Fatalf("media = %d, want %d", media, out*2)
+	}
+	s.Reset()
+	if s.Pending() != 0 {
+		t.Fatalf("pending after reset = %d", s.Pending())
+	}
+}
@@ -0,0 +1,176 @@
+package stretch
+
+import (
+	"math"
+	
+	"github.com/faiface/beep"
+)
+
+// wsola 波形相似重叠相加(WSOLA)时间伸缩: 按 tempo 的步长在输入上取帧,
+// 并在 ±tol 范围内搜索与上一帧自然延续最相似的位置, 用 50% 重叠的 Hann 窗相加, 音调不变
+type wsola struct {
+	src    beep.Streamer
+	tempo  float64
+	frame  int
+	hop    int
+	tol    int
+	window []float64
+	
+	// in 输入缓冲, 开头补了 hop 个零, 使第一帧的后半窗正好落在第一个采样上
+	in [][2]float64
+	// pos 下一帧的名义输入位置, prev 上一帧实际选中的位置, 都相对于 in[0], prev 可能为负
+	pos  float64
+	prev int
+	// acc 重叠相加缓冲, out 已经完成、等待输出的采样
+	acc [][2]float64
+	out [][2]float64
+	// skip 第一帧输出的前 hop 个采样对应补的零, 丢弃
+	skip bool
+	eof  bool
+	err  error
+	
+	// pulled 从 src 读到的采样数, media 已输出部分对应的输入采样数
+	pulled int
+	media  float64
+}
+
+func newWSOLA(src beep.Streamer, rate beep.SampleRate) *wsola {
+	w := &wsola{src: src, tempo: 1}
+	w.hop = rate.N(frameDuration) / 2
+	w.frame = w.hop * 2
+	w.tol = rate.N(seekDuration)
+	// 周期 Hann 窗, 相距半帧的两个窗之和恒为1
+	w.window = make([]float64, w.frame)
+	for i := range w.window {
+		w.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(w.frame))
+	}
+	w.reset()
+	return w
+}
+
+// reset 清空缓冲, 源 Seek 之后调用
+func (w *wsola) reset() {
+	w.in = append(w.in[:0], make([][2]float64, w.hop)...)
+	w.pos, w.prev = 0, 0
+	w.acc = make([][2]float64, w.frame)
+	w.out = w.out[:0]
+	w.skip = true
+	w.eof = false
+	w.pulled, w.media = 0, 0
+}
+
+// pending 已从源读取但还没有输出的采样数
+func (w *wsola) pending() int {
+	return w.pulled - int(w.media)
+}
+
+func (w *wsola) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		if len(w.out) == 0 {
+			if w.eof && w.media >= float64(w.pulled) {
+				break
+			}
+			w.next()
+			continue
+		}
+		c := copy(samples[n:], w.out)
+		// 源结束后只输出到最后一个输入采样为止
+		if w.eof {
+			if left := int(math.Ceil((float64(w.pulled) - w.media) / w.tempo)); c > left {
+				c = left
+				w.out = w.out[:c]
+			}
+		}
+		w.out = w.out[c:]
+		w.media += float64(c) * w.tempo
+		n += c
+	}
+	return n, n > 0
+}
+
+func (w *wsola) Err() error {
+	return w.err
+}
+
+// next 处理一帧, 产生 hop 个输出采样
+func (w *wsola) next() {
+	p := int(w.pos)
+	c := p
+	if !w.skip {
+		w.fill(max(p+w.tol, w.prev+w.hop) + w.frame)
+		if w.tempo != 1 {
+			c = w.search(p, w.prev+w.hop)
+		}
+	}
+	w.fill(c + w.frame)
+	
+	for i, v := range w.in[c : c+w.frame] {
+		w.acc[i][0] += v[0] * w.window[i]
+		w.acc[i][1] += v[1] * w.window[i]
+	}
+	if w.skip {
+		w.skip = false
+	} else {
+		w.out = append(w.out, w.acc[:w.hop]...)
+	}
+	copy(w.acc, w.acc[w.hop:])
+	for i := w.frame - w.hop; i < w.frame; i++ {
+		w.acc[i] = [2]float64{}
+	}
+	
+	w.prev = c
+	w.pos += float64(w.hop) * w.tempo
+	w.trim()
+}
+
+// search 在 p±tol 范围内寻找与 target 处波形最相似的位置
+func (w *wsola) search(p, target int) int {
+	best, bestScore := p, math.Inf(-1)
+	ref := w.in[target : target+w.hop]
+	for c := max(p-w.tol, 0); c <= p+w.tol; c++ {
+		var corr, energy float64
+		cand := w.in[c : c+w.hop]
+		// 隔一个采样计算, 对相似度影响很小
+		for i := 0; i < w.hop; i += 2 {
+			a := ref[i][0] + ref[i][1]
+			b := cand[i][0] + cand[i][1]
+			corr += a * b
+			energy += b * b
+		}
+		score := corr / math.Sqrt(energy+1e-9)
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best
+}
+
+// fill 保证输入缓冲中至少有 n 个采样, 源结束后补零
+func (w *wsola) fill(n int) {
+	for len(w.in) < n {
+		if w.eof {
+			w.in = append(w.in, make([][2]float64, n-len(w.in))...)
+			return
+		}
+		start := len(w.in)
+		w.in = append(w.in, make([][2]float64, n-start)...)
+		sn, ok := w.src.Stream(w.in[start:])
+		w.pulled += sn
+		w.in = w.in[:start+sn]
+		if !ok {
+			w.eof = true
+			w.err = w.src.Err()
+		}
+	}
+}
+
+// trim 丢弃之后不会再用到的输入
+func (w *wsola) trim() {
+	lo := min(w.prev+w.hop, int(w.pos)-w.tol)
+	if lo <= 0 {
+		return
+	}
+	w.in = append(w.in[:0], w.in[lo:]...)
+	w.pos -= float64(lo)
+	w.prev -= lo
+}
@@ -2,18 +2,18 @@ package decode
 
 import (
 	"context"
+	"errors"
 	"io"
 	"sync"
 	"time"
 	
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/decode/stretch"
 	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/music"
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/wav"
 	"k8s.io/klog"
 )
 
@@ -24,95 +24,136 @@ type beepDecoder struct {
 	cancel context.CancelFunc
 	// r is the reader of the decoder.
 	r io.ReadSeekCloser
-	// streamer is the streamer of the decoder.
+	// streamer is the streamer of the decoder, positions are relative to the trimmed range.
 	streamer beep.StreamSeekCloser
+	// pre holds the samples decoded ahead of playback.
+	pre *preStreamer
+	// trim limits playback to the track's start/end offsets.
+	trim *trimmer
 	// format is the format of the decoder.
 	format beep.Format
+	// loop repeats the A-B section.
+	loop *looper
+	// stretch changes the playback speed and pitch.
+	stretch *stretch.Stretcher
 	// ctrl is the controller of the decoder.
 	ctrl *beep.Ctrl
-	// volume is the volume of the decoder.
-	volume *effects.Volume
+	// gain applies the ReplayGain factor.
+	gain *effects.Gain
+	// limiter keeps the gained samples from clipping when the peak is unknown.
+	limiter *replaygain.Limiter
+	// replayGain is the track's loudness information.
+	replayGain replaygain.Info
+	// eq is the graphic equalizer.
+	eq *eq.Equalizer
+	// fader fades the decoder in and out.
+	fader *fader
+	// out is the decoder's stream resampled to the output sample rate.
+	out beep.Streamer
 	// cb is when action is done, call this callback.
 	cb        *music.Callback
 	musicType model.MusicType
 	// stats is the status of the decoder.
 	status    model.StatusController
 	playOnce  sync.Once
+	doneOnce  sync.Once
 	closeOnce sync.Once
 }
 
-func newBeepDecoder(ctx context.Context, reader io.ReadSeekCloser, volume float64, cb *music.Callback, Type model.MusicType) (Decoder, error) {
-	var (
-		streamer beep.StreamSeekCloser
-		format   beep.Format
-		err      error
-		decoder  beepDecoder
-	)
-	switch Type {
-	case model.MusicTypeMP3:
-		streamer, format, err = mp3.Decode(reader)
-	case model.MusicTypeFLAC:
-		streamer, format, err = flac.Decode(reader)
-	case model.MusicTypeWAV:
-		streamer, format, err = wav.Decode(reader)
-	default:
-		panic("unhandled default case")
+// decodeStream 按注册的格式打开解码流
+func decodeStream(reader io.ReadSeekCloser, Type model.MusicType) (beep.StreamSeekCloser, beep.Format, error) {
+	c, ok := Lookup(Type)
+	if !ok {
+		return nil, beep.Format{}, ErrUnknownType
 	}
+	return c.Decode(reader)
+}
+
+func newBeepDecoder(ctx context.Context, reader io.ReadSeekCloser, volume float64, cb *music.Callback, Type model.MusicType) (Decoder, error) {
+	var decoder beepDecoder
+	streamer, format, err := decodeStream(reader, Type)
 	if err != nil {
 		return nil, err
 	}
 	decoder.ctx, decoder.cancel = context.WithCancel(ctx)
 	
 	decoder.r = reader
-	decoder.streamer = streamer
+	decoder.pre = &preStreamer{StreamSeekCloser: streamer}
+	decoder.trim = &trimmer{StreamSeekCloser: decoder.pre}
+	decoder.streamer = decoder.trim
 	decoder.format = format
-	decoder.ctrl = &beep.Ctrl{Streamer: beep.Seq(streamer, beep.Callback(func() {
-		decoder.Close()
-	})), Paused: false}
-	decoder.volume = &effects.Volume{
-		Streamer: decoder.ctrl,
-		Base:     2,
-		Silent:   false,
-	}
+	decoder.loop = &looper{StreamSeeker: decoder.streamer}
+	decoder.stretch = stretch.New(decoder.loop, format.SampleRate)
+	decoder.ctrl = &beep.Ctrl{Streamer: decoder.stretch, Paused: false}
+	decoder.gain = &effects.Gain{Streamer: decoder.ctrl}
+	decoder.limiter = replaygain.NewLimiter(decoder.gain, format.SampleRate)
+	decoder.eq = eq.New(decoder.limiter, format.SampleRate)
+	decoder.fader = &fader{Streamer: decoder.eq, gain: 1, target: 1}
+	decoder.out = _output.resample(decoder.fader, format.SampleRate)
 	decoder.cb = cb
 	decoder.musicType = Type
 	decoder.SetVolume(volume)
+	_output.lock()
+	decoder.eq.Set(_output.eq)
+	decoder.stretch.SetSpeed(_output.speed)
+	decoder.stretch.SetPitch(_output.pitch)
+	_output.unlock()
 	
 	return &decoder, nil
 }
 
 func (d *beepDecoder) Play() {
-	speaker.Lock()
-	defer speaker.Unlock()
-	d.ctrl.Paused = false
+	_output.lock()
+	if d.ctrl.Paused || d.fader.target == 0 {
+		d.ctrl.Paused = false
+		d.fader.to(1, d.format.SampleRate.N(fadeDuration), nil)
+	}
+	_output.unlock()
+	_output.play(d)
+	d.start()
+	return
+}
+
+// Prepare 预解码开头的一小段音频, 并挂到当前播放流之后, 当前音乐结束时无缝衔接
+func (d *beepDecoder) Prepare() bool {
+	d.pre.fill(d.format.SampleRate.N(preDecodeDuration))
+	return _output.enqueue(d)
+}
+
+// start 启动进度回调, 只会执行一次
+func (d *beepDecoder) start() {
 	d.playOnce.Do(func() {
-		go d.Runner()
+		stop := _output.out.Every(progressInterval, d.tick)
+		go func() {
+			<-d.ctx.Done()
+			stop()
+		}()
 	})
-	return
 }
 
 func (d *beepDecoder) Pause() {
-	speaker.Lock()
-	defer speaker.Unlock()
-	d.ctrl.Paused = true
+	_output.lock()
+	d.fader.to(0, d.format.SampleRate.N(fadeDuration), func() {
+		d.ctrl.Paused = true
+	})
+	_output.unlock()
+	_output.hurry()
 	return
 }
 
 func (d *beepDecoder) Stop() {
 	d.status.SetStop()
+	if _output.stop(d) {
+		return
+	}
 	d.Close()
 }
 
 var _volume = [101]float64{-6.60, -6.60, -5.64, -5.05, -4.64, -4.32, -4.05, -3.83, -3.64, -3.47, -3.32, -3.18, -3.05, -2.94, -2.83, -2.73, -2.64, -2.55, -2.47, -2.39, -2.32, -2.25, -2.18, -2.12, -2.05, -2.00, -1.94, -1.88, -1.83, -1.78, -1.73, -1.68, -1.64, -1.59, -1.55, -1.51, -1.47, -1.43, -1.39, -1.35, -1.32, -1.28, -1.25, -1.21, -1.18, -1.15, -1.12, -1.08, -1.05, -1.02, -1.00, -0.97, -0.94, -0.91, -0.88, -0.86, -0.83, -0.81, -0.78, -0.76, -0.73, -0.71, -0.68, -0.66, -0.64, -0.62, -0.59, -0.57, -0.55, -0.53, -0.51, -0.49, -0.47, -0.45, -0.43, -0.41, -0.39, -0.37, -0.35, -0.34, -0.32, -0.30, -0.28, -0.26, -0.25, -0.23, -0.21, -0.20, -0.18, -0.16, -0.15, -0.13, -0.12, -0.10, -0.08, -0.07, -0.05, -0.04, -0.02, -0.01, -0.00}
 
+// SetVolume 设置的是混音器的主音量, 对所有解码器生效
 func (d *beepDecoder) SetVolume(f float64) {
-	speaker.Lock()
-	defer speaker.Unlock()
-	if f > 1 {
-		f = 1
-	}
-	
-	d.volume.Volume = _volume[int(f*100)]
+	SetVolume(f)
 }
 
 func (d *beepDecoder) Seek(f float64) {
@@ -120,73 +161,137 @@ func (d *beepDecoder) Seek(f float64) {
 		f = 100
 	}
 	total := d.streamer.Len()
-	seek := int(float64(total) * f / 100)
-	speaker.Lock()
-	defer speaker.Unlock()
-	if err := d.streamer.Seek(seek); err != nil {
+	d.seek(int(float64(total) * f / 100))
+}
+
+func (d *beepDecoder) SeekTime(t time.Duration) {
+	d.seek(d.format.SampleRate.N(t))
+}
+
+// seek 跳转到指定采样
+func (d *beepDecoder) seek(pos int) {
+	pos = max(0, min(pos, d.streamer.Len()))
+	_output.lock()
+	defer _output.unlock()
+	if err := d.streamer.Seek(pos); err != nil {
 		klog.Error(err)
 		return
 	}
+	d.stretch.Reset()
 }
 
 func (d *beepDecoder) Metadata() (Metadata, error) {
-	var err error
-	var m Metadata
-	switch d.musicType {
-	case model.MusicTypeMP3:
-		_, _ = d.r.Seek(0, 0)
-		m, err = getMP3Metadata(d.r)
-	case model.MusicTypeFLAC:
-		_, _ = d.r.Seek(0, 0)
-		m, err = getFLACMetadata(d.r)
-	case model.MusicTypeWAV:
-		_, _ = d.r.Seek(0, 0)
-		m, err = getWAVMetadata(d.r)
-	}
+	m, err := ReadMetadata(d.r, d.musicType)
 	if err != nil {
 		return Metadata{}, err
 	}
-	
-	m.EndTime = d.format.SampleRate.D(d.streamer.Len()).Round(time.Second)
+	m.Duration = d.format.SampleRate.D(d.streamer.Len()).Round(time.Second)
 	return m, nil
 }
 func (d *beepDecoder) CurTime() time.Duration {
-	return d.format.SampleRate.D(d.streamer.Position()).Round(time.Second)
+	_output.lock()
+	defer _output.unlock()
+	return d.format.SampleRate.D(d.position())
 }
 func (d *beepDecoder) EndTime() time.Duration {
 	return d.format.SampleRate.D(d.streamer.Len()).Round(time.Second)
 }
 
-func (d *beepDecoder) Runner() {
-	speaker.Init(d.format.SampleRate, d.format.SampleRate.N(time.Second/10))
-	speaker.Play(d.volume)
-	defer d.Close()
-	defer speaker.Clear()
-	ticker := time.NewTicker(time.Millisecond * 500)
-	for {
-		select {
-		case <-d.ctx.Done():
-			return
-		case <-ticker.C:
-			if d.cb != nil {
-				d.cb.CurTime(d.format.SampleRate.D(d.streamer.Position()).Round(time.Second))
-			}
-		}
+// progressInterval 进度回调的间隔, 按输出后端的时钟计时
+const progressInterval = time.Millisecond * 500
+
+// tick 回调当前的播放进度
+func (d *beepDecoder) tick() {
+	if d.ctx.Err() != nil || d.cb == nil {
+		return
 	}
+	d.cb.CurTime(d.CurTime().Round(time.Second))
 }
 
 func (d *beepDecoder) Close() {
 	d.closeOnce.Do(func() {
-		d.cancel()
+		_output.detach(d)
+		// 关闭之前检查解码错误
+		d.done()
 		if d.streamer != nil {
 			_ = d.streamer.Close()
 		}
 		if d.r != nil {
 			_ = d.r.Close()
 		}
-		d.status.SetPlayDone()
+	})
+}
+
+// done 通知播放结束, 交叉淡化时会早于 Close 调用。
+// 解码流因为错误(例如损坏的帧)提前结束时报告 StatusPlayFailed
+func (d *beepDecoder) done() {
+	d.doneOnce.Do(func() {
+		d.cancel()
+		var err error
+		if d.streamer != nil {
+			err = d.streamer.Err()
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			d.status.SetPlayFailed()
+		} else {
+			d.status.SetPlayDone()
+		}
+		status := d.status.Load()
+		if status != model.StatusPlayFailed {
+			err = nil
+		}
 		if d.cb != nil {
-			go d.cb.DoneFn(d.status.Load())
+			go d.cb.DoneFn(status, err)
 		}
 	})
 }
+
+// position 正在播放的媒体位置(采样), 不含变速缓冲中还没有播放的部分, 调用方需持有 输出锁
+func (d *beepDecoder) position() int {
+	return max(d.streamer.Position()-d.stretch.Pending(), 0)
+}
+
+// remaining 播放到结尾还需要输出的采样数, 已按播放速度换算, 调用方需持有 输出锁
+func (d *beepDecoder) remaining() int {
+	return int(float64(d.streamer.Len()-d.position()) / d.stretch.Speed())
+}
+
+// preDecodeDuration is how much audio Prepare decodes before the track starts.
+const preDecodeDuration = time.Second / 2
+
+// preStreamer serves samples decoded ahead of time before pulling from the underlying streamer.
+type preStreamer struct {
+	beep.StreamSeekCloser
+	buf [][2]float64
+}
+
+// fill 预解码n个采样, 调用时解码器还未挂到播放流上, 无需加锁
+func (p *preStreamer) fill(n int) {
+	if len(p.buf) > 0 {
+		return
+	}
+	buf := make([][2]float64, n)
+	n, _ = p.StreamSeekCloser.Stream(buf)
+	p.buf = buf[:n]
+}
+
+func (p *preStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if len(p.buf) > 0 {
+		n = copy(samples, p.buf)
+		p.buf = p.buf[n:]
+		if n == len(samples) {
+			return n, true
+		}
+	}
+	sn, ok := p.StreamSeekCloser.Stream(samples[n:])
+	return n + sn, ok || n > 0
+}
+
+func (p *preStreamer) Position() int {
+	return p.StreamSeekCloser.Position() - len(p.buf)
+}
+
+func (p *preStreamer) Seek(pos int) error {
+	p.buf = nil
+	return p.StreamSeekCloser.Seek(pos)
+}
@@ -0,0 +1,95 @@
+package decode
+
+import (
+	"io"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+	"k8s.io/klog"
+)
+
+// trimmer 只播放 [start,end) 之间的部分, end 为 0 时播放到结尾, 对外的位置和长度都相对于 start;
+// 字段由 输出锁保护。位于循环之前, 进度、跳转、交叉淡化和播放结束都以裁剪后的范围为准
+type trimmer struct {
+	beep.StreamSeekCloser
+	start, end int
+}
+
+func (t *trimmer) Stream(samples [][2]float64) (n int, ok bool) {
+	if t.end > 0 {
+		remain := t.end - t.StreamSeekCloser.Position()
+		if remain <= 0 {
+			return 0, false
+		}
+		samples = samples[:min(len(samples), remain)]
+	}
+	return t.StreamSeekCloser.Stream(samples)
+}
+
+// Len 边下载边播放时总长度是估算的, 没有裁剪结尾时跟随底层的长度
+func (t *trimmer) Len() int {
+	if t.end > 0 {
+		return t.end - t.start
+	}
+	return max(t.StreamSeekCloser.Len()-t.start, 0)
+}
+
+func (t *trimmer) Position() int {
+	return max(t.StreamSeekCloser.Position()-t.start, 0)
+}
+
+func (t *trimmer) Seek(p int) error {
+	return t.StreamSeekCloser.Seek(p + t.start)
+}
+
+// SetTrim 只播放 [start,end) 之间的部分, end<=0 表示到结尾, 范围无效时不裁剪
+func (d *beepDecoder) SetTrim(start, end time.Duration) {
+	_output.lock()
+	defer _output.unlock()
+	total := d.trim.StreamSeekCloser.Len()
+	a := max(d.format.SampleRate.N(start), 0)
+	var b int
+	if end > 0 && d.format.SampleRate.N(end) < total {
+		b = d.format.SampleRate.N(end)
+	}
+	if a >= total || (b > 0 && b <= a) {
+		a, b = 0, 0
+	}
+	if a == d.trim.start && b == d.trim.end {
+		return
+	}
+	
+	// 尽量保持当前的播放位置, 超出新的范围时从头播放
+	pos := d.trim.StreamSeekCloser.Position()
+	d.trim.start, d.trim.end = a, b
+	d.loop.a, d.loop.b = 0, 0
+	if pos >= a && (b == 0 || pos < b) {
+		return
+	}
+	if err := d.trim.Seek(0); err != nil {
+		klog.Error(err)
+		return
+	}
+	d.stretch.Reset()
+}
+
+// openRegion 打开音乐中 [start,end) 之间的部分, end<=0 表示到结尾, 用于 CUE 整轨中的一轨; 不会关闭 reader
+func openRegion(reader io.ReadSeeker, Type model.MusicType, start, end time.Duration) (beep.StreamSeekCloser, beep.Format, error) {
+	streamer, format, err := decodeStream(nopCloser{reader}, Type)
+	if err != nil {
+		return nil, format, err
+	}
+	if start <= 0 && end <= 0 {
+		return streamer, format, nil
+	}
+	t := &trimmer{StreamSeekCloser: streamer, start: format.SampleRate.N(start)}
+	if end > 0 {
+		t.end = format.SampleRate.N(end)
+	}
+	if err := t.Seek(0); err != nil {
+		_ = streamer.Close()
+		return nil, format, err
+	}
+	return t, format, nil
+}
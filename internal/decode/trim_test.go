@@ -0,0 +1,64 @@
+package decode
+
+import "testing"
+
+// counter 长度为 n 的测试流, 第 i 个采样的值为 i
+type counter struct {
+	pos, n int
+}
+
+func (c *counter) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) && c.pos < c.n {
+		samples[n] = [2]float64{float64(c.pos), float64(c.pos)}
+		n, c.pos = n+1, c.pos+1
+	}
+	return n, n > 0
+}
+
+func (c *counter) Err() error {
+	return nil
+}
+
+func (c *counter) Len() int {
+	return c.n
+}
+
+func (c *counter) Position() int {
+	return c.pos
+}
+
+func (c *counter) Seek(p int) error {
+	c.pos = p
+	return nil
+}
+
+func (c *counter) Close() error {
+	return nil
+}
+
+func TestTrimmer(t *testing.T) {
+	s := &trimmer{StreamSeekCloser: &counter{n: 100}, start: 10, end: 30}
+	if err := s.Seek(0); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 20 || s.Position() != 0 {
+		t.Fatalf("len = %d, position = %d", s.Len(), s.Position())
+	}
+	buf := make([][2]float64, 50)
+	n, ok := s.Stream(buf)
+	if !ok || n != 20 || buf[0][0] != 10 || buf[n-1][0] != 29 {
+		t.Fatalf("stream = %d %v, first %v, last %v", n, ok, buf[0], buf[n-1])
+	}
+	if n, ok := s.Stream(buf); n != 0 || ok {
+		t.Fatalf("stream after end = %d %v", n, ok)
+	}
+	
+	// 没有裁剪结尾时播放到底层的结尾
+	s.end = 0
+	if err := s.Seek(85); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Stream(buf); s.Len() != 90 || n != 5 || buf[0][0] != 95 {
+		t.Fatalf("len = %d, stream = %d, first %v", s.Len(), n, buf[0])
+	}
+}
@@ -0,0 +1,23 @@
+package decode
+
+import (
+	"context"
+	"io"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/model"
+)
+
+// ExtractWaveform 完整解码一遍 [start,end) 之间的部分并提取峰值波形, end<=0 表示到结尾, 不会关闭 reader.
+// CUE 中的一轨按自己的范围提取, 与整个文件一样有 waveform.Points 个点
+func ExtractWaveform(ctx context.Context, Type model.MusicType, reader io.ReadSeeker, start, end time.Duration) (waveform.Peaks, error) {
+	streamer, format, err := openRegion(reader, Type, start, end)
+	if err != nil {
+		return waveform.Peaks{}, err
+	}
+	defer func() {
+		_ = streamer.Close()
+	}()
+	return waveform.Extract(ctx, streamer, format, streamer.Len())
+}
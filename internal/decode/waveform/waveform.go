@@ -0,0 +1,121 @@
+// Package waveform 提取整首音乐的峰值波形, 用于进度条显示, 并提供磁盘缓存的编码
+package waveform
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+// Points 每首音乐的峰值点数
+const Points = 1000
+
+// magic 缓存文件头, 最后一个字节为版本号
+var magic = []byte("MPWF\x01")
+
+var ErrUnknownLength = errors.New("waveform: unknown length")
+
+// Peaks 峰值波形, Values[i] 是第 i 段采样的最大绝对值, 量化到 [0,255]
+type Peaks struct {
+	Duration time.Duration
+	Values   []uint8
+}
+
+// Extract 完整解码一遍, 把 s 均分为 Points 段取每段的峰值, total 为 s 的总采样数
+func Extract(ctx context.Context, s beep.Streamer, format beep.Format, total int) (Peaks, error) {
+	e, err := NewExtractor(format, total)
+	if err != nil {
+		return Peaks{}, err
+	}
+	buf := make([][2]float64, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Peaks{}, err
+		}
+		n, ok := s.Stream(buf)
+		e.Add(buf[:n])
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Peaks{}, err
+	}
+	return e.Peaks(), nil
+}
+
+// Extractor 逐块提取峰值, 用于在同一遍解码中同时做其它分析
+type Extractor struct {
+	p          Peaks
+	total, pos int
+}
+
+// NewExtractor total 为总采样数, 未知时返回 ErrUnknownLength
+func NewExtractor(format beep.Format, total int) (*Extractor, error) {
+	if total <= 0 {
+		return nil, ErrUnknownLength
+	}
+	return &Extractor{p: Peaks{Duration: format.SampleRate.D(total), Values: make([]uint8, Points)}, total: total}, nil
+}
+
+func (e *Extractor) Add(frames [][2]float64) {
+	for _, frame := range frames {
+		// 实际长度可能与 total 略有出入, 超出部分算在最后一段
+		i := min(e.pos*Points/e.total, Points-1)
+		peak := math.Max(math.Abs(frame[0]), math.Abs(frame[1]))
+		if v := uint8(math.Round(math.Min(peak, 1) * math.MaxUint8)); v > e.p.Values[i] {
+			e.p.Values[i] = v
+		}
+		e.pos++
+	}
+}
+
+func (e *Extractor) Peaks() Peaks {
+	return e.p
+}
+
+// MarshalBinary 缓存文件格式: 文件头, 时长(纳秒), 点数, 各点的值
+func (p Peaks) MarshalBinary() ([]byte, error) {
+	buf := append([]byte{}, magic...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(p.Duration))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.Values)))
+	return append(buf, p.Values...), nil
+}
+
+func (p *Peaks) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, magic) || len(data) < len(magic)+12 {
+		return errors.New("waveform: invalid cache")
+	}
+	data = data[len(magic):]
+	duration := time.Duration(binary.LittleEndian.Uint64(data))
+	n := binary.LittleEndian.Uint32(data[8:])
+	data = data[12:]
+	if uint32(len(data)) != n {
+		return errors.New("waveform: truncated cache")
+	}
+	p.Duration = duration
+	p.Values = append([]uint8{}, data...)
+	return nil
+}
+
+// Slice 截取 [start,end) 之间的波形, end<=0 表示到结尾, 用于只显示裁剪后的部分
+func (p Peaks) Slice(start, end time.Duration) Peaks {
+	if p.Duration <= 0 || len(p.Values) == 0 {
+		return p
+	}
+	if end <= 0 || end > p.Duration {
+		end = p.Duration
+	}
+	start = max(start, 0)
+	if end <= start {
+		return p
+	}
+	lo := int(int64(start) * int64(len(p.Values)) / int64(p.Duration))
+	hi := int((int64(end)*int64(len(p.Values)) + int64(p.Duration) - 1) / int64(p.Duration))
+	return Peaks{Duration: end - start, Values: p.Values[lo:max(hi, lo+1)]}
+}
@@ -0,0 +1,75 @@
+package waveform
+
+import (
+	"context"
+	"testing"
+	"time"
+	
+	"github.com/faiface/beep"
+)
+
+func TestExtract(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	total := format.SampleRate.N(time.Second * 2)
+	// 前一半音量 0.5, 后一半静音
+	var pos int
+	s := beep.Take(total, beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := 0.0
+			if pos < total/2 {
+				v = 0.5
+				if pos%2 == 1 {
+					v = -0.5
+				}
+			}
+			samples[i] = [2]float64{v, v}
+			pos++
+		}
+		return len(samples), true
+	}))
+	p, err := Extract(context.Background(), s, format, total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Duration != time.Second*2 || len(p.Values) != Points {
+		t.Fatalf("duration = %v, points = %d", p.Duration, len(p.Values))
+	}
+	for i, v := range p.Values {
+		want := uint8(128)
+		if i >= Points/2 {
+			want = 0
+		}
+		if v != want {
+			t.Fatalf("value %d = %d, want %d", i, v, want)
+		}
+	}
+	
+	data, _ := p.MarshalBinary()
+	var q Peaks
+	if err := q.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if q.Duration != p.Duration || string(q.Values) != string(p.Values) {
+		t.Fatal("round trip mismatch")
+	}
+	if err := q.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated cache accepted")
+	}
+}
+
+func TestSlice(t *testing.T) {
+	p := Peaks{Duration: time.Second * 10, Values: make([]uint8, 10)}
+	for i := range p.Values {
+		p.Values[i] = uint8(i)
+	}
+	s := p.Slice(time.Second*2, time.Second*5)
+	if s.Duration != time.Second*3 || len(s.Values) != 3 || s.Values[0] != 2 {
+		t.Fatalf("slice = %+v", s)
+	}
+	if s := p.Slice(time.Second*8, 0); s.Duration != time.Second*2 || len(s.Values) != 2 {
+		t.Fatalf("slice to end = %+v", s)
+	}
+	if s := p.Slice(0, 0); s.Duration != p.Duration || len(s.Values) != len(p.Values) {
+		t.Fatalf("no trim = %+v", s)
+	}
+}
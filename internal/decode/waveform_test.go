@@ -0,0 +1,55 @@
+package decode
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+)
+
+// TestExtractWaveformRegion CUE 中的一轨只提取自己的范围, 点数与整个文件相同
+func TestExtractWaveformRegion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 前4秒静音, 后4秒是固定的幅度
+	loud := beep.Take(44100*4, beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			samples[i] = [2]float64{0.5, 0.5}
+		}
+		return len(samples), true
+	}))
+	if err := encode.Encode(context.Background(), f, beep.Seq(beep.Silence(44100*4), loud), 44100, 16, encode.FormatWAV, encode.Tags{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	peaks, err := ExtractWaveform(context.Background(), model.MusicTypeWAV, bytes.NewReader(buf), time.Second*5, time.Second*7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peaks.Duration != time.Second*2 || len(peaks.Values) != waveform.Points {
+		t.Fatalf("duration = %v, points = %d", peaks.Duration, len(peaks.Values))
+	}
+	for i, v := range peaks.Values {
+		if v == 0 {
+			t.Fatalf("point %d = %d, want loud", i, v)
+		}
+	}
+	if peaks, err = ExtractWaveform(context.Background(), model.MusicTypeWAV, bytes.NewReader(buf), 0, time.Second*4); err != nil || peaks.Values[waveform.Points-1] != 0 {
+		t.Fatalf("silent region = %v %v", peaks.Values[waveform.Points-1], err)
+	}
+}
@@ -0,0 +1,144 @@
+// Package encode 把解码后的音频编码为 WAV 或 FLAC, 用于转码和片段导出
+package encode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+)
+
+// Format 导出格式
+type Format int
+
+const (
+	FormatWAV Format = iota
+	FormatFLAC
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatWAV:
+		return "WAV"
+	case FormatFLAC:
+		return "FLAC"
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Ext 文件扩展名, 带点
+func (f Format) Ext() string {
+	switch f {
+	case FormatFLAC:
+		return ".flac"
+	default:
+		return ".wav"
+	}
+}
+
+// BitDepths 支持的位深
+var BitDepths = []int{16, 24}
+
+// Options 导出设置, SampleRate 为 0 时保持原采样率, BitDepth 为 0 时保持原位深(不支持的位深按 16 位)
+type Options struct {
+	Format     Format
+	SampleRate beep.SampleRate
+	BitDepth   int
+}
+
+// BitDepthFor 按导出设置和源的精度(字节)决定位深
+func (o Options) BitDepthFor(precision int) int {
+	if o.BitDepth != 0 {
+		return o.BitDepth
+	}
+	if validBitDepth(precision * 8) {
+		return precision * 8
+	}
+	return 16
+}
+
+// Tags 写入导出文件的标签, Track 和 Year 为 0 表示没有
+type Tags struct {
+	Title      string
+	Artist     string
+	Album      string
+	Track      int
+	Genre      string
+	Year       int
+	ReplayGain replaygain.Info
+	// Cover 封面, FLAC 写为 PICTURE 块, WAV 写在 id3 块中; 为 nil 时没有封面
+	Cover *tag.Picture
+}
+
+var ErrBitDepth = errors.New("encode: unsupported bit depth")
+
+// encoder 按帧写入采样, 关闭时回写文件头
+type encoder interface {
+	write(samples [][2]float64) error
+	close() error
+}
+
+// Encode 把 s 的全部采样编码写入 w, s 的采样率为 sampleRate, 位深按 bitDepth 量化。
+// w 必须可以 Seek, 文件头中的长度在结束时回写
+func Encode(ctx context.Context, w io.WriteSeeker, s beep.Streamer, sampleRate beep.SampleRate, bitDepth int, f Format, tags Tags) error {
+	if !validBitDepth(bitDepth) {
+		return fmt.Errorf("%w: %d", ErrBitDepth, bitDepth)
+	}
+	var (
+		enc encoder
+		err error
+	)
+	switch f {
+	case FormatWAV:
+		enc, err = newWAVEncoder(w, sampleRate, bitDepth, tags)
+	case FormatFLAC:
+		enc, err = newFLACEncoder(w, sampleRate, bitDepth, tags)
+	default:
+		return fmt.Errorf("encode: unknown format %v", f)
+	}
+	if err != nil {
+		return err
+	}
+	
+	buf := make([][2]float64, flacBlockSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, ok := s.Stream(buf)
+		if n > 0 {
+			if err := enc.write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return enc.close()
+}
+
+func validBitDepth(bits int) bool {
+	for _, b := range BitDepths {
+		if b == bits {
+			return true
+		}
+	}
+	return false
+}
+
+// quantize 把 [-1,1] 的采样四舍五入为 bits 位有符号整数, 超出范围的截断
+func quantize(v float64, bits int) int64 {
+	scale := float64(int64(1) << (bits - 1))
+	x := math.Round(v * scale)
+	return int64(math.Max(-scale, math.Min(scale-1, x)))
+}
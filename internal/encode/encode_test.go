@@ -0,0 +1,155 @@
+package encode
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	gowav "github.com/go-audio/wav"
+)
+
+// testSignal 已经按 bitDepth 量化的测试信号: 正弦波、噪声、静音和左右声道相同的部分, 长度不是块大小的整数倍
+func testSignal(bitDepth int) [][2]float64 {
+	rng := rand.New(rand.NewSource(1))
+	scale := float64(int64(1) << (bitDepth - 1))
+	samples := make([][2]float64, flacBlockSize*5+123)
+	for i := range samples {
+		var l, r float64
+		switch i / flacBlockSize {
+		case 0:
+			l = 0.5 * math.Sin(float64(i)/10)
+			r = 0.3 * math.Sin(float64(i)/7)
+		case 1:
+			l, r = rng.Float64()*2-1, rng.Float64()*2-1
+		case 2:
+			// 静音
+		case 3:
+			l = 0.8 * math.Sin(float64(i)/20)
+			r = l
+		default:
+			l = 1
+			r = -1
+		}
+		samples[i] = [2]float64{float64(quantize(l, bitDepth)) / scale, float64(quantize(r, bitDepth)) / scale}
+	}
+	return samples
+}
+
+var testTags = Tags{Title: "Title", Artist: "Artist", Album: "Album", Track: 3, ReplayGain: replaygain.Info{TrackGain: -6.5, TrackPeak: 0.9, HasTrack: true}}
+
+// encodeFile 编码到临时文件并重新打开
+func encodeFile(t *testing.T, samples [][2]float64, bitDepth int, f Format) *os.File {
+	path := filepath.Join(t.TempDir(), "out"+f.Ext())
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	s := beep.StreamerFunc(func(buf [][2]float64) (int, bool) {
+		n := copy(buf, samples)
+		samples = samples[n:]
+		return n, n > 0
+	})
+	if err := Encode(context.Background(), file, s, 44100, bitDepth, f, testTags); err != nil {
+		t.Fatal(err)
+	}
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// checkDecoded 解码出的采样与原始采样完全一致
+func checkDecoded(t *testing.T, s beep.StreamSeekCloser, format beep.Format, want [][2]float64, bitDepth int) {
+	if format.SampleRate != 44100 || format.Precision != bitDepth/8 {
+		t.Fatalf("format = %+v", format)
+	}
+	if s.Len() != len(want) {
+		t.Fatalf("len = %d, want %d", s.Len(), len(want))
+	}
+	got := make([][2]float64, len(want)+10)
+	n, _ := s.Stream(got)
+	for n < len(want) {
+		sn, ok := s.Stream(got[n:])
+		n += sn
+		if !ok {
+			break
+		}
+	}
+	if n != len(want) {
+		t.Fatalf("decoded %d samples, want %d", n, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFLAC(t *testing.T) {
+	for _, bitDepth := range BitDepths {
+		samples := testSignal(bitDepth)
+		r := encodeFile(t, samples, bitDepth, FormatFLAC)
+		s, format, err := flac.Decode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDecoded(t, s, format, samples, bitDepth)
+		
+		_, _ = r.Seek(0, io.SeekStart)
+		m, err := tag.ReadFrom(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track, _ := m.Track(); m.Title() != "Title" || m.Artist() != "Artist" || m.Album() != "Album" || track != 3 {
+			t.Fatalf("tags = %v", m.Raw())
+		}
+		if info := replaygain.FromTags(m.Raw()); !info.HasTrack || info.TrackGain != -6.5 {
+			t.Fatalf("replay gain = %+v", info)
+		}
+		// 比 WAV 小
+		stat, _ := r.Stat()
+		if raw := int64(len(samples) * 2 * bitDepth / 8); stat.Size() >= raw {
+			t.Fatalf("flac size %d >= raw size %d", stat.Size(), raw)
+		}
+	}
+}
+
+func TestWAV(t *testing.T) {
+	for _, bitDepth := range BitDepths {
+		samples := testSignal(bitDepth)
+		r := encodeFile(t, samples, bitDepth, FormatWAV)
+		// beep/wav 解码 16 位时缩放有误差, 直接比较整数采样
+		buf, _ := os.ReadFile(r.Name())
+		d := gowav.NewDecoder(bytes.NewReader(buf))
+		pcm, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.SampleRate != 44100 || int(d.BitDepth) != bitDepth || len(pcm.Data) != len(samples)*2 {
+			t.Fatalf("rate = %d, bit depth = %d, samples = %d", d.SampleRate, d.BitDepth, len(pcm.Data))
+		}
+		for i, v := range pcm.Data {
+			if want := quantize(samples[i/2][i%2], bitDepth); int64(v) != want {
+				t.Fatalf("sample %d = %d, want %d", i, v, want)
+			}
+		}
+		
+		d = gowav.NewDecoder(bytes.NewReader(buf))
+		d.ReadMetadata()
+		if d.Metadata == nil || d.Metadata.Title != "Title" || d.Metadata.Artist != "Artist" || d.Metadata.Product != "Album" || d.Metadata.TrackNbr != "3" {
+			t.Fatalf("metadata = %+v", d.Metadata)
+		}
+	}
+}
@@ -0,0 +1,570 @@
+package encode
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math/bits"
+	"strconv"
+	
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+)
+
+// flacBlockSize 每帧的采样数, 最后一帧可以更短
+const flacBlockSize = 4096
+
+// flacMaxPartitionOrder Rice 分区阶数的上限
+const flacMaxPartitionOrder = 6
+
+// flacEncoder 使用固定预测(0~4 阶)和 Rice 编码的 FLAC 编码器, 每帧在独立、左/差、右/差、中/差
+// 四种声道编码中选择最小的一种。STREAMINFO 中的总采样数、帧大小和 MD5 在关闭时回写
+type flacEncoder struct {
+	w          io.WriteSeeker
+	sampleRate beep.SampleRate
+	bitDepth   int
+	// pending 还不够一帧的采样
+	pending [2][]int64
+	frame   uint64
+	total   uint64
+	// 帧的最小和最大字节数
+	minFrame, maxFrame int
+	md5                hash.Hash
+	bw                 bitWriter
+}
+
+func newFLACEncoder(w io.WriteSeeker, sampleRate beep.SampleRate, bitDepth int, tags Tags) (*flacEncoder, error) {
+	e := &flacEncoder{w: w, sampleRate: sampleRate, bitDepth: bitDepth, md5: md5.New()}
+	header := append([]byte("fLaC"), blockHeader(0, false, 34)...)
+	header = append(header, e.streamInfo()...)
+	comment := vorbisComment(tags)
+	header = append(header, blockHeader(4, tags.Cover == nil, len(comment))...)
+	header = append(header, comment...)
+	if tags.Cover != nil {
+		picture := pictureBlock(tags.Cover)
+		header = append(header, blockHeader(6, true, len(picture))...)
+		header = append(header, picture...)
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// blockHeader 元数据块头: 1 位是否最后一块, 7 位类型, 24 位长度
+func blockHeader(typ byte, last bool, length int) []byte {
+	if last {
+		typ |= 0x80
+	}
+	return []byte{typ, byte(length >> 16), byte(length >> 8), byte(length)}
+}
+
+// streamInfo STREAMINFO 块的内容, 编码结束前总采样数和 MD5 为 0
+func (e *flacEncoder) streamInfo() []byte {
+	block := uint64(flacBlockSize)
+	if e.total > 0 && e.total < block {
+		block = e.total
+	}
+	var w bitWriter
+	w.write(block, 16)
+	w.write(block, 16)
+	w.write(uint64(e.minFrame), 24)
+	w.write(uint64(e.maxFrame), 24)
+	w.write(uint64(e.sampleRate), 20)
+	w.write(2-1, 3)
+	w.write(uint64(e.bitDepth-1), 5)
+	w.write(e.total, 36)
+	var sum [md5.Size]byte
+	if e.total > 0 {
+		copy(sum[:], e.md5.Sum(nil))
+	}
+	return append(w.bytes(), sum[:]...)
+}
+
+// vorbisComment VORBIS_COMMENT 块的内容, 长度为小端序
+func vorbisComment(tags Tags) []byte {
+	var comments []string
+	add := func(key, value string) {
+		if value != "" {
+			comments = append(comments, key+"="+value)
+		}
+	}
+	add("TITLE", tags.Title)
+	add("ARTIST", tags.Artist)
+	add("ALBUM", tags.Album)
+	if tags.Track > 0 {
+		add("TRACKNUMBER", strconv.Itoa(tags.Track))
+	}
+	add("GENRE", tags.Genre)
+	if tags.Year > 0 {
+		add("DATE", strconv.Itoa(tags.Year))
+	}
+	rg := tags.ReplayGain
+	if rg.HasTrack {
+		add("REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", rg.TrackGain))
+		if rg.TrackPeak > 0 {
+			add("REPLAYGAIN_TRACK_PEAK", fmt.Sprintf("%.6f", rg.TrackPeak))
+		}
+	}
+	if rg.HasAlbum {
+		add("REPLAYGAIN_ALBUM_GAIN", fmt.Sprintf("%.2f dB", rg.AlbumGain))
+		if rg.AlbumPeak > 0 {
+			add("REPLAYGAIN_ALBUM_PEAK", fmt.Sprintf("%.6f", rg.AlbumPeak))
+		}
+	}
+	
+	const vendor = "music_player"
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+// pictureTypeFront FLAC PICTURE 块和 ID3 APIC 帧中的封面(正面)类型
+const pictureTypeFront = 3
+
+// pictureBlock PICTURE 块的内容, 长度为大端序; 图片的尺寸和色深填 0 表示未知
+func pictureBlock(p *tag.Picture) []byte {
+	b := binary.BigEndian.AppendUint32(nil, pictureTypeFront)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.MIMEType)))
+	b = append(b, p.MIMEType...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Description)))
+	b = append(b, p.Description...)
+	b = append(b, make([]byte, 16)...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Data)))
+	return append(b, p.Data...)
+}
+
+func (e *flacEncoder) write(samples [][2]float64) error {
+	for _, frame := range samples {
+		for ch, v := range frame {
+			e.pending[ch] = append(e.pending[ch], quantize(v, e.bitDepth))
+		}
+	}
+	for len(e.pending[0]) >= flacBlockSize {
+		if err := e.writeFrame(flacBlockSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close 写入最后一帧并回写 STREAMINFO
+func (e *flacEncoder) close() error {
+	if n := len(e.pending[0]); n > 0 {
+		if err := e.writeFrame(n); err != nil {
+			return err
+		}
+	}
+	if _, err := e.w.Seek(8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.streamInfo()); err != nil {
+		return err
+	}
+	_, err := e.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// channel assignment 取值
+const (
+	flacIndependent = 1 // 两个独立声道
+	flacLeftSide    = 8
+	flacRightSide   = 9
+	flacMidSide     = 10
+)
+
+// writeFrame 把 pending 中的前 n 个采样编码为一帧
+func (e *flacEncoder) writeFrame(n int) error {
+	left, right := e.pending[0][:n], e.pending[1][:n]
+	e.hash(left, right)
+	
+	side := make([]int64, n)
+	mid := make([]int64, n)
+	for i := range left {
+		side[i] = left[i] - right[i]
+		mid[i] = (left[i] + right[i]) >> 1
+	}
+	// 差声道需要多 1 位
+	l, r := newSubframe(left, e.bitDepth), newSubframe(right, e.bitDepth)
+	s, m := newSubframe(side, e.bitDepth+1), newSubframe(mid, e.bitDepth)
+	assignment, first, second := flacIndependent, l, r
+	best := l.cost + r.cost
+	if c := l.cost + s.cost; c < best {
+		assignment, first, second, best = flacLeftSide, l, s, c
+	}
+	if c := s.cost + r.cost; c < best {
+		assignment, first, second, best = flacRightSide, s, r, c
+	}
+	if c := m.cost + s.cost; c < best {
+		assignment, first, second = flacMidSide, m, s
+	}
+	
+	w := &e.bw
+	w.reset()
+	// 同步码 + 固定块大小
+	w.write(0xFFF8, 16)
+	blockCode := uint64(12) // 4096
+	if n != flacBlockSize {
+		blockCode = 7 // 帧头末尾的 16 位块大小-1
+	}
+	w.write(blockCode, 4)
+	w.write(0, 4) // 采样率见 STREAMINFO
+	w.write(uint64(assignment), 4)
+	w.write(bitDepthCode(e.bitDepth), 3)
+	w.write(0, 1)
+	for _, b := range utf8Number(e.frame) {
+		w.write(uint64(b), 8)
+	}
+	if n != flacBlockSize {
+		w.write(uint64(n-1), 16)
+	}
+	w.write(uint64(crc8(w.bytes())), 8)
+	first.encode(w)
+	second.encode(w)
+	w.align()
+	frame := w.bytes()
+	frame = binary.BigEndian.AppendUint16(frame, crc16(frame))
+	if _, err := e.w.Write(frame); err != nil {
+		return err
+	}
+	
+	if e.minFrame == 0 || len(frame) < e.minFrame {
+		e.minFrame = len(frame)
+	}
+	e.maxFrame = max(e.maxFrame, len(frame))
+	e.frame++
+	e.total += uint64(n)
+	e.pending[0] = append(e.pending[0][:0], e.pending[0][n:]...)
+	e.pending[1] = append(e.pending[1][:0], e.pending[1][n:]...)
+	return nil
+}
+
+// hash MD5 按小端序交错的原始采样计算
+func (e *flacEncoder) hash(left, right []int64) {
+	size := e.bitDepth / 8
+	buf := make([]byte, 0, len(left)*2*size)
+	for i := range left {
+		for _, x := range [2]int64{left[i], right[i]} {
+			for j := 0; j < size; j++ {
+				buf = append(buf, byte(x>>(8*j)))
+			}
+		}
+	}
+	e.md5.Write(buf)
+}
+
+func bitDepthCode(bitDepth int) uint64 {
+	switch bitDepth {
+	case 8:
+		return 1
+	case 12:
+		return 2
+	case 16:
+		return 4
+	case 20:
+		return 5
+	case 24:
+		return 6
+	}
+	return 0
+}
+
+// utf8Number 帧号使用扩展的 UTF-8 编码, 最长 7 字节 36 位
+func utf8Number(x uint64) []byte {
+	if x < 0x80 {
+		return []byte{byte(x)}
+	}
+	n := 2
+	for ; n < 7; n++ {
+		if x < 1<<(5*n+1) {
+			break
+		}
+	}
+	b := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		b[i] = 0x80 | byte(x&0x3F)
+		x >>= 6
+	}
+	b[0] = byte(0xFF<<(8-n)) | byte(x)
+	return b
+}
+
+// subframe 一个声道选出的编码方式, cost 为编码后的位数
+type subframe struct {
+	samples  []int64
+	bitDepth int
+	// order 固定预测的阶数, -1 表示常量, -2 表示原样
+	order    int
+	residual []uint64
+	// partition Rice 分区阶数, params 每个分区的参数
+	partition int
+	params    []int
+	cost      int
+}
+
+const (
+	subframeConstant = -1
+	subframeVerbatim = -2
+)
+
+// newSubframe 选择编码后最小的预测阶数和 Rice 分区
+func newSubframe(samples []int64, bitDepth int) *subframe {
+	sf := &subframe{samples: samples, bitDepth: bitDepth, order: subframeConstant, cost: 8 + bitDepth}
+	constant := true
+	for _, x := range samples[1:] {
+		if x != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		return sf
+	}
+	
+	sf.order, sf.cost = subframeVerbatim, 8+len(samples)*bitDepth
+	bestOrder := -1
+	var bestSum uint64
+	for order := 0; order <= 4 && order < len(samples); order++ {
+		var sum uint64
+		for i := order; i < len(samples); i++ {
+			r := fixedResidual(samples, i, order)
+			sum += uint64(max(r, -r))
+		}
+		if bestOrder < 0 || sum < bestSum {
+			bestOrder, bestSum = order, sum
+		}
+	}
+	residual := make([]uint64, 0, len(samples)-bestOrder)
+	for i := bestOrder; i < len(samples); i++ {
+		r := fixedResidual(samples, i, bestOrder)
+		residual = append(residual, uint64(r<<1)^uint64(r>>63))
+	}
+	partition, params, riceCost := riceParams(residual, len(samples), bestOrder)
+	if cost := 8 + bestOrder*bitDepth + riceCost; cost < sf.cost {
+		sf.order, sf.residual, sf.partition, sf.params, sf.cost = bestOrder, residual, partition, params, cost
+	}
+	return sf
+}
+
+// fixedResidual 固定预测的残差
+func fixedResidual(x []int64, i, order int) int64 {
+	switch order {
+	case 0:
+		return x[i]
+	case 1:
+		return x[i] - x[i-1]
+	case 2:
+		return x[i] - 2*x[i-1] + x[i-2]
+	case 3:
+		return x[i] - 3*x[i-1] + 3*x[i-2] - x[i-3]
+	default:
+		return x[i] - 4*x[i-1] + 6*x[i-2] - 4*x[i-3] + x[i-4]
+	}
+}
+
+// riceParams 选择 Rice 分区阶数和每个分区的参数, 返回残差部分的位数。
+// 第一个分区少 order 个残差, 分区数必须整除块大小
+func riceParams(residual []uint64, blockSize, order int) (partition int, params []int, cost int) {
+	cost = -1
+	for p := 0; p <= flacMaxPartitionOrder; p++ {
+		size := blockSize >> p
+		if blockSize%(1<<p) != 0 || size <= order {
+			break
+		}
+		ps := make([]int, 1<<p)
+		// 2 位编码方式 + 4 位分区阶数
+		c := 6
+		start := 0
+		for i := range ps {
+			end := start + size
+			if i == 0 {
+				end -= order
+			}
+			k, pc := riceParam(residual[start:end])
+			ps[i] = k
+			c += pc
+			start = end
+		}
+		if cost < 0 || c < cost {
+			partition, params, cost = p, ps, c
+		}
+	}
+	// 参数超过 14 时使用 5 位参数的 RICE2
+	if slicesMax(params) > 14 {
+		cost += len(params)
+	}
+	return partition, params, cost
+}
+
+// riceParam 按均值估算参数, 在相邻的参数中取位数最少的, 返回参数和包含 4 位参数的位数
+func riceParam(u []uint64) (k, cost int) {
+	var sum uint64
+	for _, v := range u {
+		sum += v
+	}
+	guess := 0
+	if len(u) > 0 && sum > uint64(len(u)) {
+		guess = bits.Len64(sum/uint64(len(u))) - 1
+	}
+	cost = -1
+	for c := max(guess-1, 0); c <= min(guess+1, 30); c++ {
+		bitsUsed := 4 + len(u)*(c+1)
+		for _, v := range u {
+			bitsUsed += int(v >> c)
+		}
+		if cost < 0 || bitsUsed < cost {
+			k, cost = c, bitsUsed
+		}
+	}
+	return k, cost
+}
+
+func slicesMax(s []int) int {
+	m := 0
+	for _, v := range s {
+		m = max(m, v)
+	}
+	return m
+}
+
+// encode 写入子帧头和数据
+func (sf *subframe) encode(w *bitWriter) {
+	w.write(0, 1)
+	switch sf.order {
+	case subframeConstant:
+		w.write(0, 6)
+		w.write(0, 1)
+		w.writeSigned(sf.samples[0], sf.bitDepth)
+		return
+	case subframeVerbatim:
+		w.write(1, 6)
+		w.write(0, 1)
+		for _, x := range sf.samples {
+			w.writeSigned(x, sf.bitDepth)
+		}
+		return
+	}
+	w.write(uint64(0x08|sf.order), 6)
+	w.write(0, 1)
+	for _, x := range sf.samples[:sf.order] {
+		w.writeSigned(x, sf.bitDepth)
+	}
+	
+	paramBits := uint(4)
+	if slicesMax(sf.params) > 14 {
+		paramBits = 5
+		w.write(1, 2)
+	} else {
+		w.write(0, 2)
+	}
+	w.write(uint64(sf.partition), 4)
+	size := len(sf.samples) >> sf.partition
+	start := 0
+	for i, k := range sf.params {
+		end := start + size
+		if i == 0 {
+			end -= sf.order
+		}
+		w.write(uint64(k), paramBits)
+		for _, v := range sf.residual[start:end] {
+			w.write(0, uint(v>>k))
+			w.write(1, 1)
+			w.write(v, uint(k))
+		}
+		start = end
+	}
+}
+
+// bitWriter 高位在前的位写入
+type bitWriter struct {
+	buf []byte
+	cur byte
+	n   uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for n > 0 {
+		k := min(n, 8-w.n)
+		var part byte
+		if n-k < 64 {
+			part = byte(v>>(n-k)) & (1<<k - 1)
+		}
+		w.cur = w.cur<<k | part
+		w.n += k
+		n -= k
+		if w.n == 8 {
+			w.buf = append(w.buf, w.cur)
+			w.cur, w.n = 0, 0
+		}
+	}
+}
+
+// writeSigned 写入 n 位的补码
+func (w *bitWriter) writeSigned(x int64, n int) {
+	w.write(uint64(x)&(1<<n-1), uint(n))
+}
+
+// align 补 0 到字节边界
+func (w *bitWriter) align() {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+}
+
+// bytes 已经写满的字节
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+func (w *bitWriter) reset() {
+	w.buf, w.cur, w.n = w.buf[:0], 0, 0
+}
+
+var crc8Table, crc16Table = func() (t8 [256]byte, t16 [256]uint16) {
+	for i := range t8 {
+		c := byte(i)
+		for j := 0; j < 8; j++ {
+			if c&0x80 != 0 {
+				c = c<<1 ^ 0x07
+			} else {
+				c <<= 1
+			}
+		}
+		t8[i] = c
+		c16 := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		t16[i] = c16
+	}
+	return
+}()
+
+// crc8 帧头校验, 多项式 x^8+x^2+x+1
+func crc8(b []byte) byte {
+	var c byte
+	for _, v := range b {
+		c = crc8Table[c^v]
+	}
+	return c
+}
+
+// crc16 帧校验, 多项式 x^16+x^15+x^2+1
+func crc16(b []byte) uint16 {
+	var c uint16
+	for _, v := range b {
+		c = c<<8 ^ crc16Table[byte(c>>8)^v]
+	}
+	return c
+}
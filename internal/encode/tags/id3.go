@@ -0,0 +1,224 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// padding 新标签之后预留的空间, 用于 ID3 标签和 FLAC 的 PADDING 块
+const padding = 1024
+
+var errID3 = errors.New("tags: invalid ID3v2 tag")
+
+// id3Frame ID3v2 中的一个帧, data 已经去掉了非同步、分组等帧格式
+type id3Frame struct {
+	id   string
+	data []byte
+}
+
+// readID3 读取开头的 ID3v2 标签, 返回其中的帧和标签之后的位置, 没有标签时 end 为 0。
+// v2.3 的帧转换为 v2.4, v2.2 和压缩、加密的帧被丢弃
+func readID3(r io.ReadSeeker) (frames []id3Frame, end int64, err error) {
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var head [10]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	if string(head[:3]) != "ID3" {
+		return nil, 0, nil
+	}
+	major, flags := head[3], head[5]
+	size := syncsafe(head[6:10])
+	end = 10 + int64(size)
+	if major == 4 && flags&0x10 != 0 {
+		end += 10
+	}
+	body := make([]byte, size)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return nil, 0, err
+	}
+	if major != 3 && major != 4 {
+		return nil, end, nil
+	}
+	if major == 3 && flags&0x80 != 0 {
+		body = resync(body)
+	}
+	if flags&0x40 != 0 {
+		if len(body) < 4 {
+			return nil, 0, errID3
+		}
+		n := int(binary.BigEndian.Uint32(body)) + 4
+		if major == 4 {
+			n = syncsafe(body)
+		}
+		if n > len(body) {
+			return nil, 0, errID3
+		}
+		body = body[n:]
+	}
+	
+	for len(body) >= 10 && body[0] != 0 {
+		id := string(body[:4])
+		n := int(binary.BigEndian.Uint32(body[4:8]))
+		if major == 4 {
+			n = syncsafe(body[4:8])
+		}
+		format := body[9]
+		if 10+n > len(body) {
+			return nil, 0, fmt.Errorf("%w: frame %s too long", errID3, id)
+		}
+		data := body[10 : 10+n]
+		body = body[10+n:]
+		
+		if major == 3 {
+			// 压缩、加密的帧无法转换
+			if format&0xC0 != 0 {
+				continue
+			}
+			if format&0x20 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+			if id == "TYER" {
+				id = "TDRC"
+			}
+		} else {
+			if format&0x0C != 0 {
+				continue
+			}
+			if format&0x40 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+			if format&0x01 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+			if format&0x02 != 0 {
+				data = resync(data)
+			}
+		}
+		frames = append(frames, id3Frame{id: id, data: data})
+	}
+	return frames, end, nil
+}
+
+// buildID3 在原有的帧上应用修改, 返回完整的 ID3v2.4 标签
+func buildID3(frames []id3Frame, e Edit) []byte {
+	track := ""
+	if e.Track > 0 {
+		track = strconv.Itoa(e.Track)
+		// 保留原有的总音轨数
+		for _, f := range frames {
+			if f.id != "TRCK" {
+				continue
+			}
+			if _, total, ok := strings.Cut(id3Text(f.data), "/"); ok && total != "" {
+				track += "/" + total
+			}
+		}
+	}
+	
+	var out []id3Frame
+	text := func(id, value string) {
+		if value != "" {
+			out = append(out, id3Frame{id: id, data: append([]byte{3}, value...)})
+		}
+	}
+	text("TIT2", e.Title)
+	text("TPE1", e.Artist)
+	text("TALB", e.Album)
+	text("TRCK", track)
+	text("TCON", e.Genre)
+	if e.Lyrics != "" {
+		// UTF-8, 语言未知, 空的描述
+		data := append([]byte{3}, "XXX\x00"...)
+		out = append(out, id3Frame{id: "USLT", data: append(data, e.Lyrics...)})
+	}
+	if e.Cover != nil {
+		data := append([]byte{3}, e.Cover.MIMEType...)
+		data = append(data, 0, pictureTypeFront, 0)
+		out = append(out, id3Frame{id: "APIC", data: append(data, e.Cover.Data...)})
+	}
+	for _, f := range frames {
+		switch f.id {
+		case "TIT2", "TPE1", "TALB", "TRCK", "TCON", "USLT":
+			continue
+		case "APIC":
+			if e.Cover != nil && apicType(f.data) == pictureTypeFront {
+				continue
+			}
+		}
+		out = append(out, f)
+	}
+	
+	var body []byte
+	for _, f := range out {
+		body = append(body, f.id...)
+		body = appendSyncsafe(body, len(f.data))
+		body = append(body, 0, 0)
+		body = append(body, f.data...)
+	}
+	body = append(body, make([]byte, padding)...)
+	tag := append([]byte("ID3"), 4, 0, 0)
+	tag = appendSyncsafe(tag, len(body))
+	return append(tag, body...)
+}
+
+// rewriteMP3 用新的 ID3v2.4 标签替换开头的 ID3v2 标签, ID3v1 标签保持不变
+func rewriteMP3(r io.ReadSeeker, w io.Writer, e Edit) error {
+	frames, end, err := readID3(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildID3(frames, e)); err != nil {
+		return err
+	}
+	if _, err := r.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// id3Text 文本帧的第一个值, 只识别 ISO-8859-1 和 UTF-8 编码
+func id3Text(data []byte) string {
+	if len(data) < 1 || (data[0] != 0 && data[0] != 3) {
+		return ""
+	}
+	text, _, _ := strings.Cut(string(data[1:]), "\x00")
+	return text
+}
+
+// apicType APIC 帧中的图片类型, 位于 MIME 类型之后
+func apicType(data []byte) int {
+	if len(data) < 1 {
+		return -1
+	}
+	i := bytes.IndexByte(data[1:], 0)
+	if i < 0 || 1+i+1 >= len(data) {
+		return -1
+	}
+	return int(data[1+i+1])
+}
+
+// syncsafe 每字节只使用低 7 位的整数
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func appendSyncsafe(b []byte, n int) []byte {
+	return append(b, byte(n>>21)&0x7f, byte(n>>14)&0x7f, byte(n>>7)&0x7f, byte(n)&0x7f)
+}
+
+// resync 去掉非同步处理在 0xFF 之后插入的 0x00
+func resync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xff, 0x00}, []byte{0xff})
+}
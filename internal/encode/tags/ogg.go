@@ -0,0 +1,198 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errOgg = errors.New("tags: unsupported ogg stream")
+
+// oggPage Ogg 的一页, segments 为分段长度(lacing values)
+type oggPage struct {
+	headerType byte
+	granule    uint64
+	serial     uint32
+	seq        uint32
+	segments   []byte
+	data       []byte
+}
+
+func readOggPage(r io.Reader) (oggPage, error) {
+	var head [27]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return oggPage{}, err
+	}
+	if string(head[:4]) != "OggS" {
+		return oggPage{}, errors.New("tags: missing OggS capture pattern")
+	}
+	p := oggPage{
+		headerType: head[5],
+		granule:    binary.LittleEndian.Uint64(head[6:14]),
+		serial:     binary.LittleEndian.Uint32(head[14:18]),
+		seq:        binary.LittleEndian.Uint32(head[18:22]),
+		segments:   make([]byte, head[26]),
+	}
+	if _, err := io.ReadFull(r, p.segments); err != nil {
+		return oggPage{}, err
+	}
+	size := 0
+	for _, s := range p.segments {
+		size += int(s)
+	}
+	p.data = make([]byte, size)
+	if _, err := io.ReadFull(r, p.data); err != nil {
+		return oggPage{}, err
+	}
+	return p, nil
+}
+
+// bytes 编码为一页并计算校验和
+func (p oggPage) bytes() []byte {
+	b := append([]byte("OggS"), 0, p.headerType)
+	b = binary.LittleEndian.AppendUint64(b, p.granule)
+	b = binary.LittleEndian.AppendUint32(b, p.serial)
+	b = binary.LittleEndian.AppendUint32(b, p.seq)
+	b = append(b, 0, 0, 0, 0, byte(len(p.segments)))
+	b = append(b, p.segments...)
+	b = append(b, p.data...)
+	binary.LittleEndian.PutUint32(b[22:26], oggCRC(b))
+	return b
+}
+
+// paginate 把 packets 分成从 seq 开始的页, 每页最多 255 个分段; 没有包在页中结束时 granule 为 -1
+func paginate(serial, seq uint32, packets [][]byte) []oggPage {
+	var pages []oggPage
+	page := oggPage{serial: serial, seq: seq, granule: ^uint64(0)}
+	for _, packet := range packets {
+		for off := 0; ; {
+			if len(page.segments) == 255 {
+				pages = append(pages, page)
+				seq++
+				next := oggPage{serial: serial, seq: seq, granule: ^uint64(0)}
+				// 上一页的最后一个分段为 255 时包还没有结束
+				if page.segments[254] == 255 {
+					next.headerType = 0x01
+				}
+				page = next
+			}
+			n := min(255, len(packet)-off)
+			page.segments = append(page.segments, byte(n))
+			page.data = append(page.data, packet[off:off+n]...)
+			off += n
+			if n < 255 {
+				page.granule = 0
+				break
+			}
+		}
+	}
+	if len(page.segments) > 0 {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// rewriteOGG 替换 Vorbis 的注释包. 注释包和 setup 包重新分页, 之后的页按新的页数重新编号;
+// 只支持第一个逻辑流是 Vorbis 且头部没有和其它流交错的文件
+func rewriteOGG(r io.ReadSeeker, w io.Writer, e Edit) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	first, err := readOggPage(r)
+	if err != nil {
+		return err
+	}
+	if first.headerType&0x02 == 0 || !bytes.HasPrefix(first.data, []byte("\x01vorbis")) {
+		return errOgg
+	}
+	serial := first.serial
+	
+	// 读取注释包和 setup 包, setup 包必须在页的结尾结束
+	var (
+		packets [][]byte
+		packet  []byte
+		last    = first
+	)
+	for len(packets) < 2 {
+		page, err := readOggPage(r)
+		if err != nil {
+			return err
+		}
+		if page.serial != serial {
+			return errOgg
+		}
+		data := page.data
+		for _, s := range page.segments {
+			if len(packets) == 2 {
+				return errOgg
+			}
+			packet = append(packet, data[:s]...)
+			data = data[s:]
+			if s < 255 {
+				packets, packet = append(packets, packet), nil
+			}
+		}
+		last = page
+	}
+	comment := packets[0]
+	if !bytes.HasPrefix(comment, []byte("\x03vorbis")) {
+		return errOgg
+	}
+	c, err := parseVorbisComments(comment[7:])
+	if err != nil {
+		return err
+	}
+	c.apply(e, true)
+	packets[0] = append(append([]byte("\x03vorbis"), c.bytes()...), 1)
+	
+	if _, err := w.Write(first.bytes()); err != nil {
+		return err
+	}
+	headers := paginate(serial, first.seq+1, packets)
+	for _, page := range headers {
+		if _, err := w.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+	shift := headers[len(headers)-1].seq - last.seq
+	for {
+		page, err := readOggPage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if page.serial == serial {
+			page.seq += shift
+		}
+		if _, err := w.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// oggCRCTable 多项式 0x04c11db7, 高位在前, 初值和结果都不取反
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, v := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+	}
+	return crc
+}
@@ -0,0 +1,89 @@
+// Package tags 把标签写回已有的音频文件: MP3 写 ID3v2.4, FLAC/OGG 写 Vorbis 注释,
+// WAV 写 LIST/INFO 块和 id3 块. 音频数据原样复制, 不认识的标签保持不变
+package tags
+
+import (
+	"errors"
+	"io"
+	"os"
+	
+	"github.com/Theodoree/music_player/internal/model"
+)
+
+var ErrUnsupported = errors.New("tags: unsupported file type")
+
+// Edit 要写入的标签, 字符串为空或 Track 为 0 时删除对应的标签
+type Edit struct {
+	Title  string
+	Artist string
+	Album  string
+	Track  int
+	Genre  string
+	Lyrics string
+	// Cover 封面, 替换原有的封面(正面), 为 nil 时保留原有的图片
+	Cover *Picture
+}
+
+// Picture 封面图片
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// pictureTypeFront ID3 APIC 帧和 FLAC PICTURE 块中的封面(正面)类型
+const pictureTypeFront = 3
+
+// Supported 是否支持写入这种文件的标签
+func Supported(t model.MusicType) bool {
+	switch t {
+	case model.MusicTypeMP3, model.MusicTypeFLAC, model.MusicTypeOGG, model.MusicTypeWAV:
+		return true
+	}
+	return false
+}
+
+// Write 把标签写入 path. 先写入同目录下的 .part 文件, 完成后重命名覆盖原文件, 失败时原文件不变
+func Write(path string, t model.MusicType, e Edit) error {
+	var rewrite func(r io.ReadSeeker, w io.Writer, e Edit) error
+	switch t {
+	case model.MusicTypeMP3:
+		rewrite = rewriteMP3
+	case model.MusicTypeFLAC:
+		rewrite = rewriteFLAC
+	case model.MusicTypeOGG:
+		rewrite = rewriteOGG
+	case model.MusicTypeWAV:
+		rewrite = rewriteWAV
+	default:
+		return ErrUnsupported
+	}
+	
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = rewrite(src, dst, e)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
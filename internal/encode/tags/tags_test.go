@@ -0,0 +1,218 @@
+package tags
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+)
+
+var testEdit = Edit{
+	Title:  "标题",
+	Artist: "Artist",
+	Album:  "Album",
+	Track:  3,
+	Genre:  "Pop",
+	Lyrics: "[00:01.00]歌词",
+	Cover:  &Picture{MIMEType: "image/png", Data: bytes.Repeat([]byte{0x89}, 70000)},
+}
+
+// checkTags 检查 testEdit 中的标签都已写入
+func checkTags(t *testing.T, m tag.Metadata) {
+	t.Helper()
+	if track, _ := m.Track(); m.Title() != testEdit.Title || m.Artist() != testEdit.Artist || m.Album() != testEdit.Album ||
+		track != testEdit.Track || m.Genre() != testEdit.Genre || m.Lyrics() != testEdit.Lyrics {
+		t.Fatalf("tags = %q %q %q %d %q %q", m.Title(), m.Artist(), m.Album(), track, m.Genre(), m.Lyrics())
+	}
+	if pic := m.Picture(); pic == nil || pic.Type != "Cover (front)" || !bytes.Equal(pic.Data, testEdit.Cover.Data) {
+		t.Fatalf("picture = %v", pic)
+	}
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// id3v23Frame v2.3 的帧, 大小不是 synchsafe 整数
+func id3v23Frame(id string, data []byte) []byte {
+	b := append([]byte(id), binary.BigEndian.AppendUint32(nil, uint32(len(data)))...)
+	return append(append(b, 0, 0), data...)
+}
+
+func TestMP3(t *testing.T) {
+	var frames []byte
+	frames = append(frames, id3v23Frame("TIT2", []byte("\x00Old"))...)
+	frames = append(frames, id3v23Frame("TRCK", []byte("\x001/12"))...)
+	frames = append(frames, id3v23Frame("TXXX", []byte("\x00REPLAYGAIN_TRACK_GAIN\x00-6.50 dB"))...)
+	frames = append(frames, id3v23Frame("APIC", []byte("\x00image/jpeg\x00\x04\x00back"))...)
+	head := append([]byte("ID3"), 3, 0, 0)
+	head = appendSyncsafe(head, len(frames)+100)
+	audio := append([]byte{0xff, 0xfb, 0x90, 0x00}, bytes.Repeat([]byte{0x55}, 1000)...)
+	path := writeTemp(t, "a.mp3", append(append(append(head, frames...), make([]byte, 100)...), audio...))
+	
+	if err := Write(path, model.MusicTypeMP3, testEdit); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasSuffix(data, audio) || data[3] != 4 {
+		t.Fatal("audio data changed or not ID3v2.4")
+	}
+	m, err := tag.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, m)
+	// 总音轨数、其它帧和背面的封面保持不变
+	if _, total := m.Track(); total != 12 {
+		t.Fatalf("track total = %d", total)
+	}
+	if info := replaygain.FromTags(m.Raw()); !info.HasTrack || info.TrackGain != -6.5 {
+		t.Fatalf("replay gain = %+v", info)
+	}
+	if _, ok := m.Raw()["APIC_0"]; !ok {
+		t.Fatalf("back cover removed: %v", m.Raw())
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left: %v", err)
+	}
+}
+
+// encodeFile 用 encode 生成 1 秒的静音文件
+func encodeFile(t *testing.T, f encode.Format) string {
+	path := filepath.Join(t.TempDir(), "a"+f.Ext())
+	w, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	tags := encode.Tags{Title: "Old", Track: 1, ReplayGain: replaygain.Info{HasTrack: true, TrackGain: -6.5}}
+	if err := encode.Encode(context.Background(), w, beep.Silence(44100), 44100, 16, f, tags); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFLACAndWAV(t *testing.T) {
+	for _, tc := range []struct {
+		format encode.Format
+		typ    model.MusicType
+	}{
+		{encode.FormatFLAC, model.MusicTypeFLAC},
+		{encode.FormatWAV, model.MusicTypeWAV},
+	} {
+		path := encodeFile(t, tc.format)
+		before, err := decode.GetMetadata(path, tc.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(path, tc.typ, testEdit); err != nil {
+			t.Fatal(err)
+		}
+		m, err := decode.GetMetadata(path, tc.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Title != testEdit.Title || m.Artist != testEdit.Artist || m.Album != testEdit.Album || m.Track != testEdit.Track ||
+			m.Genre != testEdit.Genre || m.Lyrics != testEdit.Lyrics || len(m.Pictures) != 1 {
+			t.Fatalf("%s: metadata = %+v", tc.format, m)
+		}
+		if m.Duration != before.Duration || m.SampleRate != before.SampleRate {
+			t.Fatalf("%s: duration = %v, want %v", tc.format, m.Duration, before.Duration)
+		}
+		// FLAC 中其它的注释保持不变
+		if tc.typ == model.MusicTypeFLAC && !m.ReplayGain.HasTrack {
+			t.Fatalf("replay gain removed")
+		}
+	}
+}
+
+// TestWAVCorruptChunk 块大小损坏时返回错误, 不按这个大小分配内存
+func TestWAVCorruptChunk(t *testing.T) {
+	file := []byte("RIFF\xff\xff\xff\xffWAVELIST\xf0\xff\xff\xffINFO")
+	var out bytes.Buffer
+	if err := rewriteWAV(bytes.NewReader(file), &out, testEdit); err == nil {
+		t.Fatal("rewrite succeeded")
+	}
+}
+
+func TestOGG(t *testing.T) {
+	const serial = 0x1234
+	comments := vorbisComments{vendor: "test", comments: []string{"TITLE=Old", "REPLAYGAIN_TRACK_GAIN=-6.50 dB"}}
+	first := paginate(serial, 0, [][]byte{append([]byte("\x01vorbis"), make([]byte, 23)...)})[0]
+	first.headerType = 0x02
+	headers := paginate(serial, 1, [][]byte{
+		append(append([]byte("\x03vorbis"), comments.bytes()...), 1),
+		append([]byte("\x05vorbis"), bytes.Repeat([]byte{1}, 3000)...),
+	})
+	var src []byte
+	src = append(src, first.bytes()...)
+	for _, p := range headers {
+		src = append(src, p.bytes()...)
+	}
+	seq := headers[len(headers)-1].seq
+	for i := 0; i < 3; i++ {
+		seq++
+		page := oggPage{granule: uint64(i+1) * 1024, serial: serial, seq: seq, segments: []byte{100}, data: bytes.Repeat([]byte{byte(i)}, 100)}
+		src = append(src, page.bytes()...)
+	}
+	path := writeTemp(t, "a.ogg", src)
+	
+	if err := Write(path, model.MusicTypeOGG, testEdit); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	m, err := tag.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, m)
+	if info := replaygain.FromTags(m.Raw()); !info.HasTrack {
+		t.Fatalf("replay gain removed")
+	}
+	
+	// 封面让注释包变长, 之后的页连续编号, 校验和正确, 音频页的内容不变
+	r := bytes.NewReader(data)
+	var pages []oggPage
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+		page, err := readOggPage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw := data[start : len(data)-r.Len()]; !bytes.Equal(raw, page.bytes()) {
+			t.Fatalf("page %d checksum mismatch", page.seq)
+		}
+		if page.seq != uint32(len(pages)) {
+			t.Fatalf("page seq = %d, want %d", page.seq, len(pages))
+		}
+		pages = append(pages, page)
+	}
+	if len(pages) <= len(headers)+4 {
+		t.Fatalf("pages = %d, want more than %d", len(pages), len(headers)+4)
+	}
+	for i, page := range pages[len(pages)-3:] {
+		if page.granule != uint64(i+1)*1024 || !bytes.Equal(page.data, bytes.Repeat([]byte{byte(i)}, 100)) {
+			t.Fatalf("audio page %d changed", i)
+		}
+	}
+}
+
+func TestOggCRC(t *testing.T) {
+	// 与 CRC-32/POSIX(cksum) 相同但结果不取反, 标准校验值为 0x765e7680
+	if got := oggCRC([]byte("123456789")); got != 0x89a1897f {
+		t.Fatalf("crc = %#x", got)
+	}
+}
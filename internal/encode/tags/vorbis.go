@@ -0,0 +1,216 @@
+package tags
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errVorbisComment = errors.New("tags: invalid vorbis comment")
+
+// vorbisKeys Edit 中各项对应的注释名
+var vorbisKeys = []string{"TITLE", "ARTIST", "ALBUM", "TRACKNUMBER", "GENRE", "LYRICS"}
+
+// vorbisComments Vorbis 注释, comments 为 KEY=value, 长度都是小端序
+type vorbisComments struct {
+	vendor   string
+	comments []string
+}
+
+func parseVorbisComments(b []byte) (vorbisComments, error) {
+	var c vorbisComments
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	vendor, ok := next()
+	if !ok || len(b) < 4 {
+		return c, errVorbisComment
+	}
+	c.vendor = vendor
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count; i++ {
+		s, ok := next()
+		if !ok {
+			return c, errVorbisComment
+		}
+		c.comments = append(c.comments, s)
+	}
+	return c, nil
+}
+
+func (c vorbisComments) bytes() []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(c.vendor)))
+	b = append(b, c.vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(c.comments)))
+	for _, s := range c.comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// apply 删除要修改的注释后追加新的值. withPicture 为 true 时封面写为 METADATA_BLOCK_PICTURE 注释(OGG),
+// FLAC 的封面在单独的 PICTURE 块中
+func (c *vorbisComments) apply(e Edit, withPicture bool) {
+	kept := c.comments[:0]
+	for _, s := range c.comments {
+		key, value, _ := strings.Cut(s, "=")
+		key = strings.ToUpper(key)
+		if containsKey(vorbisKeys, key) {
+			continue
+		}
+		if withPicture && e.Cover != nil && key == "METADATA_BLOCK_PICTURE" {
+			if data, err := base64.StdEncoding.DecodeString(value); err == nil && len(data) >= 4 &&
+				binary.BigEndian.Uint32(data) == pictureTypeFront {
+				continue
+			}
+		}
+		kept = append(kept, s)
+	}
+	
+	var added []string
+	add := func(key, value string) {
+		if value != "" {
+			added = append(added, key+"="+value)
+		}
+	}
+	add("TITLE", e.Title)
+	add("ARTIST", e.Artist)
+	add("ALBUM", e.Album)
+	if e.Track > 0 {
+		add("TRACKNUMBER", strconv.Itoa(e.Track))
+	}
+	add("GENRE", e.Genre)
+	add("LYRICS", e.Lyrics)
+	if withPicture && e.Cover != nil {
+		add("METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(pictureBlock(e.Cover)))
+	}
+	c.comments = append(added, kept...)
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// pictureBlock FLAC PICTURE 块的内容, 宽高等图片参数未知时为 0, 长度为大端序
+func pictureBlock(p *Picture) []byte {
+	b := binary.BigEndian.AppendUint32(nil, pictureTypeFront)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.MIMEType)))
+	b = append(b, p.MIMEType...)
+	// 描述、宽、高、色深、索引色数
+	b = append(b, make([]byte, 4*5)...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Data)))
+	return append(b, p.Data...)
+}
+
+// flacBlock FLAC 的元数据块
+type flacBlock struct {
+	typ  byte
+	data []byte
+}
+
+const (
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// rewriteFLAC 替换 VORBIS_COMMENT 块和封面的 PICTURE 块, 原有的 PADDING 合并为一个;
+// 文件开头的 ID3v2 标签被丢弃
+func rewriteFLAC(r io.ReadSeeker, w io.Writer, e Edit) error {
+	_, start, err := readID3(r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return err
+	}
+	if string(magic[:]) != "fLaC" {
+		return errors.New("tags: missing fLaC header")
+	}
+	
+	var blocks []flacBlock
+	hasComment := false
+	for last := false; !last; {
+		var head [4]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return err
+		}
+		last = head[0]&0x80 != 0
+		b := flacBlock{typ: head[0] & 0x7f, data: make([]byte, int(head[1])<<16|int(head[2])<<8|int(head[3]))}
+		if _, err := io.ReadFull(r, b.data); err != nil {
+			return err
+		}
+		switch b.typ {
+		case flacPadding:
+			continue
+		case flacVorbisComment:
+			c, err := parseVorbisComments(b.data)
+			if err != nil {
+				return err
+			}
+			c.apply(e, false)
+			b.data = c.bytes()
+			hasComment = true
+		case flacPicture:
+			if e.Cover != nil && len(b.data) >= 4 && binary.BigEndian.Uint32(b.data) == pictureTypeFront {
+				continue
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	if len(blocks) == 0 {
+		return errors.New("tags: missing STREAMINFO")
+	}
+	if !hasComment {
+		c := vorbisComments{vendor: "music_player"}
+		c.apply(e, false)
+		// STREAMINFO 必须是第一个块
+		blocks = append(blocks[:1], append([]flacBlock{{typ: flacVorbisComment, data: c.bytes()}}, blocks[1:]...)...)
+	}
+	if e.Cover != nil {
+		blocks = append(blocks, flacBlock{typ: flacPicture, data: pictureBlock(e.Cover)})
+	}
+	blocks = append(blocks, flacBlock{typ: flacPadding, data: make([]byte, padding)})
+	
+	out := []byte("fLaC")
+	for i, b := range blocks {
+		if len(b.data) >= 1<<24 {
+			return fmt.Errorf("tags: metadata block too large (%d bytes)", len(b.data))
+		}
+		typ := b.typ
+		if i == len(blocks)-1 {
+			typ |= 0x80
+		}
+		out = append(out, typ, byte(len(b.data)>>16), byte(len(b.data)>>8), byte(len(b.data)))
+		out = append(out, b.data...)
+	}
+	if _, err := w.Write(out); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,161 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	
+	"github.com/Theodoree/music_player/internal/decode/iff"
+)
+
+// infoKeys Edit 中各项对应的 INFO 子块
+var infoKeys = []string{"INAM", "IART", "IPRD", "ITRK", "IGNR"}
+
+// riffChunk RIFF 中的一个块, offset 为数据的位置
+type riffChunk struct {
+	id     string
+	offset int64
+	size   int64
+}
+
+// rewriteWAV 替换 LIST/INFO 块和 id3 块, 新的块放在 data 块之前.
+// INFO 没有歌词和封面, 完整的标签写在 id3 块中
+func rewriteWAV(r io.ReadSeeker, w io.Writer, e Edit) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var head [12]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return err
+	}
+	if string(head[:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return errors.New("tags: missing RIFF/WAVE header")
+	}
+	end := int64(binary.LittleEndian.Uint32(head[4:8])) + 8
+	
+	var (
+		chunks []riffChunk
+		info   []byte
+		frames []id3Frame
+	)
+	for offset := int64(12); offset+8 <= end; {
+		var ch [8]byte
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, ch[:]); err != nil {
+			// 截断的文件, 保留已经读到的块
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+		c := riffChunk{id: string(ch[:4]), offset: offset + 8, size: int64(binary.LittleEndian.Uint32(ch[4:8]))}
+		offset = c.offset + c.size + c.size&1
+		switch c.id {
+		case "LIST", "id3 ", "ID3 ":
+			// 块大小直接来自文件, 超过文件剩余长度时返回错误
+			data, err := iff.ReadChunk(r, c.offset, c.size)
+			if err != nil {
+				return err
+			}
+			if c.id != "LIST" {
+				f, _, err := readID3(bytes.NewReader(data))
+				if err != nil {
+					return err
+				}
+				frames = f
+				continue
+			}
+			if bytes.HasPrefix(data, []byte("INFO")) {
+				info = data[4:]
+				continue
+			}
+		}
+		chunks = append(chunks, c)
+	}
+	
+	extra := append(infoChunk(info, e), riffChunkBytes("id3 ", buildID3(frames, e))...)
+	size := int64(4 + len(extra))
+	for _, c := range chunks {
+		size += 8 + c.size + c.size&1
+	}
+	if size > 1<<32-1 {
+		return errors.New("tags: file too large")
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(size))...)
+	if _, err := w.Write(append(out, "WAVE"...)); err != nil {
+		return err
+	}
+	written := false
+	for _, c := range chunks {
+		if c.id == "data" && !written {
+			if _, err := w.Write(extra); err != nil {
+				return err
+			}
+			written = true
+		}
+		if _, err := r.Seek(c.offset-8, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, 8+c.size); err != nil {
+			return err
+		}
+		if c.size&1 == 1 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+	}
+	if !written {
+		_, err := w.Write(extra)
+		return err
+	}
+	return nil
+}
+
+// infoChunk 在原有的 INFO 子块上应用修改, 返回 LIST/INFO 块; 每个子块的大小都补齐为偶数
+func infoChunk(old []byte, e Edit) []byte {
+	var body []byte
+	add := func(id, value string) {
+		if value == "" {
+			return
+		}
+		data := append([]byte(value), 0)
+		body = append(body, riffChunkBytes(id, data)...)
+	}
+	add("INAM", e.Title)
+	add("IART", e.Artist)
+	add("IPRD", e.Album)
+	if e.Track > 0 {
+		add("ITRK", strconv.Itoa(e.Track))
+	}
+	add("IGNR", e.Genre)
+	for len(old) >= 8 {
+		id := string(old[:4])
+		n := int(binary.LittleEndian.Uint32(old[4:8]))
+		if n > len(old)-8 {
+			break
+		}
+		if !containsKey(infoKeys, id) {
+			body = append(body, riffChunkBytes(id, old[8:8+n])...)
+		}
+		old = old[min(8+n+n&1, len(old)):]
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return riffChunkBytes("LIST", append([]byte("INFO"), body...))
+}
+
+// riffChunkBytes 块头和数据, 奇数长度补一个 0
+func riffChunkBytes(id string, data []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+package encode
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	
+	"github.com/faiface/beep"
+)
+
+// wavEncoder 写入 PCM WAV, 标签写在 data 之前的 LIST/INFO 块中
+type wavEncoder struct {
+	w        io.WriteSeeker
+	bitDepth int
+	// dataStart data 块大小字段的位置, dataSize 已写入的采样字节数
+	dataStart int64
+	dataSize  int64
+	buf       []byte
+}
+
+func newWAVEncoder(w io.WriteSeeker, sampleRate beep.SampleRate, bitDepth int, tags Tags) (*wavEncoder, error) {
+	const channels = 2
+	blockAlign := channels * bitDepth / 8
+	
+	var header []byte
+	header = append(header, "RIFF\x00\x00\x00\x00WAVE"...)
+	header = append(header, "fmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1) // PCM
+	header = binary.LittleEndian.AppendUint16(header, channels)
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(int(sampleRate)*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(bitDepth))
+	header = append(header, infoChunk(tags)...)
+	header = append(header, id3Chunk(tags)...)
+	header = append(header, "data\x00\x00\x00\x00"...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &wavEncoder{w: w, bitDepth: bitDepth, dataStart: int64(len(header) - 4)}, nil
+}
+
+// infoChunk LIST/INFO 块, 没有标签时为空; 每个子块的大小都补齐为偶数
+func infoChunk(tags Tags) []byte {
+	var body []byte
+	add := func(id, value string) {
+		if value == "" {
+			return
+		}
+		data := append([]byte(value), 0)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+		body = append(body, id...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+		body = append(body, data...)
+	}
+	add("INAM", tags.Title)
+	add("IART", tags.Artist)
+	add("IPRD", tags.Album)
+	if tags.Track > 0 {
+		add("ITRK", strconv.Itoa(tags.Track))
+	}
+	add("IGNR", tags.Genre)
+	if tags.Year > 0 {
+		add("ICRD", strconv.Itoa(tags.Year))
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	chunk := append([]byte("LIST"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	chunk = append(chunk, "INFO"...)
+	return append(chunk, body...)
+}
+
+// id3Chunk INFO 没有封面, 封面写在只有一个 APIC 帧的 ID3v2.3 id3 块中; 没有封面时为空
+func id3Chunk(tags Tags) []byte {
+	p := tags.Cover
+	if p == nil {
+		return nil
+	}
+	// 文字编码 ISO-8859-1, MIME 类型, 图片类型, 空的描述, 图片数据
+	apic := append([]byte{0}, p.MIMEType...)
+	apic = append(apic, 0, pictureTypeFront, 0)
+	apic = append(apic, p.Data...)
+	frame := append([]byte("APIC"), binary.BigEndian.AppendUint32(nil, uint32(len(apic)))...)
+	frame = append(frame, 0, 0)
+	frame = append(frame, apic...)
+	
+	// 标签大小为 synchsafe 整数, 不含10字节的标签头
+	n := len(frame)
+	data := append([]byte("ID3\x03\x00\x00"), byte(n>>21&0x7f), byte(n>>14&0x7f), byte(n>>7&0x7f), byte(n&0x7f))
+	data = append(data, frame...)
+	chunk := append([]byte("id3 "), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	// 块的大小不含补齐的字节
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func (e *wavEncoder) write(samples [][2]float64) error {
+	e.buf = e.buf[:0]
+	for _, frame := range samples {
+		for _, v := range frame {
+			x := quantize(v, e.bitDepth)
+			for i := 0; i < e.bitDepth/8; i++ {
+				e.buf = append(e.buf, byte(x>>(8*i)))
+			}
+		}
+	}
+	n, err := e.w.Write(e.buf)
+	e.dataSize += int64(n)
+	return err
+}
+
+// close 回写 RIFF 和 data 块的大小
+func (e *wavEncoder) close() error {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(e.dataSize))
+	if _, err := e.w.Seek(e.dataStart, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(size[:], uint32(e.dataStart+4+e.dataSize-8))
+	if _, err := e.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,269 @@
+package gui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	
+	"fyne.io/fyne/v2/data/binding"
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/mp"
+	"github.com/Theodoree/music_player/internal/music"
+)
+
+// playerBinding 把播放器的事件流转换为 fyne 的数据绑定, 播放器本身不依赖 fyne。
+// 绑定和列表在订阅协程中更新, 自定义组件通过 on 注册事件处理函数
+type playerBinding struct {
+	mp.MusicPlayer
+	
+	musicName  binding.String
+	singerName binding.String
+	// curTime 当前播放时间, 缓冲时显示"缓冲中"
+	curTime binding.String
+	endTime binding.String
+	lyrics  binding.String
+	volume  *synced[float64, binding.Float]
+	// eqEnabled, eqPreamp, eqBands 均衡器开关、前级增益和各频段增益, 任何一项改变都整体设置到播放器
+	eqEnabled *synced[bool, binding.Bool]
+	eqPreamp  *synced[float64, binding.Float]
+	eqBands   [eq.Bands]*synced[float64, binding.Float]
+	
+	tables     listData[model.MusicTable]
+	list       listData[music.Music]
+	streamList listData[music.Music]
+	presets    listData[model.EQPreset]
+	
+	// source 选中的流媒体来源, 只在界面协程中读写
+	source int
+	
+	mu sync.Mutex
+	// tableID 本地列表所属的表格
+	tableID   uint
+	buffering bool
+	handlers  []func(e mp.Event)
+}
+
+func newPlayerBinding(player mp.MusicPlayer) *playerBinding {
+	b := &playerBinding{
+		MusicPlayer: player,
+		musicName:   binding.NewString(),
+		singerName:  binding.NewString(),
+		curTime:     binding.NewString(),
+		endTime:     binding.NewString(),
+		lyrics:      binding.NewString(),
+	}
+	b.volume = newSynced[float64](binding.NewFloat(), player.SetVolume)
+	setEqualizer := func() {
+		s := eq.Settings{Enabled: b.eqEnabled.get(), Preamp: b.eqPreamp.get()}
+		for i := range b.eqBands {
+			s.Gains[i] = b.eqBands[i].get()
+		}
+		player.SetEqualizer(s)
+	}
+	b.eqEnabled = newSynced[bool](binding.NewBool(), func(bool) {
+		setEqualizer()
+	})
+	b.eqPreamp = newSynced[float64](binding.NewFloat(), func(float64) {
+		setEqualizer()
+	})
+	for i := range b.eqBands {
+		b.eqBands[i] = newSynced[float64](binding.NewFloat(), func(float64) {
+			setEqualizer()
+		})
+	}
+	return b
+}
+
+// on 注册事件处理函数, 在订阅协程中按事件顺序调用
+func (b *playerBinding) on(fn func(e mp.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// start 订阅事件并用播放器当前的数据初始化绑定, 在所有组件注册完处理函数后调用
+func (b *playerBinding) start() {
+	events, _ := b.Subscribe()
+	status := b.Status()
+	tableID, items := b.List(mp.ListLocal)
+	_, streamItems := b.List(mp.ListStream)
+	for _, e := range []mp.Event{
+		mp.TablesChanged{Tables: b.Tables()},
+		mp.EQPresetsChanged{Presets: b.EQPresets()},
+		mp.SettingsChanged{Settings: b.Settings()},
+		mp.QueueChanged{Kind: mp.ListLocal, TableID: tableID, Items: items},
+		mp.QueueChanged{Kind: mp.ListStream, Items: streamItems},
+		mp.StateChanged{From: status.State, To: status.State},
+		mp.TrackChanged{Music: status.Music, Duration: status.Duration, Lyrics: status.Lyrics},
+		mp.PositionChanged{Position: status.Position, Duration: status.Duration},
+		mp.ABLoopChanged{A: status.LoopA, B: status.LoopB},
+		mp.WaveformChanged{Peaks: status.Waveform},
+	} {
+		b.handle(e)
+	}
+	go func() {
+		for e := range events {
+			b.handle(e)
+		}
+	}()
+}
+
+func (b *playerBinding) handle(e mp.Event) {
+	switch e := e.(type) {
+	case mp.TrackChanged:
+		_ = b.musicName.Set(e.Music.Name)
+		_ = b.singerName.Set(e.Music.Singer)
+		_ = b.endTime.Set(formatTime(e.Duration))
+		_ = b.lyrics.Set(e.Lyrics)
+	case mp.PositionChanged:
+		if !b.isBuffering() {
+			_ = b.curTime.Set(formatTime(e.Position))
+		}
+	case mp.StateChanged:
+		buffering := e.To == mp.StateBuffering
+		b.mu.Lock()
+		b.buffering = buffering
+		b.mu.Unlock()
+		if buffering {
+			_ = b.curTime.Set("缓冲中")
+		}
+	case mp.SettingsChanged:
+		b.volume.update(e.Settings.Volume)
+		b.eqEnabled.update(e.Settings.Equalizer.Enabled)
+		b.eqPreamp.update(e.Settings.Equalizer.Preamp)
+		for i := range b.eqBands {
+			b.eqBands[i].update(e.Settings.Equalizer.Gains[i])
+		}
+	case mp.QueueChanged:
+		switch e.Kind {
+		case mp.ListLocal:
+			b.mu.Lock()
+			b.tableID = e.TableID
+			b.mu.Unlock()
+			b.list.set(e.Items)
+		case mp.ListStream:
+			b.streamList.set(e.Items)
+		}
+	case mp.TablesChanged:
+		b.tables.set(e.Tables)
+	case mp.EQPresetsChanged:
+		b.presets.set(e.Presets)
+	}
+	
+	b.mu.Lock()
+	handlers := b.handlers
+	b.mu.Unlock()
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
+
+func (b *playerBinding) isBuffering() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffering
+}
+
+// currentTable 本地列表所属的表格
+func (b *playerBinding) currentTable() uint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tableID
+}
+
+func formatTime(ts time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(ts.Minutes()), int(ts.Seconds())%60)
+}
+
+type bindable[T any] interface {
+	binding.DataItem
+	Get() (T, error)
+	Set(T) error
+}
+
+// synced 界面可以修改的绑定: 界面修改时调用 set, 播放器发布的值通过 update 写回, 写回引起的通知不会再调用 set,
+// 避免界面和播放器来回设置
+type synced[T comparable, B bindable[T]] struct {
+	data B
+	mu   sync.Mutex
+	// applied 最近一次写回的值, pending 它引起的通知还没有到达
+	applied T
+	pending bool
+}
+
+func newSynced[T comparable, B bindable[T]](data B, set func(T)) *synced[T, B] {
+	// 添加监听器时的第一次通知也不调用 set
+	s := &synced[T, B]{data: data, pending: true}
+	data.AddListener(binding.NewDataListener(func() {
+		v := s.get()
+		s.mu.Lock()
+		applied := s.pending && v == s.applied
+		if applied {
+			s.pending = false
+		}
+		s.mu.Unlock()
+		if !applied {
+			set(v)
+		}
+	}))
+	return s
+}
+
+func (s *synced[T, B]) get() T {
+	v, _ := s.data.Get()
+	return v
+}
+func (s *synced[T, B]) update(v T) {
+	s.mu.Lock()
+	if s.get() == v {
+		// 值没有变化, 不会有通知
+		s.mu.Unlock()
+		return
+	}
+	s.applied, s.pending = v, true
+	s.mu.Unlock()
+	_ = s.data.Set(v)
+}
+
+// listData 只读的列表数据, 变化时通知组件刷新
+type listData[T any] struct {
+	mu        sync.RWMutex
+	items     []T
+	listeners []func()
+}
+
+func (l *listData[T]) set(items []T) {
+	l.mu.Lock()
+	l.items = items
+	listeners := l.listeners
+	l.mu.Unlock()
+	for _, fn := range listeners {
+		fn()
+	}
+}
+func (l *listData[T]) Length() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.items)
+}
+
+// get 列表刷新前组件可能使用旧的下标, 越界时 ok 为 false
+func (l *listData[T]) get(index int) (item T, ok bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if index < 0 || index >= len(l.items) {
+		return item, false
+	}
+	return l.items[index], true
+}
+func (l *listData[T]) all() []T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.items
+}
+func (l *listData[T]) addListener(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
@@ -1,10 +1,14 @@
 package gui
 
 import (
+	"fmt"
+	"time"
+	
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
 	"github.com/Theodoree/music_player/internal/mp"
 )
 
@@ -31,13 +35,14 @@ func newController() *controller {
 	return &controller{}
 }
 
-func (b *controller) View(musicPlayer mp.MusicPlayer) fyne.CanvasObject {
+func (b *controller) View(musicPlayer *playerBinding) fyne.CanvasObject {
+	settings := musicPlayer.Settings()
 	
 	// 音乐名和歌手名组件
 	musicName := widget.NewLabelWithStyle("          ", fyne.TextAlignCenter, fyne.TextStyle{})
-	musicName.Bind(musicPlayer.MusicName())
+	musicName.Bind(musicPlayer.musicName)
 	playerName := widget.NewLabelWithStyle("          ", fyne.TextAlignCenter, fyne.TextStyle{})
-	playerName.Bind(musicPlayer.SingerName())
+	playerName.Bind(musicPlayer.singerName)
 	left := container.NewVBox(musicName, playerName)
 	
 	// 播放控制组件
@@ -52,57 +57,130 @@ func (b *controller) View(musicPlayer mp.MusicPlayer) fyne.CanvasObject {
 	playerMenu.pause.Hide()
 	playerMenu.prev = widget.NewButtonWithIcon("", theme.MediaSkipPreviousIcon(), musicPlayer.Prev)
 	playerMenu.next = widget.NewButtonWithIcon("", theme.MediaSkipNextIcon(), musicPlayer.Next)
-	playStatus := musicPlayer.PlayStatus()
-	playStatus.AddListener(&mp.DataListener{Fn: func() {
-		ok, _ := playStatus.Get()
-		switch ok {
-		case true:
-			playerMenu.play.Hide()
-			playerMenu.pause.Show()
-		case false:
-			playerMenu.pause.Hide()
-			playerMenu.play.Show()
-		}
-	}})
 	midder := container.NewGridWithColumns(3, playerMenu.prev, playerMenu.pause, playerMenu.play, playerMenu.next)
 	
 	// 音量条
 	volumeProgress := widget.NewSlider(0, 100)
-	volumeProgress.Bind(musicPlayer.Volume())
-	volumeProgress.Refresh()
-	val, _ := musicPlayer.Volume().Get()
-	volumeProgress.SetValue(val)
-	
-	// 播放模式
-	playModeSelect := widget.NewSelect([]string{"顺序播放", "单曲循环", "随机播放"}, func(s string) {
-		mode := musicPlayer.PlayMode().(*mp.BindingModel[mp.PlayMode])
-		switch s {
-		case "顺序播放":
-			_ = mode.Set(mp.PlayModeCycle)
-		case "单曲循环":
-			_ = mode.Set(mp.PlayModeSingleCycle)
-		case "随机播放":
-			_ = mode.Set(mp.PlayModeRandom)
+	volumeProgress.Bind(musicPlayer.volume.data)
+	
+	// 播放模式, 选项顺序与 mp.PlayMode 一致
+	playModeOptions := []string{"顺序播放", "单曲循环", "随机播放"}
+	playModeSelect := widget.NewSelect(playModeOptions, func(s string) {
+		for idx, v := range playModeOptions {
+			if v == s {
+				musicPlayer.SetPlayMode(mp.PlayMode(idx))
+			}
+		}
+	})
+	playModeSelect.SetSelectedIndex(int(settings.Mode))
+	
+	// 交叉淡化
+	crossfadeOptions := []string{"无缝衔接", "淡化 2秒", "淡化 4秒", "淡化 6秒", "淡化 8秒", "淡化 10秒"}
+	crossfadeSelect := widget.NewSelect(crossfadeOptions, func(s string) {
+		for idx, v := range crossfadeOptions {
+			if v == s {
+				musicPlayer.SetCrossfade(time.Duration(idx*2) * time.Second)
+			}
 		}
 	})
-	playModeSelect.SetSelectedIndex(0)
-	right := container.NewVBox(playModeSelect, volumeProgress)
+	crossfadeSelect.SetSelectedIndex(int(settings.Crossfade.Seconds()) / 2)
+	
+	// 响度归一化, 选项顺序与 replaygain.Mode 一致
+	replayGainOptions := []string{"音量均衡 关", "音轨增益", "专辑增益"}
+	replayGainSelect := widget.NewSelect(replayGainOptions, func(s string) {
+		for idx, v := range replayGainOptions {
+			if v == s {
+				musicPlayer.SetReplayGainMode(replaygain.Mode(idx))
+			}
+		}
+	})
+	replayGainSelect.SetSelectedIndex(int(settings.ReplayGain))
+	
+	// 播放速度(音调不变)
+	speeds := []float64{0.5, 0.75, 1, 1.25, 1.5, 1.75, 2}
+	speedOptions := []string{"0.5倍速", "0.75倍速", "正常速度", "1.25倍速", "1.5倍速", "1.75倍速", "2倍速"}
+	speedSelect := widget.NewSelect(speedOptions, func(s string) {
+		for idx, v := range speedOptions {
+			if v == s {
+				musicPlayer.SetSpeed(speeds[idx])
+			}
+		}
+	})
+	for idx, v := range speeds {
+		if v == settings.Speed {
+			speedSelect.SetSelectedIndex(idx)
+		}
+	}
+	
+	// 变调(速度不变), 以半音为单位
+	var pitchOptions []string
+	for i := -12; i <= 12; i++ {
+		switch {
+		case i == 0:
+			pitchOptions = append(pitchOptions, "原调")
+		default:
+			pitchOptions = append(pitchOptions, fmt.Sprintf("变调 %+d", i))
+		}
+	}
+	pitchSelect := widget.NewSelect(pitchOptions, func(s string) {
+		for idx, v := range pitchOptions {
+			if v == s {
+				musicPlayer.SetPitch(float64(idx - 12))
+			}
+		}
+	})
+	pitchSelect.SetSelectedIndex(int(settings.Pitch) + 12)
+	
+	right := container.NewVBox(
+		container.NewGridWithColumns(3, playModeSelect, crossfadeSelect, replayGainSelect),
+		container.NewGridWithColumns(2, speedSelect, pitchSelect),
+		volumeProgress,
+	)
 	topContainer := container.NewGridWithColumns(3, left, midder, right)
 	
 	var progressWidget struct {
 		cur         *widget.Label // 进度条
-		Progressbar *widget.Slider
+		Progressbar fyne.CanvasObject
 		end         *widget.Label // 进度条
 	}
 	// 播放条
 	progressWidget.cur = widget.NewLabel("00:00")
-	progressWidget.cur.Bind(musicPlayer.MusicCurTime())
-	progressWidget.Progressbar = widget.NewSlider(0, 100)
-	progressWidget.Progressbar.Bind(musicPlayer.ProcessBar())
+	progressWidget.cur.Bind(musicPlayer.curTime)
+	progressWidget.Progressbar = newWaveformSeekBar(musicPlayer)
 	progressWidget.end = widget.NewLabel("00:00")
-	progressWidget.end.Bind(musicPlayer.MusicEndTime())
+	progressWidget.end.Bind(musicPlayer.endTime)
+	
+	// A-B 循环: 依次标记A点、B点, 再次点击取消
+	abButton := widget.NewButton("A-B", musicPlayer.ToggleABLoop)
+	
+	// 网络音乐缓冲中
+	bufferingBar := widget.NewProgressBarInfinite()
+	bufferingBar.Hide()
+	
+	// 播放按钮和缓冲条跟随播放状态
+	musicPlayer.on(func(e mp.Event) {
+		changed, ok := e.(mp.StateChanged)
+		if !ok {
+			return
+		}
+		if changed.To.Active() {
+			playerMenu.play.Hide()
+			playerMenu.pause.Show()
+		} else {
+			playerMenu.pause.Hide()
+			playerMenu.play.Show()
+		}
+		switch {
+		case changed.To == mp.StateBuffering:
+			bufferingBar.Show()
+			bufferingBar.Start()
+		case changed.From == mp.StateBuffering:
+			bufferingBar.Stop()
+			bufferingBar.Hide()
+		}
+	})
 	
-	bottomContainer := container.NewBorder(nil, nil, progressWidget.cur, progressWidget.end, progressWidget.Progressbar)
+	bottomContainer := container.NewBorder(bufferingBar, nil, progressWidget.cur, container.NewHBox(progressWidget.end, abButton), progressWidget.Progressbar)
 	
 	return container.NewVBox(topContainer, bottomContainer)
 }
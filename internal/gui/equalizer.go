@@ -0,0 +1,118 @@
+package gui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode/eq"
+)
+
+// equalizerView 均衡器面板: 开关、预设、前级增益与10个频段的推子
+type equalizerView struct {
+	mp *playerBinding
+	w  fyne.Window
+	d  dialog.Dialog
+}
+
+func newEqualizerView(mp *playerBinding, w fyne.Window) *equalizerView {
+	return &equalizerView{mp: mp, w: w}
+}
+
+// show 以对话框的形式打开均衡器面板, 面板只创建一次
+func (e *equalizerView) show() {
+	if e.d == nil {
+		e.d = dialog.NewCustom("均衡器", "关闭", e.view(), e.w)
+		e.d.Resize(fyne.NewSize(720, 420))
+	}
+	e.d.Show()
+}
+
+func (e *equalizerView) view() fyne.CanvasObject {
+	enabledCheck := widget.NewCheckWithData("启用", e.mp.eqEnabled.data)
+	
+	// 预设, 选中的预设被删除后显示第一个, 播放器同时载入它
+	presets := &e.mp.presets
+	presetSelect := widget.NewSelect(nil, nil)
+	refreshPresets := func() {
+		var options []string
+		for _, p := range presets.all() {
+			options = append(options, p.Name)
+		}
+		presetSelect.Options = options
+		if !slices.Contains(options, presetSelect.Selected) && len(options) > 0 {
+			presetSelect.Selected = options[0]
+		}
+		presetSelect.Refresh()
+	}
+	refreshPresets()
+	presetSelect.OnChanged = func(s string) {
+		for _, p := range presets.all() {
+			if p.Name == s {
+				e.mp.LoadEQPreset(p.ID)
+			}
+		}
+	}
+	presets.addListener(refreshPresets)
+	
+	top := container.NewHBox(enabledCheck, presetSelect, e.saveButton(presetSelect), e.delButton(presetSelect))
+	
+	// 推子
+	faders := []fyne.CanvasObject{e.fader("前级", e.mp.eqPreamp.data), widget.NewSeparator()}
+	for i, f := range eq.Frequencies {
+		label := fmt.Sprintf("%.0f", f)
+		if f >= 1000 {
+			label = fmt.Sprintf("%.0fk", f/1000)
+		}
+		faders = append(faders, e.fader(label, e.mp.eqBands[i].data))
+	}
+	return container.NewBorder(top, nil, nil, nil, container.NewGridWithColumns(len(faders), faders...))
+}
+
+// fader 一个竖直的增益推子, 下方显示频段, 上方显示当前增益
+func (e *equalizerView) fader(name string, value binding.Float) fyne.CanvasObject {
+	slider := widget.NewSlider(-eq.MaxGain, eq.MaxGain)
+	slider.Orientation = widget.Vertical
+	slider.Step = 0.5
+	slider.Bind(value)
+	gain := widget.NewLabelWithData(binding.FloatToStringWithFormat(value, "%+.1f"))
+	gain.Alignment = fyne.TextAlignCenter
+	return container.NewBorder(gain, widget.NewLabelWithStyle(name, fyne.TextAlignCenter, fyne.TextStyle{}), nil, nil, slider)
+}
+
+// saveButton 保存后选中保存的预设
+func (e *equalizerView) saveButton(presetSelect *widget.Select) fyne.CanvasObject {
+	nameEntry := widget.NewEntry()
+	from := dialog.NewForm("保存预设", "确认", "取消", []*widget.FormItem{widget.NewFormItem("预设名称", nameEntry)}, func(ok bool) {
+		defer func() {
+			nameEntry.SetText("")
+		}()
+		if !ok {
+			return
+		}
+		e.mp.SaveEQPreset(nameEntry.Text)
+		presetSelect.Selected = strings.TrimSpace(nameEntry.Text)
+		presetSelect.Refresh()
+	}, e.w)
+	
+	from.Resize(fyne.NewSize(400, 0))
+	return widget.NewButtonWithIcon("保存预设", theme.DocumentSaveIcon(), func() {
+		from.Show()
+	})
+}
+
+func (e *equalizerView) delButton(presetSelect *widget.Select) fyne.CanvasObject {
+	return widget.NewButtonWithIcon("删除预设", theme.ContentRemoveIcon(), func() {
+		item, ok := e.mp.presets.get(presetSelect.SelectedIndex())
+		if !ok {
+			return
+		}
+		e.mp.DeleteEQPreset(item.ID)
+	})
+}
@@ -0,0 +1,119 @@
+package gui
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/mp"
+	"github.com/faiface/beep"
+	"k8s.io/klog"
+)
+
+const keepOriginal = "原始"
+
+// exportOptions 导出格式、采样率和位深的表单项, options 读取当前的选择
+func exportOptions() (items []*widget.FormItem, options func() encode.Options) {
+	format := widget.NewSelect([]string{encode.FormatFLAC.String(), encode.FormatWAV.String()}, nil)
+	format.SetSelectedIndex(0)
+	rate := widget.NewSelect([]string{keepOriginal, "44100", "48000", "88200", "96000"}, nil)
+	rate.SetSelectedIndex(0)
+	depths := []string{keepOriginal}
+	for _, d := range encode.BitDepths {
+		depths = append(depths, strconv.Itoa(d))
+	}
+	depth := widget.NewSelect(depths, nil)
+	depth.SetSelectedIndex(0)
+	
+	items = []*widget.FormItem{
+		widget.NewFormItem("格式", format),
+		widget.NewFormItem("采样率", rate),
+		widget.NewFormItem("位深", depth),
+	}
+	return items, func() encode.Options {
+		var opts encode.Options
+		if format.Selected == encode.FormatWAV.String() {
+			opts.Format = encode.FormatWAV
+		}
+		if r, err := strconv.Atoi(rate.Selected); err == nil {
+			opts.SampleRate = beep.SampleRate(r)
+		}
+		opts.BitDepth, _ = strconv.Atoi(depth.Selected)
+		return opts
+	}
+}
+
+// showExport 导出一首音乐或其中的一段, 默认为裁剪后的范围
+func showExport(player mp.MusicPlayer, item model.Music, w fyne.Window) {
+	items, options := exportOptions()
+	start := widget.NewEntry()
+	start.Validator = func(s string) error {
+		_, err := parseOffset(s)
+		return err
+	}
+	start.SetText(formatOffset(item.StartOffset))
+	end := widget.NewEntry()
+	end.SetPlaceHolder("结尾")
+	end.Validator = start.Validator
+	if item.EndOffset > 0 {
+		end.SetText(formatOffset(item.EndOffset))
+	}
+	items = append(items, widget.NewFormItem("开始位置", start), widget.NewFormItem("结束位置", end))
+	
+	form := dialog.NewForm("导出", "选择位置", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		opts := options()
+		from, _ := parseOffset(start.Text)
+		to, _ := parseOffset(end.Text)
+		save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			_ = writer.Close()
+			player.ExportMusic(item, writer.URI().Path(), opts, from, to)
+		}, w)
+		name := item.Name
+		if _, ok := decode.LookupExt(name); ok {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		save.SetFileName(name + opts.Format.Ext())
+		save.Show()
+	}, w)
+	form.Resize(fyne.NewSize(400, 0))
+	form.Show()
+}
+
+// showExportTable 把列表中的所有音乐导出到选择的目录
+func showExportTable(player mp.MusicPlayer, tableID uint, w fyne.Window) {
+	items, options := exportOptions()
+	form := dialog.NewForm("导出列表", "选择目录", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		opts := options()
+		dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if dir == nil {
+				return
+			}
+			player.ExportTable(tableID, dir.Path(), opts)
+		}, w)
+	}, w)
+	form.Resize(fyne.NewSize(400, 0))
+	form.Show()
+}
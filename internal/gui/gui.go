@@ -11,6 +11,7 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/Theodoree/music_player/internal/mp"
+	"k8s.io/klog"
 )
 
 type _theme struct {
@@ -37,33 +38,49 @@ func Run(a fyne.App, res *embed.FS) {
 	a.Settings().SetTheme(_theme{Theme: theme.DefaultTheme(), font: fyne.NewStaticResource("simkai.ttf", buf)})
 	var gui gui
 	gui.ctx = context.Background()
+	out := openOutput(a, w)
 	musicPlayer, err := mp.NewMusicPlayer(gui.ctx, func(str string) {
 		dialog.ShowError(errors.New(str), w)
-	})
+	}, mp.WithOutput(out))
 	if err != nil {
 		panic(err)
 	}
+	player := newPlayerBinding(musicPlayer)
 	w.Resize(fyne.NewSize(1024, 768))
 	w.SetMaster()
-	gui.InitMenu(w, musicPlayer)
-	gui.View(w, musicPlayer)
+	gui.InitMenu(a, w, player)
+	gui.View(w, player)
+	player.start()
 	w.ShowAndRun()
+	// 补全 WAV 输出的文件头
+	if out != nil {
+		if err := out.Close(); err != nil {
+			klog.Error(err)
+		}
+	}
 }
 
-func (app *gui) InitMenu(window fyne.Window, musicPlayer mp.MusicPlayer) {
+func (app *gui) InitMenu(a fyne.App, window fyne.Window, musicPlayer *playerBinding) {
 	// 添加子菜单项到“File”菜单下
 	pauseMenuItem := fyne.NewMenuItem("暂停", musicPlayer.Play)
 	prevMenuItem := fyne.NewMenuItem("上一首", musicPlayer.Prev)
 	nextMenuItem := fyne.NewMenuItem("下一首", musicPlayer.Next)
+	// 音效
+	equalizer := newEqualizerView(musicPlayer, window)
+	equalizerMenuItem := fyne.NewMenuItem("均衡器", equalizer.show)
+	outputMenuItem := fyne.NewMenuItem("音频输出", func() {
+		showOutputSettings(a, window)
+	})
 	// 创建主菜单并添加菜单项
 	mainMenu := fyne.NewMainMenu(
 		fyne.NewMenu("播放控制", pauseMenuItem, prevMenuItem, nextMenuItem),
+		fyne.NewMenu("音效", equalizerMenuItem, outputMenuItem),
 	)
 	// 设置窗口的菜单栏
 	window.SetMainMenu(mainMenu)
 }
 
-func (app *gui) View(window fyne.Window, musicPlayer mp.MusicPlayer) {
+func (app *gui) View(window fyne.Window, musicPlayer *playerBinding) {
 	
 	entry := newSelectEntry(musicPlayer)
 	// 表格列表视图
@@ -3,25 +3,25 @@ package gui
 import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
-	"github.com/Theodoree/music_player/internal/mp"
 	"k8s.io/klog"
 )
 
 type lyricsView struct {
-	mp mp.MusicPlayer
+	mp *playerBinding
 	w  fyne.Window
 }
 
-func newLyricsView(mp mp.MusicPlayer, w fyne.Window) *lyricsView {
+func newLyricsView(mp *playerBinding, w fyne.Window) *lyricsView {
 	return &lyricsView{mp: mp, w: w}
 }
 func (t *lyricsView) view() fyne.CanvasObject {
 	
 	// 创建一个足够长的歌词字符串（这里仅为示例，实际应用中应根据歌词文件生成）
-	lyrics := t.mp.Lyrics()
+	lyrics := t.mp.lyrics
 	lyricsLabel := widget.NewLabelWithData(lyrics)
 	
 	button := widget.NewButton("导入歌词", func() {
@@ -43,7 +43,7 @@ func (t *lyricsView) view() fyne.CanvasObject {
 	})
 	button.Alignment = widget.ButtonAlignCenter
 	
-	lyrics.AddListener(&mp.DataListener{Fn: func() {
+	lyrics.AddListener(binding.NewDataListener(func() {
 		l, _ := lyrics.Get()
 		if len(l) == 0 {
 			button.Text = "导入歌词"
@@ -52,7 +52,7 @@ func (t *lyricsView) view() fyne.CanvasObject {
 			button.Text = "更新歌词"
 		}
 		button.Refresh()
-	}})
+	}))
 	
 	// 设置歌词标签的最大行数，以模拟定长（例如，10行）
 	lyricsLabel.Alignment = fyne.TextAlignCenter
@@ -62,5 +62,29 @@ func (t *lyricsView) view() fyne.CanvasObject {
 	scroll := container.NewScroll(scrollContent)
 	scroll.SetMinSize(fyne.NewSize(400, 0))
 	
-	return container.NewBorder(button, nil, widget.NewSeparator(), nil, widget.NewCard("", "", scroll))
+	// 显示内容: 歌词、频谱可视化, 或者在歌词下方显示频谱
+	card := widget.NewCard("", "", scroll)
+	visualizer := newVisualizer(t.mp, visualizerBars)
+	modes := []string{"歌词", "频谱", "示波器", "歌词+频谱"}
+	modeSelect := widget.NewSelect(modes, func(s string) {
+		// 不显示时隐藏, 不再刷新
+		visualizer.obj.Show()
+		switch s {
+		case "频谱":
+			visualizer.setMode(visualizerBars)
+			card.SetContent(visualizer.obj)
+		case "示波器":
+			visualizer.setMode(visualizerScope)
+			card.SetContent(visualizer.obj)
+		case "歌词+频谱":
+			visualizer.setMode(visualizerBars)
+			card.SetContent(container.NewBorder(nil, visualizer.obj, nil, nil, scroll))
+		default:
+			visualizer.obj.Hide()
+			card.SetContent(scroll)
+		}
+	})
+	modeSelect.SetSelected(modes[0])
+	
+	return container.NewBorder(container.NewBorder(nil, nil, nil, modeSelect, button), nil, widget.NewSeparator(), nil, card)
 }
@@ -7,9 +7,7 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/mp"
-	"github.com/Theodoree/music_player/internal/music"
 	"k8s.io/klog"
 	"time"
 )
@@ -22,7 +20,7 @@ const (
 )
 
 type musicListView struct {
-	mp   mp.MusicPlayer
+	mp   *playerBinding
 	w    fyne.Window
 	list struct {
 		list        *widget.List
@@ -39,7 +37,7 @@ type musicListView struct {
 	}
 }
 
-func newMusicListView(mp mp.MusicPlayer, w fyne.Window, selectEntry *selectEntry) *musicListView {
+func newMusicListView(mp *playerBinding, w fyne.Window, selectEntry *selectEntry) *musicListView {
 	var mlv = &musicListView{mp: mp, w: w}
 	mlv.selectEntry.selectEntry = selectEntry
 	return mlv
@@ -51,8 +49,6 @@ func (m *musicListView) view() fyne.CanvasObject {
 	return container.NewBorder(nil, nil, nil, nil, m.listContainer, m.streamListContainer)
 }
 func (m *musicListView) toolBar() fyne.CanvasObject {
-	_, _, keyword := m.mp.MusicList()
-	
 	importButton := widget.NewButton("导入", func() {
 		dialog.ShowFolderOpen(func(reader fyne.ListableURI, err error) {
 			if err != nil {
@@ -62,12 +58,9 @@ func (m *musicListView) toolBar() fyne.CanvasObject {
 			if reader == nil {
 				return
 			}
-			ml, index := m.mp.MusicTableList()
-			idx, _ := index.Get()
-			item, _ := ml.GetItem(idx)
-			table := item.(model.MusicTable)
-			m.mp.ImportMusic(table.ID, reader.Path())
-			_ = index.Set(idx)
+			tableID := m.mp.currentTable()
+			m.mp.ImportMusic(tableID, reader.Path())
+			m.mp.SelectTable(tableID)
 		}, m.w)
 	})
 	
@@ -80,17 +73,14 @@ func (m *musicListView) toolBar() fyne.CanvasObject {
 		}
 		
 		tableID := m.selectEntry.GetTableID()
-		items, _, _ := m.mp.MusicList()
 		for idx, selected := range m.selectEntry.musicSelected {
 			if !selected {
 				continue
 			}
-			_item, err := items.GetItem(idx)
-			if err != nil {
-				klog.Error(err)
+			item, ok := m.mp.list.get(idx)
+			if !ok {
 				continue
 			}
-			item := _item.(music.Music)
 			
 			_music, err := item.GetMusic()
 			if err != nil {
@@ -103,12 +93,18 @@ func (m *musicListView) toolBar() fyne.CanvasObject {
 	addMusicButton := widget.NewButton("添加到", func() {
 		from.Show()
 	})
+	exportButton := widget.NewButton("导出", func() {
+		showExportTable(m.mp, m.mp.currentTable(), m.w)
+	})
 	searchEntry := widget.NewEntry()
 	searchEntry.SetPlaceHolder("搜索")
 	searchEntry.OnSubmitted = func(k string) {
-		_ = keyword.Set(k)
+		m.mp.SearchList(k)
 	}
-	toolBox := container.NewBorder(nil, widget.NewSeparator(), container.NewHBox(importButton, addMusicButton), nil, searchEntry)
+	brokenCheck := widget.NewCheck("只看失败", func(b bool) {
+		m.mp.FilterBroken(b)
+	})
+	toolBox := container.NewBorder(nil, widget.NewSeparator(), container.NewHBox(importButton, addMusicButton, exportButton), brokenCheck, searchEntry)
 	
 	selectLabel := widget.NewCheck("", func(b bool) {
 		if b {
@@ -128,12 +124,15 @@ func (m *musicListView) toolBar() fyne.CanvasObject {
 	return container.NewBorder(toolBox, nil, nil, nil, tableHeader)
 }
 func (m *musicListView) musicList() fyne.CanvasObject {
-	items, index, _ := m.mp.MusicList()
+	items := &m.mp.list
 	
 	ml := widget.NewList(items.Length, func() fyne.CanvasObject {
 		checkBox := widget.NewCheck("", nil)
 		titleLabel := widget.NewLabelWithStyle("歌曲名", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 		titleLabel.Truncation = fyne.TextTruncateEllipsis
+		// 最近播放失败的音乐在歌名前显示警告
+		warning := widget.NewIcon(theme.WarningIcon())
+		warning.Hide()
 		singerLabel := widget.NewLabel("歌手")
 		singerLabel.Truncation = fyne.TextTruncateEllipsis
 		album := widget.NewLabel("专辑")
@@ -141,19 +140,30 @@ func (m *musicListView) musicList() fyne.CanvasObject {
 		length := widget.NewLabel("长度")
 		length.Truncation = fyne.TextTruncateEllipsis
 		button := widget.NewButtonWithIcon("", theme.MediaPlayIcon(), func() {})
-		return container.NewGridWithColumns(6, checkBox, titleLabel, singerLabel, album, length, button)
+		properties := widget.NewButtonWithIcon("", theme.InfoIcon(), func() {})
+		edit := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {})
+		export := widget.NewButtonWithIcon("", theme.DocumentSaveIcon(), func() {})
+		return container.NewGridWithColumns(6, checkBox, container.NewBorder(nil, nil, warning, nil, titleLabel), singerLabel, album, length, container.NewGridWithColumns(4, button, properties, edit, export))
 	}, func(id widget.ListItemID, object fyne.CanvasObject) {
-		_item, _ := items.GetItem(id)
+		item, ok := items.get(id)
+		if !ok {
+			return
+		}
 		o := object.(*fyne.Container)
-		item := _item.(music.Music)
 		
 		gridColumns := o
 		check := gridColumns.Objects[0].(*widget.Check)
-		title := gridColumns.Objects[1].(*widget.Label)
+		titleCell := gridColumns.Objects[1].(*fyne.Container)
+		title := titleCell.Objects[0].(*widget.Label)
+		warning := titleCell.Objects[1].(*widget.Icon)
 		singerLabel := gridColumns.Objects[2].(*widget.Label)
 		album := gridColumns.Objects[3].(*widget.Label)
 		length := gridColumns.Objects[4].(*widget.Label)
-		button := gridColumns.Objects[5].(*widget.Button)
+		buttons := gridColumns.Objects[5].(*fyne.Container)
+		button := buttons.Objects[0].(*widget.Button)
+		properties := buttons.Objects[1].(*widget.Button)
+		edit := buttons.Objects[2].(*widget.Button)
+		export := buttons.Objects[3].(*widget.Button)
 		switch m.list.allSelected {
 		case 1:
 			check.SetChecked(true)
@@ -173,14 +183,42 @@ func (m *musicListView) musicList() fyne.CanvasObject {
 			m.selectEntry.musicSelected[id] = b
 		}
 		button.OnTapped = func() {
-			_ = index.Set(id - 1)
-			m.mp.Next()
+			m.mp.PlayAt(mp.ListLocal, id)
+		}
+		properties.OnTapped = func() {
+			_music, err := item.GetMusic()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			showProperties(m.mp, _music, m.w)
+		}
+		edit.OnTapped = func() {
+			_music, err := item.GetMusic()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			showTagEditor(m.mp, _music, m.w)
+		}
+		export.OnTapped = func() {
+			_music, err := item.GetMusic()
+			if err != nil {
+				klog.Error(err)
+				return
+			}
+			showExport(m.mp, _music, m.w)
 		}
 		title.Text = item.MusicName()
 		singerLabel.Text = item.SingerName()
 		album.Text = item.Album()
 		end, _ := item.EndTime()
 		length.Text = fmt.Sprintf("%01d:%02d", end/time.Second/60, end/time.Second%60)
+		if _music, _ := item.GetMusic(); _music.FailCount > 0 {
+			warning.Show()
+		} else {
+			warning.Hide()
+		}
 		
 		check.Refresh()
 		title.Refresh()
@@ -190,19 +228,16 @@ func (m *musicListView) musicList() fyne.CanvasObject {
 		o.Show()
 	})
 	
-	items.AddListener(&mp.DataListener{Fn: func() {
-		ml.Refresh()
-	}})
+	items.addListener(ml.Refresh)
 	m.list.list = ml
 	return ml
 }
 
 func (m *musicListView) streamToolBar() fyne.CanvasObject {
-	_, _, searchKey := m.mp.StreamMusicList()
 	searchEntry := widget.NewEntry()
 	searchEntry.SetPlaceHolder("搜索")
 	searchEntry.OnSubmitted = func(s string) {
-		_ = searchKey.Set(s)
+		m.mp.SearchStream(m.mp.source, s)
 	}
 	
 	importButton := widget.NewButton("导入", func() {})
@@ -221,7 +256,7 @@ func (m *musicListView) streamToolBar() fyne.CanvasObject {
 	return container.NewBorder(toolBox, nil, nil, nil, tableHeader)
 }
 func (m *musicListView) streamMusicList() fyne.CanvasObject {
-	items, index, _ := m.mp.StreamMusicList()
+	items := &m.mp.streamList
 	ml := widget.NewList(items.Length, func() fyne.CanvasObject {
 		titleLabel := widget.NewLabelWithStyle("歌曲名", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 		titleLabel.Truncation = fyne.TextTruncateEllipsis
@@ -234,9 +269,11 @@ func (m *musicListView) streamMusicList() fyne.CanvasObject {
 		button := widget.NewButtonWithIcon("", theme.MediaPlayIcon(), func() {})
 		return container.NewGridWithColumns(5, titleLabel, singerLabel, album, length, button)
 	}, func(id widget.ListItemID, object fyne.CanvasObject) {
-		_item, _ := items.GetItem(id)
+		item, ok := items.get(id)
+		if !ok {
+			return
+		}
 		o := object.(*fyne.Container)
-		item := _item.(music.Music)
 		
 		gridColumns := o
 		title := gridColumns.Objects[0].(*widget.Label)
@@ -245,8 +282,7 @@ func (m *musicListView) streamMusicList() fyne.CanvasObject {
 		length := gridColumns.Objects[3].(*widget.Label)
 		button := gridColumns.Objects[4].(*widget.Button)
 		button.OnTapped = func() {
-			_ = index.Set(id - 1)
-			m.mp.Next()
+			m.mp.PlayAt(mp.ListStream, id)
 		}
 		title.Text = item.MusicName()
 		singerLabel.Text = item.SingerName()
@@ -258,9 +294,7 @@ func (m *musicListView) streamMusicList() fyne.CanvasObject {
 		album.Refresh()
 		length.Refresh()
 	})
-	items.AddListener(&mp.DataListener{Fn: func() {
-		ml.Refresh()
-	}})
+	items.addListener(ml.Refresh)
 	
 	return ml
 }
@@ -279,7 +313,7 @@ func (m *musicListView) SwapTable(t listType) {
 		}
 		m.streamListContainer.Show()
 		m.listContainer.Hide()
-		
+	
 	}
 }
 
@@ -0,0 +1,69 @@
+package gui
+
+import (
+	"errors"
+	"slices"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode"
+)
+
+// 输出后端保存在应用的偏好设置中, 输出只能在第一次播放前替换, 修改后重启生效
+const (
+	outputBackendKey = "output.backend"
+	outputPathKey    = "output.path"
+)
+
+var outputBackends = []decode.OutputBackend{decode.OutputDefault, decode.OutputSpeaker, decode.OutputNull, decode.OutputWAV}
+var outputNames = []string{"默认", "扬声器", "静音", "WAV 文件"}
+
+// outputSettings 从偏好设置中读取输出后端
+func outputSettings(p fyne.Preferences) decode.OutputSettings {
+	return decode.OutputSettings{
+		Backend: decode.OutputBackend(p.String(outputBackendKey)),
+		Path:    p.String(outputPathKey),
+	}
+}
+
+// openOutput 按偏好设置打开输出后端, 失败时提示并使用默认输出(返回 nil)
+func openOutput(a fyne.App, w fyne.Window) decode.Output {
+	s := outputSettings(a.Preferences())
+	if s.Backend == decode.OutputDefault {
+		return nil
+	}
+	out, err := decode.OpenOutput(s)
+	if err != nil {
+		dialog.ShowError(err, w)
+		return nil
+	}
+	return out
+}
+
+// showOutputSettings 选择输出后端, wav 后端需要填写文件路径
+func showOutputSettings(a fyne.App, w fyne.Window) {
+	cur := outputSettings(a.Preferences())
+	backend := widget.NewSelect(outputNames, nil)
+	backend.SetSelectedIndex(max(slices.Index(outputBackends, cur.Backend), 0))
+	path := widget.NewEntry()
+	path.SetPlaceHolder("/path/to/output.wav")
+	path.SetText(cur.Path)
+	path.Validator = func(s string) error {
+		if outputBackends[backend.SelectedIndex()] == decode.OutputWAV && s == "" {
+			return errors.New("WAV 文件需要路径")
+		}
+		return nil
+	}
+	items := []*widget.FormItem{
+		widget.NewFormItem("输出", backend),
+		widget.NewFormItem("WAV 路径", path),
+	}
+	dialog.ShowForm("音频输出(重启后生效)", "保存", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		a.Preferences().SetString(outputBackendKey, string(outputBackends[backend.SelectedIndex()]))
+		a.Preferences().SetString(outputPathKey, path.Text)
+	}, w)
+}
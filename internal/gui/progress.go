@@ -0,0 +1,186 @@
+package gui
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/mp"
+)
+
+// abMarkers 在进度条上绘制 A-B 循环的标记与区间, 位置为进度百分比, 负数表示未标记;
+// a/b 由事件协程写入, 在 UI 协程中布局, 由 mu 保护
+type abMarkers struct {
+	mu      sync.Mutex
+	a, b    float64
+	markA   *canvas.Rectangle
+	markB   *canvas.Rectangle
+	section *canvas.Rectangle
+}
+
+// waveformSeekBar 以波形显示播放进度的进度条, 已播放的部分使用主题色, 点击按时间跳转。
+// 波形还没有提取完成时显示为一条直线, 点击按进度百分比跳转
+type waveformSeekBar struct {
+	widget.BaseWidget
+	player *playerBinding
+	// mu 保护 peaks 和 played, 它们由事件协程写入, 在绘制和点击时读取
+	mu    sync.Mutex
+	peaks waveform.Peaks
+	// played 已播放的比例 [0,1]
+	played  float64
+	raster  *canvas.Raster
+	markers *fyne.Container
+}
+
+// newWaveformSeekBar 带 A-B 标记的波形进度条, 跟随播放器的进度、波形和 A-B 循环事件
+func newWaveformSeekBar(player *playerBinding) fyne.CanvasObject {
+	w := &waveformSeekBar{player: player}
+	w.ExtendBaseWidget(w)
+	w.raster = canvas.NewRaster(w.draw)
+	w.raster.SetMinSize(fyne.NewSize(0, 40))
+	
+	primary := theme.PrimaryColor()
+	// 区间使用半透明的主题色
+	section := color.NRGBAModel.Convert(primary).(color.NRGBA)
+	section.A = 0x40
+	m := &abMarkers{
+		a: -1, b: -1,
+		markA:   canvas.NewRectangle(theme.ForegroundColor()),
+		markB:   canvas.NewRectangle(theme.ForegroundColor()),
+		section: canvas.NewRectangle(section),
+	}
+	w.markers = container.New(m, m.section, m.markA, m.markB)
+	
+	var duration time.Duration
+	percent := func(t time.Duration) float64 {
+		if t < 0 || duration == 0 {
+			return -1
+		}
+		return float64(t) / float64(duration) * 100
+	}
+	player.on(func(e mp.Event) {
+		switch e := e.(type) {
+		case mp.TrackChanged:
+			duration = e.Duration
+		case mp.PositionChanged:
+			var played float64
+			if e.Duration > 0 {
+				played = float64(e.Position) / float64(e.Duration)
+			}
+			w.mu.Lock()
+			changed := played != w.played
+			w.played = played
+			w.mu.Unlock()
+			if changed {
+				w.raster.Refresh()
+			}
+		case mp.ABLoopChanged:
+			m.mu.Lock()
+			m.a, m.b = percent(e.A), percent(e.B)
+			m.mu.Unlock()
+			w.markers.Refresh()
+		case mp.WaveformChanged:
+			w.mu.Lock()
+			w.peaks = e.Peaks
+			w.mu.Unlock()
+			w.raster.Refresh()
+		}
+	})
+	return w
+}
+
+func (w *waveformSeekBar) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewStack(w.raster, w.markers))
+}
+
+// Tapped Implementation fyne.Tappable
+func (w *waveformSeekBar) Tapped(ev *fyne.PointEvent) {
+	width := w.Size().Width
+	if width <= 0 {
+		return
+	}
+	ratio := math.Max(0, math.Min(1, float64(ev.Position.X/width)))
+	w.mu.Lock()
+	duration := w.peaks.Duration
+	w.mu.Unlock()
+	if duration > 0 {
+		w.player.SeekTime(time.Duration(ratio * float64(duration)))
+		return
+	}
+	w.player.Seek(ratio * 100)
+}
+
+// draw 每个像素列取对应区间的最大峰值, 上下对称绘制
+func (w *waveformSeekBar) draw(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	played := color.NRGBAModel.Convert(theme.PrimaryColor()).(color.NRGBA)
+	rest := color.NRGBAModel.Convert(theme.DisabledColor()).(color.NRGBA)
+	mid := height / 2
+	// 事件协程替换 peaks 时不修改原来的切片, 复制切片头即可
+	w.mu.Lock()
+	values, progress := w.peaks.Values, w.played
+	w.mu.Unlock()
+	for x := 0; x < width; x++ {
+		c := rest
+		if float64(x) < progress*float64(width) {
+			c = played
+		}
+		var peak uint8
+		if len(values) > 0 {
+			lo := x * len(values) / width
+			hi := max((x+1)*len(values)/width, lo+1)
+			for _, v := range values[lo:min(hi, len(values))] {
+				peak = max(peak, v)
+			}
+		}
+		// 至少绘制一个像素高的中线
+		half := max(int(float64(peak)/math.MaxUint8*float64(mid)), 1)
+		for y := max(mid-half, 0); y < min(mid+half, height); y++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// Layout Implementation fyne.Layout, 与波形同宽
+func (m *abMarkers) Layout(_ []fyne.CanvasObject, size fyne.Size) {
+	x := func(percent float64) float32 {
+		return size.Width * float32(percent/100)
+	}
+	const markWidth = 2
+	height := size.Height
+	m.mu.Lock()
+	a, b := m.a, m.b
+	m.mu.Unlock()
+	
+	place := func(o fyne.CanvasObject, percent float64) {
+		if percent < 0 {
+			o.Hide()
+			return
+		}
+		o.Move(fyne.NewPos(x(percent)-markWidth/2, 0))
+		o.Resize(fyne.NewSize(markWidth, height))
+		o.Show()
+	}
+	place(m.markA, a)
+	place(m.markB, b)
+	if a < 0 || b < 0 {
+		m.section.Hide()
+		return
+	}
+	m.section.Move(fyne.NewPos(x(a), 0))
+	m.section.Resize(fyne.NewSize(x(b)-x(a), height))
+	m.section.Show()
+}
+
+func (m *abMarkers) MinSize(_ []fyne.CanvasObject) fyne.Size {
+	return fyne.NewSize(0, 0)
+}
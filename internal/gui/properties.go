@@ -0,0 +1,128 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/mp"
+)
+
+var errOffset = errors.New("格式为 分:秒, 例如 1:02.5")
+
+// showProperties 音乐属性对话框, 可以手动修改开始和结束位置, 勾选自动检测时交给后台重新检测静音
+func showProperties(player mp.MusicPlayer, item model.Music, w fyne.Window) {
+	start := widget.NewEntry()
+	start.Validator = func(s string) error {
+		_, err := parseOffset(s)
+		return err
+	}
+	end := widget.NewEntry()
+	end.SetPlaceHolder("结尾")
+	end.Validator = start.Validator
+	start.SetText(formatOffset(item.StartOffset))
+	if item.EndOffset > 0 {
+		end.SetText(formatOffset(item.EndOffset))
+	}
+	
+	auto := widget.NewCheck("自动检测静音", func(b bool) {
+		if b {
+			start.Disable()
+			end.Disable()
+		} else {
+			start.Enable()
+			end.Enable()
+		}
+	})
+	auto.SetChecked(item.TrimSource != model.TrimSourceManual)
+	
+	length := formatOffset(item.Length)
+	items := []*widget.FormItem{
+		widget.NewFormItem("歌曲名", widget.NewLabel(item.Name)),
+		widget.NewFormItem("歌手", widget.NewLabel(item.Singer)),
+		widget.NewFormItem("专辑", widget.NewLabel(item.Album)),
+		widget.NewFormItem("路径", widget.NewLabel(item.Path)),
+		widget.NewFormItem("长度", widget.NewLabel(length)),
+		widget.NewFormItem("格式", widget.NewLabel(formatAudio(item))),
+		widget.NewFormItem("", auto),
+		widget.NewFormItem("开始位置", start),
+		widget.NewFormItem("结束位置", end),
+	}
+	if item.FailCount > 0 {
+		failure := widget.NewLabel(fmt.Sprintf("连续 %d 次: %s", item.FailCount, item.LastError))
+		failure.Wrapping = fyne.TextWrapWord
+		items = slices.Insert(items, 6, widget.NewFormItem("播放失败", failure))
+	}
+	form := dialog.NewForm("属性", "确认", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		if auto.Checked {
+			// 手动设置过的重新检测, 检测过的保持不变
+			if item.TrimSource == model.TrimSourceManual {
+				item.TrimSource, item.StartOffset, item.EndOffset = model.TrimSourceNone, 0, 0
+			}
+		} else {
+			item.TrimSource = model.TrimSourceManual
+			item.StartOffset, _ = parseOffset(start.Text)
+			item.EndOffset, _ = parseOffset(end.Text)
+		}
+		player.UpdateMusic(item.MusicTableID, item)
+	}, w)
+	form.Resize(fyne.NewSize(400, 0))
+	form.Show()
+}
+
+// formatAudio 音频参数, 例如 FLAC 44.1kHz 16bit 2ch 900kbps, 扫描前导入的音乐为空
+func formatAudio(item model.Music) string {
+	if item.Codec == "" {
+		return ""
+	}
+	parts := []string{item.Codec}
+	if item.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%gkHz", float64(item.SampleRate)/1000))
+	}
+	if item.BitDepth > 0 {
+		parts = append(parts, fmt.Sprintf("%dbit", item.BitDepth))
+	}
+	if item.Channels > 0 {
+		parts = append(parts, fmt.Sprintf("%dch", item.Channels))
+	}
+	if item.Bitrate > 0 {
+		parts = append(parts, fmt.Sprintf("%dkbps", item.Bitrate/1000))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatOffset 格式化为 分:秒.毫秒
+func formatOffset(d time.Duration) string {
+	return fmt.Sprintf("%d:%06.3f", int(d/time.Minute), (d % time.Minute).Seconds())
+}
+
+// parseOffset 解析 分:秒 或 秒, 秒可以带小数, 空字符串为 0
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	var minutes int
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		m, err := strconv.Atoi(s[:i])
+		if err != nil || m < 0 {
+			return 0, errOffset
+		}
+		minutes, s = m, s[i+1:]
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds < 0 {
+		return 0, errOffset
+	}
+	return time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second)), nil
+}
@@ -13,12 +13,12 @@ import (
 
 type musicTableView struct {
 	fn          mp.MusicPlayerOperationModule
-	data        mp.MusicPlayerDataModule
+	data        *playerBinding
 	w           fyne.Window
 	selectEntry *selectEntry
 }
 
-func newMusicTableView(mp mp.MusicPlayer, w fyne.Window, selectEntry *selectEntry) *musicTableView {
+func newMusicTableView(mp *playerBinding, w fyne.Window, selectEntry *selectEntry) *musicTableView {
 	return &musicTableView{fn: mp, data: mp, w: w, selectEntry: selectEntry}
 }
 
@@ -27,36 +27,33 @@ func (m *musicTableView) view(swap func(t listType)) fyne.CanvasObject {
 	streamMusicTable := m.streamTable(swap)
 	musicTable := m.table(swap)
 	
-	label := container.NewBorder(container.NewVBox(label0, streamMusicTable, widget.NewSeparator(), m.addTableButton(), m.delButton(), widget.NewSeparator()), nil, nil, nil, musicTable)
+	label := container.NewBorder(container.NewVBox(label0, streamMusicTable, widget.NewSeparator(), m.addTableButton(), m.delButton(), m.charsetButton(), widget.NewSeparator()), nil, nil, nil, musicTable)
 	return container.NewBorder(nil, nil, nil, widget.NewSeparator(), label)
 }
 func (m *musicTableView) streamTable(swap func(t listType)) fyne.CanvasObject {
-	items, index := m.data.StreamMusicTableList()
+	sources := m.data.StreamSources()
 	ml := widget.NewList(
-		items.Length,
+		func() int {
+			return len(sources)
+		},
 		func() fyne.CanvasObject {
 			bt := widget.NewButton("", func() {})
 			return bt
 		},
 		func(id widget.ListItemID, object fyne.CanvasObject) {
-			_item, _ := items.GetItem(id)
 			o := object.(*widget.Button)
-			item := _item.(*mp.BindingModel[string])
 			o.SetIcon(theme.MediaMusicIcon())
-			o.Text, _ = item.Get()
+			o.Text = sources[id]
 			o.OnTapped = func() {
-				_ = index.Set(id)
+				m.data.source = id
 				swap(StreamListType)
 			}
 			o.Refresh()
 		})
-	items.AddListener(&mp.DataListener{Fn: func() {
-		ml.Refresh()
-	}})
 	return ml
 }
 func (m *musicTableView) table(swap func(t listType)) fyne.CanvasObject {
-	items, index := m.data.MusicTableList()
+	items := &m.data.tables
 	ml := widget.NewList(
 		items.Length,
 		func() fyne.CanvasObject {
@@ -65,21 +62,21 @@ func (m *musicTableView) table(swap func(t listType)) fyne.CanvasObject {
 		},
 		func(id widget.ListItemID, object fyne.CanvasObject) {
 			o := object.(*widget.Button)
-			_item, _ := items.GetItem(id)
-			item := _item.(model.MusicTable)
+			item, ok := items.get(id)
+			if !ok {
+				return
+			}
 			if item.ID == db.DefaultTableID {
 				o.SetIcon(theme.HomeIcon())
 			}
 			o.Text = item.Name
 			o.OnTapped = func() {
-				_ = index.Set(id)
+				m.fn.SelectTable(item.ID)
 				swap(ListType)
 			}
 			o.Refresh()
 		})
-	items.AddListener(&mp.DataListener{Fn: func() {
-		ml.Refresh()
-	}})
+	items.addListener(ml.Refresh)
 	return ml
 }
 func (m *musicTableView) addTableButton() fyne.CanvasObject {
@@ -120,3 +117,51 @@ func (m *musicTableView) delButton() fyne.CanvasObject {
 		from.Show()
 	})
 }
+
+// charsetOptions 选项顺序与 model.Charset 一致
+var charsetOptions = []string{"自动识别", "UTF-8", "GBK(简体)", "Big5(繁体)"}
+
+// charsetButton 指定表格的文字编码, 标签和歌词自动识别错误时使用
+func (m *musicTableView) charsetButton() fyne.CanvasObject {
+	var tables []model.MusicTable
+	tableSelect := widget.NewSelect(nil, nil)
+	charsetSelect := widget.NewSelect(charsetOptions, nil)
+	tableSelect.OnChanged = func(string) {
+		if idx := tableSelect.SelectedIndex(); idx >= 0 {
+			charsetSelect.SetSelectedIndex(int(tables[idx].Charset))
+		}
+	}
+	from := dialog.NewForm("文字编码", "确认", "取消", []*widget.FormItem{
+		widget.NewFormItem("列表名称", tableSelect),
+		widget.NewFormItem("文字编码", charsetSelect),
+		widget.NewFormItem("", widget.NewLabel("标签和歌词显示为乱码时指定编码, 已导入的标签会重新读取")),
+	}, func(ok bool) {
+		if !ok || tableSelect.SelectedIndex() < 0 || charsetSelect.SelectedIndex() < 0 {
+			return
+		}
+		m.fn.SetTableCharset(tables[tableSelect.SelectedIndex()].ID, model.Charset(charsetSelect.SelectedIndex()))
+	}, m.w)
+	
+	from.Resize(fyne.NewSize(400, 0))
+	return widget.NewButtonWithIcon("文字编码", theme.SettingsIcon(), func() {
+		tables = m.data.tables.all()
+		var names []string
+		for _, item := range tables {
+			names = append(names, item.Name)
+		}
+		tableSelect.SetOptions(names)
+		tableSelect.ClearSelected()
+		charsetSelect.ClearSelected()
+		from.Show()
+	})
+}
+
+// tableCharset 表格指定的文字编码
+func tableCharset(player mp.MusicPlayer, tableID uint) model.Charset {
+	for _, item := range player.Tables() {
+		if item.ID == tableID {
+			return item.Charset
+		}
+	}
+	return model.CharsetAuto
+}
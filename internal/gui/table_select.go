@@ -3,7 +3,6 @@ package gui
 import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/Theodoree/music_player/internal/db"
-	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/mp"
 )
 
@@ -15,12 +14,9 @@ type selectEntry struct {
 
 func newSelectEntry(mp mp.MusicPlayer) *selectEntry {
 	fn := func() ([]string, []uint) {
-		items, _ := mp.MusicTableList()
 		var options []string
 		var idx []uint
-		for i := 0; i < items.Length(); i++ {
-			_item, _ := items.GetItem(i)
-			item := _item.(model.MusicTable)
+		for _, item := range mp.Tables() {
 			if item.ID == db.DefaultTableID {
 				continue
 			}
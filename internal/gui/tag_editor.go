@@ -0,0 +1,137 @@
+package gui
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/encode/tags"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/mp"
+	"k8s.io/klog"
+)
+
+var errTrack = errors.New("音轨号为正整数")
+
+// showTagEditor 编辑音乐的标签, 保存时写回文件并更新音乐库.
+// 不支持写入的格式和 CUE 中的一轨只修改音乐库, 不能修改歌词和封面
+func showTagEditor(player mp.MusicPlayer, item model.Music, w fyne.Window) {
+	writable := item.CueTrack == 0 && tags.Supported(item.Type)
+	
+	title := widget.NewEntry()
+	title.SetText(item.Name)
+	artist := widget.NewEntry()
+	artist.SetText(item.Singer)
+	album := widget.NewEntry()
+	album.SetText(item.Album)
+	genre := widget.NewEntry()
+	genre.SetText(item.Genre)
+	track := widget.NewEntry()
+	track.Validator = func(s string) error {
+		if n, err := strconv.Atoi(s); s != "" && (err != nil || n <= 0) {
+			return errTrack
+		}
+		return nil
+	}
+	if item.TrackNumber > 0 {
+		track.SetText(strconv.Itoa(item.TrackNumber))
+	}
+	lyrics := widget.NewMultiLineEntry()
+	lyrics.SetMinRowsVisible(4)
+	
+	// 可以写入时以文件中的标签为准, 歌词和封面不在音乐库中
+	cover := canvas.NewImageFromResource(nil)
+	cover.FillMode = canvas.ImageFillContain
+	cover.SetMinSize(fyne.NewSize(96, 96))
+	if writable {
+		if m, err := decode.GetMetadata(item.Path, item.Type); err == nil {
+			m.FixCharset(tableCharset(player, item.MusicTableID))
+			title.SetText(m.Title)
+			artist.SetText(m.Artist)
+			album.SetText(m.Album)
+			genre.SetText(m.Genre)
+			track.SetText("")
+			if m.Track > 0 {
+				track.SetText(strconv.Itoa(m.Track))
+			}
+			lyrics.SetText(m.Lyrics)
+			if pic := m.Cover(); pic != nil {
+				cover.Resource = fyne.NewStaticResource("cover", pic.Data)
+			}
+		} else {
+			klog.Error(item.Path, err)
+		}
+	}
+	var picture *tags.Picture
+	choose := widget.NewButton("选择图片", func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			if reader == nil {
+				return
+			}
+			defer func() {
+				_ = reader.Close()
+			}()
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			mime := "image/jpeg"
+			if strings.EqualFold(filepath.Ext(reader.URI().Name()), ".png") {
+				mime = "image/png"
+			}
+			picture = &tags.Picture{MIMEType: mime, Data: data}
+			cover.Resource = fyne.NewStaticResource(reader.URI().Name(), data)
+			cover.Refresh()
+		}, w)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".jpg", ".jpeg", ".png"}))
+		open.Show()
+	})
+	if !writable {
+		lyrics.Disable()
+		choose.Disable()
+	}
+	
+	items := []*widget.FormItem{
+		widget.NewFormItem("歌曲名", title),
+		widget.NewFormItem("歌手", artist),
+		widget.NewFormItem("专辑", album),
+		widget.NewFormItem("音轨号", track),
+		widget.NewFormItem("流派", genre),
+		widget.NewFormItem("歌词", lyrics),
+		widget.NewFormItem("封面", container.NewBorder(nil, nil, cover, choose)),
+	}
+	if !writable {
+		items = append(items, widget.NewFormItem("", widget.NewLabel("这种文件只修改音乐库, 不写入文件")))
+	}
+	form := dialog.NewForm("编辑标签", "保存", "取消", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		edit := tags.Edit{
+			Title:  strings.TrimSpace(title.Text),
+			Artist: strings.TrimSpace(artist.Text),
+			Album:  strings.TrimSpace(album.Text),
+			Genre:  strings.TrimSpace(genre.Text),
+			Lyrics: lyrics.Text,
+			Cover:  picture,
+		}
+		edit.Track, _ = strconv.Atoi(track.Text)
+		player.EditTags(item, edit)
+	}, w)
+	form.Resize(fyne.NewSize(480, 0))
+	form.Show()
+}
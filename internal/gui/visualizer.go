@@ -0,0 +1,98 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"github.com/Theodoree/music_player/internal/decode/spectrum"
+	"github.com/Theodoree/music_player/internal/mp"
+)
+
+type visualizerMode int
+
+const (
+	// visualizerBars 频谱柱状图
+	visualizerBars visualizerMode = iota
+	// visualizerScope 示波器
+	visualizerScope
+)
+
+// scopePoints 示波器绘制的点数
+const scopePoints = 128
+
+// visualizer 频谱可视化, 按 mode 绘制柱状图或示波器
+type visualizer struct {
+	mode  visualizerMode
+	frame spectrum.Frame
+	bars  [spectrum.Bands]*canvas.Rectangle
+	lines [scopePoints - 1]*canvas.Line
+	obj   *fyne.Container
+}
+
+// newVisualizer 跟随播放器的频谱事件刷新
+func newVisualizer(player *playerBinding, mode visualizerMode) *visualizer {
+	v := &visualizer{mode: mode}
+	var objects []fyne.CanvasObject
+	for i := range v.bars {
+		v.bars[i] = canvas.NewRectangle(theme.PrimaryColor())
+		objects = append(objects, v.bars[i])
+	}
+	for i := range v.lines {
+		v.lines[i] = canvas.NewLine(theme.PrimaryColor())
+		v.lines[i].StrokeWidth = 1.5
+		objects = append(objects, v.lines[i])
+	}
+	v.obj = container.New(v, objects...)
+	
+	player.on(func(e mp.Event) {
+		changed, ok := e.(mp.SpectrumChanged)
+		if !ok {
+			return
+		}
+		v.frame = changed.Frame
+		if v.obj.Visible() {
+			v.obj.Refresh()
+		}
+	})
+	return v
+}
+
+func (v *visualizer) setMode(mode visualizerMode) {
+	v.mode = mode
+	v.obj.Refresh()
+}
+
+// Layout Implementation fyne.Layout
+func (v *visualizer) Layout(_ []fyne.CanvasObject, size fyne.Size) {
+	for _, bar := range v.bars {
+		bar.Hidden = v.mode != visualizerBars
+	}
+	for _, line := range v.lines {
+		line.Hidden = v.mode != visualizerScope
+	}
+	switch v.mode {
+	case visualizerBars:
+		const gap = 2
+		width := size.Width / spectrum.Bands
+		for i, bar := range v.bars {
+			height := size.Height * float32(v.frame.Bands[i])
+			bar.Move(fyne.NewPos(float32(i)*width+gap/2, size.Height-height))
+			bar.Resize(fyne.NewSize(max(width-gap, 1), height))
+		}
+	case visualizerScope:
+		step := spectrum.WaveSize / scopePoints
+		point := func(i int) fyne.Position {
+			x := size.Width * float32(i) / (scopePoints - 1)
+			y := size.Height / 2 * (1 - float32(v.frame.Wave[i*step]))
+			return fyne.NewPos(x, y)
+		}
+		for i, line := range v.lines {
+			line.Position1, line.Position2 = point(i), point(i+1)
+		}
+	}
+}
+
+func (v *visualizer) MinSize(_ []fyne.CanvasObject) fyne.Size {
+	return fyne.NewSize(0, 120)
+}
@@ -8,6 +8,8 @@ const (
 	StatusInit Status = iota
 	StatusStop
 	StatusPlayDone
+	// StatusPlayFailed 播放中途解码出错, 例如损坏的帧
+	StatusPlayFailed
 )
 
 type StatusController struct {
@@ -40,3 +42,13 @@ func (s *StatusController) SetPlayDone() {
 	}
 	s.status = StatusPlayDone
 }
+func (s *StatusController) SetPlayFailed() {
+	s.Lock()
+	defer s.Unlock()
+	switch s.status {
+	case StatusInit:
+	default:
+		return
+	}
+	s.status = StatusPlayFailed
+}
@@ -4,10 +4,9 @@ import (
 	"fmt"
 	"gorm.io/gorm"
 	"math"
+	"strconv"
 	"strings"
 	"time"
-	
-	"fyne.io/fyne/v2/data/binding"
 )
 
 type MusicType int
@@ -16,36 +15,38 @@ const (
 	MusicTypeMP3 = iota
 	MusicTypeFLAC
 	MusicTypeWAV
+	MusicTypeOGG
+	MusicTypeAIFF
+	MusicTypeM4A // MP4 容器, 仅支持 ALAC 编码
+	MusicTypeDSD // DSF/DFF, 播放时转换为 PCM
 	MusicTypeEnd
 	
 	MusicTypeUnknown = math.MinInt16
 )
 
 func InitModel(db *gorm.DB) {
-	err := db.AutoMigrate(&MusicTable{}, &Music{}, &Picture{})
+	err := db.AutoMigrate(&MusicTable{}, &Music{}, &Picture{}, &EQPreset{})
 	if err != nil {
 		panic(err)
 	}
 }
 
-func IsMusicType(name string) (MusicType, bool) {
-	if strings.HasSuffix(name, "mp3") {
-		return MusicTypeMP3, true
-	}
-	if strings.HasSuffix(name, "flac") {
-		return MusicTypeFLAC, true
-	}
-	if strings.HasSuffix(name, "wav") {
-		return MusicTypeWAV, true
-	}
-	
-	return MusicTypeUnknown, false
-}
+// Charset 表格中标签、CUE 和歌词文件的文字编码, 自动识别错误时手动指定
+type Charset int
+
+const (
+	// CharsetAuto 自动识别 UTF-8、GBK 和 Big5
+	CharsetAuto Charset = iota
+	// CharsetUTF8 按原样使用, 不转换
+	CharsetUTF8
+	CharsetGBK
+	CharsetBig5
+)
 
 type MusicTable struct {
-	Name string `gorm:"name"`
+	Name    string  `gorm:"name"`
+	Charset Charset `gorm:"charset"`
 	gorm.Model
-	dummyDataListener `gorm:"-"`
 }
 
 type Music struct {
@@ -59,23 +60,133 @@ type Music struct {
 	Lyric        string        `gorm:"lyric"`
 	Union        string        `gorm:"index:idx_name,unique"`
 	
-	dummyDataListener `gorm:"-"`
+	// 标签中的其它信息, 音轨号和碟号的 Total 为 0 表示未知
+	AlbumArtist string `gorm:"album_artist"`
+	Composer    string `gorm:"composer"`
+	Genre       string `gorm:"genre"`
+	Year        int    `gorm:"year"`
+	TrackNumber int    `gorm:"track_number"`
+	TrackTotal  int    `gorm:"track_total"`
+	DiscNumber  int    `gorm:"disc_number"`
+	DiscTotal   int    `gorm:"disc_total"`
+	
+	// 音频参数, Bitrate 单位 bps, 有损编码的 BitDepth 为 0
+	Codec      string `gorm:"codec"`
+	Bitrate    int    `gorm:"bitrate"`
+	SampleRate int    `gorm:"sample_rate"`
+	Channels   int    `gorm:"channels"`
+	BitDepth   int    `gorm:"bit_depth"`
+	
+	// 响度归一化, Gain 单位 dB, Peak 为线性峰值(0 表示未知)
+	GainSource   GainSource `gorm:"gain_source"`
+	TrackGain    float64    `gorm:"track_gain"`
+	TrackPeak    float64    `gorm:"track_peak"`
+	AlbumGain    float64    `gorm:"album_gain"`
+	AlbumPeak    float64    `gorm:"album_peak"`
+	HasAlbumGain bool       `gorm:"has_album_gain"`
+	
+	// 裁剪范围, 均为相对音轨开头的位置, EndOffset 为 0 表示播放到结尾
+	TrimSource  TrimSource    `gorm:"trim_source"`
+	StartOffset time.Duration `gorm:"start_offset"`
+	EndOffset   time.Duration `gorm:"end_offset"`
+	
+	// CUE 整轨中的一轨, CueTrack 为 0 表示整个文件; CueEnd 为 0 表示到文件结尾
+	CueTrack int           `gorm:"cue_track"`
+	CueStart time.Duration `gorm:"cue_start"`
+	CueEnd   time.Duration `gorm:"cue_end"`
+	
+	// 连续播放失败的次数和最后一次的错误, 播放成功后清零; FailCount 大于 0 时自动切歌会跳过
+	FailCount int    `gorm:"fail_count"`
+	LastError string `gorm:"last_error"`
+	
 	gorm.Model
 }
 
+// GainSource 响度增益的来源
+type GainSource int
+
+const (
+	// GainSourceNone 还没有增益信息, 等待后台分析
+	GainSourceNone GainSource = iota
+	// GainSourceTag 来自 ReplayGain/R128 标签
+	GainSourceTag
+	// GainSourceAnalysis 来自后台响度分析, 只有音轨增益
+	GainSourceAnalysis
+	// GainSourceFailed 无法分析, 不再重试
+	GainSourceFailed
+)
+
+// TrimSource 裁剪范围的来源
+type TrimSource int
+
+const (
+	// TrimSourceNone 还没有检测静音, 等待后台分析
+	TrimSourceNone TrimSource = iota
+	// TrimSourceDetected 来自后台静音检测
+	TrimSourceDetected
+	// TrimSourceManual 用户手动设置, 不会被检测结果覆盖
+	TrimSourceManual
+	// TrimSourceFailed 无法检测, 不再重试
+	TrimSourceFailed
+)
+
+// PlayRange 实际播放的文件范围 [start,end), end 为 0 表示到文件结尾
+func (m *Music) PlayRange() (start, end time.Duration) {
+	start, end = m.CueStart+m.StartOffset, m.CueEnd
+	if m.EndOffset > 0 && (end == 0 || m.CueStart+m.EndOffset < end) {
+		end = m.CueStart + m.EndOffset
+	}
+	return start, end
+}
+
+// PlayLength 裁剪后的播放时长
+func (m *Music) PlayLength() time.Duration {
+	end := m.Length
+	if m.EndOffset > 0 && m.EndOffset < end {
+		end = m.EndOffset
+	}
+	return max(end-m.StartOffset, 0)
+}
+
 func (m *Music) SetUnion() {
 	m.Union = fmt.Sprintf("%d-%s", m.MusicTableID, m.Path)
+	if m.CueTrack > 0 {
+		m.Union += fmt.Sprintf("#%d", m.CueTrack)
+	}
 }
 
 type Picture struct {
-	Path              string `json:"path"`
-	dummyDataListener `gorm:"-"`
+	Path string `json:"path"`
 	gorm.Model
 }
 
-type dummyDataListener struct{}
+// EQPreset 均衡器预设, 内置预设不能删除
+type EQPreset struct {
+	Name    string  `gorm:"uniqueIndex"`
+	Preamp  float64 `gorm:"preamp"`
+	Gains   string  `gorm:"gains"` // 逗号分隔的各频段增益(dB)
+	BuiltIn bool    `gorm:"built_in"`
+	
+	gorm.Model
+}
 
-func (t dummyDataListener) AddListener(listener binding.DataListener) {
+func (p *EQPreset) SetGains(gains []float64) {
+	items := make([]string, len(gains))
+	for i, g := range gains {
+		items[i] = strconv.FormatFloat(g, 'f', -1, 64)
+	}
+	p.Gains = strings.Join(items, ",")
+}
 
+// GetGains 解析各频段增益, 无法解析的频段为0
+func (p *EQPreset) GetGains() []float64 {
+	if p.Gains == "" {
+		return nil
+	}
+	items := strings.Split(p.Gains, ",")
+	gains := make([]float64, len(items))
+	for i, v := range items {
+		gains[i], _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return gains
 }
-func (t dummyDataListener) RemoveListener(listener binding.DataListener) {}
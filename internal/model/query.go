@@ -83,7 +83,7 @@ func (q MusicTableQuery) Delete(db *gorm.DB, cacheService cacheInterface, item M
 func (q MusicTableQuery) Update(db *gorm.DB, cacheService cacheInterface, item MusicTable) error {
 	cacheService.Delete(q.CacheKey(item.ID))
 	return q.basicQuery.update(db, item, item.ID)
-	
+
 }
 func (q MusicTableQuery) GetByID(db *gorm.DB, cacheService cacheInterface, id uint) (MusicTable, error) {
 	value, _ := cacheService.Load(q.CacheKey(id))
@@ -143,3 +143,69 @@ func (q MusicQuery) GetByMusicListID(db *gorm.DB, musicTableTag uint) ([]Music,
 func (q MusicQuery) Update(db *gorm.DB, item Music) error {
 	return q.basicQuery.update(db, item, item.ID)
 }
+
+// UpdateReplayGain 只更新响度增益相关的字段, 不覆盖其他可能被用户修改的字段
+func (q MusicQuery) UpdateReplayGain(db *gorm.DB, item Music) error {
+	if item.ID == 0 {
+		return NotFoundPrimaryKey
+	}
+	return db.Model(&Music{Model: gorm.Model{ID: item.ID}}).
+		Select("gain_source", "track_gain", "track_peak", "album_gain", "album_peak", "has_album_gain").
+		Updates(item).Error
+}
+
+// UpdateTrim 只更新裁剪范围相关的字段
+func (q MusicQuery) UpdateTrim(db *gorm.DB, item Music) error {
+	if item.ID == 0 {
+		return NotFoundPrimaryKey
+	}
+	return db.Model(&Music{Model: gorm.Model{ID: item.ID}}).
+		Select("trim_source", "start_offset", "end_offset").
+		Updates(item).Error
+}
+
+type EQPresetQuery struct {
+	basicQuery[EQPreset]
+}
+
+func (q EQPresetQuery) GetAll(db *gorm.DB) ([]EQPreset, error) {
+	var items []EQPreset
+	return items, db.Order("id").Find(&items).Error
+}
+
+// Save 按名称保存预设, 同名时覆盖增益
+func (q EQPresetQuery) Save(db *gorm.DB, item EQPreset) error {
+	var exist EQPreset
+	return db.Where(EQPreset{Name: item.Name}).
+		Assign(map[string]interface{}{"preamp": item.Preamp, "gains": item.Gains}).
+		Attrs(EQPreset{BuiltIn: item.BuiltIn}).
+		FirstOrCreate(&exist).Error
+}
+
+// Delete 删除用户预设, 硬删除以便之后可以使用相同的名称
+func (q EQPresetQuery) Delete(db *gorm.DB, item EQPreset) error {
+	if item.ID == 0 {
+		return NotFoundPrimaryKey
+	}
+	return db.Unscoped().Where("built_in = ?", false).Delete(&q.empty, item.ID).Error
+}
+
+// UpdateTags 只更新标签中的文字和音轨号, 用于编辑标签和按新的编码重新读取标签
+func (q MusicQuery) UpdateTags(db *gorm.DB, item Music) error {
+	if item.ID == 0 {
+		return NotFoundPrimaryKey
+	}
+	return db.Model(&Music{Model: gorm.Model{ID: item.ID}}).
+		Select("name", "singer", "album", "album_artist", "composer", "genre", "track_number").
+		Updates(item).Error
+}
+
+// UpdateFailure 只更新播放失败的次数和错误
+func (q MusicQuery) UpdateFailure(db *gorm.DB, item Music) error {
+	if item.ID == 0 {
+		return NotFoundPrimaryKey
+	}
+	return db.Model(&Music{Model: gorm.Model{ID: item.ID}}).
+		Select("fail_count", "last_error").
+		Updates(item).Error
+}
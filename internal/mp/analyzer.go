@@ -0,0 +1,165 @@
+package mp
+
+import (
+	"os"
+	"sync"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+	"github.com/Theodoree/music_player/internal/tool"
+	"k8s.io/klog"
+)
+
+// trackAnalyzer 在后台补全音乐缺少的增益和裁剪范围: 读取增益标签,
+// 没有标签的测量响度, 同时检测开头和结尾的静音, 结果保存到数据库
+type trackAnalyzer struct {
+	trigger chan struct{}
+	mu      sync.Mutex
+	// results 已经分析完成的音乐, 播放前同步到列表中的音乐上, key 为音乐ID
+	results map[uint]model.Music
+}
+
+func newTrackAnalyzer() trackAnalyzer {
+	return trackAnalyzer{trigger: make(chan struct{}, 1), results: map[uint]model.Music{}}
+}
+
+// request 请求重新扫描一遍数据库, 正在扫描时合并为一次
+func (l *trackAnalyzer) request() {
+	select {
+	case l.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (l *trackAnalyzer) store(item model.Music) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results[item.ID] = item
+}
+
+func (l *trackAnalyzer) load(id uint) (model.Music, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item, ok := l.results[id]
+	return item, ok
+}
+
+// analyzeTracks 后台分析协程, 一次只分析一首, 导入音乐后由 request 触发
+func (m *musicPlayer) analyzeTracks() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.analyzer.trigger:
+		}
+		tables, err := m.store.GetMusicTable(0, 5000)
+		if err != nil {
+			klog.Error(err)
+			continue
+		}
+		for _, table := range tables {
+			items, err := m.store.GetMusicByMusicTableID(table.ID)
+			if err != nil {
+				klog.Error(err)
+				continue
+			}
+			for _, item := range items {
+				needGain, needTrim := item.GainSource == model.GainSourceNone, item.TrimSource == model.TrimSourceNone
+				if !needGain && !needTrim {
+					continue
+				}
+				if err := m.analyzeTrack(&item); err != nil {
+					if m.ctx.Err() != nil {
+						return
+					}
+					klog.Error(err)
+				}
+				if needGain {
+					if err := m.store.UpdateReplayGain(item); err != nil {
+						klog.Error(err)
+						continue
+					}
+				}
+				if needTrim {
+					if err := m.store.UpdateTrim(item); err != nil {
+						klog.Error(err)
+						continue
+					}
+				}
+				m.analyzer.store(item)
+			}
+		}
+	}
+}
+
+// analyzeTrack 补全缺少的增益和裁剪范围, 没有得到的标记为 GainSourceFailed/TrimSourceFailed。
+// 优先读取增益标签, 其余的在同一遍解码中测量响度和检测静音, 顺便缓存波形, 播放时不用再解码一遍
+func (m *musicPlayer) analyzeTrack(item *model.Music) error {
+	needGain, needTrim := item.GainSource == model.GainSourceNone, item.TrimSource == model.TrimSourceNone
+	if needGain {
+		item.GainSource = model.GainSourceFailed
+	}
+	if needTrim {
+		item.TrimSource = model.TrimSourceFailed
+	}
+	file, err := os.Open(item.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	
+	// CUE 中的一轨与整个文件的响度不同, 文件的标签不适用
+	if needGain && item.CueTrack == 0 {
+		if meta, err := decode.ReadMetadata(file, item.Type); err == nil && meta.ReplayGain.Found() {
+			tool.SetReplayGain(item, meta.ReplayGain, model.GainSourceTag)
+			needGain = false
+		}
+		if !needGain && !needTrim {
+			return nil
+		}
+		_, _ = file.Seek(0, 0)
+	}
+	a, err := decode.Analyze(m.ctx, item.Type, file, item.CueStart, item.CueEnd)
+	if err != nil {
+		return err
+	}
+	if needTrim {
+		item.TrimSource = model.TrimSourceDetected
+		item.StartOffset, item.EndOffset = a.Silence.Start, a.Silence.End
+	}
+	if a.WaveformErr == nil {
+		if cache, err := m.waveforms.cacheFile(*item); err == nil {
+			m.saveWaveform(cache, a.Waveform)
+		}
+	}
+	if needGain {
+		if a.LoudnessErr != nil {
+			return a.LoudnessErr
+		}
+		tool.SetReplayGain(item, a.Loudness, model.GainSourceAnalysis)
+	}
+	return nil
+}
+
+// syncAnalysis 把后台分析的增益和裁剪范围同步到即将播放的音乐上
+func (m *musicPlayer) syncAnalysis(music music.Music) {
+	cur, err := music.GetMusic()
+	if err != nil || cur.ID == 0 || (cur.GainSource != model.GainSourceNone && cur.TrimSource != model.TrimSourceNone) {
+		return
+	}
+	item, ok := m.analyzer.load(cur.ID)
+	if !ok {
+		return
+	}
+	if cur.GainSource == model.GainSourceNone {
+		info := tool.ReplayGain(item)
+		tool.SetReplayGain(&cur, info, item.GainSource)
+	}
+	if cur.TrimSource == model.TrimSourceNone {
+		cur.TrimSource, cur.StartOffset, cur.EndOffset = item.TrimSource, item.StartOffset, item.EndOffset
+	}
+	music.Update(cur)
+}
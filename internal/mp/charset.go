@@ -0,0 +1,89 @@
+package mp
+
+import (
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/tool"
+	"k8s.io/klog"
+)
+
+// SetTableCharset Implementation MusicPlayerOperationModule
+func (m *musicPlayer) SetTableCharset(tableID uint, c model.Charset) {
+	m.do(func() {
+		m.setTableCharset(tableID, c)
+	})
+}
+
+// setTableCharset 保存表格的文字编码. 歌词每次读取时转换, 当前歌词立即刷新; 标签在导入时已经转换, 在后台重新读取
+func (m *musicPlayer) setTableCharset(tableID uint, c model.Charset) {
+	table, err := m.store.GetMusicTableByID(tableID)
+	if err != nil {
+		m.alert(err.Error())
+		return
+	}
+	if table.Charset == c {
+		return
+	}
+	table.Charset = c
+	if err := m.store.UpdateMusicTable(table); err != nil {
+		m.alert(err.Error())
+		return
+	}
+	if err := m.refreshTable(); err != nil {
+		m.alert(err.Error())
+	}
+	if m.curMusic != nil && m.curMusic.TableID() == tableID {
+		m.musicPlayerData.progress.setLyrics(m.curMusic.Lyrics())
+		m.publishTrack()
+	}
+	
+	items, err := m.store.GetMusicByMusicTableID(tableID)
+	if err != nil {
+		m.alert(err.Error())
+		return
+	}
+	go m.rereadTags(tableID, items, c)
+}
+
+// rereadTags 按编码 c 重新读取表格中音乐的标签, 全部读取后在命令循环中一起更新
+func (m *musicPlayer) rereadTags(tableID uint, items []model.Music, c model.Charset) {
+	var changed []model.Music
+	for _, item := range items {
+		if m.ctx.Err() != nil {
+			return
+		}
+		before := item
+		if err := tool.RereadTags(&item, c); err != nil {
+			klog.Error(item.Path, err)
+			continue
+		}
+		if item != before {
+			changed = append(changed, item)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	m.post(func() {
+		for _, item := range changed {
+			if err := m.store.UpdateTags(item); err != nil {
+				klog.Error(err)
+			}
+		}
+		if err := m.refreshMusic(tableID); err != nil {
+			m.alert(err.Error())
+		}
+		if m.curMusic == nil {
+			return
+		}
+		cur, _ := m.curMusic.GetMusic()
+		for _, item := range changed {
+			if item.ID != cur.ID {
+				continue
+			}
+			cur.Name, cur.Singer, cur.Album = item.Name, item.Singer, item.Album
+			cur.AlbumArtist, cur.Composer, cur.Genre = item.AlbumArtist, item.Composer, item.Genre
+			m.curMusic.Update(cur)
+			m.publishTrack()
+		}
+	})
+}
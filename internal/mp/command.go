@@ -0,0 +1,216 @@
+package mp
+
+import (
+	"slices"
+	"sync"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+)
+
+// commands 播放器的命令队列. curMusic、selectList 等状态只在 run 协程中读写,
+// 界面协程的操作和解码器回调都作为命令依次执行, 不需要加锁
+type commands struct {
+	mu      sync.Mutex
+	pending []func()
+	// wake 有新命令时唤醒 run
+	wake chan struct{}
+	// stopped run 退出后关闭, 之后投递的命令不再执行
+	stopped chan struct{}
+}
+
+func newCommands() commands {
+	return commands{wake: make(chan struct{}, 1), stopped: make(chan struct{})}
+}
+
+func (c *commands) push(fn func()) {
+	c.mu.Lock()
+	c.pending = append(c.pending, fn)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *commands) pop() (func(), bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil, false
+	}
+	fn := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	return fn, true
+}
+
+// run 命令循环, ctx 取消后退出
+func (m *musicPlayer) run() {
+	defer close(m.commands.stopped)
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-m.commands.wake:
+		}
+		for {
+			fn, ok := m.commands.pop()
+			if !ok {
+				break
+			}
+			fn()
+			if m.ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// do 在命令循环中执行 fn 并等待完成, 不能在命令循环中调用
+func (m *musicPlayer) do(fn func()) {
+	done := make(chan struct{})
+	m.commands.push(func() {
+		defer close(done)
+		fn()
+	})
+	select {
+	case <-done:
+	case <-m.commands.stopped:
+	}
+}
+
+// post 把 fn 投递到命令循环后立即返回, 解码器回调和后台协程使用 post, 不让输出的时钟协程等待命令循环,
+// 也可以在命令循环中调用
+func (m *musicPlayer) post(fn func()) {
+	m.commands.push(fn)
+}
+
+// Play Implementation MusicPlayerPlaybackModule, 播放控制都是发给命令循环的消息
+func (m *musicPlayer) Play() {
+	m.do(m.play)
+}
+func (m *musicPlayer) Pause() {
+	m.do(m.pause)
+}
+func (m *musicPlayer) Stop() {
+	m.do(m.stop)
+}
+func (m *musicPlayer) Prev() {
+	m.do(m.prev)
+}
+func (m *musicPlayer) Next() {
+	m.do(m.next)
+}
+func (m *musicPlayer) PlayAt(kind ListKind, index int) {
+	m.do(func() {
+		m.playAt(kind, index)
+	})
+}
+func (m *musicPlayer) Seek(percent float64) {
+	m.do(func() {
+		m.seek(percent)
+	})
+}
+func (m *musicPlayer) SeekTime(t time.Duration) {
+	m.do(func() {
+		m.seekTime(t)
+	})
+}
+func (m *musicPlayer) ToggleABLoop() {
+	m.do(m.toggleABLoop)
+}
+
+// Status Implementation MusicPlayerDataModule, 返回命令循环中的数据的副本
+func (m *musicPlayer) Status() Status {
+	var s Status
+	m.do(func() {
+		s = m.status()
+	})
+	return s
+}
+func (m *musicPlayer) Tables() []model.MusicTable {
+	var tables []model.MusicTable
+	m.do(func() {
+		tables = slices.Clone(m.musicPlayerData.tables)
+	})
+	return tables
+}
+func (m *musicPlayer) List(kind ListKind) (uint, []music.Music) {
+	var (
+		tableID uint
+		items   []music.Music
+	)
+	m.do(func() {
+		l := m.listOf(kind)
+		tableID, items = l.tableId, slices.Clone(l.items)
+	})
+	return tableID, items
+}
+func (m *musicPlayer) StreamSources() []string {
+	var sources []string
+	m.do(func() {
+		sources = slices.Clone(m.musicPlayerData.streamSources)
+	})
+	return sources
+}
+
+// SelectTable Implementation MusicPlayerOperationModule
+func (m *musicPlayer) SelectTable(tableID uint) {
+	m.do(func() {
+		m.selectTable(tableID)
+	})
+}
+func (m *musicPlayer) SearchList(keyword string) {
+	m.do(func() {
+		m.list.Search(keyword)
+	})
+}
+func (m *musicPlayer) SearchStream(source int, keyword string) {
+	m.do(func() {
+		m.searchStream(source, keyword)
+	})
+}
+func (m *musicPlayer) AddTable(table model.MusicTable) {
+	m.do(func() {
+		m.addTable(table)
+	})
+}
+func (m *musicPlayer) DelTable(tableID uint) {
+	m.do(func() {
+		m.delTable(tableID)
+	})
+}
+func (m *musicPlayer) ImportMusic(tableID uint, path string) {
+	m.do(func() {
+		m.importMusic(tableID, path)
+	})
+}
+func (m *musicPlayer) AddMusic(tableID uint, music model.Music) {
+	m.do(func() {
+		m.addMusic(tableID, music)
+	})
+}
+func (m *musicPlayer) UpdateMusic(tableID uint, music model.Music) {
+	m.do(func() {
+		m.updateMusic(tableID, music)
+	})
+}
+func (m *musicPlayer) SaveEQPreset(name string) {
+	m.do(func() {
+		m.saveEQPreset(name)
+	})
+}
+func (m *musicPlayer) DeleteEQPreset(presetID uint) {
+	m.do(func() {
+		m.deleteEQPreset(presetID)
+	})
+}
+func (m *musicPlayer) GetPlayedMusic() music.Music {
+	var cur music.Music
+	m.do(func() {
+		cur = m.curMusic
+	})
+	return cur
+}
@@ -0,0 +1,101 @@
+package mp
+
+import (
+	"slices"
+	"strings"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/model"
+	"k8s.io/klog"
+)
+
+// loadEQPreset 把预设载入到各频段, 开关保持不变
+func (m *musicPlayer) loadEQPreset(p model.EQPreset) {
+	m.setSettings(func(s *Settings) {
+		s.Equalizer = eq.Settings{Enabled: s.Equalizer.Enabled, Preamp: p.Preamp}
+		copy(s.Equalizer.Gains[:], p.GetGains())
+	}, func(s Settings) {
+		decode.SetEqualizer(s.Equalizer)
+	})
+}
+
+func (m *musicPlayer) refreshEQPresets() error {
+	presets, err := m.store.GetEQPresets()
+	if err != nil {
+		return err
+	}
+	m.musicPlayerData.presets = presets
+	m.events.publish(EQPresetsChanged{Presets: slices.Clone(presets)})
+	return nil
+}
+
+// LoadEQPreset Implementation MusicPlayerSettingsModule
+func (m *musicPlayer) LoadEQPreset(presetID uint) {
+	m.do(func() {
+		for _, p := range m.musicPlayerData.presets {
+			if p.ID == presetID {
+				m.loadEQPreset(p)
+			}
+		}
+	})
+}
+
+// EQPresets Implementation MusicPlayerDataModule
+func (m *musicPlayer) EQPresets() []model.EQPreset {
+	var presets []model.EQPreset
+	m.do(func() {
+		presets = slices.Clone(m.musicPlayerData.presets)
+	})
+	return presets
+}
+
+// saveEQPreset 把当前的均衡器设置保存为预设
+func (m *musicPlayer) saveEQPreset(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		m.alert("预设名称不能为空")
+		return
+	}
+	for _, p := range m.musicPlayerData.presets {
+		if p.Name == name && p.BuiltIn {
+			m.alert("不能覆盖内置预设")
+			return
+		}
+	}
+	item := model.EQPreset{Name: name, Preamp: m.settings.Equalizer.Preamp}
+	item.SetGains(m.settings.Equalizer.Gains[:])
+	if err := m.store.SaveEQPreset(item); err != nil {
+		klog.Error(err)
+		m.alert(err.Error())
+		return
+	}
+	if err := m.refreshEQPresets(); err != nil {
+		m.alert(err.Error())
+	}
+}
+
+// deleteEQPreset 删除用户保存的预设, 随后载入第一个预设
+func (m *musicPlayer) deleteEQPreset(presetID uint) {
+	for _, p := range m.musicPlayerData.presets {
+		if p.ID != presetID {
+			continue
+		}
+		if p.BuiltIn {
+			m.alert("不能删除内置预设")
+			return
+		}
+		if err := m.store.DeleteEQPreset(p); err != nil {
+			klog.Error(err)
+			m.alert(err.Error())
+			return
+		}
+	}
+	if err := m.refreshEQPresets(); err != nil {
+		m.alert(err.Error())
+		return
+	}
+	if len(m.musicPlayerData.presets) > 0 {
+		m.loadEQPreset(m.musicPlayerData.presets[0])
+	}
+}
@@ -0,0 +1,230 @@
+package mp
+
+import (
+	"slices"
+	"sync"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/spectrum"
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+)
+
+// Event 播放器事件, 具体类型为下面定义的各个结构体之一
+type Event interface {
+	event()
+}
+
+// TrackChanged 当前音乐或它的信息变化, 停止播放时 Music 为零值
+type TrackChanged struct {
+	Music    model.Music
+	Duration time.Duration
+	// Lyrics 去掉时间标签后的全部歌词, 一行一句
+	Lyrics string
+}
+
+// PositionChanged 播放进度, 约 500ms 一次
+type PositionChanged struct {
+	Position time.Duration
+	Duration time.Duration
+}
+
+// StateChanged 播放状态变化
+type StateChanged struct {
+	From, To State
+}
+
+// ErrorOccurred 播放或操作出错, 与音乐无关的错误 Music 为零值
+type ErrorOccurred struct {
+	Music model.Music
+	Err   error
+}
+
+// QueueChanged 播放列表的内容变化, Items 为新的列表内容
+type QueueChanged struct {
+	Kind    ListKind
+	TableID uint
+	Items   []music.Music
+}
+
+// TablesChanged 自定义表格增删
+type TablesChanged struct {
+	Tables []model.MusicTable
+}
+
+// SettingsChanged 播放设置变化
+type SettingsChanged struct {
+	Settings Settings
+}
+
+// EQPresetsChanged 均衡器预设增删
+type EQPresetsChanged struct {
+	Presets []model.EQPreset
+}
+
+// ABLoopChanged A-B 循环的标记变化, -1 表示未标记
+type ABLoopChanged struct {
+	A, B time.Duration
+}
+
+// WaveformChanged 当前音乐的峰值波形, 切歌时先发布一次空波形, 后台提取完成后再发布
+type WaveformChanged struct {
+	Peaks waveform.Peaks
+}
+
+// SpectrumChanged 约 30 fps 的输出频谱与波形, 持续静音时停止发布
+type SpectrumChanged struct {
+	Frame spectrum.Frame
+}
+
+func (TrackChanged) event()     {}
+func (PositionChanged) event()  {}
+func (StateChanged) event()     {}
+func (ErrorOccurred) event()    {}
+func (QueueChanged) event()     {}
+func (TablesChanged) event()    {}
+func (SettingsChanged) event()  {}
+func (EQPresetsChanged) event() {}
+func (ABLoopChanged) event()    {}
+func (WaveformChanged) event()  {}
+func (SpectrumChanged) event()  {}
+
+// eventBuffer 每个订阅者通道的缓冲事件数
+const eventBuffer = 64
+
+// lossy 高频事件, 订阅者来不及读取时只保留最新的一个; 其余事件携带的变化不会被之后的事件重复, 不能丢弃
+func lossy(e Event) bool {
+	switch e.(type) {
+	case PositionChanged, SpectrumChanged:
+		return true
+	}
+	return false
+}
+
+// sameLossy a 和 b 是否是同一种高频事件
+func sameLossy(a, b Event) bool {
+	switch a.(type) {
+	case PositionChanged:
+		_, ok := b.(PositionChanged)
+		return ok
+	case SpectrumChanged:
+		_, ok := b.(SpectrumChanged)
+		return ok
+	}
+	return false
+}
+
+// eventHub 把事件分发给所有订阅者, 发布方永远不会阻塞。
+// 每个订阅者有自己的队列和投递协程, 读取过慢时队列中的高频事件被同类的新事件替换, 其余事件按顺序全部投递
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// subscriber 一个订阅者, queue 中是还没有放进通道的事件
+type subscriber struct {
+	ch    chan Event
+	wake  chan struct{}
+	done  chan struct{}
+	mu    sync.Mutex
+	queue []Event
+}
+
+func (h *eventHub) subscribe() (<-chan Event, func()) {
+	s := &subscriber{ch: make(chan Event, eventBuffer), wake: make(chan struct{}, 1), done: make(chan struct{})}
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*subscriber]struct{})
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	go s.run()
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, s)
+			h.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+func (h *eventHub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		s.push(e)
+	}
+}
+
+// push 把事件加入队列, 高频事件替换队列中还没有投递的同类事件
+func (s *subscriber) push(e Event) {
+	s.mu.Lock()
+	if lossy(e) {
+		s.queue = slices.DeleteFunc(s.queue, func(q Event) bool {
+			return sameLossy(q, e)
+		})
+	}
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	e := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return e, true
+}
+
+// run 投递协程, 把队列中的事件依次放进通道; 取消订阅后剩余的事件尽量留在通道的缓冲中, 然后关闭通道
+func (s *subscriber) run() {
+	defer close(s.ch)
+	for {
+		e, ok := s.pop()
+		if !ok {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				s.flush()
+				return
+			}
+		}
+		select {
+		case s.ch <- e:
+		case <-s.done:
+			select {
+			case s.ch <- e:
+				s.flush()
+			default:
+			}
+			return
+		}
+	}
+}
+
+// flush 把队列中的事件放进通道, 缓冲满时丢弃剩下的
+func (s *subscriber) flush() {
+	for {
+		e, ok := s.pop()
+		if !ok {
+			return
+		}
+		select {
+		case s.ch <- e:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package mp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/tool"
+	"k8s.io/klog"
+)
+
+var ErrExportSource = errors.New("不能覆盖源文件")
+
+// ExportMusic Implementation MusicPlayerOperationModule
+func (m *musicPlayer) ExportMusic(music model.Music, path string, opts encode.Options, start, end time.Duration) {
+	go func() {
+		if err := exportMusic(m.ctx, music, path, opts, start, end); err != nil {
+			klog.Error(err)
+			m.alert(fmt.Sprintf("导出失败: %s", err))
+			return
+		}
+		m.alert(fmt.Sprintf("已导出到 %s", path))
+	}()
+}
+
+// ExportTable Implementation MusicPlayerOperationModule
+func (m *musicPlayer) ExportTable(tableID uint, dir string, opts encode.Options) {
+	var (
+		items []model.Music
+		err   error
+	)
+	m.do(func() {
+		items, err = m.store.GetMusicByMusicTableID(tableID)
+	})
+	if err != nil {
+		m.alert(err.Error())
+		return
+	}
+	go func() {
+		var failed int
+		used := map[string]bool{}
+		for i, item := range items {
+			path := uniquePath(dir, exportName(i+1, item, opts.Format), used)
+			if err := exportMusic(m.ctx, item, path, opts, item.StartOffset, item.EndOffset); err != nil {
+				if m.ctx.Err() != nil {
+					return
+				}
+				klog.Error(item.Path, err)
+				failed++
+			}
+		}
+		m.alert(fmt.Sprintf("导出完成: 成功 %d 首, 失败 %d 首", len(items)-failed, failed))
+	}()
+}
+
+// exportMusic 转码一首音乐, start/end 相对音轨开头, end 为 0 时到音轨结尾。
+// 先写入 .part 文件, 完成后重命名, 失败时不会留下不完整的文件
+func exportMusic(ctx context.Context, item model.Music, path string, opts encode.Options, start, end time.Duration) error {
+	if abs, _ := filepath.Abs(path); abs == item.Path {
+		return ErrExportSource
+	}
+	src, err := os.Open(item.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	
+	// 换算为文件中的位置, 不超过 CUE 中这一轨的结尾
+	from, to := item.CueStart+start, item.CueEnd
+	if end > 0 && (to == 0 || item.CueStart+end < to) {
+		to = item.CueStart + end
+	}
+	tmp := path + ".part"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	tags := encode.Tags{Title: item.Name, Artist: item.Singer, Album: item.Album, Track: item.TrackNumber, Genre: item.Genre, Year: item.Year, ReplayGain: tool.ReplayGain(item)}
+	// CUE 中的一轨使用 CUE 中的音轨号, 整个文件的标签属于整张专辑
+	if item.CueTrack > 0 {
+		tags.Track = item.CueTrack
+	}
+	if meta, err := decode.GetMetadata(item.Path, item.Type); err == nil {
+		tags.Cover = meta.Cover()
+	}
+	err = decode.Export(ctx, item.Type, src, from, to, dst, opts, tags)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// exportName 批量导出的文件名: 序号 - 歌手 - 歌曲名.扩展名
+func exportName(index int, item model.Music, f encode.Format) string {
+	name := item.Name
+	if _, ok := decode.LookupExt(name); ok {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if item.Singer != "" {
+		name = item.Singer + " - " + name
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return fmt.Sprintf("%02d - %s%s", index, name, f.Ext())
+}
+
+// uniquePath 文件名与这次导出的其它文件或已有的文件重复时加上 (2)、(3) 等后缀, 避免覆盖
+func uniquePath(dir, name string, used map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	path := filepath.Join(dir, name)
+	for i := 2; ; i++ {
+		// 不区分大小写的文件系统上只有大小写不同的文件名也是同一个文件
+		key := strings.ToLower(path)
+		if _, err := os.Stat(path); !used[key] && errors.Is(err, os.ErrNotExist) {
+			used[key] = true
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+	}
+}
@@ -1,7 +1,12 @@
 package mp
 
 import (
-	"fyne.io/fyne/v2/data/binding"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/encode/tags"
 	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/music"
 )
@@ -17,61 +22,99 @@ type MusicPlayerPlaybackModule interface {
 	Prev()
 	// Next 下一首
 	Next()
+	// PlayAt 播放指定列表中的第 index 首, 之后的切歌都在这个列表中进行
+	PlayAt(kind ListKind, index int)
+	// Seek 跳转到进度条上的位置[0,100]
+	Seek(percent float64)
+	// SeekTime 跳转到指定时间
+	SeekTime(t time.Duration)
+	// ToggleABLoop A-B 循环: 依次标记A点、标记B点并开始循环、取消循环
+	ToggleABLoop()
+}
+
+type MusicPlayerSettingsModule interface {
+	// Settings 当前的播放设置, 修改后发布 SettingsChanged
+	Settings() Settings
+	// SetVolume 音量[0,100]
+	SetVolume(volume float64)
+	// SetPlayMode 播放模式
+	SetPlayMode(mode PlayMode)
+	// SetCrossfade 交叉淡化时长, 0 表示无缝衔接
+	SetCrossfade(d time.Duration)
+	// SetReplayGainMode 响度归一化模式
+	SetReplayGainMode(mode replaygain.Mode)
+	// SetEqualizer 均衡器开关、前级增益和各频段增益(dB), 频段见 eq.Frequencies
+	SetEqualizer(s eq.Settings)
+	// LoadEQPreset 把预设载入到均衡器, 开关保持不变
+	LoadEQPreset(presetID uint)
+	// SetSpeed 播放速度[0.5,2], 音调不变
+	SetSpeed(speed float64)
+	// SetPitch 变调半音数[-12,12], 速度不变
+	SetPitch(semitones float64)
 }
 
 type MusicPlayerDataModule interface {
-	// Lyrics 返回一个动态绑定的歌词(全量)
-	Lyrics() binding.String
-	// Lyric 返回一个动态绑定的歌词(一行)
-	Lyric() binding.String
-	// MusicName 返回一个动态绑定的音乐名
-	MusicName() binding.String
-	// SingerName 返回一个动态绑定的歌手名
-	SingerName() binding.String
-	// Volume 返回一个动态绑定的float64[0,100]
-	Volume() binding.Float
-	// ProcessBar 返回一个动态绑定的进度条值[0,100]
-	ProcessBar() binding.Float
-	// MusicCurTime 返回一个动态绑定的当前播放时间
-	MusicCurTime() binding.String
-	// MusicEndTime 返回一个动态绑定的音乐结束时间
-	MusicEndTime() binding.String
-	// MusicTableList 自定义表格列表和索引
-	MusicTableList() (binding.DataList, binding.Int)
-	// MusicList 音乐列表和索引
-	MusicList() (binding.DataList, binding.Int, binding.String)
-	// PictureList 返回一个墙纸列表
-	PictureList() binding.DataList
-	// PlayMode 播放模式
-	PlayMode() binding.DataItem
-	// PlayStatus 返回一个动态绑定的播放状态
-	PlayStatus() binding.Bool
-	
-	// StreamMusicList 流媒体列表和索引
-	StreamMusicList() (binding.DataList, binding.Int, binding.String)
-	// StreamMusicTableList 流媒体表格列表和索引
-	StreamMusicTableList() (binding.DataList, binding.Int)
+	// Status 当前音乐、进度、歌词、A-B 循环和波形的快照
+	Status() Status
+	// Tables 自定义表格列表, 变化时发布 TablesChanged
+	Tables() []model.MusicTable
+	// List 播放列表所属的表格和当前内容(搜索过滤后), 变化时发布 QueueChanged
+	List(kind ListKind) (tableID uint, items []music.Music)
+	// StreamSources 流媒体来源的名称, 下标即 SearchStream 的 source
+	StreamSources() []string
+	// EQPresets 均衡器预设列表, 变化时发布 EQPresetsChanged
+	EQPresets() []model.EQPreset
 }
 
 type MusicPlayerOperationModule interface {
+	// SelectTable 把表格中的音乐载入本地列表
+	SelectTable(tableID uint)
+	// SearchList 按歌名、歌手或专辑过滤本地列表, 为空时恢复整个表格
+	SearchList(keyword string)
+	// FilterBroken 本地列表只显示最近播放失败的音乐, 可以与 SearchList 同时使用
+	FilterBroken(on bool)
+	// SearchStream 在流媒体来源中搜索, 结果放入流媒体列表
+	SearchStream(source int, keyword string)
 	// AddTable 新增表格
 	AddTable(table model.MusicTable)
 	// DelTable  删除表格
 	DelTable(tableID uint)
 	// ImportMusic 导入音乐
 	ImportMusic(tableID uint, path string)
+	// SetTableCharset 指定表格中标签、CUE 和歌词的文字编码, 自动识别错误时使用; 已导入的标签在后台重新读取
+	SetTableCharset(tableID uint, c model.Charset)
 	// AddWallpaper 新增墙纸
 	AddWallpaper(path string)
 	// AddMusic 新增音乐项至指定表格
 	AddMusic(tableID uint, music model.Music)
 	// UpdateMusic 更新音乐
 	UpdateMusic(tableID uint, music model.Music)
+	// SaveEQPreset 把当前均衡器设置保存为预设, 同名的用户预设会被覆盖
+	SaveEQPreset(name string)
+	// DeleteEQPreset 删除用户预设, 随后载入第一个预设
+	DeleteEQPreset(presetID uint)
 	// GetPlayedMusic 获取当前音乐
 	GetPlayedMusic() music.Music
+	// ExportMusic 在后台把音乐中 [start,end) 之间的部分转码保存到 path, 范围相对音轨开头, end 为 0 时到结尾
+	ExportMusic(music model.Music, path string, opts encode.Options, start, end time.Duration)
+	// ExportTable 在后台把列表中的所有音乐按裁剪后的范围转码保存到 dir, 文件名重复时加上序号
+	ExportTable(tableID uint, dir string, opts encode.Options)
+	// EditTags 在后台把标签写回文件, 成功后更新音乐; CUE 中的一轨和不支持写入的格式只更新音乐库
+	EditTags(music model.Music, edit tags.Edit)
+}
+
+type MusicPlayerEventModule interface {
+	// State 当前播放状态
+	State() State
+	// Subscribe 订阅播放器事件, cancel 后通道被关闭; 读取过慢时进度和频谱事件只保留最新的, 其余事件不会丢弃, 不会阻塞播放
+	Subscribe() (events <-chan Event, cancel func())
 }
 
+// MusicPlayer 播放器核心, 只使用普通的 Go 类型和事件流, 不依赖界面库
 type MusicPlayer interface {
 	MusicPlayerPlaybackModule
+	MusicPlayerSettingsModule
+	MusicPlayerEventModule
 	MusicPlayerDataModule
 	MusicPlayerOperationModule
 }
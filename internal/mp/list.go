@@ -1,9 +1,11 @@
 package mp
 
 import (
-	"github.com/Theodoree/music_player/internal/music"
 	"math/rand/v2"
+	"slices"
 	"strings"
+	
+	"github.com/Theodoree/music_player/internal/music"
 )
 
 type PlayMode int
@@ -14,67 +16,171 @@ const (
 	PlayModeRandom
 )
 
+// ListKind 播放列表的种类
+type ListKind int
+
+const (
+	// ListLocal 本地表格中的音乐
+	ListLocal ListKind = iota
+	// ListStream 流媒体搜索结果
+	ListStream
+)
+
+// list 播放列表, 只在命令循环中读写, 内容变化时发布 QueueChanged
 type list struct {
+	kind    ListKind
 	tableId uint
-	bindingTable[music.Music]
-	tmp       []music.Music
-	searchKey BindingModel[string]
+	items   []music.Music
+	// index 正在播放的下标, 列表刷新后为 -1
+	index  int
+	tmp    []music.Music
+	events *eventHub
+	// pending 预先选好的下一首, 只在当前索引仍为 from 时有效
+	pending struct {
+		from, to int
+		ok       bool
+	}
+	// keyword 和 onlyBroken 是当前的过滤条件, 表格刷新后保留
+	keyword    string
+	onlyBroken bool
+	// failures 流媒体音乐播放失败的次数, 本地音乐记录在数据库中
+	failures map[music.Music]int
 }
 
 func (t *list) setItems(items []music.Music, tableId uint, cache bool) {
 	if cache {
 		t.tmp = make([]music.Music, len(items))
 		copy(t.tmp, items)
+		items = t.filter()
+	}
+	if t.kind == ListStream {
+		// 新的搜索结果是新的音乐
+		t.failures = nil
 	}
 	t.tableId = tableId
-	t.items.SetItems(items)
-	_ = t.bindingTable.index.Set(-1)
+	t.items = items
+	t.pending.ok = false
+	t.index = -1
+	t.changed()
+}
+
+// changed 发布列表的当前内容
+func (t *list) changed() {
+	t.events.publish(QueueChanged{Kind: t.kind, TableID: t.tableId, Items: slices.Clone(t.items)})
+}
+
+// broken 音乐最近是否播放失败
+func (t *list) broken(item music.Music) bool {
+	if t.kind == ListStream {
+		// 流媒体的 GetMusic 会下载文件
+		return t.failures[item] > 0
+	}
+	cur, _ := item.GetMusic()
+	return cur.FailCount > 0
+}
+
+// step 从 index 按 delta 循环移动, 跳过播放失败的音乐; 全部失败时不跳过
+func (t *list) step(index, delta int) int {
+	n := len(t.items)
+	for i := 1; i <= n; i++ {
+		next := ((index+delta*i)%n + n) % n
+		if !t.broken(t.items[next]) {
+			return next
+		}
+	}
+	return ((index+delta)%n + n) % n
+}
+
+// random 随机选择一首没有播放失败的音乐; 全部失败时不跳过
+func (t *list) random() int {
+	var playable []int
+	for i, item := range t.items {
+		if !t.broken(item) {
+			playable = append(playable, i)
+		}
+	}
+	if len(playable) == 0 {
+		return rand.IntN(len(t.items))
+	}
+	return playable[rand.IntN(len(playable))]
 }
 func (t *list) prev(mode PlayMode) music.Music {
-	index := t.index.get()
+	t.pending.ok = false
+	index := t.index
 	switch mode {
 	case PlayModeSingleCycle:
+		index = max(index, 0)
 	case PlayModeCycle:
-		index -= 1
-		if index == -1 {
-			index = t.items.Length() - 1
+		// 列表刷新后索引为 -1, 从最后一首开始
+		if index < 0 {
+			index = 0
 		}
+		index = t.step(index, -1)
 	case PlayModeRandom:
-		index = rand.IntN(t.items.Length())
+		index = t.random()
 	}
-	_ = t.index.Set(index)
-	return t.items.items[index]
+	t.index = index
+	return t.items[index]
 }
 func (t *list) next(mode PlayMode) music.Music {
-	index := t.index.get()
+	index := t.nextIndex(mode)
+	t.pending.ok = false
+	t.index = index
+	return t.items[index]
+}
+
+// peek 返回下一首但不移动索引, 随后的 next 会返回同一首
+func (t *list) peek(mode PlayMode) music.Music {
+	index := t.nextIndex(mode)
+	t.pending.from, t.pending.to, t.pending.ok = t.index, index, true
+	return t.items[index]
+}
+func (t *list) nextIndex(mode PlayMode) int {
+	index := t.index
+	if t.pending.ok && t.pending.from == index && t.pending.to < len(t.items) {
+		return t.pending.to
+	}
 	switch mode {
 	case PlayModeSingleCycle:
+		index = max(index, 0)
 	case PlayModeCycle:
-		index += 1
-		index %= t.items.Length()
+		index = t.step(index, 1)
 	case PlayModeRandom:
-		index = rand.IntN(t.items.Length())
+		index = t.random()
 	}
-	_ = t.index.Set(index)
-	return t.items.items[index]
+	return index
 }
 func (t *list) valid() bool {
-	return t.items.Length() > 0
+	return len(t.items) > 0
 }
 
+// Search 按歌名、歌手或专辑过滤, 为空时取消
 func (t *list) Search(keyword string) {
-	switch {
-	case len(keyword) == 0:
-		t.setItems(t.tmp, t.tableId, false)
-	case len(keyword) > 0:
-		var tmp []music.Music
-		for i := 0; i < len(t.tmp); i++ {
-			m := t.tmp[i]
-			if !(strings.Index(m.SingerName(), keyword) >= 0 || strings.Index(m.MusicName(), keyword) >= 0 || strings.Index(m.Album(), keyword) >= 0) {
-				continue
-			}
-			tmp = append(tmp, m)
+	t.keyword = keyword
+	t.setItems(t.filter(), t.tableId, false)
+}
+
+// FilterBroken 只显示播放失败的音乐
+func (t *list) FilterBroken(on bool) {
+	t.onlyBroken = on
+	t.setItems(t.filter(), t.tableId, false)
+}
+
+// filter 按当前的过滤条件筛选整个表格
+func (t *list) filter() []music.Music {
+	if len(t.keyword) == 0 && !t.onlyBroken {
+		return t.tmp
+	}
+	var tmp []music.Music
+	for i := 0; i < len(t.tmp); i++ {
+		m := t.tmp[i]
+		if t.onlyBroken && !t.broken(m) {
+			continue
+		}
+		if len(t.keyword) > 0 && !(strings.Index(m.SingerName(), t.keyword) >= 0 || strings.Index(m.MusicName(), t.keyword) >= 0 || strings.Index(m.Album(), t.keyword) >= 0) {
+			continue
 		}
-		t.setItems(tmp, t.tableId, false)
+		tmp = append(tmp, m)
 	}
+	return tmp
 }
@@ -0,0 +1,60 @@
+package mp
+
+import (
+	"time"
+	
+	"k8s.io/klog"
+)
+
+// abLoop A-B 循环的标记, -1 表示未标记
+type abLoop struct {
+	a, b time.Duration
+}
+
+func (m *musicPlayer) seek(percent float64) {
+	if m.curMusic == nil {
+		return
+	}
+	m.curMusic.Seek(percent)
+}
+func (m *musicPlayer) seekTime(t time.Duration) {
+	if m.curMusic == nil {
+		return
+	}
+	m.curMusic.SeekTime(t)
+}
+
+// toggleABLoop 依次标记A点、标记B点并开始循环、取消循环
+func (m *musicPlayer) toggleABLoop() {
+	loop := &m.musicPlayerData.abLoop
+	if m.curMusic == nil || m.musicPlayerData.progress.end == 0 {
+		return
+	}
+	cur, err := m.curMusic.CurTime()
+	if err != nil {
+		klog.Error(err)
+		return
+	}
+	switch {
+	case loop.a < 0:
+		loop.a = cur
+	case loop.b < 0:
+		if cur <= loop.a {
+			m.alert("B点需要在A点之后")
+			return
+		}
+		m.curMusic.SetLoop(loop.a, cur)
+		loop.b = cur
+	default:
+		m.curMusic.SetLoop(0, 0)
+		m.clearABLoop()
+		return
+	}
+	m.events.publish(ABLoopChanged{A: loop.a, B: loop.b})
+}
+
+// clearABLoop 清除标记, 切歌时循环随解码器一起失效
+func (m *musicPlayer) clearABLoop() {
+	m.musicPlayerData.abLoop = abLoop{a: -1, b: -1}
+	m.events.publish(ABLoopChanged{A: -1, B: -1})
+}
@@ -2,16 +2,15 @@ package mp
 
 import (
 	"context"
-	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 	
-	"fyne.io/fyne/v2/data/binding"
 	"github.com/Theodoree/music_player/internal/db"
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/waveform"
 	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/music"
 	"github.com/Theodoree/music_player/internal/music/local"
@@ -23,21 +22,31 @@ import (
 
 var _ MusicPlayer = (*musicPlayer)(nil)
 
+// musicPlayerData 只在命令循环中读写, 变化都作为事件发布
 type musicPlayerData struct {
-	tableList        bindingTable[model.MusicTable]
-	picList          bindingTable[model.Picture]
-	volume           BindingModel[float64]
-	singerName       BindingModel[string]
-	musicName        BindingModel[string]
-	PlayStatus       BindingModel[bool]
-	streamMusicTable bindingTable[*BindingModel[string]]
-	processBar       processBar
-	mode             BindingModel[PlayMode]
+	tables        []model.MusicTable
+	streamSources []string
+	progress      progress
+	presets       []model.EQPreset
+	abLoop        abLoop
+	waveform      waveform.Peaks
 }
 
-type bindingTable[T binding.DataItem] struct {
-	items BindingDataList[T]
-	index BindingModel[int]
+// Status 播放器状态的快照
+type Status struct {
+	State State
+	// Music 当前音乐, 没有播放时为零值
+	Music    model.Music
+	Position time.Duration
+	Duration time.Duration
+	// Buffering 网络音乐正在缓冲
+	Buffering bool
+	// Lyrics 去掉时间标签后的全部歌词
+	Lyrics string
+	// LoopA, LoopB A-B 循环的标记, -1 表示未标记
+	LoopA, LoopB time.Duration
+	// Waveform 当前音乐的峰值波形, 后台提取完成前为空
+	Waveform waveform.Peaks
 }
 
 type musicPlayer struct {
@@ -45,7 +54,7 @@ type musicPlayer struct {
 	cancel        context.CancelFunc
 	store         db.MusicStore
 	alert         func(str string)
-	cb            music.Callback
+	commands      commands
 	localSource   music.Source
 	neteaseSource music.Source
 	
@@ -55,92 +64,151 @@ type musicPlayer struct {
 	list            list
 	neteaseList     list
 	curMusic        music.Music
+	// preloaded 已经预加载、将在当前音乐结束后无缝播放的下一首
+	preloaded music.Music
+	analyzer  trackAnalyzer
+	waveforms waveformLoader
+	// state 播放状态, 每次转换都会发布到 events
+	state  stateMachine
+	events eventHub
 }
 
 type settings struct {
+	// BasePath 数据库和下载目录所在的目录
+	BasePath string
+	// Output 音频输出后端, 为空时使用默认的声卡输出
+	Output   decode.Output
 	SavePath string
+	Settings
 }
 
-func NewMusicPlayer(ctx context.Context, alert func(str string)) (MusicPlayer, error) {
+// Option 创建播放器时的可选设置
+type Option func(s *settings)
+
+// WithBasePath 设置数据库和下载目录所在的目录
+func WithBasePath(path string) Option {
+	return func(s *settings) {
+		s.BasePath = path
+	}
+}
+
+// WithOutput 设置音频输出后端, 为 nil 时使用默认输出; 界面按设置通过 decode.OpenOutput 创建, 测试时使用 decode.NullOutput 或 decode.WAVOutput
+func WithOutput(out decode.Output) Option {
+	return func(s *settings) {
+		s.Output = out
+	}
+}
+
+func NewMusicPlayer(ctx context.Context, alert func(str string), opts ...Option) (MusicPlayer, error) {
 	var s musicPlayer
+	s.settings.BasePath = "/Users/ted/workspace/go/music_player"
+	for _, opt := range opts {
+		opt(&s.settings)
+	}
+	if s.settings.Output != nil {
+		if err := decode.SetOutput(s.settings.Output); err != nil {
+			return nil, err
+		}
+	}
 	s.ctx, s.cancel = context.WithCancel(ctx)
-	s.store = db.New(db.SqliteFactory("/Users/ted/workspace/go/music_player"), db.MemoryCacheFactory())
-	if err := s.InitSettings("/Users/ted/workspace/go/music_player"); err != nil {
+	s.store = db.New(db.SqliteFactory(s.settings.BasePath), db.MemoryCacheFactory())
+	if err := s.InitSettings(s.settings.BasePath); err != nil {
 		return nil, err
 	}
 	s.alert = alert
-	s.cb = music.Callback{
-		CurTime: func(duration time.Duration) {
-			s.musicPlayerData.processBar.UpdateTS(duration)
-		},
-		DoneFn: func(status model.Status) {
-			if status == model.StatusPlayDone {
-				s.Next()
-			}
-		},
-	}
+	s.state.events = &s.events
+	s.commands = newCommands()
 	s.localSource = local.Source(s.ctx, s.store)
 	s.neteaseSource = netease.Source(s.ctx, s.settings.SavePath)
+	s.list = list{kind: ListLocal, events: &s.events}
+	s.neteaseList = list{kind: ListStream, events: &s.events}
 	s.selectList = &s.list
-	if err := s.init(); err != nil {
+	s.analyzer = newTrackAnalyzer()
+	s.waveforms = newWaveformLoader(filepath.Join(s.settings.BasePath, "waveform"))
+	go s.run()
+	var err error
+	s.do(func() {
+		err = s.init()
+	})
+	if err != nil {
+		s.cancel()
 		return nil, err
 	}
+	go s.analyzeTracks()
+	go s.loadWaveforms()
+	s.analyzer.request()
 	return &s, nil
 }
 
-// 绑定数据
+// callback 为 item 创建解码器回调, 回调在命令循环中执行; 已经切走的音乐迟到的回调被忽略,
+// 例如连续点击下一首时上一首的播放结束回调
+func (m *musicPlayer) callback(item music.Music) *music.Callback {
+	return &music.Callback{
+		CurTime: func(duration time.Duration) {
+			m.post(func() {
+				if m.curMusic != item {
+					return
+				}
+				m.musicPlayerData.progress.cur = duration
+				m.events.publish(PositionChanged{Position: duration, Duration: m.musicPlayerData.progress.end})
+				m.prepareNext(duration)
+			})
+		},
+		DoneFn: func(status model.Status, err error) {
+			m.post(func() {
+				if m.curMusic != item {
+					return
+				}
+				switch status {
+				case model.StatusPlayDone:
+					m.setState(StateEnded)
+					m.advance(false)
+				case model.StatusPlayFailed:
+					m.skipFailed(item, err)
+				}
+			})
+		},
+		Buffering: func(b bool) {
+			m.post(func() {
+				if m.curMusic != item {
+					return
+				}
+				m.musicPlayerData.progress.buffering = b
+				// 暂停期间的缓冲变化不影响状态, 恢复播放时再根据缓冲状态决定
+				if b {
+					m.setState(StateBuffering, StateLoading, StatePlaying)
+				} else {
+					m.setState(StatePlaying, StateBuffering)
+				}
+			})
+		},
+	}
+}
+
+// init 载入表格和均衡器预设并应用默认设置, 在命令循环中执行
 func (m *musicPlayer) init() error {
 	if err := m.refreshTable(); err != nil {
 		return err
 	}
-	_ = m.musicPlayerData.volume.Set(10)
-	
-	// 本地列表
-	m.musicPlayerData.tableList.index.AddListener(&DataListener{func() {
-		idx := m.musicPlayerData.tableList.index.get()
-		item, _ := m.musicPlayerData.tableList.items.GetItem(idx)
-		id := item.(model.MusicTable).ID
-		musics, _ := m.localSource.List(id)
-		m.list.setItems(musics, id, true)
-		m.selectList = &m.list
-	}})
-	_ = m.musicPlayerData.tableList.index.Set(0)
-	
-	// 流媒体表格
-	m.musicPlayerData.streamMusicTable.items.AddItem(&BindingModel[string]{val: "网易云"})
-	m.list.searchKey.AddListener(&DataListener{Fn: func() {
-		m.list.Search(m.list.searchKey.get())
-	}})
-	
-	// 流媒体列表搜索
-	m.neteaseList.searchKey.AddListener(&DataListener{func() {
-		index := m.musicPlayerData.streamMusicTable.index.get()
-		searchKey := m.neteaseList.searchKey.get()
-		switch index {
-		case 0:
-			musics, _ := m.neteaseSource.SearchMusic(0, searchKey)
-			m.neteaseList.setItems(musics, 0, false)
-			m.selectList = &m.neteaseList
-		}
-		
-	}})
-	
-	// 播放条拖动
-	m.musicPlayerData.processBar.cur.AddListener(&DataListener{func() {
-		cur := m.musicPlayerData.processBar.cur.get()
-		if cur == m.musicPlayerData.processBar.lastSet || m.curMusic == nil {
-			return
-		}
-		m.curMusic.Seek(cur)
-	}})
+	if err := m.refreshEQPresets(); err != nil {
+		return err
+	}
+	m.settings.Volume, m.settings.Speed = 10, 1
+	if len(m.musicPlayerData.presets) > 0 {
+		// 开关保持关闭, 只载入第一个预设的增益
+		p := m.musicPlayerData.presets[0]
+		m.settings.Equalizer.Preamp = p.Preamp
+		copy(m.settings.Equalizer.Gains[:], p.GetGains())
+	}
+	m.applySettings()
+	m.clearABLoop()
+	m.musicPlayerData.streamSources = []string{"网易云"}
+	if len(m.musicPlayerData.tables) > 0 {
+		m.selectTable(m.musicPlayerData.tables[0].ID)
+	}
 	
-	// 音量条拖动
-	m.musicPlayerData.volume.AddListener(&DataListener{func() {
-		volume, _ := m.musicPlayerData.volume.Get()
-		if m.curMusic != nil {
-			m.curMusic.SetVolume(volume / 100)
-		}
-	}})
+	// 频谱
+	m.initSpectrum()
 	
 	return nil
 }
@@ -155,79 +223,135 @@ func (m *musicPlayer) InitSettings(basePath string) error {
 			return err
 		}
 	}
+	m.settings.BasePath = basePath
 	m.settings.SavePath = filepath.Join(basePath, "save")
 	_ = os.MkdirAll(m.settings.SavePath, 0766)
 	return nil
 }
 
-// Play Implementation MusicPlayerFrontend
-func (m *musicPlayer) Play() {
+func (m *musicPlayer) play() {
 	if !m.selectList.valid() {
 		m.alert("No music")
 		return
 	}
 	if m.curMusic == nil {
-		m.curMusic = m.selectList.next(m.musicPlayerData.mode.get())
+		m.curMusic = m.selectList.next(m.settings.Mode)
+	}
+	if m.state.load() == StatePaused {
+		m.resume()
+		return
+	}
+	m.playOrSkip(m.curMusic, m.skipNext)
+}
+
+// resume 从暂停恢复, 不重新打开音乐
+func (m *musicPlayer) resume() {
+	if err := m.curMusic.Play(m.callback(m.curMusic), m.settings.Volume/1e2); err != nil {
+		m.fail(m.curMusic, err)
+		m.setState(StateError)
+		return
+	}
+	if m.musicPlayerData.progress.buffering {
+		m.setState(StateBuffering)
+	} else {
+		m.setState(StatePlaying)
 	}
-	m._play(m.curMusic)
 }
-func (m *musicPlayer) Pause() {
+func (m *musicPlayer) pause() {
 	if !m.selectList.valid() || m.curMusic == nil {
 		m.alert("No music")
 		return
 	}
 	err := m.curMusic.Pause()
 	if err != nil {
-		klog.Error(err)
-		m.alert(err.Error())
+		m.fail(m.curMusic, err)
 		return
 	}
-	_ = m.musicPlayerData.PlayStatus.Set(false)
+	m.setState(StatePaused)
 }
-func (m *musicPlayer) Stop() {
+func (m *musicPlayer) stop() {
 	if !m.selectList.valid() || m.curMusic == nil {
 		m.alert("No music")
 		return
 	}
+	m.discardPreloaded(nil)
 	err := m.curMusic.Stop()
 	if err != nil {
-		klog.Error(err)
-		m.alert(err.Error())
+		m.fail(m.curMusic, err)
 		return
 	}
 	m.curMusic = nil
 	m.resetMusicPlayerData()
-	_ = m.musicPlayerData.PlayStatus.Set(false)
-	return
-	
+	m.setState(StateIdle)
 }
 
+// resetMusicPlayerData 清空当前音乐的数据, 发布空的 TrackChanged
 func (m *musicPlayer) resetMusicPlayerData() {
-	m.musicPlayerData.processBar.UpdateTS(0)
-	m.musicPlayerData.processBar.UpdateEnd(0)
-	_ = m.musicPlayerData.singerName.Set("")
-	_ = m.musicPlayerData.musicName.Set("")
+	m.musicPlayerData.progress = progress{}
+	m.events.publish(TrackChanged{})
+	m.events.publish(PositionChanged{})
+	m.setWaveform(waveform.Peaks{})
+	m.clearABLoop()
+}
+
+// stopCurrent 停止当前音乐, 准备播放另一首
+func (m *musicPlayer) stopCurrent() {
+	m.discardPreloaded(nil)
+	if m.curMusic == nil {
+		return
+	}
+	if err := m.curMusic.Stop(); err != nil {
+		klog.Error(err)
+	}
+	m.curMusic = nil
+	m.resetMusicPlayerData()
 }
-func (m *musicPlayer) Prev() {
+func (m *musicPlayer) prev() {
 	if !m.selectList.valid() {
 		m.alert("No music")
 		return
 	}
-	if m.curMusic != nil {
-		err := m.curMusic.Stop()
-		if err != nil {
-			klog.Error(err)
-		}
-		m.curMusic = nil
-		m.resetMusicPlayerData()
-	}
-	m._play(m.selectList.prev(m.musicPlayerData.mode.get()))
+	m.stopCurrent()
+	m.playOrSkip(m.selectList.prev(m.settings.Mode), m.skipPrev)
 }
-func (m *musicPlayer) Next() {
+func (m *musicPlayer) next() {
 	if !m.selectList.valid() {
 		m.alert("No music")
 		return
 	}
+	m.selectList.pending.ok = false
+	m.stopCurrent()
+	m.playOrSkip(m.selectList.next(m.settings.Mode), m.skipNext)
+}
+
+// playAt 切换到 kind 列表并播放其中的第 index 首
+func (m *musicPlayer) playAt(kind ListKind, index int) {
+	l := m.listOf(kind)
+	if index < 0 || index >= len(l.items) {
+		m.alert("No music")
+		return
+	}
+	m.selectList = l
+	m.stopCurrent()
+	l.pending.ok = false
+	l.index = index
+	m.playOrSkip(l.items[index], m.skipNext)
+}
+
+func (m *musicPlayer) listOf(kind ListKind) *list {
+	if kind == ListStream {
+		return &m.neteaseList
+	}
+	return &m.list
+}
+
+// advance 当前音乐播放完毕, 切换到下一首; 如果下一首已经预加载, 它已在边界处开始播放, 这里只切换绑定数据。
+// failed 表示当前音乐播放中途出错, 单曲循环时也切到下一首
+func (m *musicPlayer) advance(failed bool) {
+	if !m.selectList.valid() {
+		m.discardPreloaded(nil)
+		return
+	}
 	if m.curMusic != nil {
 		err := m.curMusic.Stop()
 		if err != nil {
@@ -236,76 +360,97 @@ func (m *musicPlayer) Next() {
 		m.curMusic = nil
 		m.resetMusicPlayerData()
 	}
-	m._play(m.selectList.next(m.musicPlayerData.mode.get()))
+	mode := m.settings.Mode
+	if failed {
+		mode = skipMode(mode)
+	}
+	next := m.selectList.next(mode)
+	m.discardPreloaded(next)
+	m.playOrSkip(next, m.skipNext)
 }
-func (m *musicPlayer) _play(music music.Music) bool {
-	volume, _ := m.musicPlayerData.volume.Get()
-	
-	if err := music.Play(&m.cb, volume/1e2); err != nil {
+
+// prepareAhead 在交叉淡化开始前多久预加载下一首
+const prepareAhead = time.Second * 5
+
+// prepareNext 在当前音乐即将结束时预加载下一首
+func (m *musicPlayer) prepareNext(ts time.Duration) {
+	end := m.musicPlayerData.progress.end
+	// 进度是媒体时间, 按播放速度换算为实际剩余时长
+	remain := time.Duration(float64(end-ts) / m.settings.Speed)
+	if m.preloaded != nil || m.curMusic == nil || end == 0 || remain > prepareAhead+m.settings.Crossfade || !m.selectList.valid() {
+		return
+	}
+	next := m.selectList.peek(m.settings.Mode)
+	if next == m.curMusic {
+		// 单曲循环, 同一个解码器无法拼接在自己之后
+		return
+	}
+	m.preloaded = next
+	m.syncAnalysis(next)
+	if err := next.Prepare(m.callback(next), m.settings.Volume/1e2); err != nil {
 		klog.Error(err)
-		m.alert(err.Error())
-		return false
 	}
+}
+
+// discardPreloaded 释放预加载但不会播放的音乐
+func (m *musicPlayer) discardPreloaded(keep music.Music) {
+	if m.preloaded == nil {
+		return
+	}
+	if m.preloaded != keep {
+		_ = m.preloaded.Stop()
+	}
+	m.preloaded = nil
+}
+
+// open 打开并播放 music, 成功后设为当前音乐
+func (m *musicPlayer) open(music music.Music) error {
+	m.syncAnalysis(music)
+	m.musicPlayerData.progress.buffering = false
+	m.setState(StateLoading)
+	if err := music.Play(m.callback(music), m.settings.Volume/1e2); err != nil {
+		m.recordFailure(music, err)
+		return err
+	}
+	m.clearFailure(music)
 	
 	end, _ := music.EndTime()
-	m.musicPlayerData.processBar.UpdateEnd(end)
-	_ = m.musicPlayerData.musicName.Set(music.MusicName())
-	_ = m.musicPlayerData.singerName.Set(music.SingerName())
+	m.musicPlayerData.progress.end = end
+	m.musicPlayerData.progress.setLyrics(music.Lyrics())
 	m.curMusic = music
-	_ = m.musicPlayerData.PlayStatus.Set(true)
-	m.musicPlayerData.processBar.UpdateLyrics(music.Lyrics())
-	return true
+	m.publishTrack()
+	// 打开时已经进入缓冲的保持 StateBuffering
+	m.setState(StatePlaying, StateLoading)
+	m.requestWaveform(music)
+	return nil
 }
 
-// Lyrics Implementation MusicPlayerFrontendData
-func (m *musicPlayer) Lyrics() binding.String {
-	return &m.musicPlayerData.processBar.lyrics
-}
-func (m *musicPlayer) Lyric() binding.String {
-	return &m.musicPlayerData.processBar.lyric
-}
-func (m *musicPlayer) MusicName() binding.String {
-	return &m.musicPlayerData.musicName
+// publishTrack 发布当前音乐的信息
+func (m *musicPlayer) publishTrack() {
+	p := &m.musicPlayerData.progress
+	m.events.publish(TrackChanged{Music: trackInfo(m.curMusic), Duration: p.end, Lyrics: p.lyrics})
 }
-func (m *musicPlayer) SingerName() binding.String {
-	return &m.musicPlayerData.singerName
-}
-func (m *musicPlayer) Volume() binding.Float {
-	return &m.musicPlayerData.volume
-}
-func (m *musicPlayer) ProcessBar() binding.Float {
-	return &m.musicPlayerData.processBar.cur
-}
-func (m *musicPlayer) MusicCurTime() binding.String {
-	return &m.musicPlayerData.processBar.curStr
-}
-func (m *musicPlayer) MusicEndTime() binding.String {
-	return &m.musicPlayerData.processBar.end
-}
-func (m *musicPlayer) MusicTableList() (binding.DataList, binding.Int) {
-	return &m.musicPlayerData.tableList.items, &m.musicPlayerData.tableList.index
-}
-func (m *musicPlayer) MusicList() (binding.DataList, binding.Int, binding.String) {
-	return &m.list.items, &m.list.index, &m.list.searchKey
-}
-func (m *musicPlayer) PictureList() binding.DataList {
-	return &m.musicPlayerData.picList.items
-}
-func (m *musicPlayer) PlayMode() binding.DataItem {
-	return &m.musicPlayerData.mode
-}
-func (m *musicPlayer) PlayStatus() binding.Bool {
-	return &m.musicPlayerData.PlayStatus
+
+// trackInfo 用于显示的音乐信息。边下载边播放的网络音乐在下载完成前 GetMusic 返回错误,
+// 这时名称、歌手和专辑取自音乐本身
+func trackInfo(music music.Music) model.Music {
+	cur, err := music.GetMusic()
+	if err != nil {
+		cur = model.Music{Name: music.MusicName(), Singer: music.SingerName(), Album: music.Album()}
+		cur.Length, _ = music.EndTime()
+	}
+	return cur
 }
-func (m *musicPlayer) StreamMusicList() (binding.DataList, binding.Int, binding.String) {
-	return &m.neteaseList.items, &m.neteaseList.index, &m.neteaseList.searchKey
+
+// State Implementation MusicPlayerEventModule
+func (m *musicPlayer) State() State {
+	return m.state.load()
 }
-func (m *musicPlayer) StreamMusicTableList() (binding.DataList, binding.Int) {
-	return &m.musicPlayerData.streamMusicTable.items, &m.musicPlayerData.streamMusicTable.index
+func (m *musicPlayer) Subscribe() (<-chan Event, func()) {
+	return m.events.subscribe()
 }
 
-// AddTable Implementation MusicPlayerBackend
-func (m *musicPlayer) AddTable(table model.MusicTable) {
+func (m *musicPlayer) addTable(table model.MusicTable) {
 	if err := m.store.SaveMusicTable(table); err != nil {
 		m.alert(err.Error())
 		return
@@ -313,9 +458,9 @@ func (m *musicPlayer) AddTable(table model.MusicTable) {
 	if err := m.refreshTable(); err != nil {
 		m.alert(err.Error())
 	}
-	
+
 }
-func (m *musicPlayer) DelTable(tableID uint) {
+func (m *musicPlayer) delTable(tableID uint) {
 	if err := m.store.DeleteMusicTable(model.MusicTable{
 		Model: gorm.Model{
 			ID: tableID,
@@ -332,13 +477,14 @@ func (m *musicPlayer) DelTable(tableID uint) {
 		m.alert(err.Error())
 	}
 }
-func (m *musicPlayer) ImportMusic(tableID uint, path string) {
-	if _, err := m.store.GetMusicTableByID(tableID); err != nil {
+func (m *musicPlayer) importMusic(tableID uint, path string) {
+	table, err := m.store.GetMusicTableByID(tableID)
+	if err != nil {
 		m.alert(err.Error())
 		return
 	}
 	
-	items := tool.SearchMusicFileByPath(path)
+	items := tool.SearchMusicFileByPath(path, table.Charset)
 	for idx := range items {
 		items[idx].MusicTableID = tableID
 	}
@@ -347,11 +493,12 @@ func (m *musicPlayer) ImportMusic(tableID uint, path string) {
 		m.alert(err.Error())
 		return
 	}
+	m.analyzer.request()
 }
 func (m *musicPlayer) AddWallpaper(path string) {
 	_ = path
 }
-func (m *musicPlayer) AddMusic(tableID uint, music model.Music) {
+func (m *musicPlayer) addMusic(tableID uint, music model.Music) {
 	music.MusicTableID = tableID
 	music.ID = 0
 	if err := m.store.SaveMusic(music); err != nil {
@@ -362,15 +509,20 @@ func (m *musicPlayer) AddMusic(tableID uint, music model.Music) {
 		m.alert(err.Error())
 		return
 	}
+	m.analyzer.request()
 	if err := m.refreshMusic(tableID); err != nil {
 		m.alert(err.Error())
 	}
 }
-func (m *musicPlayer) UpdateMusic(tableID uint, music model.Music) {
+func (m *musicPlayer) updateMusic(tableID uint, music model.Music) {
 	music.MusicTableID = tableID
 	if err := m.store.UpdateMusic(music); err != nil {
 		m.alert(err.Error())
 	}
+	// 裁剪范围改回自动检测时重新检测
+	if music.TrimSource == model.TrimSourceNone {
+		m.analyzer.request()
+	}
 	if m.list.tableId != tableID {
 		return
 	}
@@ -386,13 +538,14 @@ func (m *musicPlayer) UpdateMusic(tableID uint, music model.Music) {
 		return
 	}
 	m.curMusic.Update(music)
-	_ = m.musicPlayerData.musicName.Set(m.curMusic.MusicName())
-	_ = m.musicPlayerData.singerName.Set(m.curMusic.SingerName())
-	m.musicPlayerData.processBar.UpdateLyrics(m.curMusic.Lyrics())
-	
-}
-func (m *musicPlayer) GetPlayedMusic() music.Music {
-	return m.curMusic
+	m.musicPlayerData.progress.setLyrics(m.curMusic.Lyrics())
+	// 裁剪范围变化后进度和波形都相对于新的范围
+	if curMusic.StartOffset != music.StartOffset || curMusic.EndOffset != music.EndOffset {
+		m.clearABLoop()
+		m.musicPlayerData.progress.end, _ = m.curMusic.EndTime()
+		m.requestWaveform(m.curMusic)
+	}
+	m.publishTrack()
 }
 
 // private
@@ -401,8 +554,8 @@ func (m *musicPlayer) refreshTable() error {
 	if err != nil {
 		return err
 	}
-	// 本地列表
-	m.musicPlayerData.tableList.items.SetItems(tables)
+	m.musicPlayerData.tables = tables
+	m.events.publish(TablesChanged{Tables: slices.Clone(tables)})
 	return nil
 }
 
@@ -410,115 +563,70 @@ func (m *musicPlayer) refreshMusic(tableID uint) error {
 	if m.list.tableId != tableID {
 		return nil
 	}
-	for idx, v := range m.musicPlayerData.tableList.items.items {
-		if v.ID != tableID {
-			continue
-		}
-		_ = m.musicPlayerData.tableList.index.Set(idx)
-	}
-	return nil
-}
-
-type BindingModel[T any] struct {
-	val           T
-	DataListeners []binding.DataListener
+	return m.loadTable(tableID)
 }
 
-func (b *BindingModel[T]) Get() (T, error) {
-	return b.get(), nil
-}
-func (b *BindingModel[T]) get() T {
-	return b.val
-}
-func (b *BindingModel[T]) Set(t T) error {
-	b.val = t
-	b.Signal()
+// loadTable 把表格中的音乐载入本地列表
+func (m *musicPlayer) loadTable(tableID uint) error {
+	musics, err := m.localSource.List(tableID)
+	if err != nil {
+		return err
+	}
+	m.list.setItems(musics, tableID, true)
 	return nil
 }
-func (b *BindingModel[T]) AddListener(listener binding.DataListener) {
-	b.DataListeners = append(b.DataListeners, listener)
-}
-func (b *BindingModel[T]) RemoveListener(ls binding.DataListener) {
-	b.DataListeners = slices.DeleteFunc(b.DataListeners, func(listener binding.DataListener) bool {
-		return listener == ls
-	})
-}
-func (b *BindingModel[T]) Signal() {
-	for _, listener := range b.DataListeners {
-		listener.DataChanged()
+func (m *musicPlayer) selectTable(tableID uint) {
+	if err := m.loadTable(tableID); err != nil {
+		m.alert(err.Error())
+		return
 	}
+	m.selectList = &m.list
 }
-
-type BindingDataList[T binding.DataItem] struct {
-	items         []T
-	DataListeners []binding.DataListener
+func (m *musicPlayer) searchStream(source int, keyword string) {
+	switch source {
+	case 0:
+		musics, err := m.neteaseSource.SearchMusic(0, keyword)
+		if err != nil {
+			klog.Error(err)
+		}
+		m.neteaseList.setItems(musics, 0, false)
+		m.selectList = &m.neteaseList
+	}
 }
 
-func (b *BindingDataList[T]) SetItems(items []T) {
-	b.items = items
-	b.Signal()
-}
-func (b *BindingDataList[T]) AddListener(listener binding.DataListener) {
-	b.DataListeners = append(b.DataListeners, listener)
-}
-func (b *BindingDataList[T]) RemoveListener(ls binding.DataListener) {
-	b.DataListeners = slices.DeleteFunc(b.DataListeners, func(listener binding.DataListener) bool {
-		return listener == ls
-	})
-}
-func (b *BindingDataList[T]) AddItem(item T) {
-	b.items = append(b.items, item)
-	b.Signal()
-}
-func (b *BindingDataList[T]) GetItem(index int) (binding.DataItem, error) {
-	return b.items[index], nil
-}
-func (b *BindingDataList[T]) Length() int {
-	return len(b.items)
-}
-func (b *BindingDataList[T]) Signal() {
-	for _, listener := range b.DataListeners {
-		listener.DataChanged()
+// status 在命令循环中复制当前状态
+func (m *musicPlayer) status() Status {
+	p := &m.musicPlayerData.progress
+	s := Status{
+		State:     m.state.load(),
+		Position:  p.cur,
+		Duration:  p.end,
+		Buffering: p.buffering,
+		Lyrics:    p.lyrics,
+		LoopA:     m.musicPlayerData.abLoop.a,
+		LoopB:     m.musicPlayerData.abLoop.b,
+		Waveform:  m.musicPlayerData.waveform,
 	}
+	if m.curMusic != nil {
+		s.Music = trackInfo(m.curMusic)
+	}
+	return s
 }
 
-type processBar struct {
-	curStr  BindingModel[string]  // 00:00
-	cur     BindingModel[float64] // 百分比
-	end     BindingModel[string]  // 00:00
-	lyrics  BindingModel[string]
-	lyric   BindingModel[string]
-	lrcLine []LrcLine
-	lastSet float64
-	endTs   time.Duration
+// progress 当前音乐的进度和歌词
+type progress struct {
+	cur, end time.Duration
+	// buffering 网络音乐正在缓冲
+	buffering bool
+	lrcLine   []LrcLine
+	lyrics    string
 }
 
-func (p *processBar) UpdateEnd(ts time.Duration) {
-	p.endTs = ts
-	_ = p.end.Set(fmt.Sprintf("%02d:%02d", int(ts.Minutes()), int(ts.Seconds())%60))
-}
-func (p *processBar) UpdateTS(ts time.Duration) {
-	_ = p.curStr.Set(fmt.Sprintf("%02d:%02d", int(ts.Minutes()), int(ts.Seconds())%60))
-	if ts == 0 {
-		_ = p.cur.Set(0)
-		return
-	}
-	p.lastSet = math.Round(float64(ts) / float64(p.endTs) * 100)
-	_ = p.cur.Set(p.lastSet)
-}
-func (p *processBar) UpdateLyrics(str string) {
+func (p *progress) setLyrics(str string) {
 	p.lrcLine, _ = decodeLrc(str)
 	var lyrics string
 	for _, v := range p.lrcLine {
 		lyrics += v.Lyrics + "\n"
 	}
-	_ = p.lyrics.Set(lyrics)
-}
-
-type DataListener struct {
-	Fn func()
-}
-
-func (d *DataListener) DataChanged() {
-	d.Fn()
+	p.lyrics = lyrics
 }
@@ -1,11 +1,416 @@
 package mp
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/db"
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/encode"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+	"github.com/dhowden/tag"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/wav"
 )
 
 func TestParse(t *testing.T) {
 	buf, _ := os.ReadFile("/Users/ted/workspace/go/music_player/save/周杰伦 温岚-屋顶-5257138.lrc")
 	_, _ = decodeLrc(string(buf))
 }
+
+// writeSine 写入 d 时长的正弦波 WAV 文件
+func writeSine(t *testing.T, path string, freq float64, d time.Duration) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var i int
+	s := beep.Take(format.SampleRate.N(d), beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for j := range samples {
+			v := 0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(format.SampleRate))
+			samples[j] = [2]float64{v, v}
+			i++
+		}
+		return len(samples), true
+	}))
+	if err := wav.Encode(f, s, format); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// flush 等待已经投递的解码器回调在命令循环中执行完
+func flush(p MusicPlayer) {
+	p.(*musicPlayer).do(func() {})
+}
+
+// childEnv 子进程中正在运行的测试名
+const childEnv = "MP_TEST_CHILD"
+
+// runInChild 输出后端在进程内只能设置一次, 需要自己的输出的测试在单独的子进程中重新运行。
+// 在父进程中等待子进程结束并返回 true, 调用方直接返回; 在子进程中返回 false
+func runInChild(t *testing.T) bool {
+	t.Helper()
+	if os.Getenv(childEnv) == t.Name() {
+		return false
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.count=1")
+	cmd.Env = append(os.Environ(), childEnv+"="+t.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	return true
+}
+
+// TestPlayback 用 WAVOutput 在没有声卡的情况下确定性地播放两首音乐
+func TestPlayback(t *testing.T) {
+	if runInChild(t) {
+		return
+	}
+	
+	dir := t.TempDir()
+	names := []string{"first", "second"}
+	for i, name := range names {
+		writeSine(t, filepath.Join(dir, name+".wav"), 440*float64(i+1), time.Second*3)
+	}
+	out, err := decode.NewWAVOutput(filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewMusicPlayer(ctx, func(str string) { t.Log(str) }, WithBasePath(dir), WithOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		p.AddMusic(db.DefaultTableID, model.Music{Name: name, Path: filepath.Join(dir, name+".wav"), Type: model.MusicTypeWAV, Length: time.Second * 3})
+	}
+	p.SetVolume(100)
+	
+	// 收集状态变化和频谱, 频谱事件较多, 在另一个协程中读取避免丢弃
+	events, unsubscribe := p.Subscribe()
+	type result struct {
+		states []State
+		heard  bool
+	}
+	results := make(chan result, 1)
+	playing := make(chan struct{})
+	go func() {
+		var got result
+		for e := range events {
+			switch e := e.(type) {
+			case StateChanged:
+				got.states = append(got.states, e.To)
+				if e.To == StatePlaying && len(got.states) == 2 {
+					close(playing)
+				}
+			case SpectrumChanged:
+				got.heard = got.heard || !e.Frame.Silent()
+			}
+		}
+		results <- got
+	}()
+	
+	p.Play()
+	<-playing
+	if err := out.Advance(time.Second * 2); err != nil {
+		t.Fatal(err)
+	}
+	flush(p)
+	if status := p.Status(); status.Position != time.Second*2 || status.Music.Name != names[0] {
+		t.Fatalf("status = %v %s, want 2s %s", status.Position, status.Music.Name, names[0])
+	}
+	// 波形在后台提取并缓存到数据库旁
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond * 10) {
+		if p.Status().Waveform.Duration == time.Second*3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("waveform is not extracted")
+		}
+	}
+	// 后台分析增益和静音时同一遍解码也缓存了还没播放的音乐的波形
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond * 10) {
+		caches, _ := filepath.Glob(filepath.Join(dir, "waveform", "*.wf"))
+		if len(caches) == len(names) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("waveform caches = %v", caches)
+		}
+	}
+	
+	// 第一首结束后自动切到第二首, 切歌在另一个协程中完成
+	_ = out.Advance(time.Second * 2)
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		if p.Status().Music.Name == names[1] {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("did not advance to the second music")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	_ = out.Advance(time.Second)
+	p.Stop()
+	if p.State() != StateIdle {
+		t.Fatalf("state = %s, want Idle", p.State())
+	}
+	unsubscribe()
+	want := []State{StateLoading, StatePlaying, StateEnded, StateLoading, StatePlaying, StateIdle}
+	got := <-results
+	if !slices.Equal(got.states, want) {
+		t.Fatalf("states = %v, want %v", got.states, want)
+	}
+	if !got.heard {
+		t.Fatal("spectrum is silent")
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	
+	f, err := os.Open(filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, format, err := wav.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := format.SampleRate.D(s.Len()), time.Second*5; got != want {
+		t.Fatalf("rendered %v, want %v", got, want)
+	}
+	// 文件头中的长度之外还要检查实际的文件大小
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(44 + s.Len()*4); info.Size() != want {
+		t.Fatalf("file size = %d, want %d", info.Size(), want)
+	}
+	// 开头两秒是第一首, 不应该是静音
+	buf := make([][2]float64, format.SampleRate.N(time.Second*2))
+	n, _ := s.Stream(buf)
+	// 正弦波从 0 开始上升, 数据错位时开头不是 0
+	if math.Abs(buf[0][0]) > 1e-3 {
+		t.Fatalf("first sample = %v, want 0", buf[0][0])
+	}
+	for i := 1; i < 10; i++ {
+		if buf[i][0] <= buf[i-1][0] {
+			t.Fatalf("samples = %v, want rising sine", buf[:10])
+		}
+	}
+	var energy float64
+	for _, v := range buf[:n] {
+		energy += v[0] * v[0]
+	}
+	if rms := math.Sqrt(energy / float64(n)); rms < 0.05 {
+		t.Fatalf("rms = %v, output is silent", rms)
+	}
+}
+
+// writeCorruptFLAC 写入 d 时长的正弦波 FLAC 文件, 并破坏中间的音频帧
+func writeCorruptFLAC(t *testing.T, path string, d time.Duration) {
+	src := path + ".wav"
+	writeSine(t, src, 440, d)
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	s, format, err := wav.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := encode.Encode(context.Background(), f, s, format.SampleRate, 16, encode.FormatFLAC, encode.Tags{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{0x5A}, 4096), info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSkipBroken 无法打开和播放中途解码出错的音乐被跳过并记录到数据库, 过滤后只显示它们
+func TestSkipBroken(t *testing.T) {
+	if runInChild(t) {
+		return
+	}
+	
+	dir := t.TempDir()
+	writeSine(t, filepath.Join(dir, "ok.wav"), 440, time.Second*3)
+	writeCorruptFLAC(t, filepath.Join(dir, "corrupt.flac"), time.Second*3)
+	out := decode.NewNullOutput()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewMusicPlayer(ctx, func(str string) { t.Log(str) }, WithBasePath(dir), WithOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddMusic(db.DefaultTableID, model.Music{Name: "missing", Path: filepath.Join(dir, "missing.wav"), Type: model.MusicTypeWAV, Length: time.Second * 3})
+	p.AddMusic(db.DefaultTableID, model.Music{Name: "corrupt", Path: filepath.Join(dir, "corrupt.flac"), Type: model.MusicTypeFLAC, Length: time.Second * 3})
+	p.AddMusic(db.DefaultTableID, model.Music{Name: "ok", Path: filepath.Join(dir, "ok.wav"), Type: model.MusicTypeWAV, Length: time.Second * 3})
+	
+	p.Play()
+	if status := p.Status(); p.State() != StatePlaying || status.Music.Name != "corrupt" {
+		t.Fatalf("state = %s %s, want Playing corrupt", p.State(), status.Music.Name)
+	}
+	// 损坏的帧让解码提前结束, 不当作正常播放完毕
+	_ = out.Advance(time.Second * 3)
+	for deadline := time.Now().Add(time.Second * 5); p.Status().Music.Name != "ok"; time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(deadline) {
+			t.Fatalf("did not skip the corrupt music, playing %s", p.Status().Music.Name)
+		}
+	}
+	p.Stop()
+	
+	// 重新载入表格, 失败记录来自数据库
+	p.SelectTable(db.DefaultTableID)
+	p.FilterBroken(true)
+	_, items := p.List(ListLocal)
+	if len(items) != 2 {
+		t.Fatalf("broken items = %d, want 2", len(items))
+	}
+	for i, name := range []string{"missing", "corrupt"} {
+		broken, _ := items[i].GetMusic()
+		if broken.Name != name || broken.FailCount != 1 || broken.LastError == "" {
+			t.Fatalf("broken = %s %d %q, want %s", broken.Name, broken.FailCount, broken.LastError, name)
+		}
+	}
+	p.FilterBroken(false)
+	if _, items := p.List(ListLocal); len(items) != 3 {
+		t.Fatalf("items = %d, want 3", len(items))
+	}
+}
+
+// streamingMusic 模拟边下载边播放的网络音乐, 下载完成前 GetMusic 返回错误
+type streamingMusic struct {
+	music.Music
+}
+
+func (streamingMusic) GetMusic() (model.Music, error) {
+	return model.Music{}, errors.New("streaming")
+}
+
+// TestStreamingTrackInfo 边下载边播放时音乐信息来自音乐本身, 名称不为空
+func TestStreamingTrackInfo(t *testing.T) {
+	if runInChild(t) {
+		return
+	}
+	
+	dir := t.TempDir()
+	writeSine(t, filepath.Join(dir, "song.wav"), 440, time.Second*3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewMusicPlayer(ctx, func(str string) { t.Log(str) }, WithBasePath(dir), WithOutput(decode.NewNullOutput()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AddMusic(db.DefaultTableID, model.Music{Name: "song", Singer: "Singer", Path: filepath.Join(dir, "song.wav"), Type: model.MusicTypeWAV, Length: time.Second * 3})
+	_, items := p.List(ListLocal)
+	if len(items) != 1 {
+		t.Fatalf("items = %d", len(items))
+	}
+	m := p.(*musicPlayer)
+	m.do(func() {
+		m.neteaseList.setItems([]music.Music{streamingMusic{items[0]}}, 0, false)
+	})
+	
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+	p.PlayAt(ListStream, 0)
+	for e := range events {
+		if e, ok := e.(TrackChanged); ok {
+			if e.Music.Name != "song" || e.Music.Singer != "Singer" {
+				t.Fatalf("track = %+v", e.Music)
+			}
+			break
+		}
+	}
+	if status := p.Status(); status.Music.Name != "song" {
+		t.Fatalf("status music = %+v", status.Music)
+	}
+	p.Stop()
+}
+
+// TestExportMusic 导出一段音乐为 22050Hz 的 FLAC, 不需要播放器
+func TestExportMusic(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.wav")
+	writeSine(t, src, 440, time.Second*3)
+	item := model.Music{Name: "src.wav", Singer: "Singer", Path: src, Type: model.MusicTypeWAV}
+	path := filepath.Join(dir, exportName(1, item, encode.FormatFLAC))
+	if filepath.Base(path) != "01 - Singer - src.flac" {
+		t.Fatalf("name = %s", path)
+	}
+	opts := encode.Options{Format: encode.FormatFLAC, SampleRate: 22050, BitDepth: 24}
+	if err := exportMusic(context.Background(), item, path, opts, time.Second, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, format, err := flac.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != 22050 || format.Precision != 3 || s.Len() != 22050 {
+		t.Fatalf("format = %+v, len = %d", format, s.Len())
+	}
+	if err := exportMusic(context.Background(), item, src, opts, 0, 0); err != ErrExportSource {
+		t.Fatalf("overwrite source: %v", err)
+	}
+	
+	// 标签中的音轨号、流派、年份和封面带到导出的文件中
+	tagged := filepath.Join(dir, "tagged.wav")
+	w, err := os.Create(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover := &tag.Picture{MIMEType: "image/png", Type: "Cover (front)", Data: []byte("\x89PNG cover")}
+	if err := encode.Encode(context.Background(), w, beep.Silence(44100), 44100, 16, encode.FormatWAV, encode.Tags{Cover: cover}); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	item = model.Music{Name: "tagged", Path: tagged, Type: model.MusicTypeWAV, TrackNumber: 7, Genre: "Rock", Year: 1999}
+	used := map[string]bool{}
+	path = uniquePath(dir, exportName(1, item, encode.FormatFLAC), used)
+	if err := exportMusic(context.Background(), item, path, opts, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	m, err := decode.GetMetadata(path, model.MusicTypeFLAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Track != 7 || m.Genre != "Rock" || m.Year != 1999 || m.Cover() == nil || string(m.Cover().Data) != string(cover.Data) {
+		t.Fatalf("tags = %d %q %d %v", m.Track, m.Genre, m.Year, m.Pictures)
+	}
+	// 同名的文件不会被覆盖
+	if again := uniquePath(dir, exportName(1, item, encode.FormatFLAC), used); filepath.Base(again) != "01 - tagged (2).flac" {
+		t.Fatalf("duplicate name = %s", again)
+	}
+}
@@ -0,0 +1,110 @@
+package mp
+
+import (
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/eq"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+)
+
+// Settings 播放设置, 只在命令循环中修改
+type Settings struct {
+	// Volume 音量[0,100]
+	Volume float64
+	Mode   PlayMode
+	// Crossfade 自动切歌时的交叉淡化时长
+	Crossfade time.Duration
+	// ReplayGain 响度归一化模式
+	ReplayGain replaygain.Mode
+	// Equalizer 均衡器设置
+	Equalizer eq.Settings
+	// Speed 播放速度, Pitch 变调的半音数
+	Speed float64
+	Pitch float64
+}
+
+// applySettings 把全部设置应用到输出
+func (m *musicPlayer) applySettings() {
+	s := m.settings.Settings
+	decode.SetVolume(s.Volume / 100)
+	decode.SetCrossfade(s.Crossfade)
+	decode.SetReplayGainMode(s.ReplayGain)
+	decode.SetEqualizer(s.Equalizer)
+	decode.SetSpeed(s.Speed)
+	decode.SetPitch(s.Pitch)
+}
+
+// setSettings 修改设置, 有变化时用 apply 应用到输出并发布 SettingsChanged
+func (m *musicPlayer) setSettings(change func(s *Settings), apply func(s Settings)) {
+	prev := m.settings.Settings
+	change(&m.settings.Settings)
+	if m.settings.Settings == prev {
+		return
+	}
+	apply(m.settings.Settings)
+	m.events.publish(SettingsChanged{Settings: m.settings.Settings})
+}
+
+// updateSettings 在命令循环中执行 setSettings
+func (m *musicPlayer) updateSettings(change func(s *Settings), apply func(s Settings)) {
+	m.do(func() {
+		m.setSettings(change, apply)
+	})
+}
+
+// Settings Implementation MusicPlayerSettingsModule
+func (m *musicPlayer) Settings() Settings {
+	var s Settings
+	m.do(func() {
+		s = m.settings.Settings
+	})
+	return s
+}
+func (m *musicPlayer) SetVolume(volume float64) {
+	m.updateSettings(func(s *Settings) {
+		s.Volume = volume
+	}, func(s Settings) {
+		decode.SetVolume(s.Volume / 100)
+	})
+}
+func (m *musicPlayer) SetPlayMode(mode PlayMode) {
+	m.updateSettings(func(s *Settings) {
+		s.Mode = mode
+	}, func(Settings) {})
+}
+func (m *musicPlayer) SetCrossfade(d time.Duration) {
+	m.updateSettings(func(s *Settings) {
+		s.Crossfade = d
+	}, func(s Settings) {
+		decode.SetCrossfade(s.Crossfade)
+	})
+}
+func (m *musicPlayer) SetReplayGainMode(mode replaygain.Mode) {
+	m.updateSettings(func(s *Settings) {
+		s.ReplayGain = mode
+	}, func(s Settings) {
+		decode.SetReplayGainMode(s.ReplayGain)
+	})
+}
+func (m *musicPlayer) SetEqualizer(e eq.Settings) {
+	m.updateSettings(func(s *Settings) {
+		s.Equalizer = e
+	}, func(s Settings) {
+		decode.SetEqualizer(s.Equalizer)
+	})
+}
+func (m *musicPlayer) SetSpeed(speed float64) {
+	m.updateSettings(func(s *Settings) {
+		s.Speed = speed
+	}, func(s Settings) {
+		decode.SetSpeed(s.Speed)
+	})
+}
+func (m *musicPlayer) SetPitch(semitones float64) {
+	m.updateSettings(func(s *Settings) {
+		s.Pitch = semitones
+	}, func(s Settings) {
+		decode.SetPitch(s.Pitch)
+	})
+}
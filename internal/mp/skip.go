@@ -0,0 +1,96 @@
+package mp
+
+import (
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+	"k8s.io/klog"
+)
+
+// maxSkip 一次切歌最多尝试的音乐数, 避免整个列表都无法播放时长时间卡住
+const maxSkip = 10
+
+// FilterBroken Implementation MusicPlayerOperationModule
+func (m *musicPlayer) FilterBroken(on bool) {
+	m.do(func() {
+		m.list.FilterBroken(on)
+	})
+}
+
+// playOrSkip 播放 item, 失败时按 skip 跳到下一首; 连续失败 maxSkip 首或整个列表后停止并提示
+func (m *musicPlayer) playOrSkip(item music.Music, skip func() music.Music) {
+	tries := min(maxSkip, len(m.selectList.items))
+	for {
+		err := m.open(item)
+		if err == nil {
+			return
+		}
+		tries--
+		if tries <= 0 {
+			m.fail(item, err)
+			m.setState(StateError)
+			return
+		}
+		klog.Warningf("skip %s: %v", item.MusicName(), err)
+		item = skip()
+	}
+}
+
+// skipFailed 播放中途解码出错(例如损坏的帧), 记录失败并跳到下一首, 单曲循环时不会重复播放
+func (m *musicPlayer) skipFailed(item music.Music, err error) {
+	klog.Warningf("skip %s: %v", item.MusicName(), err)
+	m.recordFailure(item, err)
+	m.setState(StateError)
+	m.advance(true)
+}
+
+// skipNext 和 skipPrev 跳过失败的音乐, 单曲循环时按列表循环移动
+func (m *musicPlayer) skipNext() music.Music {
+	return m.selectList.next(skipMode(m.settings.Mode))
+}
+func (m *musicPlayer) skipPrev() music.Music {
+	return m.selectList.prev(skipMode(m.settings.Mode))
+}
+func skipMode(mode PlayMode) PlayMode {
+	if mode == PlayModeSingleCycle {
+		return PlayModeCycle
+	}
+	return mode
+}
+
+// recordFailure 记录播放失败的次数和错误, 本地音乐保存到数据库
+func (m *musicPlayer) recordFailure(item music.Music, err error) {
+	l := m.selectList
+	if l.kind == ListStream {
+		if l.failures == nil {
+			l.failures = map[music.Music]int{}
+		}
+		l.failures[item]++
+		return
+	}
+	cur, _ := item.GetMusic()
+	cur.FailCount++
+	cur.LastError = err.Error()
+	m.saveFailure(item, cur)
+}
+
+// clearFailure 播放成功后清除失败记录
+func (m *musicPlayer) clearFailure(item music.Music) {
+	l := m.selectList
+	if l.kind == ListStream {
+		delete(l.failures, item)
+		return
+	}
+	cur, _ := item.GetMusic()
+	if cur.FailCount == 0 && cur.LastError == "" {
+		return
+	}
+	cur.FailCount, cur.LastError = 0, ""
+	m.saveFailure(item, cur)
+}
+func (m *musicPlayer) saveFailure(item music.Music, cur model.Music) {
+	item.Update(cur)
+	if err := m.store.UpdateFailure(cur); err != nil {
+		klog.Error(err)
+	}
+	m.selectList.changed()
+}
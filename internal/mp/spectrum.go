@@ -0,0 +1,26 @@
+package mp
+
+import (
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/spectrum"
+)
+
+// initSpectrum 订阅输出的频谱, 作为 SpectrumChanged 发布, 持续静音时不再发布
+func (m *musicPlayer) initSpectrum() {
+	var silent bool
+	stop := decode.WatchSpectrum(func(f spectrum.Frame) {
+		if f.Silent() {
+			if silent {
+				return
+			}
+			silent = true
+		} else {
+			silent = false
+		}
+		m.events.publish(SpectrumChanged{Frame: f})
+	})
+	go func() {
+		<-m.ctx.Done()
+		stop()
+	}()
+}
@@ -0,0 +1,115 @@
+package mp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+	"k8s.io/klog"
+)
+
+// State 播放器状态
+type State int
+
+const (
+	// StateIdle 没有正在播放的音乐
+	StateIdle State = iota
+	// StateLoading 正在打开音乐
+	StateLoading
+	// StateBuffering 网络音乐边下边播, 数据还没有下载到
+	StateBuffering
+	StatePlaying
+	StatePaused
+	// StateEnded 当前音乐播放完毕, 随后切到下一首或停留在此
+	StateEnded
+	// StateError 打开或播放音乐失败
+	StateError
+)
+
+var stateNames = [...]string{"Idle", "Loading", "Buffering", "Playing", "Paused", "Ended", "Error"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// Active 音乐正在(或即将)发声, 界面据此显示暂停按钮
+func (s State) Active() bool {
+	return s == StateLoading || s == StateBuffering || s == StatePlaying
+}
+
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// transitions 每个状态允许转换到的状态
+var transitions = map[State][]State{
+	StateIdle:      {StateLoading},
+	StateLoading:   {StatePlaying, StateBuffering, StateError, StateIdle},
+	StateBuffering: {StatePlaying, StatePaused, StateLoading, StateEnded, StateError, StateIdle},
+	StatePlaying:   {StatePaused, StateBuffering, StateLoading, StateEnded, StateError, StateIdle},
+	StatePaused:    {StatePlaying, StateBuffering, StateLoading, StateError, StateIdle},
+	StateEnded:     {StateLoading, StateIdle},
+	StateError:     {StateLoading, StateIdle},
+}
+
+// CanTransition 是否允许从 from 转换到 to
+func CanTransition(from, to State) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// stateMachine 校验并记录状态转换, 零值为 StateIdle; 每次转换都在锁内发布 StateChanged, 订阅者看到的顺序与转换顺序一致
+type stateMachine struct {
+	mu     sync.Mutex
+	state  State
+	events *eventHub
+}
+
+func (s *stateMachine) load() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// to 转换到 next 并返回之前的状态; 指定了 from 时只在当前状态属于 from 时转换.
+// 状态不变时 changed 为 false, 不合法的转换不会改变状态
+func (s *stateMachine) to(next State, from ...State) (prev State, changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev = s.state
+	if prev == next || len(from) > 0 && !slices.Contains(from, prev) {
+		return prev, false, nil
+	}
+	if !CanTransition(prev, next) {
+		return prev, false, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, prev, next)
+	}
+	s.state = next
+	if s.events != nil {
+		s.events.publish(StateChanged{From: prev, To: next})
+	}
+	return prev, true, nil
+}
+
+// setState 转换播放状态, 返回状态是否变化
+func (m *musicPlayer) setState(next State, from ...State) bool {
+	_, changed, err := m.state.to(next, from...)
+	if err != nil {
+		klog.Warning(err)
+		return false
+	}
+	return changed
+}
+
+// fail 记录错误, 提示用户并发布 ErrorOccurred
+func (m *musicPlayer) fail(item music.Music, err error) {
+	klog.Error(err)
+	m.alert(err.Error())
+	var cur model.Music
+	if item != nil {
+		cur, _ = item.GetMusic()
+	}
+	m.events.publish(ErrorOccurred{Music: cur, Err: err})
+}
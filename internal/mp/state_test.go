@@ -0,0 +1,88 @@
+package mp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateMachine(t *testing.T) {
+	var hub eventHub
+	events, cancel := hub.subscribe()
+	defer cancel()
+	s := stateMachine{events: &hub}
+	
+	if _, _, err := s.to(StatePaused); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Idle -> Paused err = %v", err)
+	}
+	if s.load() != StateIdle {
+		t.Fatalf("state = %s after invalid transition", s.load())
+	}
+	for _, next := range []State{StateLoading, StateBuffering, StatePlaying, StatePaused, StatePlaying, StateEnded, StateIdle} {
+		if _, changed, err := s.to(next); err != nil || !changed {
+			t.Fatalf("-> %s: changed = %v, err = %v", next, changed, err)
+		}
+	}
+	// 指定 from 时, 当前状态不符合不转换也不报错
+	if _, changed, err := s.to(StatePlaying, StateBuffering); changed || err != nil {
+		t.Fatalf("guarded transition changed = %v, err = %v", changed, err)
+	}
+	
+	want := []StateChanged{
+		{StateIdle, StateLoading}, {StateLoading, StateBuffering}, {StateBuffering, StatePlaying},
+		{StatePlaying, StatePaused}, {StatePaused, StatePlaying}, {StatePlaying, StateEnded}, {StateEnded, StateIdle},
+	}
+	for _, w := range want {
+		if got := (<-events).(StateChanged); got != w {
+			t.Fatalf("event = %v, want %v", got, w)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v", e)
+	default:
+	}
+}
+
+// TestEventHubSlowSubscriber 读取过慢的订阅者不会丢失状态事件, 进度事件只保留最新的, 发布方不阻塞
+func TestEventHubSlowSubscriber(t *testing.T) {
+	var hub eventHub
+	events, cancel := hub.subscribe()
+	const n = eventBuffer * 4
+	for i := 0; i < n; i++ {
+		hub.publish(QueueChanged{TableID: uint(i)})
+		hub.publish(PositionChanged{Position: time.Duration(i)})
+	}
+	var queue, positions int
+	for last := time.Duration(-1); last != n-1; {
+		switch e := (<-events).(type) {
+		case QueueChanged:
+			if e.TableID != uint(queue) {
+				t.Fatalf("queue event = %d, want %d", e.TableID, queue)
+			}
+			queue++
+		case PositionChanged:
+			if e.Position <= last {
+				t.Fatalf("position = %d after %d", e.Position, last)
+			}
+			last = e.Position
+			positions++
+		}
+	}
+	if queue != n || positions == n {
+		t.Fatalf("queue events = %d, positions = %d, want %d and fewer", queue, positions, n)
+	}
+	
+	// 取消订阅前发布的事件仍然可以读到, 之后通道关闭
+	hub.publish(StateChanged{From: StateIdle, To: StateLoading})
+	cancel()
+	cancel()
+	hub.publish(QueueChanged{})
+	var rest []Event
+	for e := range events {
+		rest = append(rest, e)
+	}
+	if len(rest) != 1 || rest[0] != (StateChanged{From: StateIdle, To: StateLoading}) {
+		t.Fatalf("remaining = %v", rest)
+	}
+}
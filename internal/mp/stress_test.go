@@ -0,0 +1,110 @@
+package mp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/db"
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/model"
+)
+
+// TestConcurrentCommands 多个协程同时操作播放器, 同时推进时钟让音乐不断自然结束, 配合 -race 检查数据竞争。
+// 在单独的子进程中运行, 见 runInChild
+func TestConcurrentCommands(t *testing.T) {
+	if runInChild(t) {
+		return
+	}
+	
+	dir := t.TempDir()
+	out := decode.NewNullOutput()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := NewMusicPlayer(ctx, func(str string) {}, WithBasePath(dir), WithOutput(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("track%d", i)
+		path := filepath.Join(dir, name+".wav")
+		writeSine(t, path, 220*float64(i+1), time.Second)
+		p.AddMusic(db.DefaultTableID, model.Music{Name: name, Path: path, Type: model.MusicTypeWAV, Length: time.Second})
+	}
+	events, unsubscribe := p.Subscribe()
+	go func() {
+		for range events {
+		}
+	}()
+	p.Play()
+	
+	// 时钟协程: 解码器的进度和结束回调都从这里发出
+	stop := make(chan struct{})
+	var clock sync.WaitGroup
+	clock.Add(1)
+	go func() {
+		defer clock.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = out.Advance(time.Millisecond * 100)
+		}
+	}()
+	
+	ops := []func(){
+		p.Play, p.Pause, p.Next, p.Prev, p.Stop, p.ToggleABLoop,
+		func() { p.SeekTime(time.Millisecond * 800) },
+		func() { p.Seek(50) },
+		func() { p.SetSpeed(1.5) },
+		func() { p.PlayAt(ListLocal, rand.IntN(4)) },
+		func() {
+			cur := p.GetPlayedMusic()
+			if cur == nil {
+				return
+			}
+			item, _ := cur.GetMusic()
+			item.TrimSource, item.StartOffset = model.TrimSourceManual, time.Millisecond*100
+			p.UpdateMusic(db.DefaultTableID, item)
+		},
+		func() {
+			_, items := p.List(ListLocal)
+			for _, item := range items {
+				_ = item.MusicName()
+			}
+			_ = p.Status()
+			_ = p.State()
+		},
+	}
+	var workers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := 0; i < 100; i++ {
+				ops[rand.IntN(len(ops))]()
+			}
+		}()
+	}
+	workers.Wait()
+	close(stop)
+	clock.Wait()
+	
+	// 操作结束后状态仍然一致
+	p.Next()
+	if p.State() != StatePlaying {
+		t.Fatalf("state = %s, want Playing", p.State())
+	}
+	cur := p.GetPlayedMusic()
+	if name := p.Status().Music.Name; cur == nil || name != cur.MusicName() {
+		t.Fatalf("music name = %q, playing %v", name, cur)
+	}
+	p.Stop()
+	unsubscribe()
+}
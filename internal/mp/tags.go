@@ -0,0 +1,62 @@
+package mp
+
+import (
+	"fmt"
+	"path/filepath"
+	
+	"github.com/Theodoree/music_player/internal/encode/tags"
+	"github.com/Theodoree/music_player/internal/model"
+	"k8s.io/klog"
+)
+
+// EditTags Implementation MusicPlayerOperationModule
+func (m *musicPlayer) EditTags(music model.Music, edit tags.Edit) {
+	go func() {
+		// 重写文件较慢, 在后台完成后再到命令循环中更新音乐库;
+		// CUE 中的一轨共用整个文件, 和不支持写入的格式一样只修改音乐库
+		if music.CueTrack == 0 && tags.Supported(music.Type) {
+			if err := tags.Write(music.Path, music.Type, edit); err != nil {
+				klog.Error(music.Path, err)
+				m.alert(fmt.Sprintf("保存标签失败: %s", err))
+				return
+			}
+		}
+		m.do(func() {
+			m.applyTags(music, edit)
+		})
+	}()
+}
+
+// applyTags 只更新音乐库中的标签字段, 不会覆盖编辑期间在后台更新的增益、失败记录等字段;
+// 正在播放时同时刷新歌词, 没有歌词文件时歌词来自刚写入的标签
+func (m *musicPlayer) applyTags(music model.Music, edit tags.Edit) {
+	music.Name = edit.Title
+	if music.Name == "" {
+		music.Name = filepath.Base(music.Path)
+	}
+	music.Singer = edit.Artist
+	music.Album = edit.Album
+	music.TrackNumber = edit.Track
+	music.Genre = edit.Genre
+	if err := m.store.UpdateTags(music); err != nil {
+		m.alert(err.Error())
+		return
+	}
+	if m.list.tableId == music.MusicTableID {
+		if err := m.refreshMusic(music.MusicTableID); err != nil {
+			m.alert(err.Error())
+		}
+	}
+	if m.curMusic == nil {
+		return
+	}
+	cur, _ := m.curMusic.GetMusic()
+	if cur.ID != music.ID {
+		return
+	}
+	cur.Name, cur.Singer, cur.Album = music.Name, music.Singer, music.Album
+	cur.TrackNumber, cur.Genre = music.TrackNumber, music.Genre
+	m.curMusic.Update(cur)
+	m.musicPlayerData.progress.setLyrics(m.curMusic.Lyrics())
+	m.publishTrack()
+}
@@ -0,0 +1,144 @@
+package mp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/waveform"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/music"
+	"k8s.io/klog"
+)
+
+// waveformLoader 在后台提取正在播放的音乐的波形, 结果缓存在数据库旁的 waveform 目录中
+type waveformLoader struct {
+	dir      string
+	requests chan model.Music
+	mu       sync.Mutex
+	// current 正在播放的音乐, 提取完成时已经切歌则丢弃结果; CUE 中的多轨共用同一个文件
+	current model.Music
+}
+
+func newWaveformLoader(dir string) waveformLoader {
+	return waveformLoader{dir: dir, requests: make(chan model.Music, 1)}
+}
+
+// request 请求提取波形, 还没开始处理的旧请求会被替换
+func (l *waveformLoader) request(item model.Music) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = item
+	select {
+	case <-l.requests:
+	default:
+	}
+	l.requests <- item
+}
+
+func (l *waveformLoader) isCurrent(item model.Music) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current.Path == item.Path && l.current.CueTrack == item.CueTrack
+}
+
+// cacheFile 缓存文件名由路径、大小和修改时间决定, 文件变化后重新提取; CUE 中的每一轨单独缓存
+func (l *waveformLoader) cacheFile(item model.Music) (string, error) {
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s|%d|%d", item.Path, info.Size(), info.ModTime().UnixNano())
+	if item.CueTrack > 0 {
+		key += fmt.Sprintf("|%d|%d", item.CueStart, item.CueEnd)
+	}
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(l.dir, hex.EncodeToString(sum[:])+".wf"), nil
+}
+
+// requestWaveform 切歌时清空波形并请求提取新的波形
+func (m *musicPlayer) requestWaveform(music music.Music) {
+	m.setWaveform(waveform.Peaks{})
+	item, err := music.GetMusic()
+	if err != nil || item.Path == "" {
+		return
+	}
+	m.waveforms.request(item)
+}
+
+// loadWaveforms 后台提取协程, 一次只处理一首
+func (m *musicPlayer) loadWaveforms() {
+	for {
+		var item model.Music
+		select {
+		case <-m.ctx.Done():
+			return
+		case item = <-m.waveforms.requests:
+		}
+		peaks, err := m.waveformOf(item)
+		if err != nil {
+			if m.ctx.Err() != nil {
+				return
+			}
+			klog.Error(err)
+			continue
+		}
+		// 缓存的是整首(CUE 中的一轨)的波形, 只显示裁剪后的部分; 在命令循环中判断, 不会覆盖切歌后清空的波形
+		start, end := item.PlayRange()
+		if end > 0 {
+			end -= item.CueStart
+		}
+		m.post(func() {
+			if m.waveforms.isCurrent(item) {
+				m.setWaveform(peaks.Slice(start-item.CueStart, end))
+			}
+		})
+	}
+}
+
+// waveformOf 优先读取缓存, 后台分析还没有处理到的音乐完整解码提取并写入缓存
+func (m *musicPlayer) waveformOf(item model.Music) (waveform.Peaks, error) {
+	var peaks waveform.Peaks
+	cache, err := m.waveforms.cacheFile(item)
+	if err != nil {
+		return peaks, err
+	}
+	if buf, err := os.ReadFile(cache); err == nil && peaks.UnmarshalBinary(buf) == nil {
+		return peaks, nil
+	}
+	
+	file, err := os.Open(item.Path)
+	if err != nil {
+		return peaks, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	peaks, err = decode.ExtractWaveform(m.ctx, item.Type, file, item.CueStart, item.CueEnd)
+	if err != nil {
+		return peaks, err
+	}
+	m.saveWaveform(cache, peaks)
+	return peaks, nil
+}
+
+// saveWaveform 写入波形缓存, 后台分析解码时也会顺便写入
+func (m *musicPlayer) saveWaveform(cache string, peaks waveform.Peaks) {
+	buf, _ := peaks.MarshalBinary()
+	if err := os.MkdirAll(m.waveforms.dir, 0766); err != nil {
+		klog.Error(err)
+		return
+	}
+	if err := os.WriteFile(cache, buf, 0644); err != nil {
+		klog.Error(err)
+	}
+}
+
+func (m *musicPlayer) setWaveform(peaks waveform.Peaks) {
+	m.musicPlayerData.waveform = peaks
+	m.events.publish(WaveformChanged{Peaks: peaks})
+}
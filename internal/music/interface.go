@@ -1,7 +1,6 @@
 package music
 
 import (
-	"fyne.io/fyne/v2/data/binding"
 	"github.com/Theodoree/music_player/internal/model"
 	"time"
 )
@@ -14,12 +13,14 @@ type Source interface {
 
 type Callback struct {
 	CurTime func(duration time.Duration)
-	DoneFn  func(model.Status)
+	// DoneFn 播放结束时调用, status 为 StatusPlayFailed 时 err 是解码出错的原因
+	DoneFn func(status model.Status, err error)
+	// Buffering 边下边播的音乐进入或离开缓冲状态, 可以为空
+	Buffering func(bool)
 }
 
 // Data 音乐数据接口
 type Data interface {
-	binding.DataItem
 	// TableID 返回表格ID
 	TableID() uint
 	// Lyrics 返回歌词(全量)
@@ -42,6 +43,8 @@ type Data interface {
 type Operator interface {
 	// Play 播放音乐
 	Play(cb *Callback, volume float64) error
+	// Prepare 预加载音乐, 当前音乐结束后无缝衔接
+	Prepare(cb *Callback, volume float64) error
 	// Pause 暂停音乐
 	Pause() error
 	// Stop 停止音乐
@@ -52,6 +55,10 @@ type Operator interface {
 	GetMusic() (model.Music, error)
 	
 	Seek(f float64)
+	// SeekTime 跳转到指定时间
+	SeekTime(t time.Duration)
+	// SetLoop 在 [a,b) 之间循环播放, b<=a 时取消循环
+	SetLoop(a, b time.Duration)
 	
 	Update(model model.Music)
 }
@@ -6,15 +6,19 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 	
 	"github.com/Theodoree/music_player/internal/db"
 	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/charset"
 	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/music"
+	"github.com/Theodoree/music_player/internal/tool"
 )
 
 var NoDecodeError = errors.New("no decode")
+var NoPrepareError = errors.New("can't prepare")
 
 type localSource struct {
 	ctx    context.Context
@@ -40,7 +44,7 @@ func (api *localSource) SearchMusic(tableID uint, keyWord string) ([]music.Music
 		if len(keyWord) > 0 && strings.Index(keyWord, m.Name) == -1 && strings.Index(keyWord, m.Singer) == -1 {
 			continue
 		}
-		items = append(items, newMusic(m))
+		items = append(items, newMusic(m, api))
 	}
 	
 	return items, nil
@@ -53,109 +57,211 @@ func (api *localSource) Close() error {
 	return nil
 }
 
+// tableCharset 表格指定的文字编码, 每次读取时查询, 修改后对已经载入的音乐立即生效
+func (api *localSource) tableCharset(tableID uint) model.Charset {
+	table, err := api.db.GetMusicTableByID(tableID)
+	if err != nil {
+		return model.CharsetAuto
+	}
+	return table.Charset
+}
+
 type _music struct {
+	// mu 保护 Music 和 decode: 列表界面在界面协程中读取, 播放器在命令循环中修改
+	mu sync.RWMutex
 	model.Music
 	decode decode.Decoder
+	source *localSource
+}
+
+func newMusic(m model.Music, source *localSource) music.Music {
+	return &_music{Music: m, source: source}
 }
 
-func newMusic(m model.Music) music.Music {
-	return &_music{Music: m}
+// load 返回音乐信息的副本和当前的解码器
+func (n *_music) load() (model.Music, decode.Decoder) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.Music, n.decode
 }
 
-func (n *_music) getReader() (io.ReadSeekCloser, error) {
-	file, err := os.Open(n.Music.Path)
+func (n *_music) setDecoder(d decode.Decoder) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.decode = d
+}
+
+func (n *_music) getReader(item model.Music) (io.ReadSeekCloser, error) {
+	file, err := os.Open(item.Path)
 	if err != nil {
 		return nil, err
 	}
 	return file, nil
 }
 
+// newDecoder 打开音乐并按增益和裁剪范围创建解码器
+func (n *_music) newDecoder(item model.Music, cb *music.Callback, volume float64) (decode.Decoder, error) {
+	reader, err := n.getReader(item)
+	if err != nil {
+		return nil, err
+	}
+	// tryGetCache
+	decoder, err := decode.NewDecoder(context.TODO(), item.Type, reader, volume, cb)
+	if err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	decoder.SetReplayGain(tool.ReplayGain(item))
+	decoder.SetTrim(item.PlayRange())
+	return decoder, nil
+}
+
 // TableID Implementation music.Data
 func (n *_music) TableID() uint {
-	return n.MusicTableID
+	item, _ := n.load()
+	return item.MusicTableID
 }
+
+// Lyrics 优先使用歌词文件, 没有时使用文件中内嵌的歌词; CUE 中的一轨没有自己的标签
 func (n *_music) Lyrics() string {
-	buf, _ := os.ReadFile(n.Music.Lyric)
-	return string(buf)
-	
+	item, _ := n.load()
+	c := n.source.tableCharset(item.MusicTableID)
+	if buf, err := os.ReadFile(item.Lyric); err == nil {
+		return charset.Decode(buf, c)
+	}
+	if item.CueTrack > 0 {
+		return ""
+	}
+	f, err := os.Open(item.Path)
+	if err != nil {
+		return ""
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	lyrics, err := decode.ReadLyrics(f, item.Type)
+	if err != nil {
+		return ""
+	}
+	return charset.Fix(lyrics, c)
 }
 func (n *_music) MusicName() string {
-	return n.Music.Name
+	item, _ := n.load()
+	return item.Name
 }
 func (n *_music) SingerName() string {
-	return n.Music.Singer
+	item, _ := n.load()
+	return item.Singer
 }
 func (n *_music) Album() string {
-	return n.Music.Album
+	item, _ := n.load()
+	return item.Album
 }
 func (n *_music) AlbumPicture() string {
 	//return n.Music.Pic
 	return ""
 }
 func (n *_music) CurTime() (time.Duration, error) {
-	if n.decode == nil {
+	_, d := n.load()
+	if d == nil {
 		return 0, NoDecodeError
 	}
-	if n.decode == nil {
-		return 0, NoDecodeError
-	}
-	return n.decode.CurTime(), nil
+	return d.CurTime(), nil
 }
 func (n *_music) EndTime() (time.Duration, error) {
-	return n.Music.Length, nil
+	item, d := n.load()
+	if d != nil {
+		return d.EndTime(), nil
+	}
+	return item.PlayLength(), nil
 }
 
 // Play Implementation music.Operator
 func (n *_music) Play(cb *music.Callback, volume float64) error {
-	if n.decode != nil {
-		n.decode.Play()
+	item, d := n.load()
+	if d != nil {
+		d.Play()
 		return nil
 	}
-	reader, err := n.getReader()
+	decoder, err := n.newDecoder(item, cb, volume)
 	if err != nil {
 		return err
 	}
-	// tryGetCache
-	decoder, err := decode.NewDecoder(context.TODO(), n.Type, reader, volume, cb)
+	n.setDecoder(decoder)
+	decoder.Play()
+	return nil
+
+}
+func (n *_music) Prepare(cb *music.Callback, volume float64) error {
+	item, d := n.load()
+	if d != nil {
+		return nil
+	}
+	decoder, err := n.newDecoder(item, cb, volume)
 	if err != nil {
-		_ = reader.Close()
 		return err
 	}
-	n.decode = decoder
-	n.decode.Play()
+	n.setDecoder(decoder)
+	if !decoder.Prepare() {
+		return NoPrepareError
+	}
 	return nil
-	
 }
 func (n *_music) Pause() error {
-	if n.decode == nil {
+	_, d := n.load()
+	if d == nil {
 		return NoDecodeError
 	}
-	n.decode.Pause()
+	d.Pause()
 	return nil
 }
 func (n *_music) Stop() error {
-	if n.decode == nil {
+	_, d := n.load()
+	if d == nil {
 		return NoDecodeError
 	}
-	n.decode.Stop()
-	n.decode = nil
+	d.Stop()
+	n.setDecoder(nil)
 	return nil
 }
 func (n *_music) SetVolume(f float64) {
-	if n.decode == nil {
+	_, d := n.load()
+	if d == nil {
 		return
 	}
-	n.decode.SetVolume(f)
+	d.SetVolume(f)
 }
 func (n *_music) GetMusic() (model.Music, error) {
-	return n.Music, nil
+	item, _ := n.load()
+	return item, nil
 }
 func (n *_music) Seek(f float64) {
-	if n.decode == nil {
+	_, d := n.load()
+	if d == nil {
 		return
 	}
-	n.decode.Seek(f)
+	d.Seek(f)
+}
+func (n *_music) SeekTime(t time.Duration) {
+	_, d := n.load()
+	if d == nil {
+		return
+	}
+	d.SeekTime(t)
+}
+func (n *_music) SetLoop(a, b time.Duration) {
+	_, d := n.load()
+	if d == nil {
+		return
+	}
+	d.SetLoop(a, b)
 }
 func (n *_music) Update(model model.Music) {
+	n.mu.Lock()
 	n.Music = model
+	d := n.decode
+	n.mu.Unlock()
+	if d != nil {
+		d.SetTrim(model.PlayRange())
+	}
 }
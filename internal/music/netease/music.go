@@ -14,7 +14,6 @@ import (
 	"strings"
 	"time"
 	
-	"fyne.io/fyne/v2/data/binding"
 	"github.com/Theodoree/music_player/internal/decode"
 	"github.com/Theodoree/music_player/internal/model"
 	"github.com/Theodoree/music_player/internal/music"
@@ -23,6 +22,8 @@ import (
 var _ music.Source = (*neteaseSource)(nil)
 var server = "39.101.203.25:3000"
 var NoDecodeError = errors.New("no decode")
+var NoPrepareError = errors.New("can't prepare")
+var StreamingError = errors.New("正在边下边播, 下载完成后才能使用")
 
 type neteaseSource struct {
 	ctx      context.Context
@@ -274,6 +275,8 @@ type neteaseMusic struct {
 	audio    string
 	audioURL string
 	endTime  time.Duration
+	// stream 正在边下边播的文件, 关闭后才会出现在 savePath 中
+	stream *rangeReader
 }
 
 func strJoin[T any](items []T, fn func(T) string, sep string) string {
@@ -316,7 +319,9 @@ func (n *neteaseMusic) getFileName() string {
 func (n *neteaseMusic) lyricFileName() string {
 	return fmt.Sprintf("%s-%s-%d.lrc", strings.Replace(n.singer, "/", " ", -1), strings.Replace(n.title, "/", " ", -1), n.id)
 }
-func (n *neteaseMusic) getReader() (io.ReadSeekCloser, error) {
+
+// getReader 已经下载过时读取本地文件, 否则通过 Range 请求边下边播
+func (n *neteaseMusic) getReader(cb *music.Callback) (io.ReadSeekCloser, error) {
 	file, err := os.Open(filepath.Join(n.savePath, n.getFileName()))
 	if err == nil {
 		return file, nil
@@ -324,11 +329,16 @@ func (n *neteaseMusic) getReader() (io.ReadSeekCloser, error) {
 	if err := n.getAudio(); err != nil {
 		return nil, err
 	}
-	m, err := n.GetMusic()
+	var onBuffering func(bool)
+	if cb != nil {
+		onBuffering = cb.Buffering
+	}
+	stream, err := openRangeReader(context.Background(), n.audioURL, filepath.Join(n.savePath, n.getFileName()), onBuffering)
 	if err != nil {
 		return nil, err
 	}
-	return os.Open(m.Path)
+	n.stream = stream
+	return stream, nil
 }
 func (n *neteaseMusic) getAudio() error {
 	if n.audio != "" {
@@ -423,7 +433,7 @@ func (n *neteaseMusic) Play(cb *music.Callback, volume float64) error {
 		n.decode.Play()
 		return nil
 	}
-	reader, err := n.getReader()
+	reader, err := n.getReader(cb)
 	if err != nil {
 		return err
 	}
@@ -438,6 +448,25 @@ func (n *neteaseMusic) Play(cb *music.Callback, volume float64) error {
 	return nil
 	
 }
+func (n *neteaseMusic) Prepare(cb *music.Callback, volume float64) error {
+	if n.decode != nil {
+		return nil
+	}
+	reader, err := n.getReader(cb)
+	if err != nil {
+		return err
+	}
+	d, err := decode.NewDecoder(context.TODO(), model.MusicTypeMP3, reader, volume, cb)
+	if err != nil {
+		_ = reader.Close()
+		return err
+	}
+	n.decode = d
+	if !n.decode.Prepare() {
+		return NoPrepareError
+	}
+	return nil
+}
 func (n *neteaseMusic) Pause() error {
 	if n.decode == nil {
 		return NoDecodeError
@@ -450,6 +479,7 @@ func (n *neteaseMusic) Stop() error {
 		return NoDecodeError
 	}
 	n.decode.Stop()
+	n.decode = nil
 	return nil
 }
 func (n *neteaseMusic) SetVolume(f float64) {
@@ -463,6 +493,12 @@ func (n *neteaseMusic) DownloadMusic() error {
 	if err == nil {
 		return nil
 	}
+	if n.stream != nil && !n.stream.Closed() {
+		return StreamingError
+	}
+	if err := n.getAudio(); err != nil {
+		return err
+	}
 	return download(n.audioURL, filepath.Join(n.savePath, n.getFileName()))
 }
 func (n *neteaseMusic) GetMusic() (model.Music, error) {
@@ -487,15 +523,20 @@ func (n *neteaseMusic) Seek(f float64) {
 	}
 	n.decode.Seek(f)
 }
-func (n *neteaseMusic) Update(model model.Music) {}
-
-// AddListener Implementation  binding.DataItem
-func (n *neteaseMusic) AddListener(_ binding.DataListener) {
-
+func (n *neteaseMusic) SeekTime(t time.Duration) {
+	if n.decode == nil {
+		return
+	}
+	n.decode.SeekTime(t)
 }
-func (n *neteaseMusic) RemoveListener(_ binding.DataListener) {
-
+func (n *neteaseMusic) SetLoop(a, b time.Duration) {
+	if n.decode == nil {
+		return
+	}
+	n.decode.SetLoop(a, b)
 }
+func (n *neteaseMusic) Update(model model.Music) {}
+
 func download(url, path string) error {
 	r, err := http.Get(url)
 	if err != nil {
@@ -507,15 +548,20 @@ func download(url, path string) error {
 	defer func() {
 		_ = r.Body.Close()
 	}()
-	b, err := io.ReadAll(r.Body)
+	// 先写入临时文件, 完整下载后再重命名, 避免留下不完整的文件
+	f, err := os.Create(path + ".part")
 	if err != nil {
-		return fmt.Errorf("io.ReadAll:%s", err.Error())
+		return fmt.Errorf("os.Create:%s", err.Error())
+	}
+	_, err = io.Copy(f, r.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	err = os.WriteFile(path, b, 0755)
 	if err != nil {
-		return fmt.Errorf("os.WriteFile:%s", err.Error())
+		_ = os.Remove(path + ".part")
+		return fmt.Errorf("io.Copy:%s", err.Error())
 	}
-	return nil
+	return os.Rename(path+".part", path)
 }
 
 func getLyricByID(id int) string {
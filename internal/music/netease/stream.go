@@ -0,0 +1,411 @@
+package netease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+)
+
+// streamChunk 下载和记录进度的块大小
+const streamChunk = 256 << 10
+
+// streamRetries 下载失败时的重试次数
+const streamRetries = 3
+
+// streamRetryDelay 重试之间的等待时间
+var streamRetryDelay = time.Second
+
+var errStreamClosed = errors.New("stream closed")
+
+var _ decode.Progressive = (*rangeReader)(nil)
+
+// rangeReader 通过 HTTP Range 请求边下载边读取的文件。
+// 数据按块写入与总大小相同的稀疏文件 path+".part", 读取没有下载的位置时会阻塞,
+// 后台从最近一次读取或跳转的位置开始顺序下载; 全部下载完成并关闭后重命名为 path
+type rangeReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	url    string
+	path   string
+	file   *os.File
+	size   int64
+	ranged bool
+	// buffering 缓冲状态变化时按顺序回调
+	buffering chan bool
+	wg        sync.WaitGroup
+	
+	mu   sync.Mutex
+	cond *sync.Cond
+	done []bool
+	// remaining 还没有下载的块数
+	remaining int
+	pos       int64
+	// want 下载优先从这个位置开始
+	want int64
+	// current 正在下载的块, abort 取消正在进行的请求, aborted 表示请求是因为跳转而取消的
+	current int
+	abort   context.CancelFunc
+	aborted bool
+	// starving 缓冲中等待的结束位置, -1 表示没有在缓冲
+	starving int64
+	err      error
+	closed   bool
+}
+
+// openRangeReader 请求第一块并获取文件大小, 服务器不支持 Range 时退化为顺序下载
+func openRangeReader(ctx context.Context, url, path string, onBuffering func(bool)) (*rangeReader, error) {
+	r := &rangeReader{url: url, path: path, starving: -1, buffering: make(chan bool, 16)}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	r.cond = sync.NewCond(&r.mu)
+	res, err := r.get(0)
+	if err != nil {
+		r.cancel()
+		return nil, err
+	}
+	if err := r.init(res); err != nil {
+		_ = res.Body.Close()
+		r.cancel()
+		return nil, err
+	}
+	
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		r.download(res.Body)
+	}()
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case b := <-r.buffering:
+				if onBuffering != nil {
+					onBuffering(b)
+				}
+			}
+		}
+	}()
+	return r, nil
+}
+
+// init 根据第一个响应确定文件大小并创建稀疏文件
+func (r *rangeReader) init(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-262143/5242880
+		total := res.Header.Get("Content-Range")
+		size, err := strconv.ParseInt(total[strings.LastIndex(total, "/")+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Content-Range:%s", total)
+		}
+		r.size, r.ranged = size, true
+	case http.StatusOK:
+		r.size = res.ContentLength
+	default:
+		return fmt.Errorf("r.StatusCode:%d", res.StatusCode)
+	}
+	if r.size <= 0 {
+		return errors.New("unknown content length")
+	}
+	file, err := os.Create(r.path + ".part")
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(r.size); err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.done = make([]bool, (r.size+streamChunk-1)/streamChunk)
+	r.remaining = len(r.done)
+	return nil
+}
+
+// get 从 off 开始请求到文件结尾, 跳转到别处时请求会被取消
+func (r *rangeReader) get(off int64) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.mu.Lock()
+	r.current, r.abort, r.aborted = int(off/streamChunk), cancel, false
+	r.mu.Unlock()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	return http.DefaultClient.Do(req)
+}
+
+// setWant 设置优先下载的位置, 离正在下载的块较远时取消当前请求, 调用方需持有锁
+func (r *rangeReader) setWant(off int64) {
+	r.want = off
+	c := int(off / streamChunk)
+	if off >= r.size || r.done[c] || !r.ranged || r.abort == nil {
+		return
+	}
+	if c != r.current && c != r.current+1 {
+		r.aborted = true
+		r.abort()
+	}
+}
+
+// download 后台下载协程, 每次请求从优先位置之后第一个没有下载的块开始, 直到文件结尾
+func (r *rangeReader) download(body io.ReadCloser) {
+	var start, failures int
+	for {
+		err := r.consume(body, start)
+		_ = body.Close()
+		if r.ctx.Err() != nil {
+			return
+		}
+		
+		r.mu.Lock()
+		if r.remaining == 0 {
+			r.mu.Unlock()
+			return
+		}
+		start = r.nextMissing()
+		aborted := r.aborted
+		r.mu.Unlock()
+		// 连续失败 streamRetries 次后放弃, 不支持 Range 时无法续传
+		if err != nil && !aborted {
+			failures++
+		} else {
+			failures = 0
+		}
+		for {
+			if failures > streamRetries || !r.ranged {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				r.fail(err)
+				return
+			}
+			var res *http.Response
+			if res, err = r.get(int64(start) * streamChunk); err == nil && res.StatusCode == http.StatusPartialContent {
+				body = res.Body
+				break
+			}
+			if err == nil {
+				_ = res.Body.Close()
+				err = fmt.Errorf("r.StatusCode:%d", res.StatusCode)
+			}
+			failures++
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(streamRetryDelay):
+			}
+		}
+	}
+}
+
+// consume 从第 start 块开始顺序写入响应数据。
+// 遇到已经下载的块或者读取位置跳到了别处时返回, 由 download 重新请求
+func (r *rangeReader) consume(body io.Reader, start int) error {
+	buf := make([]byte, streamChunk)
+	for c := start; c < len(r.done); c++ {
+		chunk := buf[:min(streamChunk, r.size-int64(c)*streamChunk)]
+		if _, err := io.ReadFull(body, chunk); err != nil {
+			return err
+		}
+		if _, err := r.file.WriteAt(chunk, int64(c)*streamChunk); err != nil {
+			return err
+		}
+		
+		r.mu.Lock()
+		if !r.done[c] {
+			r.done[c] = true
+			r.remaining--
+		}
+		if r.starving >= 0 && r.ready(r.pos, r.starving) {
+			r.starving = -1
+			r.notify(false)
+		}
+		r.cond.Broadcast()
+		want := int(r.want / streamChunk)
+		jump := want < len(r.done) && !r.done[want] && want != c+1
+		next := c+1 < len(r.done) && r.done[c+1]
+		r.current = c + 1
+		r.mu.Unlock()
+		if r.ranged && (jump || next) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// nextMissing 优先位置之后第一个没有下载的块, 之后没有时从头查找, 调用方需持有锁
+func (r *rangeReader) nextMissing() int {
+	want := int(r.want / streamChunk)
+	for i := range r.done {
+		if c := (want + i) % len(r.done); !r.done[c] {
+			return c
+		}
+	}
+	return 0
+}
+
+// ready [from,to) 是否已经下载, 调用方需持有锁
+func (r *rangeReader) ready(from, to int64) bool {
+	to = min(to, r.size)
+	for c := from / streamChunk; c*streamChunk < to; c++ {
+		if !r.done[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// notify 发送缓冲状态, 调用方需持有锁
+func (r *rangeReader) notify(b bool) {
+	select {
+	case r.buffering <- b:
+	default:
+	}
+}
+
+// fail 放弃下载, 结束缓冲状态并唤醒等待的读取
+func (r *rangeReader) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if r.starving >= 0 {
+		r.starving = -1
+		r.notify(false)
+	}
+	r.cond.Broadcast()
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	for {
+		if r.closed {
+			r.mu.Unlock()
+			return 0, errStreamClosed
+		}
+		if r.pos >= r.size {
+			r.mu.Unlock()
+			return 0, io.EOF
+		}
+		if r.done[r.pos/streamChunk] {
+			break
+		}
+		if r.err != nil {
+			r.mu.Unlock()
+			return 0, r.err
+		}
+		if r.want != r.pos {
+			r.setWant(r.pos)
+		}
+		r.cond.Wait()
+	}
+	// 只读到连续下载的部分为止
+	end := r.pos
+	for end < r.size && r.done[end/streamChunk] && end-r.pos < int64(len(p)) {
+		end = (end/streamChunk + 1) * streamChunk
+	}
+	n := min(int64(len(p)), min(end, r.size)-r.pos)
+	off := r.pos
+	r.pos += n
+	r.mu.Unlock()
+	return r.file.ReadAt(p[:n], off)
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	if offset < r.size && !r.done[offset/streamChunk] {
+		r.setWant(offset)
+	}
+	return offset, nil
+}
+
+func (r *rangeReader) Size() int64 {
+	return r.size
+}
+
+func (r *rangeReader) Complete() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining == 0
+}
+
+func (r *rangeReader) Ready(n int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return true
+	}
+	if r.ready(r.pos, r.pos+n) {
+		if r.starving >= 0 {
+			r.starving = -1
+			r.notify(false)
+		}
+		return true
+	}
+	if r.starving < 0 {
+		r.notify(true)
+	}
+	r.starving = r.pos + n
+	if r.want != r.pos {
+		r.setWant(r.pos)
+	}
+	return false
+}
+
+func (r *rangeReader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Closed 是否已经关闭
+func (r *rangeReader) Closed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Close 停止下载, 下载完成的文件重命名为正式文件, 没有完成的删除
+func (r *rangeReader) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+	
+	err := r.file.Close()
+	if r.remaining == 0 && err == nil {
+		return os.Rename(r.path+".part", r.path)
+	}
+	_ = os.Remove(r.path + ".part")
+	return err
+}
@@ -0,0 +1,175 @@
+package netease
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowServer 从头开始的请求只返回第一块后挂起, 模拟很慢的网络, ranged 为 false 时不支持 Range
+func slowServer(t *testing.T, content []byte, ranged bool) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var start int64
+		if ranged {
+			fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)-int(start)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		end := len(content)
+		if start == 0 {
+			end = min(streamChunk, len(content))
+		}
+		_, _ = w.Write(content[start:end])
+		w.(http.Flusher).Flush()
+		if end < len(content) {
+			<-req.Context().Done()
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestRangeReader(t *testing.T) {
+	content := make([]byte, streamChunk*5+1234)
+	rand.New(rand.NewSource(1)).Read(content)
+	path := filepath.Join(t.TempDir(), "music.mp3")
+	s := slowServer(t, content, true)
+	
+	var mu sync.Mutex
+	var states []bool
+	r, err := openRangeReader(context.Background(), s.URL, path, func(b bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		states = append(states, b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(content)) {
+		t.Fatalf("size = %d", r.Size())
+	}
+	
+	// 第一块到达后即可读取
+	buf := make([]byte, 1000)
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, content[:1000]) {
+		t.Fatalf("read first chunk: %v", err)
+	}
+	// 跳到没有下载的位置, 取消挂起的请求并从这里重新下载
+	off := int64(streamChunk*3 + 100)
+	_, _ = r.Seek(off, io.SeekStart)
+	if r.Ready(1000) {
+		t.Fatal("ready before download")
+	}
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, content[off:off+1000]) {
+		t.Fatalf("read after seek: %v", err)
+	}
+	if !r.Ready(1000) {
+		t.Fatal("not ready after download")
+	}
+	for deadline := time.Now().Add(time.Second * 5); ; time.Sleep(time.Millisecond * 10) {
+		mu.Lock()
+		got := fmt.Sprint(states)
+		mu.Unlock()
+		if got == "[true false]" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("buffering states = %s", got)
+		}
+	}
+	
+	// 读完整个文件, 关闭后成为正式文件
+	_, _ = r.Seek(0, io.SeekStart)
+	all, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(all, content) {
+		t.Fatalf("read all: %v", err)
+	}
+	if !r.Complete() {
+		t.Fatal("not complete")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(path); !bytes.Equal(saved, content) {
+		t.Fatal("saved file mismatch")
+	}
+}
+
+func TestRangeReaderIncomplete(t *testing.T) {
+	content := []byte(strings.Repeat("x", streamChunk*3))
+	path := filepath.Join(t.TempDir(), "music.mp3")
+	// 不支持 Range 的服务器, 只能顺序下载
+	r, err := openRangeReader(context.Background(), slowServer(t, content, false).URL, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("incomplete file kept: %v", err)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("part file kept: %v", err)
+	}
+}
+
+func TestRangeReaderDropped(t *testing.T) {
+	content := make([]byte, streamChunk*3)
+	// 只返回第一块就断开连接, 之后的请求直接断开
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var start int64
+		fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-", &start)
+		if start > 0 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[:streamChunk])
+	}))
+	t.Cleanup(s.Close)
+	delay := streamRetryDelay
+	streamRetryDelay = time.Millisecond
+	t.Cleanup(func() { streamRetryDelay = delay })
+	
+	r, err := openRangeReader(context.Background(), s.URL, filepath.Join(t.TempDir(), "music.mp3"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.ReadFull(r, make([]byte, streamChunk)); err != nil {
+		t.Fatalf("read first chunk: %v", err)
+	}
+	// 放弃下载后不再缓冲, 读取返回错误
+	for deadline := time.Now().Add(time.Second * 5); !r.Ready(1000); time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(deadline) {
+			t.Fatal("still buffering after the download failed")
+		}
+	}
+	if r.Err() == nil || r.Complete() {
+		t.Fatalf("err = %v, complete = %v", r.Err(), r.Complete())
+	}
+	if _, err := r.Read(make([]byte, 10)); err == nil {
+		t.Fatal("read past the downloaded part succeeded")
+	}
+}
@@ -0,0 +1,122 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/decode"
+	"github.com/Theodoree/music_player/internal/decode/charset"
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/Theodoree/music_player/internal/tool/cue"
+	"k8s.io/klog"
+)
+
+// cueTracks 把 CUE 中的每一轨转换为虚拟的音乐, 播放时只播放文件中该轨的范围。
+// 找不到的文件被跳过, 其余文件照常拆分; 整个 CUE 按编码 c 转换, 文件名也可能是 GBK 或 Big5
+func cueTracks(path string, c model.Charset) ([]model.Music, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := cue.Parse(strings.NewReader(charset.Decode(data, c)))
+	if err != nil {
+		return nil, err
+	}
+	
+	// 多文件 CUE 每个文件可能只有一轨, 音轨总数按整个 CUE 计算
+	var total int
+	for _, file := range sheet.Files {
+		total += len(file.Tracks)
+	}
+	var items []model.Music
+	for _, file := range sheet.Files {
+		audio, t, ok := resolveCueFile(filepath.Dir(path), file.Name)
+		if !ok {
+			klog.Warningf("%s: %s not found", path, file.Name)
+			continue
+		}
+		whole := model.Music{Path: audio, Type: t}
+		if err := getMetadata(audio, &whole, c); err != nil {
+			klog.Error(err)
+			continue
+		}
+		for _, track := range file.Tracks {
+			ms := model.Music{Path: audio, Type: t, CueTrack: track.Number, CueStart: track.Start, CueEnd: track.End}
+			ms.Name = firstOf(track.Title, fmt.Sprintf("Track %02d", track.Number))
+			ms.Singer = firstOf(track.Performer, sheet.Performer, whole.Singer)
+			ms.Album = firstOf(sheet.Title, whole.Album)
+			ms.AlbumArtist = firstOf(sheet.Performer, whole.AlbumArtist)
+			ms.Composer = whole.Composer
+			ms.Genre = firstOf(sheet.Rem["GENRE"], whole.Genre)
+			ms.Year = whole.Year
+			if year, err := strconv.Atoi(sheet.Rem["DATE"]); err == nil {
+				ms.Year = year
+			}
+			ms.TrackNumber, ms.TrackTotal = track.Number, total
+			ms.DiscNumber, ms.DiscTotal = whole.DiscNumber, whole.DiscTotal
+			ms.Codec, ms.Bitrate, ms.SampleRate = whole.Codec, whole.Bitrate, whole.SampleRate
+			ms.Channels, ms.BitDepth = whole.Channels, whole.BitDepth
+			end := track.End
+			if end == 0 {
+				end = whole.Length
+			}
+			ms.Length = max(end-track.Start, 0).Round(time.Second)
+			
+			// 文件的增益标签是整个文件的, 只使用 CUE 中的 REM REPLAYGAIN_*, 没有时由后台分析
+			rem := map[string]interface{}{}
+			for k, v := range sheet.Rem {
+				rem[k] = v
+			}
+			for k, v := range track.Rem {
+				rem[k] = v
+			}
+			if info := replaygain.FromTags(rem); info.Found() {
+				SetReplayGain(&ms, info, model.GainSourceTag)
+			}
+			items = append(items, ms)
+		}
+	}
+	return items, nil
+}
+
+// resolveCueFile CUE 中的文件名相对 CUE 所在目录; 找不到时按同名不同扩展名查找, 常见于抓取后转换了格式
+func resolveCueFile(dir, name string) (string, model.MusicType, bool) {
+	name = filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+	path := filepath.Join(dir, name)
+	if t, ok := decode.DetectType(path); ok {
+		return path, t, true
+	}
+	
+	stem := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return "", model.MusicTypeUnknown, false
+	}
+	for _, entry := range entries {
+		n := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(strings.TrimSuffix(n, filepath.Ext(n)), stem) {
+			continue
+		}
+		// 同名的 CUE、LOG 等文件内容无法识别, 扩展名也不是音乐
+		candidate := filepath.Join(filepath.Dir(path), n)
+		if t, ok := decode.DetectType(candidate); ok {
+			return candidate, t, true
+		}
+	}
+	return "", model.MusicTypeUnknown, false
+}
+
+// firstOf 第一个非空的字符串
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
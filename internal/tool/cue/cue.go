@@ -0,0 +1,200 @@
+// Package cue 解析整轨抓取时附带的 CUE 表, 一个 CUE 可以引用多个音频文件
+package cue
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// framesPerSecond CUE 时间 mm:ss:ff 中每秒的帧数
+const framesPerSecond = 75
+
+var ErrNoTracks = errors.New("cue: no tracks")
+
+// Sheet 一个 CUE 文件, Rem 为 REM 注释, key 为大写的注释名, 例如 GENRE、REPLAYGAIN_ALBUM_GAIN
+type Sheet struct {
+	Title     string
+	Performer string
+	Rem       map[string]string
+	Files     []File
+}
+
+// File CUE 中的 FILE 条目, Name 为 CUE 中写的文件名, 通常是相对 CUE 所在目录的路径
+type File struct {
+	Name   string
+	Type   string
+	Tracks []Track
+}
+
+// Track 音轨, Start 为 INDEX 01 在文件中的位置, End 为同一文件中下一轨的 INDEX 01, 0 表示到文件结尾
+type Track struct {
+	Number    int
+	Title     string
+	Performer string
+	Rem       map[string]string
+	Start     time.Duration
+	End       time.Duration
+}
+
+// Parse 解析 CUE 表, 会去掉 UTF-8 BOM, 不认识的命令被忽略。
+// EAC 多文件布局中 TRACK 和 INDEX 00 写在上一个 FILE 下, INDEX 01 在新的 FILE 之后,
+// 这样的音轨属于 INDEX 01 所在的文件, 间隙留在上一个文件的结尾
+func Parse(r io.Reader) (*Sheet, error) {
+	sheet := &Sheet{Rem: map[string]string{}}
+	// file 当前 FILE 的下标, trackFile 和 trackIndex 为当前音轨所在的文件和位置, 可能在上一个 FILE 中
+	file, trackFile, trackIndex := -1, -1, -1
+	track := func() *Track {
+		if trackFile < 0 {
+			return nil
+		}
+		return &sheet.Files[trackFile].Tracks[trackIndex]
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(string(bytes.TrimPrefix(scanner.Bytes(), []byte("\xef\xbb\xbf"))))
+		command, args := split(text)
+		switch strings.ToUpper(command) {
+		case "FILE":
+			name, fileType := fileArgs(args)
+			sheet.Files = append(sheet.Files, File{Name: name, Type: strings.ToUpper(fileType)})
+			file = len(sheet.Files) - 1
+		case "TRACK":
+			if file < 0 {
+				return nil, fmt.Errorf("cue: line %d: TRACK before FILE", line)
+			}
+			number, _ := split(args)
+			n, err := strconv.Atoi(number)
+			if err != nil {
+				return nil, fmt.Errorf("cue: line %d: invalid track number %q", line, number)
+			}
+			f := &sheet.Files[file]
+			f.Tracks = append(f.Tracks, Track{Number: n, Rem: map[string]string{}, Start: -1})
+			trackFile, trackIndex = file, len(f.Tracks)-1
+		case "INDEX":
+			if trackFile < 0 {
+				return nil, fmt.Errorf("cue: line %d: INDEX outside TRACK", line)
+			}
+			number, rest := split(args)
+			if n, _ := strconv.Atoi(number); n != 1 {
+				// INDEX 00 是上一轨结尾的间隙, 播放时属于上一轨
+				continue
+			}
+			start, err := parseTime(strings.TrimSpace(rest))
+			if err != nil {
+				return nil, fmt.Errorf("cue: line %d: %w", line, err)
+			}
+			if trackFile != file {
+				// 音轨从上一个文件移到 INDEX 01 所在的文件, 它总是上一个文件的最后一轨
+				prev := &sheet.Files[trackFile]
+				t := prev.Tracks[trackIndex]
+				prev.Tracks = prev.Tracks[:trackIndex]
+				f := &sheet.Files[file]
+				f.Tracks = append(f.Tracks, t)
+				trackFile, trackIndex = file, len(f.Tracks)-1
+			}
+			track().Start = start
+		case "TITLE":
+			title, _ := quoted(args)
+			if track := track(); track != nil {
+				track.Title = title
+			} else {
+				sheet.Title = title
+			}
+		case "PERFORMER":
+			performer, _ := quoted(args)
+			if track := track(); track != nil {
+				track.Performer = performer
+			} else {
+				sheet.Performer = performer
+			}
+		case "REM":
+			key, rest := split(args)
+			value, _ := quoted(rest)
+			if track := track(); track != nil {
+				track.Rem[strings.ToUpper(key)] = value
+			} else {
+				sheet.Rem[strings.ToUpper(key)] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	
+	var count int
+	for i := range sheet.Files {
+		tracks := sheet.Files[i].Tracks
+		for j := range tracks {
+			if tracks[j].Start < 0 {
+				return nil, fmt.Errorf("cue: track %d has no INDEX 01", tracks[j].Number)
+			}
+			if j > 0 {
+				tracks[j-1].End = tracks[j].Start
+			}
+		}
+		count += len(tracks)
+	}
+	if count == 0 {
+		return nil, ErrNoTracks
+	}
+	return sheet, nil
+}
+
+// split 拆出第一个单词
+func split(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
+
+// quoted 读取一个可能带引号的参数, 没有引号时取整行
+func quoted(s string) (value, rest string) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		if i := strings.IndexByte(s[1:], '"'); i >= 0 {
+			return s[1 : i+1], strings.TrimSpace(s[i+2:])
+		}
+		return s[1:], ""
+	}
+	return s, ""
+}
+
+// fileArgs FILE 的参数为 文件名 类型, 文件名没有引号时最后一个单词是类型
+func fileArgs(s string) (name, fileType string) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		return quoted(s)
+	}
+	if i := strings.LastIndexAny(s, " \t"); i >= 0 {
+		return strings.TrimSpace(s[:i]), s[i+1:]
+	}
+	return s, ""
+}
+
+// parseTime 解析 mm:ss:ff, 分钟可以超过 99
+func parseTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		v[i] = n
+	}
+	if v[1] >= 60 || v[2] >= framesPerSecond {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(v[0])*time.Minute + time.Duration(v[1])*time.Second + time.Duration(v[2])*time.Second/framesPerSecond, nil
+}
@@ -0,0 +1,104 @@
+package cue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const album = "\xef\xbb\xbfREM GENRE Pop\r\n" + `REM REPLAYGAIN_ALBUM_GAIN -7.50 dB
+PERFORMER "Various"
+TITLE "Album"
+FILE "CD1.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    PERFORMER "Singer A"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    REM REPLAYGAIN_TRACK_GAIN -6.00 dB
+    INDEX 00 03:10:00
+    INDEX 01 03:12:37
+FILE CD2 part.wav WAVE
+  TRACK 03 AUDIO
+    TITLE Three Words
+    INDEX 01 00:00:00
+  TRACK 04 AUDIO
+    INDEX 01 61:02:74
+`
+
+func TestParse(t *testing.T) {
+	sheet, err := Parse(strings.NewReader(album))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Title != "Album" || sheet.Performer != "Various" || sheet.Rem["GENRE"] != "Pop" || sheet.Rem["REPLAYGAIN_ALBUM_GAIN"] != "-7.50 dB" {
+		t.Fatalf("sheet = %+v", sheet)
+	}
+	if len(sheet.Files) != 2 || sheet.Files[0].Name != "CD1.flac" || sheet.Files[0].Type != "WAVE" || sheet.Files[1].Name != "CD2 part.wav" {
+		t.Fatalf("files = %+v", sheet.Files)
+	}
+	one, two := sheet.Files[0].Tracks[0], sheet.Files[0].Tracks[1]
+	if one.Title != "One" || one.Performer != "Singer A" || one.Start != 0 {
+		t.Fatalf("track 1 = %+v", one)
+	}
+	// INDEX 00 的间隙属于上一轨
+	start := 3*time.Minute + 12*time.Second + 37*time.Second/75
+	if one.End != start || two.Start != start || two.End != 0 || two.Rem["REPLAYGAIN_TRACK_GAIN"] != "-6.00 dB" {
+		t.Fatalf("track 1 = %+v, track 2 = %+v", one, two)
+	}
+	three, four := sheet.Files[1].Tracks[0], sheet.Files[1].Tracks[1]
+	if three.Number != 3 || three.Title != "Three Words" || three.End != four.Start {
+		t.Fatalf("track 3 = %+v", three)
+	}
+	if four.Start != 61*time.Minute+2*time.Second+74*time.Second/75 {
+		t.Fatalf("track 4 = %+v", four)
+	}
+}
+
+// multiFile EAC 多文件布局, 下一轨的 TRACK 和 INDEX 00 写在上一个文件的结尾
+const multiFile = `TITLE "Album"
+FILE "01.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 00 04:01:10
+FILE "02.wav" WAVE
+    INDEX 01 00:00:00
+  TRACK 03 AUDIO
+    TITLE "Three"
+    INDEX 00 03:30:00
+FILE "03.wav" WAVE
+    INDEX 01 00:00:00
+`
+
+func TestParseMultiFile(t *testing.T) {
+	sheet, err := Parse(strings.NewReader(multiFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Files) != 3 {
+		t.Fatalf("files = %+v", sheet.Files)
+	}
+	for i, title := range []string{"One", "Two", "Three"} {
+		tracks := sheet.Files[i].Tracks
+		if len(tracks) != 1 || tracks[0].Number != i+1 || tracks[0].Title != title || tracks[0].Start != 0 || tracks[0].End != 0 {
+			t.Fatalf("file %d tracks = %+v", i, tracks)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"TRACK 01 AUDIO\n",
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\n",
+		"FILE a.wav WAVE\nTRACK 01 AUDIO\nINDEX 01 00:60:00\n",
+	} {
+		if _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	
+	"github.com/Theodoree/music_player/internal/model"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestSearchCue(t *testing.T) {
+	dir := t.TempDir()
+	// CUE 中的文件名与实际文件的大小写或扩展名不同时按同名查找
+	f, err := os.Create(filepath.Join(dir, "album.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(f, beep.Silence(format.SampleRate.N(time.Second*10)), format); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	sheet := `PERFORMER "Singer"
+TITLE "Album"
+REM REPLAYGAIN_ALBUM_GAIN -5.00 dB
+FILE "Album.WAV" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "第二首"
+    REM REPLAYGAIN_TRACK_GAIN -3.00 dB
+    INDEX 01 00:04:00
+`
+	// 老的抓轨软件生成的 CUE 多为 GBK 编码
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "album.cue"), []byte(gbk), 0644); err != nil {
+		t.Fatal(err)
+	}
+	
+	items := SearchMusicFileByPath(dir, model.CharsetAuto)
+	if len(items) != 2 {
+		t.Fatalf("items = %+v", items)
+	}
+	one, two := items[0], items[1]
+	if one.Name != "One" || one.Singer != "Singer" || one.Album != "Album" || one.CueTrack != 1 || one.CueEnd != time.Second*4 || one.Length != time.Second*4 {
+		t.Fatalf("track 1 = %+v", one)
+	}
+	if two.Name != "第二首" || two.CueStart != time.Second*4 || two.CueEnd != 0 || two.Length != time.Second*6 || two.Path != filepath.Join(dir, "album.wav") {
+		t.Fatalf("track 2 = %+v", two)
+	}
+	if two.GainSource != model.GainSourceTag || two.TrackGain != -3 || two.AlbumGain != -5 {
+		t.Fatalf("track 2 gain = %+v", two)
+	}
+	one.SetUnion()
+	two.SetUnion()
+	if one.Union == two.Union {
+		t.Fatalf("union = %s", one.Union)
+	}
+}
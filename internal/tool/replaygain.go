@@ -0,0 +1,36 @@
+package tool
+
+import (
+	"github.com/Theodoree/music_player/internal/decode/replaygain"
+	"github.com/Theodoree/music_player/internal/model"
+)
+
+// SetReplayGain 把增益信息写入 music, 只有专辑增益时同时作为音轨增益
+func SetReplayGain(music *model.Music, info replaygain.Info, source model.GainSource) {
+	if !info.HasTrack && info.HasAlbum {
+		info.TrackGain, info.TrackPeak = info.AlbumGain, info.AlbumPeak
+	}
+	music.GainSource = source
+	music.TrackGain = info.TrackGain
+	music.TrackPeak = info.TrackPeak
+	music.AlbumGain = info.AlbumGain
+	music.AlbumPeak = info.AlbumPeak
+	music.HasAlbumGain = info.HasAlbum
+}
+
+// ReplayGain 读取 music 中保存的增益信息
+func ReplayGain(music model.Music) replaygain.Info {
+	switch music.GainSource {
+	case model.GainSourceTag, model.GainSourceAnalysis:
+	default:
+		return replaygain.Info{}
+	}
+	return replaygain.Info{
+		TrackGain: music.TrackGain,
+		TrackPeak: music.TrackPeak,
+		AlbumGain: music.AlbumGain,
+		AlbumPeak: music.AlbumPeak,
+		HasTrack:  true,
+		HasAlbum:  music.HasAlbumGain,
+	}
+}
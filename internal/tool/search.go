@@ -1,15 +1,14 @@
 package tool
 
 import (
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
 	"k8s.io/klog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 	
+	"github.com/Theodoree/music_player/internal/decode"
 	"github.com/Theodoree/music_player/internal/model"
-	"github.com/dhowden/tag"
 )
 
 type File struct {
@@ -32,74 +31,111 @@ func recursiveSearchDirectory(path string, consumer func(entry os.DirEntry, path
 	}
 }
 
-func SearchMusicFileByPath(path string) []model.Music {
+// SearchMusicFileByPath 递归搜索目录下的音乐, 带有 CUE 的整轨文件按 CUE 拆分为多轨。
+// 标签和 CUE 中不是 UTF-8 的文字按 c 转换, 见 charset.Fix
+func SearchMusicFileByPath(path string, c model.Charset) []model.Music {
 	path, _ = filepath.Abs(path)
-	var items []model.Music
+	var (
+		files []string
+		cues  []string
+		types = map[string]model.MusicType{}
+	)
+	// 按内容识别格式, 扩展名的大小写和是否正确都不影响
 	consumer := func(entry os.DirEntry, path string) {
-		t, ok := model.IsMusicType(entry.Name())
-		if !ok {
+		if strings.EqualFold(filepath.Ext(entry.Name()), ".cue") {
+			cues = append(cues, path)
 			return
 		}
+		if t, ok := decode.DetectType(path); ok {
+			files = append(files, path)
+			types[path] = t
+		}
+	}
+	recursiveSearchDirectory(path, consumer)
+	
+	// 被 CUE 引用的文件, 在文件原来的位置插入拆分后的音轨
+	tracks := map[string][]model.Music{}
+	for _, cue := range cues {
+		items, err := cueTracks(cue, c)
+		if err != nil {
+			klog.Error(cue, err)
+			continue
+		}
+		for _, item := range items {
+			tracks[item.Path] = append(tracks[item.Path], item)
+		}
+	}
+	
+	var items []model.Music
+	for _, file := range files {
+		if t, ok := tracks[file]; ok {
+			items = append(items, t...)
+			continue
+		}
 		ms := model.Music{}
-		ms.Name = entry.Name()
-		ms.Type = t
-		ms.Path = path
-		if err := getMetadata(path, &ms); err != nil {
+		ms.Name = filepath.Base(file)
+		ms.Type = types[file]
+		ms.Path = file
+		if err := getMetadata(file, &ms, c); err != nil {
 			klog.Error(err)
-			return
+			continue
 		}
 		items = append(items, ms)
 	}
-	recursiveSearchDirectory(path, consumer)
 	return items
 }
 
-func getMetadata(fileName string, music *model.Music) error {
-	file, err := os.Open(fileName)
-	if err != nil {
-		return err
-	}
-	m, err := tag.ReadFrom(file)
+// getMetadata 读取文件的标签和音频参数; 歌手优先使用 Artist, 没有时使用专辑歌手
+func getMetadata(fileName string, music *model.Music, c model.Charset) error {
+	m, err := decode.GetMetadata(fileName, music.Type)
 	if err != nil {
 		klog.Error(err)
-		return nil
+		return err
 	}
-	
-	if m.Title() != "" {
-		music.Name = m.Title()
+	m.FixCharset(c)
+	if m.Title != "" {
+		music.Name = m.Title
 	}
 	if music.Singer == "" {
-		music.Singer = m.AlbumArtist()
+		music.Singer = firstOf(m.Artist, m.AlbumArtist)
 	}
-	music.Album = m.Album()
-	//pic := m.Picture()
-	//if pic != nil {
-	//	buf, _ := json.Marshal(pic)
-	//	music.Pic = string(buf)
-	//}
-	
-	switch m.FileType() {
-	case tag.MP3:
-		_, _ = file.Seek(0, 0)
-		streamer, format, err := mp3.Decode(file)
-		if err != nil {
-			klog.Error(err)
-			_, _, err = flac.Decode(file)
-			klog.Error(err)
-			return err
-		}
-		format.SampleRate.D(streamer.Len()).Round(time.Second)
-		music.Length = format.SampleRate.D(streamer.Len()).Round(time.Second)
-	case tag.FLAC:
-		_, _ = file.Seek(0, 0)
-		streamer, format, err := flac.Decode(file)
-		if err != nil {
-			klog.Error(err)
-			return err
-		}
-		format.SampleRate.D(streamer.Len()).Round(time.Second)
-		music.Length = format.SampleRate.D(streamer.Len()).Round(time.Second)
+	music.Album = m.Album
+	music.AlbumArtist = m.AlbumArtist
+	music.Composer = m.Composer
+	music.Genre = m.Genre
+	music.Year = m.Year
+	music.TrackNumber, music.TrackTotal = m.Track, m.TrackTotal
+	music.DiscNumber, music.DiscTotal = m.Disc, m.DiscTotal
+	music.Codec = m.Codec
+	music.Bitrate = m.Bitrate
+	music.SampleRate = m.SampleRate
+	music.Channels = m.Channels
+	music.BitDepth = m.BitDepth
+	music.Length = m.Duration.Round(time.Second)
+	if m.ReplayGain.Found() {
+		SetReplayGain(music, m.ReplayGain, model.GainSourceTag)
 	}
-	
+	return nil
+}
+
+// RereadTags 按编码 c 重新读取文件标签中的文字, 用于修改表格的编码之后; 音频参数和增益不变。
+// CUE 中的一轨不处理, 需要重新导入
+func RereadTags(music *model.Music, c model.Charset) error {
+	if music.CueTrack > 0 {
+		return nil
+	}
+	m, err := decode.GetMetadata(music.Path, music.Type)
+	if err != nil {
+		return err
+	}
+	m.FixCharset(c)
+	if m.Title != "" {
+		music.Name = m.Title
+	}
+	music.Singer = firstOf(m.Artist, m.AlbumArtist)
+	music.Album = m.Album
+	music.AlbumArtist = m.AlbumArtist
+	music.Composer = m.Composer
+	music.Genre = m.Genre
 	return nil
 }